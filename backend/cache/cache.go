@@ -1,269 +1,567 @@
 package cache
 
 import (
+	"container/list"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	_ "yeetfile/backend/logging" // Configures logging before init
 	"yeetfile/backend/utils"
-	"yeetfile/shared"
-	"yeetfile/shared/constants"
 )
 
-var path = ".cache"
-var enabled = true
-var maxCacheSize int64 = 1024 * 1024 * 1024 * 25     // 25 gb max cache size
-var maxCachedFileSize int64 = 1024 * 1024 * 1024 * 5 // 5 gb max file size
+const (
+	defaultPath              = ".cache"
+	defaultMaxCacheSize      = 1024 * 1024 * 1024 * 25 // 25 gb max cache size
+	defaultMaxCachedFileSize = 1024 * 1024 * 1024 * 5  // 5 gb max file size
 
-// Map file ID -> file size to ensure in-progress file caching is accounted for
-// when determining if there's available space in the cache
-var writeMap = map[string]int64{}
-var accessMap = map[string]time.Time{}
-var locks []string
+	// Files are written to a temporary path until every chunk has been
+	// written to the cache
+	partialSuffix = ".partial"
 
-func PrepCache(fileID string, size int64) {
-	if !enabled || size > maxCachedFileSize || size > maxCacheSize || len(fileID) == 0 {
-		return
+	// In-progress files that haven't been written to in this amount of
+	// time are assumed to be abandoned, and can be evicted
+	abandonedWriteAge = time.Hour
+)
+
+var (
+	path              = defaultPath
+	enabled           = true
+	maxCacheSize      = int64(defaultMaxCacheSize)
+	maxCachedFileSize = int64(defaultMaxCachedFileSize)
+)
+
+var unavailableError = errors.New("cache not available")
+
+// entry is a single file in the cache. Entries are reserved at their full size
+// as soon as a file starts being cached, so that in-progress files are
+// accounted for when determining if there's available space in the cache.
+type entry struct {
+	id       string
+	size     int64
+	lastUsed time.Time
+	elem     *list.Element
+
+	// Chunks written so far (offset -> length), until the file is complete
+	written  map[int64]int64
+	complete bool
+
+	// The number of open readers, which prevent the file from being evicted
+	readers int
+}
+
+// index keeps track of every file in the cache, ordered by how recently each
+// file was used. The index is rebuilt from the cache directory at startup.
+var index = struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	lru     *list.List // Front is most recently used
+	size    int64
+}{
+	entries: make(map[string]*entry),
+	lru:     list.New(),
+}
+
+// IsEnabled returns true if the download cache is enabled
+func IsEnabled() bool {
+	return enabled
+}
+
+// CheckWritable verifies that files can still be written to the cache
+// directory. Always returns nil if the cache is disabled.
+func CheckWritable() error {
+	if !enabled {
+		return nil
 	}
 
-	totalCacheSize, err := utils.CheckDirSize(path)
+	// Uses the partial suffix so that the file is cleaned up at startup if
+	// the server stops before it's removed
+	file, err := os.CreateTemp(path, "health-*"+partialSuffix)
 	if err != nil {
-		log.Printf(fmt.Sprintf("Unable to check cache dir size: %v", err))
+		return err
+	}
+
+	_, err = file.Write([]byte("ok"))
+	return errors.Join(err, file.Close(), os.Remove(file.Name()))
+}
+
+// PrepCache reserves space in the cache for a file that is about to be
+// downloaded, evicting the least recently used files if necessary. Files that
+// are too large for the cache are skipped.
+func PrepCache(fileID string, size int64) {
+	if !enabled || size > maxCachedFileSize || size > maxCacheSize || len(fileID) == 0 {
 		return
 	}
 
-	for totalCacheSize+size > int64(maxCacheSize) {
-		err = removeOldestUnlockedFile()
-		if err != nil {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if e, ok := index.entries[fileID]; ok {
+		if e.complete && e.size != size {
+			// Cached file doesn't match the expected size, replace it
+			removeEntry(e)
+		} else {
+			touch(e)
 			return
 		}
+	}
 
-		totalCacheSize, err = utils.CheckDirSize(path)
-		if err != nil {
+	for index.size+size > maxCacheSize {
+		if !evictOldest() {
 			return
 		}
 	}
-	writeMap[fileID] = size
+
+	e := &entry{
+		id:       fileID,
+		size:     size,
+		lastUsed: time.Now(),
+		written:  make(map[int64]int64),
+	}
+
+	e.elem = index.lru.PushFront(e)
+	index.entries[fileID] = e
+	index.size += size
 }
 
-// HasFile returns true if the fileID provided exists in the cache and matches
-// the expected size from the metadata table
+// HasFile returns true if the fileID provided has been fully written to the
+// cache and matches the expected size from the metadata table
 func HasFile(fileID string, length int64) bool {
-	if len(fileID) == 0 {
+	if !enabled || len(fileID) == 0 {
 		return false
 	}
 
-	filePath := fmt.Sprintf("%s/%s", path, fileID)
-	info, err := os.Stat(filePath)
-	if err != nil {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	e, ok := index.entries[fileID]
+	return ok && e.complete && e.size == length
+}
+
+// HasRange returns true if a range of bytes in a file can be read from the
+// cache, either because the file is fully cached or because a chunk starting at
+// the beginning of the range has already been written to the cache
+func HasRange(fileID string, start, end int64) bool {
+	if !enabled || len(fileID) == 0 {
+		return false
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	e, ok := index.entries[fileID]
+	return ok && e.hasRange(start, end)
+}
+
+// IsPending returns true if a file has space reserved in the cache, but hasn't
+// been fully written to the cache yet
+func IsPending(fileID string) bool {
+	if !enabled || len(fileID) == 0 {
 		return false
 	}
 
-	// Ensure the file in the cache matches the size stored in the metadata
-	// table
-	return info.Size() == length
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	e, ok := index.entries[fileID]
+	return ok && !e.complete
 }
 
-// Write writes file data to a cache file named with the file ID
-func Write(fileID string, data []byte) error {
-	if len(fileID) == 0 {
+// FileWriter writes a streamed chunk of a file to the cache. Errors from
+// writing to the cache are recorded instead of returned, so that a failure to
+// cache a file never interrupts the download it's being written alongside.
+type FileWriter struct {
+	fileID string
+	entry  *entry
+	offset int64
+	n      int64
+	file   *os.File
+	err    error
+}
+
+// NewWriter returns a FileWriter for writing a chunk of a file to the cache,
+// starting at the provided offset, or nil if the file shouldn't be cached (see
+// PrepCache).
+func NewWriter(fileID string, offset int64) *FileWriter {
+	if !enabled || len(fileID) == 0 {
 		return nil
 	}
 
-	_, found := writeMap[fileID]
-	if !enabled || !found {
+	index.mu.Lock()
+	e, found := index.entries[fileID]
+	if found {
+		touch(e)
+	}
+	index.mu.Unlock()
+
+	if !found || e.complete {
 		return nil
 	}
 
-	filePath := fmt.Sprintf("%s/%s", path, fileID)
-	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	f, err := os.OpenFile(partialPath(fileID), os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
-		panic(err)
+		slog.Error("Unable to open cache file", "error", err)
+		return nil
 	}
 
-	defer func(f *os.File) {
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		slog.Error("Unable to seek in cache file", "error", err)
 		_ = f.Close()
-	}(f)
+		return nil
+	}
+
+	return &FileWriter{fileID: fileID, entry: e, offset: offset, file: f}
+}
+
+func (fw *FileWriter) Write(p []byte) (int, error) {
+	if fw.err == nil {
+		var n int
+		n, fw.err = fw.file.Write(p)
+		fw.n += int64(n)
+	}
+
+	return len(p), nil
+}
+
+// Abort closes and removes the cache file, since an incomplete chunk of data
+// has been written to it
+func (fw *FileWriter) Abort() {
+	_ = fw.file.Close()
+	_ = RemoveFile(fw.fileID)
+}
+
+// Close closes the cache file, removing it if any writes failed. Once every
+// chunk of a file has been written, the file becomes available for reading.
+func (fw *FileWriter) Close() error {
+	err := fw.file.Close()
+	if fw.err != nil || err != nil {
+		_ = RemoveFile(fw.fileID)
+		return errors.Join(fw.err, err)
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	e, ok := index.entries[fw.fileID]
+	if !ok || e != fw.entry || e.complete {
+		// Removed from the cache while the chunk was being written
+		return nil
+	}
+
+	e.written[fw.offset] = fw.n
+
+	var written int64
+	for _, n := range e.written {
+		written += n
+	}
+
+	if written < e.size {
+		return nil
+	} else if written > e.size {
+		removeEntry(e)
+		return fmt.Errorf("cached file %s is larger than expected", fw.fileID)
+	}
 
-	if _, err = f.Write(data); err != nil {
+	if err = os.Rename(partialPath(fw.fileID), filePath(fw.fileID)); err != nil {
+		removeEntry(e)
 		return err
 	}
 
+	e.complete = true
+	e.written = nil
 	return nil
 }
 
-// Read receives a file ID and start and end positions and reads from
-// a file in the cache
-func Read(fileID string, start int64, end int64) ([]byte, error) {
+// cachedSection reads part of a file in the cache, closing the file (and
+// allowing it to be evicted) once finished
+type cachedSection struct {
+	*io.SectionReader
+	file  *os.File
+	entry *entry
+	once  sync.Once
+}
+
+func (section *cachedSection) Close() error {
+	var err error
+	section.once.Do(func() {
+		err = section.file.Close()
+
+		index.mu.Lock()
+		section.entry.readers -= 1
+		index.mu.Unlock()
+	})
+
+	return err
+}
+
+// Read receives a file ID and start and end positions and returns a reader
+// for that portion of a file in the cache. Files that are still being cached
+// can be read from if the requested range has already been written (see
+// HasRange). The file can't be evicted from the cache until the reader is
+// closed.
+func Read(fileID string, start int64, end int64) (io.ReadCloser, error) {
 	if !enabled || len(fileID) == 0 {
-		return nil, errors.New("cache not available")
+		return nil, unavailableError
 	}
 
-	filePath := fmt.Sprintf("%s/%s", path, fileID)
-	if _, err := os.Stat(filePath); err != nil {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	e, ok := index.entries[fileID]
+	if !ok {
+		return nil, unavailableError
+	}
+
+	if end < 0 || end >= e.size {
+		// Read to the end of the file
+		end = e.size - 1
+	}
+
+	if !e.hasRange(start, end) {
+		return nil, unavailableError
+	}
+
+	cachedPath := filePath(fileID)
+	if !e.complete {
+		cachedPath = partialPath(fileID)
+	}
+
+	file, err := os.Open(cachedPath)
+	if err != nil {
+		removeEntry(e)
 		return nil, err
 	}
 
-	// Ensure file ID is locked and cannot be deleted before reading is done
-	if start == 0 {
-		locks = append(locks, fileID)
+	e.readers += 1
+	touch(e)
+
+	return &cachedSection{
+		SectionReader: io.NewSectionReader(file, start, end-start+1),
+		file:          file,
+		entry:         e,
+	}, nil
+}
+
+// RemoveFile removes a file from the cache, including any partially written
+// copy of the file
+func RemoveFile(id string) error {
+	if !enabled || len(id) == 0 {
+		return nil
 	}
 
-	// Update access time for this file on each read
-	accessMap[fileID] = time.Now()
+	index.mu.Lock()
+	defer index.mu.Unlock()
 
-	var data []byte
-	var err error
-	if end < 0 {
-		// Read full file
-		data, err = os.ReadFile(filePath)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// Read part of file
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, err
+	if e, ok := index.entries[id]; ok {
+		return removeEntry(e)
+	}
+
+	return removeFiles(id)
+}
+
+// hasRange returns true if the bytes from start to end have been written to
+// the cache. Must be called with index.mu held.
+func (e *entry) hasRange(start, end int64) bool {
+	if e.complete {
+		return start >= 0 && end < e.size
+	}
+
+	return e.written[start] >= end-start+1
+}
+
+// touch marks a cache entry as the most recently used entry. Must be called
+// with index.mu held.
+func touch(e *entry) {
+	e.lastUsed = time.Now()
+	index.lru.MoveToFront(e.elem)
+}
+
+// evictOldest removes the least recently used file that isn't currently being
+// read or written. Returns false if there weren't any files that could be
+// removed. Must be called with index.mu held.
+func evictOldest() bool {
+	for elem := index.lru.Back(); elem != nil; elem = elem.Prev() {
+		e := elem.Value.(*entry)
+		abandoned := !e.complete && time.Since(e.lastUsed) > abandonedWriteAge
+		if e.readers > 0 || (!e.complete && !abandoned) {
+			continue
 		}
 
-		data = make([]byte, end-start+1)
-		_, err = file.ReadAt(data, start)
-		if err != nil {
-			return nil, err
+		if err := removeEntry(e); err != nil {
+			slog.Error("Error removing cached file", "error", err)
 		}
-	}
 
-	if start > 0 && end-start < int64(constants.ChunkSize) {
-		// The last chunk of the file is being deleted, so the file lock
-		// can be removed now
-		locks = removeLock(locks, fileID)
+		return true
 	}
 
-	return data, nil
+	return false
+}
+
+// removeEntry removes a file from the index and the cache directory. Must be
+// called with index.mu held.
+func removeEntry(e *entry) error {
+	index.lru.Remove(e.elem)
+	delete(index.entries, e.id)
+	index.size -= e.size
+
+	return removeFiles(e.id)
 }
 
-// removeLock iterates through a list of locks and removes the first encountered
-// instance of the locked file ID
-func removeLock(currentLocks []string, id string) []string {
-	for i, lock := range currentLocks {
-		if lock == id {
-			currentLocks[i] = currentLocks[len(currentLocks)-1]
-			return currentLocks[:len(currentLocks)-1]
+func removeFiles(id string) error {
+	var errs []error
+	for _, p := range []string{filePath(id), partialPath(id)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
 		}
 	}
 
-	return currentLocks
+	return errors.Join(errs...)
 }
 
-// removeOldestUnlockedFile iterates through the files in the cache and removes
-// files with the oldest access times that are not currently locked.
-func removeOldestUnlockedFile() error {
-	if !enabled {
-		return nil
+func filePath(id string) string {
+	return filepath.Join(path, id)
+}
+
+func partialPath(id string) string {
+	return filepath.Join(path, id+partialSuffix)
+}
+
+// loadIndex rebuilds the cache index from the files in the cache directory,
+// removing any files that weren't finished before the server was stopped
+func loadIndex() error {
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return err
 	}
 
-	var oldestFile string
-	oldestTime := time.Now()
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	type cachedFile struct {
+		id      string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []cachedFile
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() {
+			continue
+		} else if strings.HasSuffix(name, partialSuffix) {
+			_ = os.Remove(filepath.Join(path, name))
+			continue
 		}
 
-		if info.IsDir() {
-			// Skip directories
-			return nil
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
 		}
 
-		segments := strings.Split(filePath, "/")
-		file := segments[len(segments)-1]
+		files = append(files, cachedFile{
+			id:      name,
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
 
-		if shared.ArrayContains(locks, file) {
-			// Skip locked files
-			return nil
-		}
+	// Oldest files are added first, ending up at the back of the list
+	slices.SortFunc(files, func(a, b cachedFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
 
-		fileTime, ok := accessMap[file]
-		if !ok {
-			fileTime = info.ModTime()
-		}
+	index.mu.Lock()
+	defer index.mu.Unlock()
 
-		if fileTime.Before(oldestTime) {
-			oldestTime = fileTime
-			oldestFile = file
+	for _, file := range files {
+		e := &entry{
+			id:       file.id,
+			size:     file.size,
+			lastUsed: file.modTime,
+			complete: true,
 		}
 
-		return err
-	})
+		e.elem = index.lru.PushFront(e)
+		index.entries[file.id] = e
+		index.size += file.size
+	}
 
-	if len(oldestFile) > 0 {
-		err = os.Remove(fmt.Sprintf("%s/%s", path, oldestFile))
-		if err != nil {
-			return err
+	// Trim the cache if the max size was lowered since the last run
+	for index.size > maxCacheSize {
+		if !evictOldest() {
+			break
 		}
 	}
 
 	return nil
 }
 
-func RemoveFile(id string) error {
-	if !enabled || len(id) == 0 {
-		return nil
+// parseSize parses a size from an env var, which can either be a number of
+// bytes or a size string (i.e. "10GB")
+func parseSize(value string) int64 {
+	if size, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return size
 	}
 
-	filePath := fmt.Sprintf("%s/%s", path, id)
-	if _, err := os.Stat(filePath); err != nil {
-		// If the file doesn't exist, that's fine
-		return nil
-	}
+	return utils.ParseSizeString(value)
+}
 
-	if err := os.Remove(filePath); err != nil {
+// Configure enables the cache in the provided directory, replacing any existing
+// configuration, and loads any existing cached files into the index
+func Configure(dir string, maxSize, maxFileSize int64) error {
+	path = strings.TrimSuffix(dir, "/")
+	maxCacheSize = maxSize
+	maxCachedFileSize = maxFileSize
+	enabled = true
+
+	index.mu.Lock()
+	index.entries = make(map[string]*entry)
+	index.lru.Init()
+	index.size = 0
+	index.mu.Unlock()
+
+	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
 	}
 
-	return nil
+	return loadIndex()
 }
 
 func init() {
-	if os.Getenv("YEETFILE_STORAGE") == "local" {
+	// Files stored on the machine running the server don't need to be cached
+	storageType := utils.GetEnvVar("YEETFILE_STORAGE", "local")
+	if storageType == "local" || storageType == "memory" {
 		enabled = false
 		return
 	}
 
-	userCacheDir := os.Getenv("YEETFILE_CACHE_DIR")
-	if len(userCacheDir) > 0 {
-		path = strings.TrimSuffix(userCacheDir, "/")
-	}
-
-	userCacheDirSize := os.Getenv("YEETFILE_CACHE_MAX_SIZE")
-	if len(userCacheDirSize) > 0 {
-		maxCacheSize = utils.ParseSizeString(userCacheDirSize)
-		log.Printf("Max cache size: %s (%d bytes)",
-			userCacheDirSize,
-			maxCacheSize)
-	} else {
+	cacheDir := utils.GetEnvVar("YEETFILE_CACHE_DIR", defaultPath)
+	cacheSize := utils.GetEnvVar("YEETFILE_CACHE_MAX_SIZE", "")
+	cacheFileSize := utils.GetEnvVar("YEETFILE_CACHE_MAX_FILE_SIZE", "")
+	if len(cacheSize) == 0 || len(cacheFileSize) == 0 {
 		enabled = false
 		return
 	}
 
-	userCacheFileSize := os.Getenv("YEETFILE_CACHE_MAX_FILE_SIZE")
-	if len(userCacheFileSize) > 0 {
-		maxCachedFileSize = utils.ParseSizeString(userCacheFileSize)
-		log.Printf("Max size of files in cache: %s (%d bytes)",
-			userCacheFileSize,
-			maxCachedFileSize)
-	} else {
+	maxSize := parseSize(cacheSize)
+	maxFileSize := parseSize(cacheFileSize)
+	if maxSize <= 0 || maxFileSize <= 0 {
+		slog.Error("Invalid cache size(s), caching is disabled")
 		enabled = false
 		return
 	}
 
-	err := os.MkdirAll(path, 0755)
+	slog.Info("Max cache size", "size", cacheSize, "bytes", maxSize)
+	slog.Info("Max size of files in cache", "size", cacheFileSize, "bytes", maxFileSize)
+
+	err := Configure(cacheDir, maxSize, maxFileSize)
 	if err != nil {
 		panic(err)
 	}
 
-	log.Printf("Caching files to directory: %s", path)
+	slog.Info("Caching files to directory", "path", path, "cached", len(index.entries))
 }
@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeChunks writes the chunks of data starting at the provided chunk numbers
+// to the cache in parallel, mimicking concurrent chunk downloads
+func writeChunks(t *testing.T, fileID string, data []byte, chunkSize int, chunks ...int) {
+	var wg sync.WaitGroup
+	for _, chunk := range chunks {
+		start := chunk * chunkSize
+		end := min(start+chunkSize, len(data))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writer := NewWriter(fileID, int64(start))
+			if !assert.NotNil(t, writer) {
+				return
+			}
+
+			_, _ = writer.Write(data[start:end])
+			assert.Nil(t, writer.Close())
+		}()
+	}
+
+	wg.Wait()
+}
+
+func readAll(t *testing.T, fileID string, start, end int64) []byte {
+	reader, err := Read(fileID, start, end)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	return content
+}
+
+func TestConcurrentChunkWrites(t *testing.T) {
+	assert.Nil(t, Configure(t.TempDir(), 1024*1024, 1024*1024))
+
+	data := make([]byte, 10500)
+	_, _ = rand.Read(data)
+
+	PrepCache("file", int64(len(data)))
+	assert.False(t, HasFile("file", int64(len(data))))
+
+	// Chunks finish out of order, and only the chunks that have been written
+	// are readable until the entire file is cached
+	writeChunks(t, "file", data, 1000, 10, 8, 6, 4, 2, 0)
+	assert.False(t, HasFile("file", int64(len(data))))
+	_, err := Read("file", 0, -1)
+	assert.NotNil(t, err)
+
+	assert.True(t, HasRange("file", 2000, 2999))
+	assert.False(t, HasRange("file", 3000, 3999))
+	assert.True(t, bytes.Equal(data[2000:3000], readAll(t, "file", 2000, 2999)))
+
+	writeChunks(t, "file", data, 1000, 9, 7, 5, 3, 1)
+	assert.True(t, HasFile("file", int64(len(data))))
+	assert.Nil(t, NewWriter("file", 0))
+
+	assert.True(t, bytes.Equal(data, readAll(t, "file", 0, -1)))
+	assert.True(t, bytes.Equal(data[2500:7001], readAll(t, "file", 2500, 7000)))
+	assert.True(t, bytes.Equal(data[10000:], readAll(t, "file", 10000, 20000)))
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	assert.Nil(t, Configure(t.TempDir(), 3000, 1000))
+
+	size := int64(1000)
+	data := make([]byte, size)
+	for _, id := range []string{"a", "b", "c"} {
+		PrepCache(id, size)
+		writeChunks(t, id, data, len(data), 0)
+		assert.True(t, HasFile(id, size))
+	}
+
+	// "a" is the least recently used file, but can't be evicted while it's
+	// being read
+	reader, err := Read("a", 0, -1)
+	assert.Nil(t, err)
+	PrepCache("b", size)
+
+	PrepCache("d", size)
+	assert.True(t, HasFile("a", size))
+	assert.True(t, HasFile("b", size))
+	assert.False(t, HasFile("c", size))
+	_, err = os.Stat(filepath.Join(path, "c"))
+	assert.True(t, os.IsNotExist(err))
+
+	PrepCache("e", size)
+	assert.True(t, HasFile("a", size))
+	assert.False(t, HasFile("b", size))
+
+	// In-progress files can't be evicted either, so there's no room left
+	PrepCache("f", size)
+	assert.Nil(t, NewWriter("f", 0))
+
+	assert.Nil(t, reader.Close())
+	assert.Nil(t, reader.Close())
+
+	PrepCache("f", size)
+	assert.False(t, HasFile("a", size))
+	writer := NewWriter("f", 0)
+	assert.NotNil(t, writer)
+	writer.Abort()
+	assert.LessOrEqual(t, index.size, maxCacheSize)
+
+	// Files larger than the max file size are never cached
+	PrepCache("large", size+1)
+	assert.Nil(t, NewWriter("large", 0))
+}
+
+func TestLoadIndex(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "old"), make([]byte, 100), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "new"), make([]byte, 100), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "unfinished"+partialSuffix), make([]byte, 50), 0600))
+
+	past := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "old"), past, past))
+
+	// The cache is trimmed to fit the configured size, removing older files
+	// first
+	assert.Nil(t, Configure(dir, 150, 100))
+	assert.False(t, HasFile("old", 100))
+	assert.True(t, HasFile("new", 100))
+	assert.Equal(t, int64(100), index.size)
+
+	_, err := os.Stat(filepath.Join(dir, "unfinished"+partialSuffix))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "old"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, Configure(dir, 150, 100))
+	assert.Nil(t, CheckWritable())
+
+	// The test file is removed after checking
+	dirEntries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, dirEntries)
+
+	assert.Nil(t, os.RemoveAll(dir))
+	assert.NotNil(t, CheckWritable())
+}
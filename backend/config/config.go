@@ -4,9 +4,12 @@ import (
 	"github.com/gorilla/securecookie"
 	"golang.org/x/crypto/bcrypt"
 	"log"
+	"log/slog"
 	"os"
 	"slices"
 	"strings"
+	"time"
+	_ "yeetfile/backend/logging" // Configures logging before init
 	"yeetfile/backend/server/upgrades"
 	"yeetfile/backend/utils"
 	"yeetfile/shared"
@@ -21,10 +24,14 @@ const (
 	LocalStorage = "local"
 	B2Storage    = "b2"
 	S3Storage    = "s3"
+	SFTPStorage  = "sftp"
+	MemStorage   = "memory"
 )
 
 var (
 	storageType             = utils.GetEnvVar("YEETFILE_STORAGE", LocalStorage)
+	migrateStorageFrom      = utils.GetEnvVar("YEETFILE_STORAGE_MIGRATE_FROM", "")
+	mirrorStorage           = utils.GetEnvVar("YEETFILE_STORAGE_MIRROR", "")
 	domain                  = os.Getenv("YEETFILE_DOMAIN")
 	defaultUserMaxPasswords = utils.GetEnvVarInt("YEETFILE_DEFAULT_MAX_PASSWORDS", -1)
 	defaultUserStorage      = utils.GetEnvVarInt64("YEETFILE_DEFAULT_USER_STORAGE", -1)
@@ -33,6 +40,19 @@ var (
 	password                = []byte(utils.GetEnvVar("YEETFILE_SERVER_PASSWORD", ""))
 	allowInsecureLinks      = utils.GetEnvVarBool("YEETFILE_ALLOW_INSECURE_LINKS", false)
 
+	// Storage scrubber config
+	scrubEnabled     = utils.GetEnvVarBool("YEETFILE_SCRUB_ENABLED", false)
+	scrubRateLimit   = utils.GetEnvVarInt64("YEETFILE_SCRUB_RATE_LIMIT", 5_000_000)
+	scrubRecheckDays = utils.GetEnvVarInt("YEETFILE_SCRUB_RECHECK_DAYS", 30)
+
+	// Orphaned object garbage collection config
+	gcEnabled = utils.GetEnvVarBool("YEETFILE_GC_ENABLED", false)
+	gcDryRun  = utils.GetEnvVarBool("YEETFILE_GC_DRY_RUN", true)
+
+	// Session config
+	sessionIdleHours = utils.GetEnvVarInt("YEETFILE_SESSION_IDLE_HOURS", 24*7)
+	sessionMaxDays   = utils.GetEnvVarInt("YEETFILE_SESSION_MAX_DAYS", 30)
+
 	// Limiter config
 	limiterSeconds  = utils.GetEnvVarInt("YEETFILE_LIMITER_SECONDS", 30)
 	limiterAttempts = utils.GetEnvVarInt("YEETFILE_LIMITER_ATTEMPTS", 6)
@@ -46,6 +66,16 @@ var (
 	TLSCert = utils.GetEnvVar("YEETFILE_TLS_CERT", "")
 	TLSKey  = utils.GetEnvVar("YEETFILE_TLS_KEY", "")
 
+	// TLS file config (reloaded automatically when changed)
+	TLSCertFile     = utils.GetEnvVar("YEETFILE_TLS_CERT_FILE", "")
+	TLSKeyFile      = utils.GetEnvVar("YEETFILE_TLS_KEY_FILE", "")
+	TLSClientCAFile = utils.GetEnvVar("YEETFILE_TLS_CLIENT_CA_FILE", "")
+	TLSClientAuth   = utils.GetEnvVar("YEETFILE_TLS_CLIENT_AUTH", "require")
+
+	// Unix socket config (used instead of YEETFILE_HOST/YEETFILE_PORT)
+	UnixSocket     = utils.GetEnvVar("YEETFILE_UNIX_SOCKET", "")
+	UnixSocketMode = utils.GetEnvVar("YEETFILE_UNIX_SOCKET_MODE", "0660")
+
 	IsDebugMode   = utils.GetEnvVarBool("YEETFILE_DEBUG", false)
 	IsLockedDown  = utils.GetEnvVarBool("YEETFILE_LOCKDOWN", false)
 	InstanceAdmin = utils.GetEnvVar("YEETFILE_INSTANCE_ADMIN", "")
@@ -75,6 +105,28 @@ var email = EmailConfig{
 	NoReplyAddress: os.Getenv("YEETFILE_EMAIL_NO_REPLY"),
 }
 
+// =============================================================================
+// Single sign-on configuration (OpenID Connect)
+// =============================================================================
+
+type OIDCConfig struct {
+	Configured     bool
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	AllowedDomains []string
+	SignupOnly     bool
+}
+
+var oidc = OIDCConfig{
+	Issuer:       os.Getenv("YEETFILE_OIDC_ISSUER"),
+	ClientID:     os.Getenv("YEETFILE_OIDC_CLIENT_ID"),
+	ClientSecret: os.Getenv("YEETFILE_OIDC_CLIENT_SECRET"),
+	SignupOnly:   utils.GetEnvVarBool("YEETFILE_OIDC_SIGNUP_ONLY", false),
+}
+
+var oidcAllowedDomains = utils.GetEnvVar("YEETFILE_OIDC_ALLOWED_DOMAINS", "")
+
 // =============================================================================
 // Billing configuration (Stripe)
 // =============================================================================
@@ -109,6 +161,8 @@ var btcPayBilling = BTCPayBillingConfig{
 
 type ServerConfig struct {
 	StorageType         string
+	MigrateStorageFrom  string
+	MirrorStorage       string
 	Domain              string
 	DefaultMaxPasswords int
 	DefaultUserStorage  int64
@@ -116,6 +170,7 @@ type ServerConfig struct {
 	MaxUserCount        int
 	CurrentUserCount    int
 	Email               EmailConfig
+	OIDC                OIDCConfig
 	StripeBilling       StripeBillingConfig
 	BTCPayBilling       BTCPayBillingConfig
 	BillingEnabled      bool
@@ -124,8 +179,15 @@ type ServerConfig struct {
 	ServerSecret        []byte
 	FallbackWebSecret   []byte
 	AllowInsecureLinks  bool
+	SessionIdleTimeout  time.Duration
+	SessionMaxAge       time.Duration
 	LimiterSeconds      int
 	LimiterAttempts     int
+	ScrubEnabled        bool
+	ScrubRateLimit      int64
+	ScrubRecheckDays    int
+	GCEnabled           bool
+	GCDryRun            bool
 }
 
 type TemplateConfig struct {
@@ -133,6 +195,8 @@ type TemplateConfig struct {
 	CurrentUserCount int
 	MaxUserCount     int
 	EmailEnabled     bool
+	SSOEnabled       bool
+	SSOSignupOnly    bool
 	BillingEnabled   bool
 	StripeEnabled    bool
 	BTCPayEnabled    bool
@@ -145,6 +209,16 @@ func init() {
 	email.Configured = !utils.IsStructMissingAnyField(email)
 	stripeBilling.Configured = !utils.IsStructMissingAnyField(stripeBilling)
 	btcPayBilling.Configured = !utils.IsStructMissingAnyField(btcPayBilling)
+	oidc.Configured = len(oidc.Issuer) > 0 &&
+		len(oidc.ClientID) > 0 &&
+		len(oidc.ClientSecret) > 0
+
+	for _, allowedDomain := range strings.Split(oidcAllowedDomains, ",") {
+		allowedDomain = strings.ToLower(strings.TrimSpace(allowedDomain))
+		if len(allowedDomain) > 0 {
+			oidc.AllowedDomains = append(oidc.AllowedDomains, allowedDomain)
+		}
+	}
 
 	var passwordHash []byte
 	var err error
@@ -165,14 +239,46 @@ func init() {
 			"bytes are required.", len(secret), constants.KeySize)
 	}
 
+	if migrateStorageFrom == storageType {
+		log.Fatalf("ERROR: YEETFILE_STORAGE_MIGRATE_FROM cannot be the "+
+			"same as YEETFILE_STORAGE ('%s')", storageType)
+	} else if len(mirrorStorage) > 0 &&
+		(mirrorStorage == storageType || mirrorStorage == migrateStorageFrom) {
+		log.Fatalf("ERROR: YEETFILE_STORAGE_MIRROR ('%s') must be different "+
+			"from YEETFILE_STORAGE and YEETFILE_STORAGE_MIGRATE_FROM",
+			mirrorStorage)
+	}
+
+	if sessionIdleHours <= 0 || sessionMaxDays <= 0 {
+		log.Fatalf("ERROR: YEETFILE_SESSION_IDLE_HOURS and " +
+			"YEETFILE_SESSION_MAX_DAYS must be greater than 0")
+	}
+
+	if oidc.Configured && len(domain) == 0 {
+		log.Fatalf("ERROR: YEETFILE_DOMAIN must be set to use single sign-on " +
+			"(YEETFILE_OIDC_ISSUER)")
+	} else if oidc.SignupOnly && !oidc.Configured {
+		log.Fatalf("ERROR: YEETFILE_OIDC_SIGNUP_ONLY requires " +
+			"YEETFILE_OIDC_ISSUER, YEETFILE_OIDC_CLIENT_ID, and " +
+			"YEETFILE_OIDC_CLIENT_SECRET to be set")
+	}
+
+	if scrubEnabled && (scrubRateLimit <= 0 || scrubRecheckDays <= 0) {
+		log.Fatalf("ERROR: YEETFILE_SCRUB_RATE_LIMIT and " +
+			"YEETFILE_SCRUB_RECHECK_DAYS must be greater than 0")
+	}
+
 	YeetFileConfig = ServerConfig{
 		StorageType:         storageType,
+		MigrateStorageFrom:  migrateStorageFrom,
+		MirrorStorage:       mirrorStorage,
 		Domain:              domain,
 		DefaultMaxPasswords: defaultUserMaxPasswords,
 		DefaultUserStorage:  defaultUserStorage,
 		DefaultUserSend:     defaultUserSend,
 		MaxUserCount:        maxNumUsers,
 		Email:               email,
+		OIDC:                oidc,
 		StripeBilling:       stripeBilling,
 		BTCPayBilling:       btcPayBilling,
 		BillingEnabled:      stripeBilling.Configured || btcPayBilling.Configured,
@@ -181,8 +287,15 @@ func init() {
 		ServerSecret:        secret,
 		FallbackWebSecret:   fallbackWebSecret,
 		AllowInsecureLinks:  allowInsecureLinks,
+		SessionIdleTimeout:  time.Duration(sessionIdleHours) * time.Hour,
+		SessionMaxAge:       time.Duration(sessionMaxDays) * 24 * time.Hour,
 		LimiterSeconds:      limiterSeconds,
 		LimiterAttempts:     limiterAttempts,
+		ScrubEnabled:        scrubEnabled,
+		ScrubRateLimit:      scrubRateLimit,
+		ScrubRecheckDays:    scrubRecheckDays,
+		GCEnabled:           gcEnabled,
+		GCDryRun:            gcDryRun,
 	}
 
 	// Subset of main server config to use in HTML templating
@@ -190,19 +303,18 @@ func init() {
 		Version:        YeetFileConfig.Version,
 		MaxUserCount:   YeetFileConfig.MaxUserCount,
 		EmailEnabled:   YeetFileConfig.Email.Configured,
+		SSOEnabled:     YeetFileConfig.OIDC.Configured,
+		SSOSignupOnly:  YeetFileConfig.OIDC.SignupOnly,
 		BillingEnabled: YeetFileConfig.BillingEnabled,
 		StripeEnabled:  YeetFileConfig.StripeBilling.Configured,
 		BTCPayEnabled:  YeetFileConfig.BTCPayBilling.Configured,
 	}
 
-	log.Printf("Configuration:\n"+
-		"  Email:            %v\n"+
-		"  Billing (Stripe): %v\n"+
-		"  Billing (BTCPay): %v\n",
-		email.Configured,
-		stripeBilling.Configured,
-		btcPayBilling.Configured,
-	)
+	slog.Info("Configuration",
+		"email", email.Configured,
+		"sso", oidc.Configured,
+		"billing_stripe", stripeBilling.Configured,
+		"billing_btcpay", btcPayBilling.Configured)
 
 	if IsDebugMode {
 		logWarning(
@@ -212,11 +324,9 @@ func init() {
 }
 
 func logWarning(warnings ...string) {
-	log.Println(strings.Repeat("@", 57))
 	for _, warning := range warnings {
-		log.Printf("!!! " + warning + "\n")
+		slog.Warn("!!! " + warning)
 	}
-	log.Println(strings.Repeat("@", 57))
 }
 
 func GetServerInfoStruct() shared.ServerInfo {
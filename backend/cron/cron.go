@@ -1,13 +1,16 @@
 package cron
 
 import (
+	"errors"
 	"fmt"
 	"github.com/robfig/cron/v3"
 	"hash/fnv"
 	"log"
+	"log/slog"
 	"time"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
+	"yeetfile/backend/metrics"
 	"yeetfile/backend/storage"
 	"yeetfile/shared/constants"
 )
@@ -20,8 +23,17 @@ const (
 	UpgradeTask    = "upgrade"
 	UpgradeExpTask = "upgrade-expiration"
 	B2AuthTask     = "b2-auth-task"
+	MigrationTask  = "storage-migration"
+	ScrubTask      = "storage-scrub"
+	GCTask         = "storage-gc"
+	TokensTask     = "api-tokens"
+	SessionsTask   = "sessions"
 )
 
+// staleLockGrace is the extra amount of time a task can go without running
+// before its lock is considered stale
+const staleLockGrace = time.Minute
+
 type CronTask struct {
 	Name             string
 	Interval         time.Duration
@@ -37,6 +49,11 @@ type CronTask struct {
 // - a bandwidth task for resetting user bandwidth every N days
 // - an upgrade monitoring task for instances with billing enabled
 // - a downloads cleanup task that removes abandoned in-progress downloads
+// - an API token cleanup task that removes expired tokens
+// - a session cleanup task that removes expired and idle sessions
+// - a storage migration task for copying files to a new storage backend
+// - a storage scrub task that verifies stored files against their checksums
+// - a storage garbage collection task that removes orphaned objects
 var tasks = []CronTask{
 	{
 		Name:           ExpiryTask,
@@ -81,17 +98,57 @@ var tasks = []CronTask{
 		Enabled:        true,
 		TaskFn:         db.CleanUpDownloads,
 	},
+	{
+		Name:           TokensTask,
+		Interval:       time.Hour,
+		IntervalAmount: 1,
+		Enabled:        true,
+		TaskFn:         db.CleanUpAPITokens,
+	},
+	{
+		Name:           SessionsTask,
+		Interval:       time.Hour,
+		IntervalAmount: 1,
+		Enabled:        true,
+		TaskFn: func() {
+			db.CleanUpSessions(config.YeetFileConfig.SessionIdleTimeout)
+		},
+	},
 	{
 		Name:           B2AuthTask,
 		Interval:       time.Hour,
 		IntervalAmount: 3,
-		Enabled:        config.YeetFileConfig.StorageType == config.B2Storage,
-		TaskFn:         storage.Interface.Reauthorize,
+		Enabled: config.YeetFileConfig.StorageType == config.B2Storage ||
+			config.YeetFileConfig.MigrateStorageFrom == config.B2Storage ||
+			config.YeetFileConfig.MirrorStorage == config.B2Storage,
+		TaskFn: func() { _ = storage.Interface.Reauthorize() },
 
 		// B2 re-authentication should happen on every server, therefore
 		// it doesn't need to acquire the advisory lock in the db
 		SkipAdvisoryLock: true,
 	},
+	{
+		// Only enabled while migrating from one storage backend to another
+		Name:           MigrationTask,
+		Interval:       time.Minute,
+		IntervalAmount: 1,
+		Enabled:        len(config.YeetFileConfig.MigrateStorageFrom) > 0,
+		TaskFn:         storage.MigrateFiles,
+	},
+	{
+		Name:           ScrubTask,
+		Interval:       time.Hour,
+		IntervalAmount: 1,
+		Enabled:        config.YeetFileConfig.ScrubEnabled,
+		TaskFn:         storage.ScrubFiles,
+	},
+	{
+		Name:           GCTask,
+		Interval:       time.Hour,
+		IntervalAmount: 24,
+		Enabled:        config.YeetFileConfig.GCEnabled,
+		TaskFn:         storage.CollectOrphanedObjects,
+	},
 }
 
 // getAdvisoryLockID returns a unique int64 value for the given cron task name
@@ -126,13 +183,19 @@ func (task CronTask) isLocked() bool {
 
 	lockedUntil, err := db.GetCronLockedUntil(task.Name)
 	if err != nil {
-		log.Printf("Error checking locked_until for task '%s': %v\n", task.Name, err)
+		slog.Error("Error checking locked_until for task",
+			"task", task.Name, "error", err)
 		return true
 	}
 
 	return lockedUntil.After(time.Now().UTC())
 }
 
+// lockDuration returns how long the task is locked for after each run
+func (task CronTask) lockDuration() time.Duration {
+	return task.Interval * time.Duration(task.IntervalAmount)
+}
+
 func (task CronTask) acquireLock() (bool, error) {
 	if task.SkipAdvisoryLock {
 		return true, nil
@@ -157,14 +220,14 @@ func (task CronTask) updateTaskLock(lockUntil time.Time) error {
 	// Update cron table with the latest run and lock time
 	err := db.UpdateCronTaskLockDetails(lockUntil, time.Now().UTC(), task.Name)
 	if err != nil {
-		log.Printf("Error updating cron table lock time: %v\n", err)
+		slog.Error("Error updating cron table lock time", "error", err)
 	}
 
 	err = db.ReleaseCronTaskLock(lockID)
 	if err != nil {
 		return err
 	} else if config.IsDebugMode {
-		log.Printf("'%s' task completed at %v\n", task.Name, time.Now().Format(time.RFC1123))
+		slog.Info("Task completed", "task", task.Name)
 	}
 
 	return nil
@@ -175,32 +238,59 @@ func (task CronTask) runCronTask() {
 		return
 	}
 
-	lockDuration := task.Interval * time.Duration(task.IntervalAmount)
-	lockUntil := time.Now().UTC().Add(-time.Second).Add(lockDuration)
+	lockUntil := time.Now().UTC().Add(-time.Second).Add(task.lockDuration())
 
 	lockAcquired, err := task.acquireLock()
 	if err != nil {
-		log.Printf("Error acquiring task lock: %v\n", err)
+		slog.Error("Error acquiring task lock", "error", err)
 		return
 	} else if !lockAcquired {
 		if config.IsDebugMode {
-			log.Printf("'%s' task lock already acquired, skipping", task.Name)
+			slog.Info("Task lock already acquired, skipping", "task", task.Name)
 		}
 		return
 	}
 
 	if config.IsDebugMode {
-		log.Printf("CRON: Running '%s' task...\n", task.Name)
+		slog.Info("Running task", "task", task.Name)
 	}
 
 	// Run the task
+	start := time.Now()
 	task.TaskFn()
+	metrics.ObserveCronTask(task.Name, time.Since(start))
 
 	// Update task lock
 	err = task.updateTaskLock(lockUntil)
 	if err != nil {
-		log.Printf("Error updating task lock: %v\n", err)
+		slog.Error("Error updating task lock", "error", err)
+	}
+}
+
+// CheckLocks returns an error if the lock state of any enabled task can't be
+// read, or if a task's lock expired more than one interval ago, meaning that
+// the task has stopped running on every server
+func CheckLocks() error {
+	var errs []error
+	for _, task := range tasks {
+		if !task.Enabled || task.SkipAdvisoryLock {
+			continue
+		}
+
+		lockedUntil, err := db.GetCronLockedUntil(task.Name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", task.Name, err))
+			continue
+		}
+
+		staleAt := lockedUntil.Add(task.lockDuration() + staleLockGrace)
+		if time.Now().UTC().After(staleAt) {
+			errs = append(errs, fmt.Errorf("%s: lock expired at %s",
+				task.Name, lockedUntil.Format(time.RFC3339)))
+		}
 	}
+
+	return errors.Join(errs...)
 }
 
 func InitCronTasks(limiterFn func()) {
@@ -223,9 +313,9 @@ func InitCronTasks(limiterFn func()) {
 		task.runCronTask()
 		_, err := c.AddFunc(task.getCronString(), task.runCronTask)
 		if err == nil {
-			log.Printf("Added cron task '%s'\n", task.Name)
+			slog.Info("Added cron task", "task", task.Name)
 		} else {
-			log.Printf("Error adding cron task: %v\n", err)
+			slog.Error("Error adding cron task", "error", err)
 		}
 	}
 
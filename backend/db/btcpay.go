@@ -2,7 +2,7 @@ package db
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -24,7 +24,7 @@ func GetBTCPayOrderTypeByID(orderID string) (string, error) {
 		FROM btcpay
 		WHERE id = $1`, orderID)
 	if err != nil {
-		log.Printf("Error querying for order type by ID: %v", err)
+		slog.Error("Error querying for order type by ID", "error", err)
 		return "", err
 	}
 
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	_ "embed"
@@ -8,6 +9,7 @@ import (
 	_ "github.com/lib/pq"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"sort"
 	"strconv"
@@ -96,7 +98,7 @@ func init() {
 			continue
 		}
 
-		log.Println("Running script:", file.Name())
+		slog.Info("Running script", "script", file.Name())
 
 		fullPath := fmt.Sprintf("%s/%s", migrationDir, file.Name())
 		script, err := migrationScripts.Open(fullPath)
@@ -130,27 +132,27 @@ func getScriptVersion(name string) int {
 // ClearDatabase removes all instances of a file ID from all tables in the database
 func ClearDatabase(id string) {
 	if DeleteMetadata(id) {
-		log.Printf("%s metadata deleted\n", id)
+		slog.Info("Metadata deleted", "id", id)
 	} else {
-		log.Printf("Failed to delete metadata for %s\n", id)
+		slog.Error("Failed to delete metadata", "id", id)
 	}
 
 	if DeleteUploads(id) {
-		log.Printf("%s File upload info deleted\n", id)
+		slog.Info("File upload info deleted", "id", id)
 	} else {
-		log.Printf("Failed to delete upload info for %s\n", id)
+		slog.Error("Failed to delete upload info", "id", id)
 	}
 
 	if DeleteExpiry(id) {
-		log.Printf("%s expiry fields deleted\n", id)
+		slog.Info("Expiry fields deleted", "id", id)
 	} else {
-		log.Printf("Failed to delete expiry fields for %s\n", id)
+		slog.Error("Failed to delete expiry fields", "id", id)
 	}
 
 	if AdminDeleteFile(id) == nil {
-		log.Printf("%s deleted from vault\n", id)
+		slog.Info("Deleted from vault", "id", id)
 	} else {
-		log.Printf("File does not exist in vault")
+		slog.Info("File does not exist in vault")
 	}
 }
 
@@ -159,7 +161,7 @@ func ClearDatabase(id string) {
 func TableIDExists(tableName, id string) bool {
 	rows, err := db.Query(`SELECT * FROM `+tableName+` WHERE id=$1`, id)
 	if err != nil {
-		log.Printf("Error checking for id in table '%s': %v", tableName, err)
+		slog.Error("Error checking for id in table", "table", tableName, "error", err)
 		return true
 	}
 
@@ -172,8 +174,13 @@ func TableIDExists(tableName, id string) bool {
 	return false
 }
 
+// Ping verifies that the database connection is still alive
+func Ping(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
 func Close() {
-	log.Println("Closing DB connection")
+	slog.Info("Closing DB connection")
 	err := db.Close()
 	if err != nil {
 		panic(err)
@@ -1,7 +1,7 @@
 package db
 
 import (
-	"log"
+	"log/slog"
 	"time"
 	"yeetfile/shared"
 )
@@ -66,7 +66,7 @@ func CleanUpDownloads() {
 	s := `DELETE FROM downloads WHERE updated < $1`
 	_, err := db.Exec(s, time.Now().UTC().Add(-time.Hour))
 	if err != nil {
-		log.Printf("Error cleaning up downloads: %v\n", err)
+		slog.Error("Error cleaning up downloads", "error", err)
 	}
 }
 
@@ -1,7 +1,7 @@
 package db
 
 import (
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -33,7 +33,7 @@ func DecrementDownloads(id string) int {
 	rows, err := db.Query(s2, id)
 
 	if err != nil {
-		log.Printf("Error retrieving download counter: %v\n", err)
+		slog.Error("Error retrieving download counter", "error", err)
 		return -1
 	}
 
@@ -55,7 +55,7 @@ func GetFileExpiry(metadataID string) FileExpiry {
 	rows, err := db.Query(s, metadataID)
 
 	if err != nil {
-		log.Printf("Error retrieving file expiry: %v\n", err)
+		slog.Error("Error retrieving file expiry", "error", err)
 		return FileExpiry{}
 	}
 
@@ -85,7 +85,7 @@ func CheckExpiry(deleteFn func(metadata FileMetadata)) func() {
 		rows, err := db.Query(s)
 
 		if err != nil {
-			log.Printf("Error retrieving file expiry: %v\n", err)
+			slog.Error("Error retrieving file expiry", "error", err)
 			return
 		}
 
@@ -96,15 +96,15 @@ func CheckExpiry(deleteFn func(metadata FileMetadata)) func() {
 			err = rows.Scan(&id)
 
 			if err != nil {
-				log.Printf("Error scanning rows: %v\n", err)
+				slog.Error("Error scanning rows", "error", err)
 				continue
 			}
 
 			// File has expired, remove from the DB and B2
-			log.Printf("%s has expired, removing now\n", id)
+			slog.Info("File has expired, removing now", "id", id)
 			metadata, err := RetrieveMetadata(id)
 			if err != nil {
-				log.Printf("Metadata not found for id: " + id)
+				slog.Info("Metadata not found", "id", id)
 			} else {
 				deleteFn(metadata)
 			}
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 	"yeetfile/shared"
 )
@@ -78,7 +78,7 @@ func insertFolder(id, ownerID string, folder shared.NewVaultFolder, pwFolder boo
 func FolderIDExists(id string) bool {
 	rows, err := db.Query(`SELECT * FROM folders WHERE id=$1`, id)
 	if err != nil {
-		log.Printf("Error checking folder id: %v", err)
+		slog.Error("Error checking folder id", "error", err)
 		return true
 	}
 
@@ -280,7 +280,7 @@ func ChangeFolderPermission(folderID, ownerID string, canModify bool) error {
 	      WHERE ref_id=$2 and owner_id=$3`
 	_, err := db.Exec(s, canModify, folderID, ownerID)
 	if err != nil {
-		log.Printf("Error updating folder permissions: %v\n", err)
+		slog.Error("Error updating folder permissions", "error", err)
 		return err
 	}
 
@@ -585,7 +585,7 @@ func UpdateVaultFolderName(id, ownerID, newName string) error {
 	      WHERE ref_id=$3`
 	_, err = db.Exec(s, newName, time.Now().UTC(), id)
 	if err != nil {
-		log.Printf("Error updating folder name: %v\n", err)
+		slog.Error("Error updating folder name", "error", err)
 		return err
 	}
 
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"log/slog"
 	"time"
 	"yeetfile/shared"
 	"yeetfile/shared/constants"
@@ -11,6 +12,16 @@ import (
 
 const uploadIDLength = 12
 
+// Prefixes for temporary metadata entries, used for tracking the remote ID and
+// length of a file while it's being written to a storage backend on behalf of
+// another file (i.e. when migrating or mirroring files)
+const (
+	MigrationIDPrefix = "migrate-"
+	MirrorIDPrefix    = "mirror-"
+)
+
+var tempIDPatterns = []string{MigrationIDPrefix + "%", MirrorIDPrefix + "%"}
+
 type FileMetadata struct {
 	ID                string
 	RefID             string
@@ -53,6 +64,27 @@ func InsertMetadata(chunks int, ownerID, name string, textOnly bool) (string, er
 	return id, nil
 }
 
+// InsertTempMetadata creates a temporary metadata entry that storage backends
+// can write a file's remote ID and length to, without modifying the original
+// file's metadata.
+func InsertTempMetadata(id, name string, chunks int) error {
+	s := `INSERT INTO metadata
+	      (id, chunks, filename, b2_id, length, owner_id, modified)
+	      VALUES ($1, $2, $3, '', -1, '', $4)`
+	_, err := db.Exec(s, id, chunks, name, time.Now().UTC())
+	return err
+}
+
+// GetMetadataRemoteID returns the remote (b2) ID and length of a file
+func GetMetadataRemoteID(id string) (string, int64, error) {
+	var b2ID string
+	var length int64
+
+	s := `SELECT b2_id, length FROM metadata WHERE id=$1`
+	err := db.QueryRow(s, id).Scan(&b2ID, &length)
+	return b2ID, length, err
+}
+
 func MetadataIDExists(id string) bool {
 	rows, err := db.Query(`SELECT * FROM metadata WHERE id = $1`, id)
 	if err != nil {
@@ -85,7 +117,7 @@ func RetrieveMetadata(id string) (FileMetadata, error) {
 		return ParseMetadata(rows), nil
 	}
 
-	log.Printf("No metadata found for id: %s", id)
+	slog.Info("No metadata found", "id", id)
 	return FileMetadata{}, errors.New("no metadata found")
 }
 
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// OIDCLogin is a single sign-on login attempt that's waiting for the user to
+// return from the identity provider
+type OIDCLogin struct {
+	State      string
+	Nonce      string
+	Verifier   string
+	Next       string
+	Expiration time.Time
+
+	// UserID is the user who was logged in when starting the login, whose
+	// account is linked to the provider's user (or empty if not logged in)
+	UserID string
+}
+
+// OIDCSignup is a user who has logged in with the identity provider, but
+// hasn't finished creating their account yet
+type OIDCSignup struct {
+	ID         string
+	Subject    string
+	Email      string
+	Expiration time.Time
+}
+
+// NewOIDCLogin stores a new single sign-on login attempt, removing any expired
+// login attempts
+func NewOIDCLogin(login OIDCLogin) error {
+	s := `DELETE FROM oidc_logins WHERE expiration < $1`
+	_, err := db.Exec(s, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	s = `INSERT INTO oidc_logins (state, nonce, verifier, next, expiration, user_id)
+	     VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = db.Exec(
+		s,
+		login.State,
+		login.Nonce,
+		login.Verifier,
+		login.Next,
+		login.Expiration.UTC(),
+		login.UserID)
+	return err
+}
+
+// ConsumeOIDCLogin removes and returns the login attempt matching the state,
+// returning sql.ErrNoRows if it doesn't exist or has expired
+func ConsumeOIDCLogin(state string) (OIDCLogin, error) {
+	var login OIDCLogin
+	s := `DELETE FROM oidc_logins
+	      WHERE state=$1 AND expiration > $2
+	      RETURNING state, nonce, verifier, next, expiration, user_id`
+	err := db.QueryRow(s, state, time.Now().UTC()).Scan(
+		&login.State,
+		&login.Nonce,
+		&login.Verifier,
+		&login.Next,
+		&login.Expiration,
+		&login.UserID)
+	return login, err
+}
+
+// NewOIDCSignup stores a pending single sign-on signup, removing any expired
+// signups
+func NewOIDCSignup(signup OIDCSignup) error {
+	s := `DELETE FROM oidc_signups WHERE expiration < $1`
+	_, err := db.Exec(s, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	s = `INSERT INTO oidc_signups (id, subject, email, expiration)
+	     VALUES ($1, $2, $3, $4)`
+	_, err = db.Exec(
+		s,
+		signup.ID,
+		signup.Subject,
+		signup.Email,
+		signup.Expiration.UTC())
+	return err
+}
+
+// GetOIDCSignup returns the pending signup matching the ID, returning
+// sql.ErrNoRows if it doesn't exist or has expired
+func GetOIDCSignup(id string) (OIDCSignup, error) {
+	var signup OIDCSignup
+	s := `SELECT id, subject, email, expiration
+	      FROM oidc_signups
+	      WHERE id=$1 AND expiration > $2`
+	err := db.QueryRow(s, id, time.Now().UTC()).Scan(
+		&signup.ID,
+		&signup.Subject,
+		&signup.Email,
+		&signup.Expiration)
+	return signup, err
+}
+
+// ConsumeOIDCSignup removes and returns the pending signup matching the ID,
+// returning sql.ErrNoRows if it doesn't exist or has expired
+func ConsumeOIDCSignup(id string) (OIDCSignup, error) {
+	var signup OIDCSignup
+	s := `DELETE FROM oidc_signups
+	      WHERE id=$1 AND expiration > $2
+	      RETURNING id, subject, email, expiration`
+	err := db.QueryRow(s, id, time.Now().UTC()).Scan(
+		&signup.ID,
+		&signup.Subject,
+		&signup.Email,
+		&signup.Expiration)
+	return signup, err
+}
+
+// GetUserIDByOIDCSubject returns the ID of the user linked to the identity
+// provider's subject, or an empty string if no user is linked
+func GetUserIDByOIDCSubject(subject string) (string, error) {
+	var id string
+	s := `SELECT id FROM users WHERE oidc_subject=$1`
+	err := db.QueryRow(s, subject).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return id, err
+}
+
+// SetUserOIDCSubject links a user to the identity provider's subject, so that
+// they log in with single sign-on
+func SetUserOIDCSubject(userID, subject string) error {
+	s := `UPDATE users SET oidc_subject=$2 WHERE id=$1`
+	result, err := db.Exec(s, userID, subject)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// IsOIDCUser returns true if the user is linked to the identity provider
+func IsOIDCUser(userID string) (bool, error) {
+	var linked bool
+	s := `SELECT oidc_subject IS NOT NULL FROM users WHERE id=$1`
+	err := db.QueryRow(s, userID).Scan(&linked)
+	return linked, err
+}
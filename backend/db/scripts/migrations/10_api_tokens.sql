@@ -0,0 +1,19 @@
+create table if not exists api_tokens
+(
+    id         text      not null
+        constraint api_tokens_pk
+            primary key,
+    user_id    text      not null,
+    name       text      not null,
+    token_hash bytea     not null
+        constraint api_tokens_token_hash_key
+            unique,
+    scopes     text[]    not null,
+    folder_ids text[]    default '{}'::text[],
+    created    timestamp not null,
+    expiration timestamp,
+    last_used  timestamp
+);
+
+create index if not exists api_tokens_user_id_idx
+    on api_tokens (user_id);
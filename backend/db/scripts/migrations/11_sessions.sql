@@ -0,0 +1,14 @@
+create table if not exists sessions
+(
+    id         text      not null
+        constraint sessions_pk
+            primary key,
+    user_id    text      not null,
+    user_agent text      default ''::text,
+    ip_address text      default ''::text,
+    created    timestamp not null,
+    last_seen  timestamp not null
+);
+
+create index if not exists sessions_user_id_idx
+    on sessions (user_id);
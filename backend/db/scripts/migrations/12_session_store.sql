@@ -0,0 +1,13 @@
+-- Sessions were previously stored in cookies, so existing records can't be
+-- matched to a session token and are removed
+delete from sessions;
+
+alter table sessions
+    add column if not exists token_hash bytea not null
+        constraint sessions_token_hash_key
+            unique,
+    add column if not exists data       text  default '{}'::text not null,
+    add column if not exists expiration timestamp not null;
+
+create index if not exists sessions_expiration_idx
+    on sessions (expiration);
@@ -0,0 +1,27 @@
+-- Accounts that log in with single sign-on are linked to the provider's
+-- subject identifier for the user
+alter table users
+    add column if not exists oidc_subject text
+        constraint users_oidc_subject_key
+            unique;
+
+create table if not exists oidc_logins
+(
+    state      text      not null
+        constraint oidc_logins_pk
+            primary key,
+    nonce      text      not null,
+    verifier   text      not null,
+    next       text      default ''::text not null,
+    expiration timestamp not null
+);
+
+create table if not exists oidc_signups
+(
+    id         text      not null
+        constraint oidc_signups_pk
+            primary key,
+    subject    text      not null,
+    email      text      not null,
+    expiration timestamp not null
+);
@@ -0,0 +1,9 @@
+create table if not exists presigned_chunks
+(
+    metadata_id text   not null,
+    chunk       int    not null,
+    size        bigint not null,
+    user_id     text   not null,
+    constraint presigned_chunks_pk
+        primary key (metadata_id, chunk)
+);
@@ -0,0 +1,8 @@
+create table if not exists pending_uploads
+(
+    id         text      not null
+        constraint pending_uploads_pk
+            primary key,
+    instance   text      not null,
+    expiration timestamp not null
+);
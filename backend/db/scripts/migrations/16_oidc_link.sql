@@ -0,0 +1,4 @@
+-- Existing accounts are only linked to the identity provider if the user was
+-- logged in to the account when they started logging in with single sign-on
+alter table oidc_logins
+    add column if not exists user_id text default ''::text not null;
@@ -0,0 +1,4 @@
+-- The total size of the chunks received for a pending upload, which is
+-- refunded if the upload is canceled when shutting down
+alter table pending_uploads
+    add column if not exists uploaded bigint default 0 not null;
@@ -0,0 +1,15 @@
+create table if not exists storage_migration
+(
+    item_id     text not null,
+    item_table  text not null,
+    source      text,
+    destination text,
+    old_b2_id   text,
+    new_b2_id   text,
+    status      text,
+    attempts    integer default 0,
+    error       text    default ''::text,
+    updated     timestamp,
+    constraint storage_migration_pk
+        primary key (item_id, item_table)
+);
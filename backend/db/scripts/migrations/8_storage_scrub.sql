@@ -0,0 +1,11 @@
+create table if not exists storage_scrub
+(
+    item_id    text not null,
+    item_table text not null,
+    b2_id      text default ''::text,
+    status     text,
+    error      text default ''::text,
+    checked    timestamp,
+    constraint storage_scrub_pk
+        primary key (item_id, item_table)
+);
@@ -0,0 +1,25 @@
+create table if not exists webauthn_credentials
+(
+    id         text      not null
+        constraint webauthn_credentials_pk
+            primary key,
+    user_id    text      not null,
+    name       text      not null,
+    public_key bytea     not null,
+    sign_count bigint    default 0,
+    created    timestamp not null,
+    last_used  timestamp
+);
+
+create index if not exists webauthn_credentials_user_id_idx
+    on webauthn_credentials (user_id);
+
+create table if not exists webauthn_challenges
+(
+    challenge  text      not null
+        constraint webauthn_challenges_pk
+            primary key,
+    user_id    text      not null,
+    purpose    text      not null,
+    expiration timestamp not null
+);
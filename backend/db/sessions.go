@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// Session is a single logged in session for a user. The session's values are
+// stored as JSON in Data, and only a hash of the session token (stored in the
+// user's cookie) is kept.
+type Session struct {
+	ID         string
+	UserID     string
+	TokenHash  []byte
+	Data       string
+	UserAgent  string
+	IPAddress  string
+	Created    time.Time
+	LastSeen   time.Time
+	Expiration time.Time
+}
+
+// NewSession stores a new session
+func NewSession(session Session) error {
+	s := `INSERT INTO sessions
+	      (id, user_id, token_hash, data, user_agent, ip_address,
+	       created, last_seen, expiration)
+	      VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8)`
+	_, err := db.Exec(s,
+		session.ID,
+		session.UserID,
+		session.TokenHash,
+		session.Data,
+		session.UserAgent,
+		session.IPAddress,
+		session.Created.UTC(),
+		session.Expiration.UTC())
+	return err
+}
+
+// GetSessionByHash returns the session matching the provided token hash, or
+// sql.ErrNoRows if it doesn't exist (i.e. it was revoked)
+func GetSessionByHash(tokenHash []byte) (Session, error) {
+	s := `SELECT id, user_id, token_hash, data, user_agent, ip_address,
+	             created, last_seen, expiration
+	      FROM sessions
+	      WHERE token_hash=$1`
+	return scanSession(db.QueryRow(s, tokenHash))
+}
+
+// GetUserSessions returns all of a user's sessions, most recently seen first
+func GetUserSessions(userID string) ([]Session, error) {
+	s := `SELECT id, user_id, token_hash, data, user_agent, ip_address,
+	             created, last_seen, expiration
+	      FROM sessions
+	      WHERE user_id=$1
+	      ORDER BY last_seen DESC`
+	rows, err := db.Query(s, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// UpdateSessionData replaces the values stored for a session
+func UpdateSessionData(id, userID, data string) error {
+	s := `UPDATE sessions SET user_id=$2, data=$3 WHERE id=$1`
+	_, err := db.Exec(s, id, userID, data)
+	return err
+}
+
+// UpdateSessionLastSeen records the last time a session was used, along with
+// the address it was used from
+func UpdateSessionLastSeen(id, ipAddress string) error {
+	s := `UPDATE sessions SET last_seen=$2, ip_address=$3 WHERE id=$1`
+	_, err := db.Exec(s, id, time.Now().UTC(), ipAddress)
+	return err
+}
+
+// DeleteSession revokes one of the user's sessions, returning sql.ErrNoRows if
+// the user doesn't have a session with the provided ID
+func DeleteSession(id, userID string) error {
+	s := `DELETE FROM sessions WHERE id=$1 AND user_id=$2`
+	result, err := db.Exec(s, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ExpireSession removes a session regardless of which user it belongs to
+func ExpireSession(id string) error {
+	s := `DELETE FROM sessions WHERE id=$1`
+	_, err := db.Exec(s, id)
+	return err
+}
+
+// DeleteOtherSessions revokes all of a user's sessions except for the one with
+// the provided ID
+func DeleteOtherSessions(userID, exceptID string) error {
+	s := `DELETE FROM sessions WHERE user_id=$1 AND id!=$2`
+	_, err := db.Exec(s, userID, exceptID)
+	return err
+}
+
+// CleanUpSessions removes all sessions that have expired, or that haven't been
+// used within the idle timeout
+func CleanUpSessions(idleTimeout time.Duration) {
+	now := time.Now().UTC()
+	s := `DELETE FROM sessions WHERE expiration < $1 OR last_seen < $2`
+	_, err := db.Exec(s, now, now.Add(-idleTimeout))
+	if err != nil {
+		slog.Error("Error cleaning up sessions", "error", err)
+	}
+}
+
+func scanSession(row interface{ Scan(...any) error }) (Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.TokenHash,
+		&session.Data,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.Created,
+		&session.LastSeen,
+		&session.Expiration)
+	return session, err
+}
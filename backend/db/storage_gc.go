@@ -0,0 +1,48 @@
+package db
+
+// StoredObjectRefs contains every remote ID and file name referenced by a send,
+// vault, or upload entry in the database
+type StoredObjectRefs struct {
+	RemoteIDs map[string]bool
+	Names     map[string]bool
+}
+
+// GetStoredObjectRefs returns all remote IDs and file names that may refer to
+// an object in the storage backend. This includes temporary entries used while
+// migrating or mirroring files, as well as uploads that haven't finished yet.
+func GetStoredObjectRefs() (StoredObjectRefs, error) {
+	refs := StoredObjectRefs{
+		RemoteIDs: make(map[string]bool),
+		Names:     make(map[string]bool),
+	}
+
+	s := `SELECT COALESCE(b2_id, ''), COALESCE(filename, '') FROM metadata
+	      UNION ALL
+	      SELECT COALESCE(b2_id, ''), name FROM vault
+	      UNION ALL
+	      SELECT COALESCE(upload_id, ''), COALESCE(name, '') FROM uploads`
+
+	rows, err := db.Query(s)
+	if err != nil {
+		return refs, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var remoteID, name string
+		err = rows.Scan(&remoteID, &name)
+		if err != nil {
+			return refs, err
+		}
+
+		if len(remoteID) > 0 {
+			refs.RemoteIDs[remoteID] = true
+		}
+
+		if len(name) > 0 {
+			refs.Names[name] = true
+		}
+	}
+
+	return refs, rows.Err()
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	MigrationTableVault    = "vault"
+	MigrationTableMetadata = "metadata"
+
+	MigrationStatusDone    = "done"
+	MigrationStatusFailed  = "failed"
+	MigrationStatusSkipped = "skipped"
+)
+
+// MigrationItem is a single stored file that needs to be copied from one
+// storage backend to another
+type MigrationItem struct {
+	ID     string
+	Table  string
+	Name   string
+	B2ID   string
+	Length int64
+	Chunks int
+}
+
+// GetPendingMigrationItems returns up to `limit` vault and send files that
+// haven't been copied from the source to the destination storage backend yet.
+// Files that have failed `maxAttempts` times are skipped, as are files modified
+// after `settledBefore` (which may still be uploading). Files migrated by a
+// previous migration between other backends are included.
+func GetPendingMigrationItems(
+	source, destination string,
+	limit int,
+	maxAttempts int,
+	settledBefore time.Time,
+) ([]MigrationItem, error) {
+	s := `SELECT id, $1, filename, b2_id, length, chunks
+	      FROM metadata m
+	      WHERE length > 0 AND modified < $4 AND id NOT LIKE ALL($7)
+	      AND NOT EXISTS (
+	          SELECT 1 FROM storage_migration sm
+	          WHERE sm.item_id = m.id AND sm.item_table = $1
+	          AND sm.source = $8 AND sm.destination = $9
+	          AND (sm.status <> $5 OR sm.attempts >= $6))
+	      UNION ALL
+	      SELECT id, $2, name, b2_id, length, chunks
+	      FROM vault v
+	      WHERE v.id = v.ref_id AND length > 0
+	      AND (modified IS NULL OR modified < $4)
+	      AND (pw_data IS NULL OR length(pw_data) = 0)
+	      AND NOT EXISTS (
+	          SELECT 1 FROM storage_migration sm
+	          WHERE sm.item_id = v.id AND sm.item_table = $2
+	          AND sm.source = $8 AND sm.destination = $9
+	          AND (sm.status <> $5 OR sm.attempts >= $6))
+	      LIMIT $3`
+
+	rows, err := db.Query(s,
+		MigrationTableMetadata,
+		MigrationTableVault,
+		limit,
+		settledBefore,
+		MigrationStatusFailed,
+		maxAttempts,
+		pq.Array(tempIDPatterns),
+		source,
+		destination)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var items []MigrationItem
+	for rows.Next() {
+		var item MigrationItem
+		err = rows.Scan(
+			&item.ID,
+			&item.Table,
+			&item.Name,
+			&item.B2ID,
+			&item.Length,
+			&item.Chunks)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// CountPendingMigrationItems returns the number of files that still need to be
+// copied from the source to the destination storage backend
+func CountPendingMigrationItems(source, destination string, maxAttempts int) (int, error) {
+	var count int
+	s := `SELECT
+	          (SELECT COUNT(*) FROM metadata m
+	           WHERE length > 0 AND id NOT LIKE ALL($5)
+	           AND NOT EXISTS (
+	               SELECT 1 FROM storage_migration sm
+	               WHERE sm.item_id = m.id AND sm.item_table = $1
+	               AND sm.source = $6 AND sm.destination = $7
+	               AND (sm.status <> $3 OR sm.attempts >= $4)))
+	          +
+	          (SELECT COUNT(*) FROM vault v
+	           WHERE v.id = v.ref_id AND length > 0
+	           AND (pw_data IS NULL OR length(pw_data) = 0)
+	           AND NOT EXISTS (
+	               SELECT 1 FROM storage_migration sm
+	               WHERE sm.item_id = v.id AND sm.item_table = $2
+	               AND sm.source = $6 AND sm.destination = $7
+	               AND (sm.status <> $3 OR sm.attempts >= $4)))`
+
+	err := db.QueryRow(s,
+		MigrationTableMetadata,
+		MigrationTableVault,
+		MigrationStatusFailed,
+		maxAttempts,
+		pq.Array(tempIDPatterns),
+		source,
+		destination).Scan(&count)
+	return count, err
+}
+
+// CompleteMigrationItem replaces the remote ID of a migrated file with the ID
+// from the new storage backend and records the file as migrated. Vault files
+// that have been shared with other users are updated as well. Returns false if
+// the file no longer exists or was modified during the migration.
+func CompleteMigrationItem(item MigrationItem, newB2ID, source, destination string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var s string
+	if item.Table == MigrationTableVault {
+		s = `UPDATE vault SET b2_id=$1 WHERE ref_id=$2 AND b2_id=$3`
+	} else {
+		s = `UPDATE metadata SET b2_id=$1 WHERE id=$2 AND b2_id=$3`
+	}
+
+	result, err := tx.Exec(s, newB2ID, item.ID, item.B2ID)
+	if err != nil {
+		return false, err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	} else if updated == 0 {
+		return false, nil
+	}
+
+	err = setMigrationStatus(tx, item, newB2ID, source, destination, MigrationStatusDone, "")
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// SetMigrationItemStatus records the status of a file that could not be fully
+// migrated, incrementing the number of attempts for that file.
+func SetMigrationItemStatus(item MigrationItem, source, destination, status, errMsg string) error {
+	return setMigrationStatus(db, item, "", source, destination, status, errMsg)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// setMigrationStatus records the status of a file for the migration between the
+// source and destination backends. Each file only has one entry, so the number
+// of attempts starts over when the file is part of a migration between a
+// different pair of backends.
+func setMigrationStatus(
+	e execer,
+	item MigrationItem,
+	newB2ID, source, destination, status, errMsg string,
+) error {
+	s := `INSERT INTO storage_migration
+	      (item_id, item_table, source, destination, old_b2_id, new_b2_id,
+	       status, attempts, error, updated)
+	      VALUES ($1, $2, $3, $4, $5, $6, $7, 1, $8, $9)
+	      ON CONFLICT (item_id, item_table) DO UPDATE
+	      SET source=$3, destination=$4, old_b2_id=$5, new_b2_id=$6,
+	          status=$7,
+	          attempts=(CASE
+	              WHEN storage_migration.source = $3
+	                   AND storage_migration.destination = $4
+	              THEN storage_migration.attempts + 1
+	              ELSE 1
+	          END),
+	          error=$8, updated=$9`
+	_, err := e.Exec(s,
+		item.ID,
+		item.Table,
+		source,
+		destination,
+		item.B2ID,
+		newB2ID,
+		status,
+		errMsg,
+		time.Now().UTC())
+	return err
+}
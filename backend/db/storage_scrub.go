@@ -0,0 +1,150 @@
+package db
+
+import (
+	"github.com/lib/pq"
+	"time"
+	"yeetfile/shared"
+)
+
+const (
+	ScrubStatusOK      = "ok"
+	ScrubStatusCorrupt = "corrupt"
+	ScrubStatusMissing = "missing"
+)
+
+// ScrubItem is a single stored file that should be checked for corruption
+type ScrubItem struct {
+	ID         string
+	Table      string
+	Name       string
+	B2ID       string
+	Length     int64
+	Chunks     int
+	Checksums  []string
+	LastStatus string
+}
+
+// GetScrubItems returns up to `limit` vault and send files that haven't been
+// checked since `checkedBefore`, starting with files that have never been
+// checked.
+func GetScrubItems(limit int, checkedBefore time.Time) ([]ScrubItem, error) {
+	s := `SELECT id, item_table, name, b2_id, length, chunks, checksums, status
+	      FROM (
+	          SELECT m.id, $1 AS item_table, m.filename AS name, m.b2_id,
+	                 m.length, m.chunks, u.checksums,
+	                 COALESCE(sc.status, '') AS status, sc.checked
+	          FROM metadata m
+	          LEFT JOIN uploads u ON u.metadata_id = m.id
+	          LEFT JOIN storage_scrub sc
+	              ON sc.item_id = m.id AND sc.item_table = $1
+	          WHERE m.length > 0 AND m.id NOT LIKE ALL($5)
+	          UNION ALL
+	          SELECT v.id, $2, v.name, v.b2_id, v.length, v.chunks,
+	                 u.checksums, COALESCE(sc.status, ''), sc.checked
+	          FROM vault v
+	          LEFT JOIN uploads u ON u.metadata_id = v.id
+	          LEFT JOIN storage_scrub sc
+	              ON sc.item_id = v.id AND sc.item_table = $2
+	          WHERE v.id = v.ref_id AND v.length > 0
+	          AND (v.pw_data IS NULL OR length(v.pw_data) = 0)
+	      ) items
+	      WHERE checked IS NULL OR checked < $3
+	      ORDER BY checked NULLS FIRST
+	      LIMIT $4`
+
+	rows, err := db.Query(s,
+		MigrationTableMetadata,
+		MigrationTableVault,
+		checkedBefore,
+		limit,
+		pq.Array(tempIDPatterns))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var items []ScrubItem
+	for rows.Next() {
+		var item ScrubItem
+		err = rows.Scan(
+			&item.ID,
+			&item.Table,
+			&item.Name,
+			&item.B2ID,
+			&item.Length,
+			&item.Chunks,
+			pq.Array(&item.Checksums),
+			&item.LastStatus)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// SetScrubResult records the result of checking a stored file
+func SetScrubResult(item ScrubItem, status, errMsg string) error {
+	s := `INSERT INTO storage_scrub
+	      (item_id, item_table, b2_id, status, error, checked)
+	      VALUES ($1, $2, $3, $4, $5, $6)
+	      ON CONFLICT (item_id, item_table) DO UPDATE
+	      SET b2_id=$3, status=$4, error=$5, checked=$6`
+	_, err := db.Exec(s,
+		item.ID,
+		item.Table,
+		item.B2ID,
+		status,
+		errMsg,
+		time.Now().UTC())
+	return err
+}
+
+// DeleteStaleScrubResults removes results for files that no longer exist
+func DeleteStaleScrubResults() error {
+	s := `DELETE FROM storage_scrub sc
+	      WHERE (sc.item_table = $1 AND NOT EXISTS (
+	                SELECT 1 FROM metadata m WHERE m.id = sc.item_id))
+	      OR (sc.item_table = $2 AND NOT EXISTS (
+	                SELECT 1 FROM vault v WHERE v.id = sc.item_id))`
+	_, err := db.Exec(s, MigrationTableMetadata, MigrationTableVault)
+	return err
+}
+
+// GetScrubFailures returns all stored files that were found to be corrupted
+// or missing the last time they were checked
+func GetScrubFailures() ([]shared.AdminScrubResult, error) {
+	s := `SELECT item_id, item_table, b2_id, status, error, checked
+	      FROM storage_scrub
+	      WHERE status <> $1
+	      ORDER BY checked DESC`
+
+	rows, err := db.Query(s, ScrubStatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []shared.AdminScrubResult{}
+	for rows.Next() {
+		var result shared.AdminScrubResult
+		err = rows.Scan(
+			&result.ID,
+			&result.Table,
+			&result.RemoteID,
+			&result.Status,
+			&result.Error,
+			&result.Checked)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
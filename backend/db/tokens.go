@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	"log/slog"
+	"time"
+)
+
+// APIToken is a personal API token that can be used in place of a session for
+// a limited set of scopes. Only a hash of the token is stored.
+type APIToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	TokenHash  []byte
+	Scopes     []string
+	FolderIDs  []string
+	Created    time.Time
+	Expiration time.Time
+	LastUsed   time.Time
+}
+
+// NewAPIToken stores a newly created API token for a user
+func NewAPIToken(token APIToken) error {
+	var expiration sql.NullTime
+	if !token.Expiration.IsZero() {
+		expiration = sql.NullTime{Time: token.Expiration.UTC(), Valid: true}
+	}
+
+	s := `INSERT INTO api_tokens
+	      (id, user_id, name, token_hash, scopes, folder_ids, created, expiration)
+	      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := db.Exec(s,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		pq.Array(token.Scopes),
+		pq.Array(token.FolderIDs),
+		token.Created.UTC(),
+		expiration)
+	return err
+}
+
+// GetAPITokenByHash returns the token matching the provided hash, or
+// sql.ErrNoRows if there isn't one
+func GetAPITokenByHash(tokenHash []byte) (APIToken, error) {
+	s := `SELECT id, user_id, name, token_hash, scopes, folder_ids,
+	             created, expiration, last_used
+	      FROM api_tokens
+	      WHERE token_hash=$1`
+	return scanAPIToken(db.QueryRow(s, tokenHash))
+}
+
+// GetAPITokens returns all tokens created by a user
+func GetAPITokens(userID string) ([]APIToken, error) {
+	s := `SELECT id, user_id, name, token_hash, scopes, folder_ids,
+	             created, expiration, last_used
+	      FROM api_tokens
+	      WHERE user_id=$1
+	      ORDER BY created`
+	rows, err := db.Query(s, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// CountAPITokens returns the number of tokens a user has created
+func CountAPITokens(userID string) (int, error) {
+	var count int
+	s := `SELECT COUNT(*) FROM api_tokens WHERE user_id=$1`
+	err := db.QueryRow(s, userID).Scan(&count)
+	return count, err
+}
+
+// UpdateAPITokenLastUsed records the last time a token was used
+func UpdateAPITokenLastUsed(id string) error {
+	s := `UPDATE api_tokens SET last_used=$2 WHERE id=$1`
+	_, err := db.Exec(s, id, time.Now().UTC())
+	return err
+}
+
+// DeleteAPIToken revokes one of the user's tokens, returning sql.ErrNoRows if
+// the user doesn't have a token with the provided ID
+func DeleteAPIToken(id, userID string) error {
+	s := `DELETE FROM api_tokens WHERE id=$1 AND user_id=$2`
+	result, err := db.Exec(s, id, userID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CleanUpAPITokens removes all tokens that have expired
+func CleanUpAPITokens() {
+	s := `DELETE FROM api_tokens WHERE expiration < $1`
+	_, err := db.Exec(s, time.Now().UTC())
+	if err != nil {
+		slog.Error("Error cleaning up API tokens", "error", err)
+	}
+}
+
+func scanAPIToken(row interface{ Scan(...any) error }) (APIToken, error) {
+	var token APIToken
+	var expiration, lastUsed sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.TokenHash,
+		pq.Array(&token.Scopes),
+		pq.Array(&token.FolderIDs),
+		&token.Created,
+		&expiration,
+		&lastUsed)
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	token.Expiration = expiration.Time
+	token.LastUsed = lastUsed.Time
+	return token, nil
+}
@@ -1,12 +1,16 @@
 package db
 
 import (
+	"errors"
 	"github.com/lib/pq"
-	"log"
+	"log/slog"
+	"time"
 )
 
 const ChecksumPlaceholder = "?"
 
+var PresignedChunkSizeErr = errors.New("chunk was presigned with a different size")
+
 type Upload struct {
 	MetadataID string
 	UploadURL  string
@@ -43,7 +47,7 @@ func UpdateUploadValues(
 	      WHERE metadata_id=$5`
 	_, err := db.Exec(s, uploadURL, token, uploadID, local, metadataID)
 	if err != nil {
-		log.Printf("Error updating remote upload values: %v\n", err)
+		slog.Error("Error updating remote upload values", "error", err)
 		return err
 	}
 
@@ -54,7 +58,7 @@ func UpdateUploadID(id string, metadataID string) bool {
 	s := `UPDATE uploads SET upload_id=$1 WHERE metadata_id=$2`
 	_, err := db.Exec(s, id, metadataID)
 	if err != nil {
-		log.Printf("Error updating remote upload id: %v\n", err)
+		slog.Error("Error updating remote upload id", "error", err)
 		return false
 	}
 
@@ -77,13 +81,20 @@ func UpdateChecksums(id string, chunk int, checksum string) ([]string, error) {
 		// For now this error is going to get ignored, since it's not
 		// worth abandoning the entire upload because of a somewhat
 		// benign error.
-		log.Printf("WARN: Failed checksum update (can ignore): %v\n", err)
+		slog.Warn("Failed checksum update (can ignore)", "error", err)
 		return checksums, nil
 	}
 
 	return checksums, nil
 }
 
+// SetChecksums replaces all chunk checksums for an upload
+func SetChecksums(id string, checksums []string) error {
+	s := `UPDATE uploads SET checksums=$1 WHERE metadata_id=$2`
+	_, err := db.Exec(s, pq.Array(checksums), id)
+	return err
+}
+
 func GetUploadValues(id string) Upload {
 	s := `SELECT *
 	      FROM uploads
@@ -91,7 +102,7 @@ func GetUploadValues(id string) Upload {
 
 	rows, err := db.Query(s, id)
 	if err != nil {
-		log.Printf("Error retrieving upload values: %v", err)
+		slog.Error("Error retrieving upload values", "error", err)
 		return Upload{}
 	}
 
@@ -138,3 +149,149 @@ func DeleteUploads(id string) bool {
 
 	return true
 }
+
+// DeleteTempUploadByUploadID removes the upload values and temporary metadata
+// for an upload using the ID assigned by the storage backend
+func DeleteTempUploadByUploadID(uploadID, prefix string) error {
+	s := `WITH removed AS (
+	          DELETE FROM uploads
+	          WHERE upload_id=$1 AND metadata_id LIKE $2
+	          RETURNING metadata_id
+	      )
+	      DELETE FROM metadata WHERE id IN (SELECT metadata_id FROM removed)`
+	_, err := db.Exec(s, uploadID, prefix+"%")
+	return err
+}
+
+// PresignedChunk is the storage charged to a user for a chunk that was
+// requested with a presigned upload
+type PresignedChunk struct {
+	UserID string
+	Size   int64
+}
+
+// AddPresignedChunk records the storage charged to a user for presigning a
+// chunk of a file. Returns false if the chunk was already presigned (and
+// charged) with the same size, or PresignedChunkSizeErr if it was presigned
+// with a different size.
+func AddPresignedChunk(metadataID string, chunk int, size int64, userID string) (bool, error) {
+	s := `INSERT INTO presigned_chunks (metadata_id, chunk, size, user_id)
+	      VALUES ($1, $2, $3, $4)
+	      ON CONFLICT (metadata_id, chunk) DO NOTHING`
+	result, err := db.Exec(s, metadataID, chunk, size, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if inserted, err := result.RowsAffected(); err != nil {
+		return false, err
+	} else if inserted > 0 {
+		return true, nil
+	}
+
+	var prevSize int64
+	s = `SELECT size FROM presigned_chunks WHERE metadata_id=$1 AND chunk=$2`
+	err = db.QueryRow(s, metadataID, chunk).Scan(&prevSize)
+	if err != nil {
+		return false, err
+	} else if prevSize != size {
+		return false, PresignedChunkSizeErr
+	}
+
+	return false, nil
+}
+
+// RemovePresignedChunk removes the record of a single presigned chunk, i.e. if
+// the user couldn't be charged for it
+func RemovePresignedChunk(metadataID string, chunk int) error {
+	s := `DELETE FROM presigned_chunks WHERE metadata_id=$1 AND chunk=$2`
+	_, err := db.Exec(s, metadataID, chunk)
+	return err
+}
+
+// RemovePresignedChunks removes and returns the records of each presigned
+// chunk of a file
+func RemovePresignedChunks(metadataID string) ([]PresignedChunk, error) {
+	s := `DELETE FROM presigned_chunks WHERE metadata_id=$1
+	      RETURNING user_id, size`
+	rows, err := db.Query(s, metadataID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var chunks []PresignedChunk
+	for rows.Next() {
+		var chunk PresignedChunk
+		if err = rows.Scan(&chunk.UserID, &chunk.Size); err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// HasPresignedChunks returns true if any chunks of the file were presigned
+func HasPresignedChunks(metadataID string) (bool, error) {
+	var exists bool
+	s := `SELECT EXISTS (SELECT 1 FROM presigned_chunks WHERE metadata_id=$1)`
+	err := db.QueryRow(s, metadataID).Scan(&exists)
+	return exists, err
+}
+
+// AddPendingUpload records an upload that has been started by a server
+// instance, removing any expired pending uploads
+func AddPendingUpload(id, instance string, expiration time.Time) error {
+	s := `DELETE FROM pending_uploads WHERE expiration < $1`
+	_, err := db.Exec(s, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	s = `INSERT INTO pending_uploads (id, instance, expiration)
+	     VALUES ($1, $2, $3)
+	     ON CONFLICT (id) DO UPDATE SET instance=$2, expiration=$3`
+	_, err = db.Exec(s, id, instance, expiration.UTC())
+	return err
+}
+
+// AddPendingUploadChunk records a chunk received for a pending upload, along
+// with the server instance that received it
+func AddPendingUploadChunk(id, instance string, size int64) error {
+	s := `UPDATE pending_uploads SET instance=$2, uploaded=uploaded + $3
+	      WHERE id=$1`
+	_, err := db.Exec(s, id, instance, size)
+	return err
+}
+
+// IsPendingUploadOwner returns true if the upload is still pending and the
+// instance was the last to receive a chunk for it
+func IsPendingUploadOwner(id, instance string) (bool, error) {
+	var owner bool
+	s := `SELECT EXISTS (
+	          SELECT 1 FROM pending_uploads WHERE id=$1 AND instance=$2)`
+	err := db.QueryRow(s, id, instance).Scan(&owner)
+	return owner, err
+}
+
+// ClaimPendingUpload removes a pending upload if the instance was the last to
+// receive a chunk for it, returning the total size of the chunks received. An
+// error of sql.ErrNoRows is returned if the upload has finished or is being
+// handled by another instance.
+func ClaimPendingUpload(id, instance string) (int64, error) {
+	var uploaded int64
+	s := `DELETE FROM pending_uploads WHERE id=$1 AND instance=$2
+	      RETURNING uploaded`
+	err := db.QueryRow(s, id, instance).Scan(&uploaded)
+	return uploaded, err
+}
+
+// RemovePendingUpload removes an upload that has finished or been aborted
+func RemovePendingUpload(id string) error {
+	s := `DELETE FROM pending_uploads WHERE id=$1`
+	_, err := db.Exec(s, id)
+	return err
+}
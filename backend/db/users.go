@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/lib/pq"
 	"log"
+	"log/slog"
 	"strings"
 	"time"
 	"yeetfile/backend/config"
@@ -372,7 +373,7 @@ func GetUserPasswordHashByEmail(email string) ([]byte, []byte, error) {
 		FROM users 
 		WHERE email = $1`, email).Scan(&pwHash, &secret)
 	if err != nil {
-		log.Printf("Error querying for user by email: %v", err)
+		slog.Error("Error querying for user by email", "error", err)
 		return nil, nil, err
 	}
 
@@ -389,7 +390,7 @@ func GetUserPasswordHashByID(id string) ([]byte, []byte, error) {
 		FROM users 
 		WHERE id = $1`, id).Scan(&pwHash, &secret)
 	if err != nil {
-		log.Printf("Error querying for user by id: %v", err)
+		slog.Error("Error querying for user by id", "error", err)
 		return nil, nil, err
 	}
 
@@ -404,7 +405,7 @@ func GetUserKeys(id string) ([]byte, []byte, error) {
 		FROM users 
 		WHERE id = $1`, id)
 	if err != nil {
-		log.Printf("Error querying for user by id: %v", err)
+		slog.Error("Error querying for user by id", "error", err)
 		return nil, nil, err
 	}
 
@@ -450,7 +451,7 @@ func GetUserByID(id string) (User, error) {
 	)
 
 	if err != nil {
-		log.Printf("Error querying for user by id: %s\n", id)
+		slog.Error("Error querying for user by id", "id", id)
 		return User{}, err
 	}
 
@@ -492,6 +493,14 @@ func RemoveUser2FA(userID string) error {
 	return err
 }
 
+// RemoveUserTOTP removes the user's TOTP secret, but keeps their recovery codes
+// for use with their remaining WebAuthn credentials
+func RemoveUserTOTP(userID string) error {
+	s := `UPDATE users SET secret='\x'::bytea WHERE id=$1`
+	_, err := db.Exec(s, userID)
+	return err
+}
+
 func GetUserRecoveryCodeHashes(userID string) ([]string, error) {
 	var hashes []string
 	s := `SELECT recovery_hashes FROM users WHERE id=$1`
@@ -509,7 +518,7 @@ func SetUserRecoveryCodeHashes(userID string, hashes []string) error {
 func GetUserPubKey(userID string) ([]byte, error) {
 	rows, err := db.Query(`SELECT public_key FROM users WHERE id=$1`, userID)
 	if err != nil {
-		log.Printf("Error querying for public key by user id: %v\n", err)
+		slog.Error("Error querying for public key by user id", "error", err)
 		return nil, err
 	}
 
@@ -531,7 +540,7 @@ func GetUserPublicName(userID string) (string, error) {
 	var email string
 	err := db.QueryRow(`SELECT email FROM users WHERE id=$1`, userID).Scan(&email)
 	if err != nil {
-		log.Printf("Error querying for user's public name")
+		slog.Error("Error querying for user's public name")
 		return "", err
 	}
 
@@ -551,7 +560,7 @@ func GetUserIDByEmail(email string) (string, error) {
 		FROM users 
 		WHERE email = $1`, email).Scan(&id)
 	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Error querying for user by email: %v", err)
+		slog.Error("Error querying for user by email", "error", err)
 		return "", err
 	}
 
@@ -632,7 +641,7 @@ func GetUserSendLimits(id string) (int64, int64, error) {
 	if err == sql.ErrNoRows {
 		return 0, 0, errors.New("unable to find user by id")
 	} else if err != nil {
-		log.Printf("Error querying for user by id: %s\n", id)
+		slog.Error("Error querying for user by id", "id", id)
 		return 0, 0, err
 	}
 
@@ -651,7 +660,7 @@ func GetUserStorageLimits(id string) (int64, int64, error) {
 	if err == sql.ErrNoRows {
 		return 0, 0, errors.New("unable to find user by id")
 	} else if err != nil {
-		log.Printf("Error querying for user by id: %s\n", id)
+		slog.Error("Error querying for user by id", "id", id)
 		return 0, 0, err
 	}
 
@@ -677,7 +686,7 @@ func GetPaymentIDByUserID(userID string) (string, error) {
 		FROM users
 		WHERE id = $1`, userID)
 	if err != nil {
-		log.Println("Error querying for payment_id")
+		slog.Error("Error querying for payment_id")
 		return "", err
 	}
 
@@ -686,7 +695,7 @@ func GetPaymentIDByUserID(userID string) (string, error) {
 		var paymentID string
 		err = rows.Scan(&paymentID)
 		if err != nil {
-			log.Println("Error fetching payment ID")
+			slog.Error("Error fetching payment ID")
 			return "", err
 		}
 
@@ -722,7 +731,7 @@ func GetUserEmailByPaymentID(paymentID string) (string, error) {
 		FROM users
 		WHERE payment_id = $1`, paymentID)
 	if err != nil {
-		log.Printf("Error querying for user by payment_id: %s\n", paymentID)
+		slog.Error("Error querying for user by payment_id", "payment_id", paymentID)
 		return "", err
 	}
 
@@ -731,7 +740,8 @@ func GetUserEmailByPaymentID(paymentID string) (string, error) {
 		var email string
 		err = rows.Scan(&email)
 		if err != nil {
-			log.Printf("Error fetching email for user with payment id %s\n", paymentID)
+			slog.Error("Error fetching email for user with payment id",
+				"payment_id", paymentID)
 			return "", err
 		}
 
@@ -821,7 +831,7 @@ func CheckBandwidth() {
 		constants.TotalBandwidthMultiplier,
 		constants.BandwidthMonitorDuration)
 	if err != nil {
-		log.Printf("Failed to update user bandwidths")
+		slog.Error("Failed to update user bandwidths")
 	}
 }
 
@@ -832,7 +842,7 @@ func CheckActiveUpgrades() {
               WHERE last_upgraded_month != $1`
 	rows, err := db.Query(s, int(time.Now().Month()))
 	if err != nil {
-		log.Printf("Error retrieving user upgrades: %v", err)
+		slog.Error("Error retrieving user upgrades", "error", err)
 		return
 	}
 
@@ -851,7 +861,7 @@ func CheckActiveUpgrades() {
 		err = rows.Scan(&id, &upgradeTag, &upgradeExp)
 
 		if err != nil {
-			log.Printf("Error scanning user rows: %v", err)
+			slog.Error("Error scanning user rows", "error", err)
 			return
 		}
 
@@ -888,7 +898,7 @@ func CheckActiveUpgrades() {
 		revertIDs,
 		config.YeetFileConfig.DefaultUserStorage)
 	if err != nil {
-		log.Printf("Error resetting unpaid user storage/send")
+		slog.Error("Error resetting unpaid user storage/send")
 	}
 
 	for upgradeTag, ids := range upgradeMap {
@@ -896,13 +906,13 @@ func CheckActiveUpgrades() {
 			upgradeTag,
 			upgrades.GetAllUpgrades())
 		if err != nil {
-			log.Printf("Error locating upgrade in cron: %v\n", err)
+			slog.Error("Error locating upgrade in cron", "error", err)
 			continue
 		}
 
 		err = updateFunc(ids, vaultUpgrade.Bytes)
 		if err != nil {
-			log.Printf("Error updating user storage/send: %v\n", err)
+			slog.Error("Error updating user storage/send", "error", err)
 		}
 	}
 }
@@ -918,7 +928,7 @@ func CheckUpgradeExpiration() {
 
 	rows, err := db.Query(s)
 	if err != nil {
-		log.Printf("Error retrieving upcoming user upgrade expirations: %v", err)
+		slog.Error("Error retrieving upcoming user upgrade expirations", "error", err)
 		return
 	}
 
@@ -933,7 +943,7 @@ func CheckUpgradeExpiration() {
 
 		err = rows.Scan(&email, &upgradeExp)
 		if err != nil {
-			log.Printf("Error reading rows in user upgrade expirations: %v\n", err)
+			slog.Error("Error reading rows in user upgrade expirations", "error", err)
 			return
 		}
 
@@ -954,7 +964,7 @@ func CheckUpgradeExpiration() {
 
 	err = mail.SendUpgradeExpirationEmail(notifyEmails)
 	if err != nil {
-		log.Printf("Error sending upgrade expiration emails: %v\n", err)
+		slog.Error("Error sending upgrade expiration emails", "error", err)
 	}
 }
 
@@ -996,6 +1006,24 @@ func DeleteUser(id string) error {
 		return err
 	}
 
+	s = `DELETE FROM webauthn_credentials WHERE user_id=$1`
+	_, err = db.Exec(s, id)
+	if err != nil {
+		return err
+	}
+
+	s = `DELETE FROM api_tokens WHERE user_id=$1`
+	_, err = db.Exec(s, id)
+	if err != nil {
+		return err
+	}
+
+	s = `DELETE FROM sessions WHERE user_id=$1`
+	_, err = db.Exec(s, id)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
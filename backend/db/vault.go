@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 	"yeetfile/shared"
 )
@@ -48,7 +48,7 @@ func CheckFolderOwnership(userID, folderID string) (shared.FolderOwnershipInfo,
 	if err == FolderNotFoundError {
 		return CheckFolderOwnership(userID, parentID)
 	} else if err != nil {
-		log.Printf("Error checking for folder ownership: %v\n", err)
+		slog.Error("Error checking for folder ownership", "error", err)
 		return shared.FolderOwnershipInfo{}, err
 	}
 
@@ -93,7 +93,7 @@ func GetVaultItems(
 	} else {
 		ownership, err = CheckFolderOwnership(userID, folderID)
 		if err != nil || len(ownership.ID) == 0 {
-			log.Printf("error checking folder ownership: %v\n", err)
+			slog.Error("error checking folder ownership", "error", err)
 			return nil, shared.FolderOwnershipInfo{}, AccessError
 		}
 
@@ -106,7 +106,7 @@ func GetVaultItems(
 	}
 
 	if err != nil {
-		log.Printf("Error retrieving vault contents: %v", err)
+		slog.Error("Error retrieving vault contents", "error", err)
 		return nil, shared.FolderOwnershipInfo{}, err
 	}
 
@@ -238,7 +238,7 @@ func ChangeFilePermission(fileID, ownerID string, canModify bool) error {
 	      WHERE ref_id=$2 and owner_id=$3`
 	_, err := db.Exec(s, canModify, fileID, ownerID)
 	if err != nil {
-		log.Printf("Error updating file permissions: %v\n", err)
+		slog.Error("Error updating file permissions", "error", err)
 		return err
 	}
 
@@ -311,7 +311,7 @@ func ShareFile(share shared.NewSharedItem, userID string) (string, error) {
 func VaultItemIDExists(id string) bool {
 	rows, err := db.Query(`SELECT * FROM vault WHERE id=$1`, id)
 	if err != nil {
-		log.Printf("Error checking vault item id: %v", err)
+		slog.Error("Error checking vault item id", "error", err)
 		return true
 	}
 
@@ -370,7 +370,7 @@ func AdminFetchVaultFiles(userID string) ([]shared.AdminFileInfoResponse, error)
 	s := `SELECT id, name, length, owner_id, modified FROM vault WHERE owner_id=$1`
 	rows, err := db.Query(s, userID)
 	if err != nil {
-		log.Printf("Error retrieving files: %v\n", err)
+		slog.Error("Error retrieving files", "error", err)
 		return response, err
 	}
 
@@ -448,7 +448,7 @@ func GetFileFolderID(fileID, ownerID string) (string, error) {
 	      END);`
 	rows, err := db.Query(s, fileID, ownerID)
 	if err != nil {
-		log.Printf("Error retrieving folder ID: %v\n", err)
+		slog.Error("Error retrieving folder ID", "error", err)
 		return "", err
 	}
 
@@ -548,7 +548,7 @@ func RetrieveVaultMetadata(id, ownerID string) (FileMetadata, error) {
 	}
 
 	if err != nil {
-		log.Printf("Error retrieving metadata: %v\n", err)
+		slog.Error("Error retrieving metadata", "error", err)
 		return FileMetadata{}, err
 	}
 
@@ -566,7 +566,7 @@ func RetrieveVaultMetadata(id, ownerID string) (FileMetadata, error) {
 			&itemID, &b2ID, &refID, &name,
 			&length, &chunks, &protectedKey, &passwordData)
 		if err != nil {
-			log.Printf("Error scanning rows: %v\n", err)
+			slog.Error("Error scanning rows", "error", err)
 			return FileMetadata{}, err
 		}
 
@@ -585,6 +585,6 @@ func RetrieveVaultMetadata(id, ownerID string) (FileMetadata, error) {
 		}, nil
 	}
 
-	log.Printf("No metadata found for id: %s", id)
+	slog.Info("No metadata found", "id", id)
 	return FileMetadata{}, errors.New("no metadata found")
 }
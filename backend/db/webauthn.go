@@ -0,0 +1,167 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	WebAuthnRegisterChallenge = "register"
+	WebAuthnLoginChallenge    = "login"
+)
+
+var WebAuthnCredentialExists = errors.New("credential already registered")
+
+// WebAuthnCredential is a security key or passkey registered as a second factor.
+// The ID is the base64 (URL encoded) credential ID.
+type WebAuthnCredential struct {
+	ID        string
+	UserID    string
+	Name      string
+	PublicKey []byte
+	SignCount uint32
+	Created   time.Time
+	LastUsed  time.Time
+}
+
+// NewWebAuthnCredential stores a newly registered credential for a user
+func NewWebAuthnCredential(credential WebAuthnCredential) error {
+	s := `INSERT INTO webauthn_credentials
+	      (id, user_id, name, public_key, sign_count, created)
+	      VALUES ($1, $2, $3, $4, $5, $6)
+	      ON CONFLICT DO NOTHING`
+	result, err := db.Exec(s,
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.PublicKey,
+		credential.SignCount,
+		time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return WebAuthnCredentialExists
+	}
+
+	return nil
+}
+
+// GetWebAuthnCredentials returns all credentials registered by a user
+func GetWebAuthnCredentials(userID string) ([]WebAuthnCredential, error) {
+	s := `SELECT id, name, public_key, sign_count, created, last_used
+	      FROM webauthn_credentials
+	      WHERE user_id=$1
+	      ORDER BY created`
+	rows, err := db.Query(s, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var credentials []WebAuthnCredential
+	for rows.Next() {
+		var lastUsed sql.NullTime
+		credential := WebAuthnCredential{UserID: userID}
+		err = rows.Scan(
+			&credential.ID,
+			&credential.Name,
+			&credential.PublicKey,
+			&credential.SignCount,
+			&credential.Created,
+			&lastUsed)
+		if err != nil {
+			return nil, err
+		}
+
+		credential.LastUsed = lastUsed.Time
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// CountWebAuthnCredentials returns the number of credentials a user has
+func CountWebAuthnCredentials(userID string) (int, error) {
+	var count int
+	s := `SELECT COUNT(*) FROM webauthn_credentials WHERE user_id=$1`
+	err := db.QueryRow(s, userID).Scan(&count)
+	return count, err
+}
+
+// UpdateWebAuthnSignCount stores the sign count from the latest assertion made
+// with a credential
+func UpdateWebAuthnSignCount(id, userID string, signCount uint32) error {
+	s := `UPDATE webauthn_credentials
+	      SET sign_count=$3, last_used=$4
+	      WHERE id=$1 AND user_id=$2`
+	_, err := db.Exec(s, id, userID, signCount, time.Now().UTC())
+	return err
+}
+
+// RenameWebAuthnCredential updates the name of one of the user's credentials
+func RenameWebAuthnCredential(id, userID, name string) error {
+	s := `UPDATE webauthn_credentials SET name=$3 WHERE id=$1 AND user_id=$2`
+	result, err := db.Exec(s, id, userID, name)
+	return checkWebAuthnRowUpdated(result, err)
+}
+
+// DeleteWebAuthnCredential revokes one of the user's credentials
+func DeleteWebAuthnCredential(id, userID string) error {
+	s := `DELETE FROM webauthn_credentials WHERE id=$1 AND user_id=$2`
+	result, err := db.Exec(s, id, userID)
+	return checkWebAuthnRowUpdated(result, err)
+}
+
+// NewWebAuthnChallenge stores a challenge that can be used once before its
+// expiration, removing any expired challenges
+func NewWebAuthnChallenge(
+	challenge,
+	userID,
+	purpose string,
+	expiration time.Time,
+) error {
+	s := `DELETE FROM webauthn_challenges WHERE expiration < $1`
+	_, err := db.Exec(s, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	s = `INSERT INTO webauthn_challenges (challenge, user_id, purpose, expiration)
+	     VALUES ($1, $2, $3, $4)`
+	_, err = db.Exec(s, challenge, userID, purpose, expiration.UTC())
+	return err
+}
+
+// ConsumeWebAuthnChallenge removes a challenge, returning true if the challenge
+// existed for the user and purpose and hadn't expired
+func ConsumeWebAuthnChallenge(challenge, userID, purpose string) (bool, error) {
+	s := `DELETE FROM webauthn_challenges
+	      WHERE challenge=$1 AND user_id=$2 AND purpose=$3 AND expiration > $4`
+	result, err := db.Exec(s, challenge, userID, purpose, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func checkWebAuthnRowUpdated(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"yeetfile/backend/utils"
+)
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+type requestIDKey struct{}
+
+// contextHandler adds the ID of the current request (if any) to each record
+// logged with a context, i.e. slog.ErrorContext(req.Context(), ...)
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); len(id) > 0 {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewRequestID generates a random ID for identifying a request in the logs
+func NewRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID returns a copy of the context containing the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID from the context, or an empty string if
+// the context doesn't have one
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// parseLevel returns the log level matching the provided name, defaulting to
+// slog.LevelInfo
+func parseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		slog.Warn("Invalid log level, using 'info' instead", "level", name)
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// newHandler returns a log handler writing to stderr in either text or JSON
+// format at the provided level
+func newHandler(format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case JSONFormat:
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case TextFormat:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		slog.Warn("Invalid log format, using 'text' instead", "format", format)
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	return contextHandler{handler}
+}
+
+func init() {
+	level := parseLevel(utils.GetEnvVar("YEETFILE_LOG_LEVEL", "info"))
+	format := utils.GetEnvVar("YEETFILE_LOG_FORMAT", TextFormat)
+
+	// Also routes anything written with the standard log package through the
+	// new handler
+	slog.SetDefault(slog.New(newHandler(format, level)))
+}
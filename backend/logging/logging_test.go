@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestRequestIDAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)})
+
+	requestID := NewRequestID()
+	ctx := WithRequestID(context.Background(), requestID)
+	logger.InfoContext(ctx, "Request", "method", "GET")
+
+	var record map[string]any
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, requestID, record["request_id"])
+	assert.Equal(t, "GET", record["method"])
+
+	// Records logged without a request ID shouldn't have the attribute
+	buf.Reset()
+	logger.With("service", "vault").Info("Startup")
+
+	record = nil
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.NotContains(t, record, "request_id")
+	assert.Equal(t, "vault", record["service"])
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, parseLevel("debug"))
+	assert.Equal(t, slog.LevelWarn, parseLevel("WARN"))
+	assert.Equal(t, slog.LevelInfo, parseLevel("verbose"))
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"bytes"
+	"text/template"
+)
+
+type StorageScrubEmail struct {
+	Domain   string
+	Failures []string
+}
+
+var storageScrubSubject = "YeetFile storage integrity check failed"
+var storageScrubBodyTemplate = template.Must(template.New("").Parse(
+	"The YeetFile storage integrity check on {{.Domain}} found the " +
+		"following corrupted or missing file(s):\n\n" +
+		"{{range .Failures}}- {{.}}\n{{end}}\n" +
+		"The full list of failed files is available from the admin API " +
+		"and in the storage_scrub table.\n\n- YeetFile"))
+
+// SendStorageScrubEmail notifies the instance admin of stored files that
+// failed an integrity check.
+func SendStorageScrubEmail(to string, failures []string) error {
+	var buf bytes.Buffer
+
+	scrubEmail := StorageScrubEmail{
+		Domain:   smtpConfig.CallbackDomain,
+		Failures: failures,
+	}
+
+	_ = storageScrubBodyTemplate.Execute(&buf, scrubEmail)
+	body := buf.String()
+
+	go sendEmail(to, storageScrubSubject, body)
+	return nil
+}
@@ -4,7 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"gopkg.in/gomail.v2"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"yeetfile/backend/config"
@@ -27,7 +27,7 @@ type SMTPConfig struct {
 func sendEmail(to string, subject string, body string) {
 	if smtpConfig == (SMTPConfig{}) {
 		// SMTP hasn't been configured, ignore this request
-		log.Println("Attempted to send email, but SMTP hasn't been configured")
+		slog.Info("Attempted to send email, but SMTP hasn't been configured")
 		return
 	}
 
@@ -45,7 +45,7 @@ func sendEmail(to string, subject string, body string) {
 func sendBccEmail(subject, body string, recipients []string) {
 	if smtpConfig == (SMTPConfig{}) {
 		// SMTP hasn't been configured, ignore this request
-		log.Println("Attempted to send email, but SMTP hasn't been configured")
+		slog.Info("Attempted to send email, but SMTP hasn't been configured")
 		return
 	}
 
@@ -71,9 +71,9 @@ func send(message *gomail.Message) {
 	err := d.DialAndSend(message)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		log.Println("Failed to send email")
+		slog.Error("Failed to send email")
 	} else {
-		log.Println("Email sent!")
+		slog.Info("Email sent!")
 	}
 }
 
@@ -84,8 +84,9 @@ func init() {
 
 	port, err := strconv.Atoi(config.YeetFileConfig.Email.Port)
 	if err != nil {
-		log.Printf("Unable to read email port as int: \"%s\"", config.YeetFileConfig.Email.Port)
-		log.Println("Skipping SMTP setup...")
+		slog.Error("Unable to read email port as int",
+			"port", config.YeetFileConfig.Email.Port)
+		slog.Info("Skipping SMTP setup...")
 		return
 	}
 
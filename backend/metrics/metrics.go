@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "yeetfile"
+
+// Services and directions for transfer metrics
+const (
+	Send     = "send"
+	Vault    = "vault"
+	Upload   = "upload"
+	Download = "download"
+)
+
+// Limiter types for rate limiting metrics
+const (
+	IPLimiter      = "ip"
+	SessionLimiter = "session"
+)
+
+// UnmatchedRoute is the route label used for requests that didn't match any
+// route on the server
+const UnmatchedRoute = "none"
+
+// Registry contains every YeetFile metric, along with the standard Go runtime
+// and process metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests handled, by route, method, and status.",
+	}, []string{"route", "method", "status"})
+
+	requestDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route and method.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method"})
+
+	transferBytes = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_bytes_total",
+		Help:      "Bytes of encrypted file data transferred through the server, by service and direction.",
+	}, []string{"service", "direction"})
+
+	cacheLookups = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Number of file chunk lookups in the download cache, by result.",
+	}, []string{"result"})
+
+	storageErrors = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Number of errors returned by the storage backend, by backend and operation.",
+	}, []string{"backend", "operation"})
+
+	cronDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cron_task_duration_seconds",
+		Help:      "Time taken to run background cron tasks, by task.",
+		Buckets:   prometheus.ExponentialBuckets(.01, 4, 10),
+	}, []string{"task"})
+
+	limiterRejections = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "limiter_rejections_total",
+		Help:      "Number of requests rejected by rate limiting, by limiter type.",
+	}, []string{"limiter"})
+)
+
+// ObserveRequest records a handled HTTP request for the route (the pattern the
+// request matched, not the full path)
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+// AddTransferBytes records bytes uploaded or downloaded for Send or Vault
+func AddTransferBytes(service, direction string, n int64) {
+	if n > 0 {
+		transferBytes.WithLabelValues(service, direction).Add(float64(n))
+	}
+}
+
+// RecordCacheLookup records whether a requested file chunk was found in the
+// download cache
+func RecordCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	cacheLookups.WithLabelValues(result).Inc()
+}
+
+// RecordStorageError records an error returned by a storage backend operation
+func RecordStorageError(backend, operation string) {
+	storageErrors.WithLabelValues(backend, operation).Inc()
+}
+
+// ObserveCronTask records the amount of time taken to run a cron task
+func ObserveCronTask(task string, duration time.Duration) {
+	cronDuration.WithLabelValues(task).Observe(duration.Seconds())
+}
+
+// RecordLimiterRejection records a request that was rejected by rate limiting
+func RecordLimiterRejection(limiter string) {
+	limiterRejections.WithLabelValues(limiter).Inc()
+}
+
+// Serve exposes the metrics at /metrics on a separate listener from the rest of
+// the server, so that they aren't publicly accessible
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+
+	slog.Info("Metrics enabled", "url", "http://"+addr+"/metrics")
+	err := http.ListenAndServe(addr, mux)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Metrics listener returned err", "error", err)
+	}
+}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestObserveRequest(t *testing.T) {
+	ObserveRequest("/api/vault/d/{id}", http.MethodGet, http.StatusOK, time.Millisecond)
+	ObserveRequest("/api/vault/d/{id}", http.MethodGet, http.StatusOK, time.Millisecond)
+	ObserveRequest(UnmatchedRoute, http.MethodGet, http.StatusNotFound, time.Millisecond)
+
+	ok := requests.WithLabelValues("/api/vault/d/{id}", http.MethodGet, "200")
+	notFound := requests.WithLabelValues(UnmatchedRoute, http.MethodGet, "404")
+	assert.Equal(t, float64(2), testutil.ToFloat64(ok))
+	assert.Equal(t, float64(1), testutil.ToFloat64(notFound))
+}
+
+func TestAddTransferBytes(t *testing.T) {
+	AddTransferBytes(Vault, Upload, 1024)
+	AddTransferBytes(Vault, Upload, 0)
+	AddTransferBytes(Send, Download, 512)
+
+	vaultUpload := transferBytes.WithLabelValues(Vault, Upload)
+	sendDownload := transferBytes.WithLabelValues(Send, Download)
+	assert.Equal(t, float64(1024), testutil.ToFloat64(vaultUpload))
+	assert.Equal(t, float64(512), testutil.ToFloat64(sendDownload))
+}
+
+func TestRecordCacheLookup(t *testing.T) {
+	RecordCacheLookup(true)
+	RecordCacheLookup(true)
+	RecordCacheLookup(false)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(cacheLookups.WithLabelValues("hit")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(cacheLookups.WithLabelValues("miss")))
+}
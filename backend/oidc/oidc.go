@@ -0,0 +1,245 @@
+// Package oidc implements the parts of OpenID Connect needed to log users in
+// with an external identity provider: provider discovery, the authorization
+// code flow (with PKCE), and ID token verification.
+//
+// Only RS256 signed ID tokens are supported, since it's the one algorithm that
+// every provider is required to support.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+
+	randomLen       = 32
+	maxResponseSize = 1024 * 1024
+	requestTimeout  = 10 * time.Second
+)
+
+var (
+	DiscoveryErr = errors.New("invalid provider configuration")
+	ExchangeErr  = errors.New("authorization code exchange failed")
+)
+
+// Provider is an OpenID Connect identity provider that users are sent to in
+// order to log in. The provider's endpoints and signing keys are fetched from
+// the issuer the first time they're needed.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Client       *http.Client
+
+	mu          sync.Mutex
+	config      *providerConfig
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+type providerConfig struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// AuthRequest contains the values for a single login attempt, which need to be
+// kept by the server until the user is redirected back from the provider. The
+// state is sent back to the redirect URL as-is, the nonce is included in the
+// ID token, and the verifier is sent when exchanging the authorization code.
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// NewProvider returns a provider for the issuer. The redirect URL must match
+// one of the redirect URLs registered with the provider for the client.
+func NewProvider(issuer, clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Client:       &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// NewAuthRequest generates random values for a new login attempt
+func NewAuthRequest() (AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value := make([]byte, randomLen)
+		if _, err := rand.Read(value); err != nil {
+			return AuthRequest{}, err
+		}
+
+		values[i] = base64.RawURLEncoding.EncodeToString(value)
+	}
+
+	return AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2]}, nil
+}
+
+// CodeChallenge returns the PKCE (S256) challenge for a verifier
+func CodeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthCodeURL returns the URL to send the user to in order to log in with the
+// provider
+func (p *Provider) AuthCodeURL(ctx context.Context, authReq AuthRequest) (string, error) {
+	config, err := p.getConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(config.AuthURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", DiscoveryErr, err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", "openid email profile")
+	query.Set("state", authReq.State)
+	query.Set("nonce", authReq.Nonce)
+	query.Set("code_challenge", CodeChallenge(authReq.Verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange trades the authorization code that the provider sent to the
+// redirect URL for an ID token, and returns the token's claims after verifying
+// it against the login attempt
+func (p *Provider) Exchange(
+	ctx context.Context,
+	code string,
+	authReq AuthRequest,
+) (Claims, error) {
+	config, err := p.getConfig(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {authReq.Verifier},
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		config.TokenURL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token)
+	if resp.StatusCode != http.StatusOK || len(token.Error) > 0 {
+		return Claims{}, fmt.Errorf("%w: %d %s %s", ExchangeErr,
+			resp.StatusCode, token.Error, token.ErrorDescription)
+	} else if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ExchangeErr, err)
+	} else if len(token.IDToken) == 0 {
+		return Claims{}, fmt.Errorf("%w: missing ID token", ExchangeErr)
+	}
+
+	return p.Verify(ctx, token.IDToken, authReq.Nonce)
+}
+
+// getConfig returns the provider's configuration, fetching it from the
+// discovery document if it hasn't been fetched yet
+func (p *Provider) getConfig(ctx context.Context) (*providerConfig, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config != nil {
+		return p.config, nil
+	}
+
+	var config providerConfig
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+DiscoveryPath, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%w: issuer is %s, expected %s",
+			DiscoveryErr, config.Issuer, p.Issuer)
+	} else if len(config.AuthURL) == 0 ||
+		len(config.TokenURL) == 0 ||
+		len(config.JWKSURL) == 0 {
+		return nil, fmt.Errorf("%w: missing provider endpoints", DiscoveryErr)
+	}
+
+	p.config = &config
+	return p.config, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", DiscoveryErr, target, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %v", DiscoveryErr, err)
+	}
+
+	return nil
+}
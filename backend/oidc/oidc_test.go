@@ -0,0 +1,223 @@
+package oidc
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"yeetfile/backend/oidc/oidctest"
+)
+
+const (
+	testClientID     = "yeetfile"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "http://localhost:8090/sso/callback"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Provider) {
+	mock, err := oidctest.NewProvider(testClientID, testClientSecret)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	mock.Issuer = server.URL
+	mock.User = oidctest.User{
+		Subject:       "user-1",
+		Email:         "user@example.com",
+		EmailVerified: true,
+	}
+
+	provider := NewProvider(server.URL, testClientID, testClientSecret, testRedirectURL)
+	return provider, mock
+}
+
+// login logs in with the mock provider, returning the claims from the
+// verified ID token
+func login(t *testing.T, provider *Provider, mock *oidctest.Provider) (Claims, error) {
+	ctx := context.Background()
+	authReq, err := NewAuthRequest()
+	assert.Nil(t, err)
+
+	authURL, err := provider.AuthCodeURL(ctx, authReq)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	code, state, err := mock.Authorize(authURL)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, authReq.State, state)
+	return provider.Exchange(ctx, code, authReq)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	provider, _ := newTestProvider(t)
+	authReq, err := NewAuthRequest()
+	assert.Nil(t, err)
+	assert.NotEqual(t, authReq.State, authReq.Nonce)
+	assert.NotEqual(t, authReq.Nonce, authReq.Verifier)
+
+	authURL, err := provider.AuthCodeURL(context.Background(), authReq)
+	assert.Nil(t, err)
+
+	parsed, err := url.Parse(authURL)
+	assert.Nil(t, err)
+	assert.Equal(t, provider.Issuer+oidctest.AuthPath, parsed.Scheme+"://"+parsed.Host+parsed.Path)
+
+	query := parsed.Query()
+	assert.Equal(t, testClientID, query.Get("client_id"))
+	assert.Equal(t, testRedirectURL, query.Get("redirect_uri"))
+	assert.Equal(t, authReq.State, query.Get("state"))
+	assert.Equal(t, authReq.Nonce, query.Get("nonce"))
+	assert.Equal(t, CodeChallenge(authReq.Verifier), query.Get("code_challenge"))
+	assert.NotContains(t, authURL, authReq.Verifier)
+}
+
+func TestLogin(t *testing.T) {
+	provider, mock := newTestProvider(t)
+	claims, err := login(t, provider, mock)
+	assert.Nil(t, err)
+	assert.Equal(t, "user-1", claims.Subject)
+	assert.Equal(t, "user@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, Audience{testClientID}, claims.Audience)
+}
+
+func TestDiscovery(t *testing.T) {
+	provider, mock := newTestProvider(t)
+	ctx := context.Background()
+
+	// The discovery document must be for the configured issuer
+	issuer := mock.Issuer
+	mock.Issuer = "https://idp.example.com"
+	_, err := provider.AuthCodeURL(ctx, AuthRequest{})
+	assert.ErrorIs(t, err, DiscoveryErr)
+
+	// Failed discovery is retried
+	mock.Issuer = issuer
+	_, err = provider.AuthCodeURL(ctx, AuthRequest{})
+	assert.Nil(t, err)
+
+	otherProvider := NewProvider(issuer+"/missing", testClientID, testClientSecret, testRedirectURL)
+	_, err = otherProvider.AuthCodeURL(ctx, AuthRequest{})
+	assert.ErrorIs(t, err, DiscoveryErr)
+}
+
+func TestExchange(t *testing.T) {
+	provider, mock := newTestProvider(t)
+	ctx := context.Background()
+	authReq, _ := NewAuthRequest()
+	authURL, _ := provider.AuthCodeURL(ctx, authReq)
+
+	// The verifier must match the challenge sent to the provider
+	code, _, err := mock.Authorize(authURL)
+	assert.Nil(t, err)
+	otherReq, _ := NewAuthRequest()
+	_, err = provider.Exchange(ctx, code, AuthRequest{
+		State:    authReq.State,
+		Nonce:    authReq.Nonce,
+		Verifier: otherReq.Verifier,
+	})
+	assert.ErrorIs(t, err, ExchangeErr)
+
+	// Codes can only be used once
+	code, _, _ = mock.Authorize(authURL)
+	_, err = provider.Exchange(ctx, code, authReq)
+	assert.Nil(t, err)
+	_, err = provider.Exchange(ctx, code, authReq)
+	assert.ErrorIs(t, err, ExchangeErr)
+
+	// The nonce must match the nonce sent to the provider
+	code, _, _ = mock.Authorize(authURL)
+	_, err = provider.Exchange(ctx, code, AuthRequest{
+		Nonce:    otherReq.Nonce,
+		Verifier: authReq.Verifier,
+	})
+	assert.ErrorIs(t, err, NonceMismatchErr)
+
+	// The client secret must be correct
+	code, _, _ = mock.Authorize(authURL)
+	provider.ClientSecret = "wrong"
+	_, err = provider.Exchange(ctx, code, authReq)
+	assert.ErrorIs(t, err, ExchangeErr)
+}
+
+func TestVerifyClaims(t *testing.T) {
+	provider, mock := newTestProvider(t)
+	now := time.Now()
+
+	tests := []struct {
+		claims map[string]any
+		err    error
+	}{
+		{map[string]any{"iss": "https://idp.example.com"}, IssuerMismatchErr},
+		{map[string]any{"aud": "other-client"}, AudienceMismatchErr},
+		{map[string]any{"aud": []string{"other-client", testClientID}}, AudienceMismatchErr},
+		{map[string]any{"exp": now.Add(-time.Hour).Unix()}, TokenExpiredErr},
+		{map[string]any{"iat": now.Add(time.Hour).Unix()}, InvalidTokenErr},
+		{map[string]any{"sub": ""}, InvalidTokenErr},
+		{map[string]any{
+			"aud": []string{"other-client", testClientID},
+			"azp": testClientID,
+		}, nil},
+	}
+
+	for _, test := range tests {
+		mock.Claims = test.claims
+		_, err := login(t, provider, mock)
+		if test.err == nil {
+			assert.Nil(t, err, test.claims)
+		} else {
+			assert.ErrorIs(t, err, test.err, test.claims)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	provider, mock := newTestProvider(t)
+	ctx := context.Background()
+	token, err := mock.SignIDToken(map[string]any{
+		"iss":   mock.Issuer,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": "nonce",
+	})
+	assert.Nil(t, err)
+
+	_, err = provider.Verify(ctx, token, "nonce")
+	assert.Nil(t, err)
+
+	// Tokens signed by another provider's key are rejected
+	otherMock, _ := oidctest.NewProvider(testClientID, testClientSecret)
+	otherMock.Issuer = mock.Issuer
+	otherToken, _ := otherMock.SignIDToken(map[string]any{
+		"iss":   mock.Issuer,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": "nonce",
+	})
+
+	_, err = provider.Verify(ctx, otherToken, "nonce")
+	assert.ErrorIs(t, err, InvalidSignatureErr)
+
+	// Unsigned tokens are rejected
+	parts := strings.Split(token, ".")
+	unsigned := "eyJhbGciOiJub25lIn0." + parts[1] + "."
+	_, err = provider.Verify(ctx, unsigned, "nonce")
+	assert.ErrorIs(t, err, UnsupportedAlgErr)
+
+	_, err = provider.Verify(ctx, "not-a-token", "nonce")
+	assert.ErrorIs(t, err, InvalidTokenErr)
+}
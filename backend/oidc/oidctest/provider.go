@@ -0,0 +1,276 @@
+// Package oidctest provides a mock OpenID Connect provider for testing single
+// sign-on without an external identity provider. Users are logged in as soon
+// as they visit the authorization endpoint, without being prompted.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration"
+	AuthPath      = "/authorize"
+	TokenPath     = "/token"
+	JWKSPath      = "/jwks"
+
+	keyID    = "oidctest"
+	tokenTTL = time.Hour
+)
+
+// User is the identity returned by the provider
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is a mock OpenID Connect provider with a single RSA signing key.
+// It implements http.Handler, and the issuer should be set to the URL that
+// it's served from.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// User is the user that's logged in when the authorization endpoint is
+	// visited
+	User User
+
+	// Claims are added to (or replace) the claims in each ID token, i.e. to
+	// issue expired tokens or tokens for another audience
+	Claims map[string]any
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+type authCode struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	user        User
+}
+
+func NewProvider(clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		codes:        make(map[string]authCode),
+	}, nil
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case DiscoveryPath:
+		p.discoveryHandler(w)
+	case AuthPath:
+		p.authHandler(w, req)
+	case TokenPath:
+		p.tokenHandler(w, req)
+	case JWKSPath:
+		p.jwksHandler(w)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// Authorize visits the authorization URL as a browser would, returning the
+// code and state that the provider sends to the redirect URL
+func (p *Provider) Authorize(authURL string) (string, string, error) {
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, authURL, nil))
+	if recorder.Code != http.StatusFound {
+		return "", "", errors.New(strings.TrimSpace(recorder.Body.String()))
+	}
+
+	redirect, err := url.Parse(recorder.Header().Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+
+	return redirect.Query().Get("code"), redirect.Query().Get("state"), nil
+}
+
+// SignIDToken signs an ID token with the provided claims
+func (p *Provider) SignIDToken(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *Provider) discoveryHandler(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + AuthPath,
+		"token_endpoint":                        p.Issuer + TokenPath,
+		"jwks_uri":                              p.Issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) authHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != p.ClientID || len(redirectURI) == 0 {
+		http.Error(w, "Invalid client or redirect URI", http.StatusBadRequest)
+		return
+	} else if query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" ||
+		!strings.Contains(query.Get("scope"), "openid") {
+		http.Error(w, "Invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authCode{
+		redirectURI: redirectURI,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		user:        p.User,
+	}
+	p.mu.Unlock()
+
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	redirectQuery := redirect.Query()
+	redirectQuery.Set("code", code)
+	redirectQuery.Set("state", query.Get("state"))
+	redirect.RawQuery = redirectQuery.Encode()
+	http.Redirect(w, req, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) tokenHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, _ := req.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if req.Method != http.MethodPost ||
+		clientID != p.ClientID ||
+		clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := req.PostFormValue("code")
+	p.mu.Lock()
+	request, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !ok ||
+		req.PostFormValue("grant_type") != "authorization_code" ||
+		req.PostFormValue("redirect_uri") != request.redirectURI ||
+		codeChallenge(req.PostFormValue("code_verifier")) != request.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":            p.Issuer,
+		"sub":            request.user.Subject,
+		"aud":            p.ClientID,
+		"exp":            now.Add(tokenTTL).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          request.nonce,
+		"email":          request.user.Email,
+		"email_verified": request.user.EmailVerified,
+		"name":           request.user.Name,
+	}
+
+	for claim, value := range p.Claims {
+		claims[claim] = value
+	}
+
+	idToken, err := p.SignIDToken(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) jwksHandler(w http.ResponseWriter) {
+	e := big.NewInt(int64(p.key.E)).Bytes()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(e),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func codeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func randomString() string {
+	value := make([]byte, 16)
+	_, _ = rand.Read(value)
+	return base64.RawURLEncoding.EncodeToString(value)
+}
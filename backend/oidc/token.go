@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	signingAlg = "RS256"
+
+	// Leeway for differences between the server and provider clocks
+	clockSkew = time.Minute
+
+	// Minimum time between fetching the provider's keys when a token is
+	// signed with an unknown key
+	keyRefreshInterval = 5 * time.Minute
+)
+
+var (
+	InvalidTokenErr     = errors.New("invalid ID token")
+	UnsupportedAlgErr   = errors.New("unsupported ID token signing algorithm")
+	UnknownKeyErr       = errors.New("ID token signed with unknown key")
+	InvalidSignatureErr = errors.New("invalid ID token signature")
+	IssuerMismatchErr   = errors.New("ID token issuer mismatch")
+	AudienceMismatchErr = errors.New("ID token audience mismatch")
+	TokenExpiredErr     = errors.New("ID token expired")
+	NonceMismatchErr    = errors.New("ID token nonce mismatch")
+)
+
+// Claims are the verified claims from an ID token
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        Audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	Expiry          int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	EmailVerified   bool     `json:"email_verified,omitempty"`
+	Name            string   `json:"name,omitempty"`
+}
+
+// Audience is the "aud" claim of an ID token, which can be either a single
+// string or an array of strings
+type Audience []string
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+
+	*a = multiple
+	return nil
+}
+
+// Verify checks the signature and claims of an ID token issued by the
+// provider for the client, returning the token's claims if it's valid. The
+// nonce must match the nonce sent when the user was sent to the provider.
+func (p *Provider) Verify(ctx context.Context, rawToken, nonce string) (Claims, error) {
+	config, err := p.getConfig(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, InvalidTokenErr
+	}
+
+	var header tokenHeader
+	if err = decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	} else if header.Alg != signingAlg {
+		return Claims{}, fmt.Errorf("%w: %s", UnsupportedAlgErr, header.Alg)
+	}
+
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, InvalidTokenErr
+	}
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) != nil {
+		return Claims{}, InvalidSignatureErr
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+
+	now := time.Now()
+	if claims.Issuer != config.Issuer {
+		return Claims{}, IssuerMismatchErr
+	} else if !slices.Contains(claims.Audience, p.ClientID) ||
+		(len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID) {
+		return Claims{}, AudienceMismatchErr
+	} else if now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return Claims{}, TokenExpiredErr
+	} else if time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return Claims{}, fmt.Errorf("%w: issued in the future", InvalidTokenErr)
+	} else if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return Claims{}, NonceMismatchErr
+	} else if len(claims.Subject) == 0 {
+		return Claims{}, fmt.Errorf("%w: missing subject", InvalidTokenErr)
+	}
+
+	return claims, nil
+}
+
+// getKey returns the provider's signing key with the provided key ID. The
+// provider's keys are fetched again if the key ID isn't known, in case the
+// provider has rotated its keys.
+func (p *Provider) getKey(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	config, err := p.getConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.findKey(keyID); key != nil {
+		return key, nil
+	} else if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, UnknownKeyErr
+	}
+
+	var keySet jsonWebKeySet
+	if err = p.getJSON(ctx, config.JWKSURL, &keySet); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.Kty != "RSA" || (len(jwk.Use) > 0 && jwk.Use != "sig") {
+			continue
+		}
+
+		key, err := parseRSAKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key := p.findKey(keyID); key != nil {
+		return key, nil
+	}
+
+	return nil, UnknownKeyErr
+}
+
+// findKey returns the known key matching the key ID. Tokens without a key ID
+// are only accepted if the provider has a single key.
+func (p *Provider) findKey(keyID string) *rsa.PublicKey {
+	if len(keyID) == 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+
+	return p.keys[keyID]
+}
+
+func parseRSAKey(jwk jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid key modulus", DiscoveryErr)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("%w: invalid key exponent", DiscoveryErr)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(exponent.Int64()),
+	}, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return InvalidTokenErr
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", InvalidTokenErr, err)
+	}
+
+	return nil
+}
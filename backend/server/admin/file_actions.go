@@ -2,7 +2,7 @@ package admin
 
 import (
 	"database/sql"
-	"log"
+	"log/slog"
 	"yeetfile/backend/db"
 	"yeetfile/backend/storage"
 	"yeetfile/shared"
@@ -14,7 +14,7 @@ func deleteFile(fileID string) error {
 		// Delete vault file
 		err = db.AdminDeleteFile(fileID)
 		if err != nil {
-			log.Printf("Error deleting file: %v\n", err)
+			slog.Error("Error deleting file", "error", err)
 			return err
 		}
 
@@ -3,15 +3,14 @@ package admin
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
+	"yeetfile/backend/db"
 	"yeetfile/shared"
 )
 
 func UserActionHandler(w http.ResponseWriter, req *http.Request, id string) {
-	segments := strings.Split(req.URL.Path, "/")
-	userID := segments[len(segments)-1]
+	userID := req.PathValue("id")
 
 	if userID == id {
 		http.Error(w, "Cannot fetch yourself", http.StatusBadRequest)
@@ -22,14 +21,14 @@ func UserActionHandler(w http.ResponseWriter, req *http.Request, id string) {
 	case http.MethodDelete:
 		err := deleteUser(userID)
 		if err != nil {
-			log.Printf("Error deleting user: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error deleting user", "error", err)
 			http.Error(w, "Failed to delete user", http.StatusInternalServerError)
 			return
 		}
 	case http.MethodGet:
 		user, err := getUserInfo(userID)
 		if err != nil {
-			log.Printf("Error fetching user: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error fetching user", "error", err)
 			if err == sql.ErrNoRows {
 				http.Error(w, "No match found", http.StatusNotFound)
 				return
@@ -54,8 +53,7 @@ func UserActionHandler(w http.ResponseWriter, req *http.Request, id string) {
 }
 
 func FileActionHandler(w http.ResponseWriter, req *http.Request, _ string) {
-	segments := strings.Split(req.URL.Path, "/")
-	fileID := segments[len(segments)-1]
+	fileID := req.PathValue("id")
 
 	switch req.Method {
 	case http.MethodDelete:
@@ -70,7 +68,7 @@ func FileActionHandler(w http.ResponseWriter, req *http.Request, _ string) {
 			http.Error(w, "No match found", http.StatusNotFound)
 			return
 		} else if err != nil {
-			log.Printf("Error fetching file metadata: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error fetching file metadata", "error", err)
 			http.Error(w, "Error fetching file metadata", http.StatusInternalServerError)
 			return
 		}
@@ -79,3 +77,14 @@ func FileActionHandler(w http.ResponseWriter, req *http.Request, _ string) {
 	}
 
 }
+
+func StorageScrubHandler(w http.ResponseWriter, _ *http.Request, _ string) {
+	results, err := db.GetScrubFailures()
+	if err != nil {
+		slog.Error("Error fetching storage scrub results", "error", err)
+		http.Error(w, "Error fetching scrub results", http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(results)
+}
@@ -1,7 +1,7 @@
 package admin
 
 import (
-	"log"
+	"log/slog"
 	"strings"
 	"yeetfile/backend/db"
 	"yeetfile/backend/server/auth"
@@ -20,14 +20,14 @@ func fetchAllFiles(userID string) []shared.AdminFileInfoResponse {
 	files := []shared.AdminFileInfoResponse{}
 	vaultFiles, err := db.AdminFetchVaultFiles(userID)
 	if err != nil {
-		log.Printf("Error fetching user files: %v\n", err)
+		slog.Error("Error fetching user files", "error", err)
 	}
 
 	files = append(files, vaultFiles...)
 
 	sendFiles, err := db.AdminFetchSentFiles(userID)
 	if err != nil {
-		log.Printf("Error fetching user send files: %v\n", err)
+		slog.Error("Error fetching user send files", "error", err)
 	}
 
 	files = append(files, sendFiles...)
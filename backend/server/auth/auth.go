@@ -3,12 +3,14 @@ package auth
 import (
 	"errors"
 	"golang.org/x/crypto/bcrypt"
-	"log"
+	"log/slog"
 	"strings"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
 	"yeetfile/backend/server/transfer/vault"
+	"yeetfile/backend/webauthn"
 	"yeetfile/shared"
+	"yeetfile/shared/constants"
 )
 
 var (
@@ -16,13 +18,36 @@ var (
 	Failed2FAErr  = errors.New("TOTP code failed")
 )
 
+// SecondFactor is the second factor provided when logging in, either a TOTP
+// (or recovery) code or an assertion from one of the user's security keys
+type SecondFactor struct {
+	Code     string
+	WebAuthn *shared.WebAuthnAssertion
+	RP       webauthn.RelyingParty
+}
+
+// checkServerPassword returns true if the password matches the server password
+// required to create new accounts, or if the server doesn't have a password
+func checkServerPassword(password string) bool {
+	if config.YeetFileConfig.PasswordHash == nil {
+		return true
+	}
+
+	err := bcrypt.CompareHashAndPassword(
+		config.YeetFileConfig.PasswordHash,
+		[]byte(password))
+	return err == nil
+}
+
 // ValidateCredentials checks the provided key hash against the one stored in
 // the database, and if there's a match, returns the user's true account ID.
+// If factor is nil, the user's second factor isn't checked. If the user has a
+// second factor but didn't provide one, the account ID is returned along with
+// Missing2FAErr.
 func ValidateCredentials(
 	identifier string,
 	keyHash []byte,
-	code string,
-	validate2FA bool,
+	factor *SecondFactor,
 ) (string, error) {
 	var userID string
 	var pwHash []byte
@@ -52,9 +77,11 @@ func ValidateCredentials(
 		return "", err
 	}
 
-	if secret != nil && len(secret) > 0 && validate2FA {
-		err = validateTOTP(secret, code, userID)
-		if err != nil {
+	if factor != nil {
+		err = validate2FA(userID, secret, *factor)
+		if err == Missing2FAErr {
+			return userID, err
+		} else if err != nil {
 			return "", err
 		}
 	}
@@ -62,6 +89,31 @@ func ValidateCredentials(
 	return userID, nil
 }
 
+// validate2FA checks the provided second factor against the user's TOTP secret
+// and security keys. Recovery codes are accepted in place of either.
+func validate2FA(userID string, secret []byte, factor SecondFactor) error {
+	keys, err := db.CountWebAuthnCredentials(userID)
+	if err != nil {
+		return err
+	}
+
+	hasTOTP := len(secret) > 0
+	if !hasTOTP && keys == 0 {
+		return nil
+	}
+
+	if factor.WebAuthn != nil && keys > 0 {
+		return validateWebAuthn(userID, factor.RP, *factor.WebAuthn)
+	} else if len(factor.Code) == constants.RecoveryCodeLen ||
+		(len(factor.Code) > 0 && hasTOTP) {
+		return validateTOTP(secret, factor.Code, userID)
+	} else if len(factor.Code) > 0 {
+		return Failed2FAErr
+	}
+
+	return Missing2FAErr
+}
+
 func createNewUser(values db.VerifiedAccountValues) (string, error) {
 	var id string
 	var err error
@@ -86,21 +138,21 @@ func createNewUser(values db.VerifiedAccountValues) (string, error) {
 	}
 
 	if err != nil {
-		log.Printf("Error initializing new account: %v\n", err)
+		slog.Error("Error initializing new account", "error", err)
 		return "", err
 	}
 
 	// Initialize user's root vault folder
 	err = db.NewRootFolder(id, values.ProtectedVaultFolderKey)
 	if err != nil {
-		log.Printf("Error initializing user vault: %v\n", err)
+		slog.Error("Error initializing user vault", "error", err)
 		return "", err
 	}
 
 	// Initialize user pass metadata index
 	err = db.InitPassIndex(id)
 	if err != nil {
-		log.Printf("Error initializing password index: %v\n", err)
+		slog.Error("Error initializing password index", "error", err)
 		return "", err
 	}
 
@@ -142,19 +194,19 @@ func DeleteUser(id string, deleteAccount shared.DeleteAccount) error {
 	}
 
 	if err != nil || accountID != id {
-		log.Printf("Error validating account for deletion: %v\n", err)
+		slog.Error("Error validating account for deletion", "error", err)
 		return errors.New("error validating account")
 	}
 
 	_, err = vault.DeleteVaultFolder(id, id, false, false)
 	if err != nil {
-		log.Printf("Error deleting user root folder: %v\n", err)
+		slog.Error("Error deleting user root folder", "error", err)
 		return err
 	}
 
 	err = db.DeleteUser(id)
 	if err != nil {
-		log.Printf("Error deleting user: %v\n", err)
+		slog.Error("Error deleting user", "error", err)
 		return err
 	}
 
@@ -3,7 +3,7 @@ package auth
 import (
 	"encoding/json"
 	"golang.org/x/crypto/bcrypt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"yeetfile/backend/config"
@@ -20,19 +20,36 @@ import (
 func LoginHandler(w http.ResponseWriter, req *http.Request) {
 	var login shared.Login
 	if utils.LimitedJSONReader(w, req.Body).Decode(&login) != nil {
-		log.Printf("Error decoding login request")
+		slog.ErrorContext(req.Context(), "Error decoding login request")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	userID, err := ValidateCredentials(login.Identifier, login.LoginKeyHash, login.Code, true)
-	if err != nil {
+	rp := relyingParty(req)
+	userID, err := ValidateCredentials(login.Identifier, login.LoginKeyHash, &SecondFactor{
+		Code:     login.Code,
+		WebAuthn: login.WebAuthn,
+		RP:       rp,
+	})
+	if (err == nil || err == Missing2FAErr) && requiresSSO(userID) {
+		http.Error(w, "This account logs in with single sign-on", http.StatusUnauthorized)
+		return
+	} else if err != nil {
 		if err == Missing2FAErr {
-			log.Printf("Error: Missing TOTP")
-			http.Error(w, "TOTP required", http.StatusForbidden)
+			slog.InfoContext(req.Context(), "Missing TOTP")
+			challenge, err := twoFactorChallenge(userID, rp)
+			if err != nil {
+				slog.ErrorContext(req.Context(), "Error creating 2FA challenge", "error", err)
+				http.Error(w, "Error creating 2FA challenge", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(challenge)
 			return
 		} else if err == Failed2FAErr {
-			log.Printf("Error: Incorrect TOTP")
+			slog.InfoContext(req.Context(), "Incorrect TOTP")
 			http.Error(w, "TOTP incorrect", http.StatusForbidden)
 			return
 		}
@@ -59,22 +76,22 @@ func LoginHandler(w http.ResponseWriter, req *http.Request) {
 func SignupHandler(w http.ResponseWriter, req *http.Request) {
 	var signupData shared.Signup
 	if utils.LimitedJSONReader(w, req.Body).Decode(&signupData) != nil {
-		log.Printf("Unable to parse shared.Signup request\n")
+		slog.ErrorContext(req.Context(), "Unable to parse shared.Signup request")
 		http.Error(w, "Unable to parse request", http.StatusBadRequest)
 		return
 	}
 
+	if config.YeetFileConfig.OIDC.SignupOnly {
+		http.Error(w, "Signup is only available with single sign-on", http.StatusNotFound)
+		return
+	}
+
 	// Check if server has a password
-	if config.YeetFileConfig.PasswordHash != nil {
-		err := bcrypt.CompareHashAndPassword(
-			config.YeetFileConfig.PasswordHash,
-			[]byte(signupData.ServerPassword))
-		if err != nil {
-			w.WriteHeader(http.StatusForbidden)
-			_, _ = w.Write([]byte("Missing or invalid server password"))
-			return
-		}
-	} else {
+	if !checkServerPassword(signupData.ServerPassword) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Missing or invalid server password"))
+		return
+	} else if config.YeetFileConfig.PasswordHash == nil {
 		signupData.ServerPassword = "-"
 	}
 
@@ -90,7 +107,7 @@ func SignupHandler(w http.ResponseWriter, req *http.Request) {
 			response = shared.SignupResponse{
 				Error: "Error creating account ID",
 			}
-			log.Printf("Error: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error creating account ID", "error", err)
 		} else {
 			response = shared.SignupResponse{
 				Identifier: id,
@@ -106,7 +123,8 @@ func SignupHandler(w http.ResponseWriter, req *http.Request) {
 
 		err := SignupWithEmail(signupData)
 		if err != nil && err != db.VerificationCodeExistsError {
-			log.Printf("Error creating (email) account: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error creating (email) account",
+				"error", err)
 			errMsg := "Error creating account"
 			if err == db.UserAlreadyExists {
 				errMsg = "User already exists"
@@ -159,11 +177,18 @@ func AccountHandler(w http.ResponseWriter, req *http.Request, id string) {
 	case http.MethodGet:
 		user, err := db.GetUserByID(id)
 		if err != nil {
-			log.Printf("Error fetching user by id: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error fetching user by id", "error", err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
+		keys, err := GetWebAuthnKeys(id)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "Error fetching security keys", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
 		obscuredEmail, _ := shared.ObscureEmail(user.Email)
 		_ = json.NewEncoder(w).Encode(shared.AccountResponse{
 			Email:            obscuredEmail,
@@ -175,6 +200,7 @@ func AccountHandler(w http.ResponseWriter, req *http.Request, id string) {
 			UpgradeExp:       user.UpgradeExp,
 			HasPasswordHint:  len(user.PasswordHint) > 0,
 			Has2FA:           len(user.Secret) > 0,
+			WebAuthnKeys:     keys,
 		})
 	}
 }
@@ -184,7 +210,7 @@ func AccountHandler(w http.ResponseWriter, req *http.Request, id string) {
 func AccountUsageHandler(w http.ResponseWriter, _ *http.Request, id string) {
 	usage, err := db.GetUserUsage(id)
 	if err != nil {
-		log.Printf("Error fetching usage: %v\n", err)
+		slog.Error("Error fetching usage", "error", err)
 		http.Error(w, "Error fetching usage", http.StatusInternalServerError)
 		return
 	}
@@ -243,7 +269,7 @@ func VerifyEmailHandler(w http.ResponseWriter, req *http.Request) {
 
 		err = session.InvalidateOtherSessions(w, req)
 		if err != nil {
-			log.Printf("Error invalidating user's other sessions")
+			slog.ErrorContext(req.Context(), "Error invalidating user's other sessions")
 		}
 	}
 
@@ -258,11 +284,12 @@ func VerifyAccountHandler(w http.ResponseWriter, req *http.Request) {
 	var verify shared.VerifyAccount
 	err := utils.LimitedJSONReader(w, req.Body).Decode(&verify)
 	if err != nil {
-		log.Printf("Unable to parse VerifyAccount request: %v\n", err)
+		slog.ErrorContext(req.Context(), "Unable to parse VerifyAccount request",
+			"error", err)
 		http.Error(w, "Unable to parse request", http.StatusBadRequest)
 		return
 	} else if utils.IsStructMissingAnyField(verify) {
-		log.Println("Missing required fields for verification")
+		slog.InfoContext(req.Context(), "Missing required fields for verification")
 		http.Error(w, "Unable to parse request", http.StatusBadRequest)
 		return
 	}
@@ -270,14 +297,15 @@ func VerifyAccountHandler(w http.ResponseWriter, req *http.Request) {
 	// Verify user verification code
 	_, err = db.VerifyUser(verify.ID, verify.Code)
 	if err != nil {
-		log.Printf("Error verifying user: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error verifying user", "error", err)
 		http.Error(w, "Incorrect verification code", http.StatusUnauthorized)
 		return
 	}
 
 	hash, err := bcrypt.GenerateFromPassword(verify.LoginKeyHash, 8)
 	if err != nil {
-		log.Printf("Error generating bcrypt login hash: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error generating bcrypt login hash",
+			"error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -292,7 +320,7 @@ func VerifyAccountHandler(w http.ResponseWriter, req *http.Request) {
 	})
 
 	if err != nil {
-		log.Printf("Error creating user: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error creating user", "error", err)
 		http.Error(w, "Error creating account", http.StatusInternalServerError)
 		return
 	}
@@ -307,7 +335,7 @@ func VerifyAccountHandler(w http.ResponseWriter, req *http.Request) {
 func LogoutHandler(w http.ResponseWriter, req *http.Request) {
 	err := session.RemoveSession(w, req)
 	if err != nil {
-		log.Printf("Error logging out: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error logging out", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -327,7 +355,7 @@ func ForgotPasswordHandler(w http.ResponseWriter, req *http.Request) {
 
 	canRequest, err := db.CanRequestPasswordHint(forgot.Email)
 	if err != nil {
-		log.Printf("Error checking forgot table: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error checking forgot table", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	} else if !canRequest {
@@ -337,7 +365,7 @@ func ForgotPasswordHandler(w http.ResponseWriter, req *http.Request) {
 
 	hint, err := db.GetUserPasswordHintByEmail(forgot.Email)
 	if err != nil {
-		log.Printf("Error fetching user pw hint: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching user pw hint", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -349,21 +377,22 @@ func ForgotPasswordHandler(w http.ResponseWriter, req *http.Request) {
 
 	decryptedHint, err := crypto.Decrypt(hint)
 	if err != nil {
-		log.Printf("Error decrypting user pw hint: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error decrypting user pw hint", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
 	err = mail.SendPasswordHintEmail(decryptedHint, forgot.Email)
 	if err != nil {
-		log.Printf("Error sending password hint email: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error sending password hint email",
+			"error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
 	err = db.AddForgotEntry(forgot.Email)
 	if err != nil {
-		log.Printf("Error adding forgot table entry: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error adding forgot table entry", "error", err)
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -387,14 +416,14 @@ func PubKeyHandler(w http.ResponseWriter, req *http.Request, _ string) {
 	}
 
 	if err != nil || len(userID) == 0 {
-		log.Printf("Error in user lookup for pub key: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error in user lookup for pub key", "error", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
 	pubKey, err := db.GetUserPubKey(userID)
 	if err != nil {
-		log.Printf("Error fetching pub key: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching pub key", "error", err)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
@@ -410,7 +439,7 @@ func PubKeyHandler(w http.ResponseWriter, req *http.Request, _ string) {
 func ProtectedKeyHandler(w http.ResponseWriter, _ *http.Request, id string) {
 	protectedKey, _, err := db.GetUserKeys(id)
 	if err != nil {
-		log.Printf("Error fetching user keys: %v\n", err)
+		slog.Error("Error fetching user keys", "error", err)
 		http.Error(w, "Error fetching protected key", http.StatusInternalServerError)
 		return
 	}
@@ -440,14 +469,15 @@ func ChangeEmailHandler(w http.ResponseWriter, req *http.Request, id string) {
 func startEmailChangeHandler(w http.ResponseWriter, _ *http.Request, id string) {
 	email, err := db.GetUserEmailByID(id)
 	if err != nil {
-		log.Printf("Error fetching user email: %v\n", err)
+		slog.Error("Error fetching user email", "error", err)
 		http.Error(w, "Error fetching user email", http.StatusBadRequest)
 		return
 	} else if len(email) == 0 {
 		// Account ID-only user is setting up an email
 		changeID, err := db.NewChangeEmailEntry(id, "")
 		if err != nil && err != db.ChangeEmailEntryTooNew {
-			log.Printf("Error creating email change entry for account ID user: %v\n", err)
+			slog.Error("Error creating email change entry for account ID user",
+				"error", err)
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
@@ -462,18 +492,18 @@ func startEmailChangeHandler(w http.ResponseWriter, _ *http.Request, id string)
 
 	changeID, err := db.NewChangeEmailEntry(id, email)
 	if err != nil && err != db.ChangeEmailEntryTooNew {
-		log.Printf("Error creating new change email entry: %v\n", err)
+		slog.Error("Error creating new change email entry", "error", err)
 		http.Error(w, "Error creating new change email entry", http.StatusInternalServerError)
 		return
 	} else if err == db.ChangeEmailEntryTooNew {
-		log.Printf("Change email request is too new")
+		slog.Info("Change email request is too new")
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
 	err = mail.SendEmailChangeNotification(email, changeID)
 	if err != nil {
-		log.Printf("Error sending email change notification: %v\n", err)
+		slog.Error("Error sending email change notification", "error", err)
 		http.Error(w, "Error sending email", http.StatusInternalServerError)
 		return
 	}
@@ -492,10 +522,9 @@ func finishEmailChangeHandler(w http.ResponseWriter, req *http.Request, id strin
 		return
 	}
 
-	pathSegments := strings.Split(req.URL.Path, "/")
-	changeID := pathSegments[len(pathSegments)-1]
+	changeID := req.PathValue("id")
 	if !db.IsChangeIDValid(changeID, id) {
-		log.Printf("Change email ID is invalid")
+		slog.InfoContext(req.Context(), "Change email ID is invalid")
 		http.Error(w, "Invalid email change ID", http.StatusUnauthorized)
 		return
 	}
@@ -506,7 +535,7 @@ func finishEmailChangeHandler(w http.ResponseWriter, req *http.Request, id strin
 		return
 	}
 
-	userID, err := ValidateCredentials(id, changeEmail.OldLoginKeyHash, "", false)
+	userID, err := ValidateCredentials(id, changeEmail.OldLoginKeyHash, nil)
 	if err != nil || id != userID {
 		http.Error(w, "Incorrect password", http.StatusUnauthorized)
 		return
@@ -514,7 +543,7 @@ func finishEmailChangeHandler(w http.ResponseWriter, req *http.Request, id strin
 
 	bcryptHash, err := bcrypt.GenerateFromPassword(changeEmail.NewLoginKeyHash, 8)
 	if err != nil {
-		log.Printf("Error generating bcrypt hash: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error generating bcrypt hash", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -524,14 +553,15 @@ func finishEmailChangeHandler(w http.ResponseWriter, req *http.Request, id strin
 		ProtectedPrivateKey: changeEmail.ProtectedKey,
 	}, bcryptHash, userID)
 	if err != nil {
-		log.Printf("Error creating email verification entry: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error creating email verification entry",
+			"error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
 	err = mail.SendVerificationEmail(code, changeEmail.NewEmail)
 	if err != nil {
-		log.Printf("Error sending verification email: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error sending verification email", "error", err)
 		http.Error(w, "SMTP error", http.StatusInternalServerError)
 		return
 	}
@@ -549,7 +579,7 @@ func ChangePasswordHandler(w http.ResponseWriter, req *http.Request, id string)
 		return
 	}
 
-	userID, err := ValidateCredentials(id, changePassword.OldLoginKeyHash, "", false)
+	userID, err := ValidateCredentials(id, changePassword.OldLoginKeyHash, nil)
 	if err != nil || id != userID {
 		http.Error(w, "Incorrect password", http.StatusUnauthorized)
 		return
@@ -558,14 +588,15 @@ func ChangePasswordHandler(w http.ResponseWriter, req *http.Request, id string)
 	bcryptHash, err := bcrypt.GenerateFromPassword(
 		changePassword.NewLoginKeyHash, 8)
 	if err != nil {
-		log.Printf("Error generating bcrypt hash: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error generating bcrypt hash", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
 
 	err = db.UpdateUserLogin(id, bcryptHash, changePassword.ProtectedKey)
 	if err != nil {
-		log.Printf("Error updating user login credentials: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error updating user login credentials",
+			"error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -592,7 +623,7 @@ func ChangeHintHandler(w http.ResponseWriter, req *http.Request, id string) {
 	} else {
 		encHint, err = crypto.Encrypt(changeHint.Hint)
 		if err != nil {
-			log.Printf("Error encrypting hint: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error encrypting hint", "error", err)
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		}
@@ -600,7 +631,7 @@ func ChangeHintHandler(w http.ResponseWriter, req *http.Request, id string) {
 
 	err = db.UpdatePasswordHint(id, encHint)
 	if err != nil {
-		log.Printf("Error updating pw hint: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error updating pw hint", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -613,7 +644,7 @@ func TwoFactorHandler(w http.ResponseWriter, req *http.Request, userID string) {
 	case http.MethodGet:
 		newTOTP, err := generateUserTotp(userID)
 		if err != nil {
-			log.Printf("Error generating 2FA: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error generating 2FA", "error", err)
 			http.Error(w, "Error generating 2FA", http.StatusBadRequest)
 			return
 		}
@@ -631,7 +662,7 @@ func TwoFactorHandler(w http.ResponseWriter, req *http.Request, userID string) {
 
 		response, err := setTOTP(userID, totp)
 		if err != nil {
-			log.Printf("Failed to set totp: %v\n", err)
+			slog.ErrorContext(req.Context(), "Failed to set totp", "error", err)
 			http.Error(w, "Failed to set totp", http.StatusInternalServerError)
 			return
 		}
@@ -655,19 +686,92 @@ func TwoFactorHandler(w http.ResponseWriter, req *http.Request, userID string) {
 	}
 }
 
+// WebAuthnHandler handles registering security keys and passkeys as a second
+// factor. A GET request returns the options for creating a new credential, and
+// a POST request registers the credential created with those options.
+func WebAuthnHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	switch req.Method {
+	case http.MethodGet:
+		options, err := webAuthnRegistrationOptions(userID, relyingParty(req))
+		if err != nil {
+			slog.ErrorContext(req.Context(), "Error generating WebAuthn options", "error", err)
+			http.Error(w, "Error generating security key options", http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(options)
+		if err != nil {
+			http.Error(w, "Error sending response", http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		var newKey shared.NewWebAuthnKey
+		if err := utils.LimitedJSONReader(w, req.Body).Decode(&newKey); err != nil {
+			http.Error(w, "Error decoding request body", http.StatusBadRequest)
+			return
+		}
+
+		response, err := registerWebAuthnKey(userID, relyingParty(req), newKey)
+		if err == InvalidKeyNameErr {
+			http.Error(w, "Security key name must be 1-64 characters", http.StatusBadRequest)
+			return
+		} else if err == db.WebAuthnCredentialExists {
+			http.Error(w, "Security key is already registered", http.StatusConflict)
+			return
+		} else if err != nil {
+			slog.ErrorContext(req.Context(), "Failed to register security key", "error", err)
+			http.Error(w, "Failed to register security key", http.StatusBadRequest)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			http.Error(w, "Error sending response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// WebAuthnKeyHandler handles renaming (PUT) and revoking (DELETE) one of the
+// user's security keys or passkeys
+func WebAuthnKeyHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	id := req.PathValue("id")
+
+	var err error
+	switch req.Method {
+	case http.MethodPut:
+		var modify shared.ModifyWebAuthnKey
+		if err = utils.LimitedJSONReader(w, req.Body).Decode(&modify); err != nil {
+			http.Error(w, "Error decoding request body", http.StatusBadRequest)
+			return
+		}
+
+		err = renameWebAuthnKey(userID, id, modify)
+	case http.MethodDelete:
+		err = removeWebAuthnKey(userID, id)
+	}
+
+	if err == InvalidKeyNameErr {
+		http.Error(w, "Security key name must be 1-64 characters", http.StatusBadRequest)
+	} else if err == WebAuthnKeyMissingErr {
+		http.Error(w, "Security key not found", http.StatusNotFound)
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error updating security key", "error", err)
+		http.Error(w, "Error updating security key", http.StatusInternalServerError)
+	}
+}
+
 // RecyclePaymentIDHandler handles replacing the user's current payment ID with
 // a new value
 func RecyclePaymentIDHandler(w http.ResponseWriter, _ *http.Request, userID string) {
 	paymentID, err := db.GetPaymentIDByUserID(userID)
 	if err != nil {
-		log.Println("Error fetching user payment ID", err)
+		slog.Error("Error fetching user payment ID", "error", err)
 		http.Error(w, "Error fetching user", http.StatusBadRequest)
 		return
 	}
 
 	err = db.RecycleUserPaymentID(paymentID)
 	if err != nil {
-		log.Println("Error recycling payment ID", err)
+		slog.Error("Error recycling payment ID", "error", err)
 		http.Error(w, "Error recycling payment ID", http.StatusBadRequest)
 		return
 	}
@@ -0,0 +1,493 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"yeetfile/backend/config"
+	"yeetfile/backend/crypto"
+	"yeetfile/backend/db"
+	"yeetfile/backend/oidc"
+	"yeetfile/backend/server/session"
+	"yeetfile/backend/utils"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+const (
+	ssoCookie    = "yeetfile-sso"
+	ssoLoginTTL  = 10 * time.Minute
+	ssoSignupTTL = 15 * time.Minute
+)
+
+var (
+	SSOEmailErr  = errors.New("identity provider didn't return a verified email")
+	SSODomainErr = errors.New("email domain isn't allowed on this instance")
+	SSOLinkedErr = errors.New("account is linked to another identity provider user")
+
+	SSOLinkRequiredErr = errors.New("account must be logged in to link it")
+	SSOLinkEmailErr    = errors.New("identity provider email doesn't match the account")
+)
+
+// ssoProvider is the identity provider that users log in with, or nil if
+// single sign-on isn't configured
+var ssoProvider *oidc.Provider
+
+// SSOLoginHandler starts logging in with the instance's identity provider by
+// redirecting the user to the provider's login page. Users who are already
+// logged in link their account to the provider's user.
+func SSOLoginHandler(w http.ResponseWriter, req *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "Single sign-on not configured for this instance", http.StatusNotFound)
+		return
+	}
+
+	authReq, err := oidc.NewAuthRequest()
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error creating SSO login", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := ssoProvider.AuthCodeURL(req.Context(), authReq)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error contacting identity provider", "error", err)
+		http.Error(w, "Error contacting identity provider", http.StatusBadGateway)
+		return
+	}
+
+	// The session is checked here, since the session cookie isn't sent when
+	// the provider redirects the user back to the callback
+	var userID string
+	if session.IsValidSession(w, req) {
+		userID, _ = session.GetSessionAndUserID(req)
+	}
+
+	err = db.NewOIDCLogin(db.OIDCLogin{
+		State:      authReq.State,
+		Nonce:      authReq.Nonce,
+		Verifier:   authReq.Verifier,
+		Next:       localRedirect(req.URL.Query().Get("next")),
+		Expiration: time.Now().Add(ssoLoginTTL),
+		UserID:     userID,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error storing SSO login", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	setSSOCookie(w, req, authReq.State, ssoLoginTTL)
+	http.Redirect(w, req, authURL, http.StatusFound)
+}
+
+// SSOCallbackHandler handles the user returning from the identity provider.
+// Users with an existing account are logged in, and new users are asked to set
+// a vault password to finish creating their account.
+func SSOCallbackHandler(w http.ResponseWriter, req *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "Single sign-on not configured for this instance", http.StatusNotFound)
+		return
+	}
+
+	query := req.URL.Query()
+	cookie, err := req.Cookie(ssoCookie)
+	if err != nil ||
+		subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Invalid login, please try again", http.StatusBadRequest)
+		return
+	}
+
+	login, err := db.ConsumeOIDCLogin(cookie.Value)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching SSO login", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if providerErr := query.Get("error"); len(providerErr) > 0 {
+		slog.InfoContext(req.Context(), "Identity provider login failed",
+			"error", providerErr,
+			"description", query.Get("error_description"))
+		clearSSOCookie(w, req)
+		http.Error(w, "Login failed or was canceled", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := ssoProvider.Exchange(req.Context(), query.Get("code"), oidc.AuthRequest{
+		State:    login.State,
+		Nonce:    login.Nonce,
+		Verifier: login.Verifier,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error verifying SSO login", "error", err)
+		clearSSOCookie(w, req)
+		http.Error(w, "Unable to verify login with identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := ssoUserID(claims, login.UserID)
+	if err != nil {
+		var errMsg string
+		status := http.StatusForbidden
+		switch err {
+		case SSOEmailErr:
+			errMsg = "Your identity provider account doesn't have a verified email"
+		case SSODomainErr:
+			errMsg = "Your email domain isn't allowed on this instance"
+		case SSOLinkedErr:
+			errMsg = "An account with your email is linked to another user"
+		case SSOLinkRequiredErr:
+			errMsg = "An account with your email already exists. Log in with " +
+				"your password, then link single sign-on from your account page"
+		case SSOLinkEmailErr:
+			errMsg = "Your identity provider email doesn't match your account's email"
+		default:
+			slog.ErrorContext(req.Context(), "Error fetching SSO user", "error", err)
+			errMsg = "Server error"
+			status = http.StatusInternalServerError
+		}
+
+		clearSSOCookie(w, req)
+		http.Error(w, errMsg, status)
+		return
+	}
+
+	if len(userID) == 0 {
+		// New users are identified by a new value instead of the state,
+		// since the state was included in the provider's redirect URL
+		signupID := make([]byte, 32)
+		if _, err = rand.Read(signupID); err != nil {
+			slog.ErrorContext(req.Context(), "Error creating SSO signup", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		signup := db.OIDCSignup{
+			ID:         base64.RawURLEncoding.EncodeToString(signupID),
+			Subject:    claims.Subject,
+			Email:      claims.Email,
+			Expiration: time.Now().Add(ssoSignupTTL),
+		}
+
+		if err = db.NewOIDCSignup(signup); err != nil {
+			slog.ErrorContext(req.Context(), "Error storing SSO signup", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		setSSOCookie(w, req, signup.ID, ssoSignupTTL)
+	} else {
+		clearSSOCookie(w, req)
+		if err = session.SetSession(userID, w, req); err != nil {
+			slog.ErrorContext(req.Context(), "Error setting SSO session", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The session cookie is SameSite=Strict, so it wouldn't be sent if the
+	// user was redirected straight to the next page from the provider's site.
+	// Refreshing from a page on this site avoids that.
+	target := string(endpoints.HTMLSSO)
+	if len(login.Next) > 0 {
+		target += "?next=" + url.QueryEscape(login.Next)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, `
+<html>
+<head>
+<meta http-equiv="refresh" content="0;URL='%[1]s'"/>
+</head>
+<body><p>Moved to <a href="%[1]s">%[1]s</a>.</p></body>
+</html>`, html.EscapeString(target))
+}
+
+// SSOAccountHandler returns the account of a user who has logged in with
+// single sign-on (GET), or creates the account for a new user using the keys
+// generated from their vault password (POST)
+func SSOAccountHandler(w http.ResponseWriter, req *http.Request) {
+	if ssoProvider == nil {
+		http.Error(w, "Single sign-on not configured for this instance", http.StatusNotFound)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		getSSOAccount(w, req)
+	case http.MethodPost:
+		createSSOAccount(w, req)
+	}
+}
+
+func getSSOAccount(w http.ResponseWriter, req *http.Request) {
+	var account shared.SSOAccount
+	if session.IsValidSession(w, req) {
+		userID, err := session.GetSessionAndUserID(req)
+		if err != nil {
+			http.Error(w, "Invalid session", http.StatusUnauthorized)
+			return
+		}
+
+		email, err := db.GetUserEmailByID(userID)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "Error fetching user email", "error", err)
+			http.Error(w, "Error fetching account", http.StatusInternalServerError)
+			return
+		}
+
+		protectedKey, publicKey, err := db.GetUserKeys(userID)
+		if err != nil {
+			http.Error(w, "Error retrieving user keys", http.StatusInternalServerError)
+			return
+		}
+
+		identifier := email
+		if len(identifier) == 0 {
+			identifier = userID
+		}
+
+		account = shared.SSOAccount{
+			Identifier:   identifier,
+			PublicKey:    publicKey,
+			ProtectedKey: protectedKey,
+		}
+	} else {
+		cookie, err := req.Cookie(ssoCookie)
+		if err != nil {
+			http.Error(w, "Not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		signup, err := db.GetOIDCSignup(cookie.Value)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not logged in", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			slog.ErrorContext(req.Context(), "Error fetching SSO signup", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+
+		account = shared.SSOAccount{
+			Identifier: signup.Email,
+			NewAccount: true,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(account)
+}
+
+func createSSOAccount(w http.ResponseWriter, req *http.Request) {
+	cookie, err := req.Cookie(ssoCookie)
+	if err != nil {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	var signupData shared.Signup
+	if utils.LimitedJSONReader(w, req.Body).Decode(&signupData) != nil {
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	} else if utils.IsAnyByteSliceMissing(
+		signupData.LoginKeyHash,
+		signupData.PublicKey,
+		signupData.ProtectedPrivateKey,
+		signupData.ProtectedVaultFolderKey) {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	} else if len(signupData.PasswordHint) > constants.MaxHintLen {
+		http.Error(w, "Hint is too long", http.StatusBadRequest)
+		return
+	} else if !checkServerPassword(signupData.ServerPassword) {
+		// Logging in with the identity provider doesn't bypass the
+		// server password, same as a regular signup
+		http.Error(w, "Missing or invalid server password", http.StatusForbidden)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword(signupData.LoginKeyHash, 8)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error generating bcrypt login hash",
+			"error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	var encHint []byte
+	if len(signupData.PasswordHint) > 0 {
+		encHint, err = crypto.Encrypt(signupData.PasswordHint)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "Error encrypting hint", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	signup, err := db.ConsumeOIDCSignup(cookie.Value)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Signup expired, please log in again", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching SSO signup", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	clearSSOCookie(w, req)
+	userID, err := createNewUser(db.VerifiedAccountValues{
+		Email:                   signup.Email,
+		PasswordHash:            hash,
+		ProtectedPrivateKey:     signupData.ProtectedPrivateKey,
+		PublicKey:               signupData.PublicKey,
+		ProtectedVaultFolderKey: signupData.ProtectedVaultFolderKey,
+		PasswordHint:            encHint,
+	})
+	if err == db.UserAlreadyExists {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	} else if err == db.UserLimitReached {
+		http.Error(w, "User limit has been reached", http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
+		return
+	}
+
+	if err = db.SetUserOIDCSubject(userID, signup.Subject); err != nil {
+		slog.ErrorContext(req.Context(), "Error linking SSO account", "error", err)
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
+		return
+	}
+
+	_ = session.SetSession(userID, w, req)
+}
+
+// ssoUserID returns the ID of the account belonging to the provider's user. An
+// empty ID is returned if the user doesn't have an account. Existing accounts
+// with the same email are only linked if the user started logging in while
+// logged in to that account (linkUserID), since logging in to it required the
+// account's password and second factor.
+func ssoUserID(claims oidc.Claims, linkUserID string) (string, error) {
+	userID, err := db.GetUserIDByOIDCSubject(claims.Subject)
+	if err != nil || len(userID) > 0 {
+		return userID, err
+	}
+
+	if err = checkSSOEmail(claims); err != nil {
+		return "", err
+	}
+
+	userID, err = db.GetUserIDByEmail(claims.Email)
+	if err != nil {
+		return "", err
+	} else if len(linkUserID) > 0 && userID != linkUserID {
+		return "", SSOLinkEmailErr
+	} else if len(userID) == 0 {
+		return "", nil
+	}
+
+	linked, err := db.IsOIDCUser(userID)
+	if err != nil {
+		return "", err
+	} else if linked {
+		return "", SSOLinkedErr
+	} else if len(linkUserID) == 0 {
+		return "", SSOLinkRequiredErr
+	}
+
+	return userID, db.SetUserOIDCSubject(userID, claims.Subject)
+}
+
+// checkSSOEmail ensures the provider's user has a verified email that's
+// allowed to create (or link) an account on this instance
+func checkSSOEmail(claims oidc.Claims) error {
+	at := strings.LastIndex(claims.Email, "@")
+	if at < 1 || !claims.EmailVerified {
+		return SSOEmailErr
+	}
+
+	allowedDomains := config.YeetFileConfig.OIDC.AllowedDomains
+	domain := strings.ToLower(claims.Email[at+1:])
+	if len(allowedDomains) > 0 && !slices.Contains(allowedDomains, domain) {
+		return SSODomainErr
+	}
+
+	return nil
+}
+
+// requiresSSO returns true if the user has to log in with single sign-on
+// instead of their password. Users can still log in with their vault password
+// if single sign-on is disabled on the instance.
+func requiresSSO(userID string) bool {
+	if ssoProvider == nil {
+		return false
+	}
+
+	linked, err := db.IsOIDCUser(userID)
+	if err != nil {
+		slog.Error("Error checking if user is linked to SSO", "error", err)
+		return true
+	}
+
+	return linked
+}
+
+// localRedirect returns the path if it's a path on this server, otherwise an
+// empty string
+func localRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") ||
+		strings.HasPrefix(path, "//") ||
+		strings.Contains(path, `\`) {
+		return ""
+	}
+
+	return path
+}
+
+func setSSOCookie(w http.ResponseWriter, req *http.Request, value string, ttl time.Duration) {
+	// Lax (instead of Strict) so that the cookie is sent when the provider
+	// redirects the user back to the callback
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   req.TLS != nil || strings.HasPrefix(config.YeetFileConfig.Domain, "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearSSOCookie(w http.ResponseWriter, req *http.Request) {
+	setSSOCookie(w, req, "", -time.Second)
+}
+
+func init() {
+	oidcConfig := config.YeetFileConfig.OIDC
+	if oidcConfig.Configured {
+		ssoProvider = oidc.NewProvider(
+			oidcConfig.Issuer,
+			oidcConfig.ClientID,
+			oidcConfig.ClientSecret,
+			endpoints.SSOCallback.Format(config.YeetFileConfig.Domain))
+	}
+}
@@ -0,0 +1,369 @@
+//go:build server_test
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+	"yeetfile/backend/oidc"
+	"yeetfile/backend/oidc/oidctest"
+	"yeetfile/backend/server/session"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+// setupSSO points single sign-on at a mock identity provider for the duration
+// of the test
+func setupSSO(t *testing.T) *oidctest.Provider {
+	mock, err := oidctest.NewProvider("yeetfile", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(mock)
+	mock.Issuer = server.URL
+
+	original := ssoProvider
+	ssoProvider = oidc.NewProvider(
+		mock.Issuer,
+		mock.ClientID,
+		mock.ClientSecret,
+		endpoints.SSOCallback.Format("http://localhost:8090"))
+
+	t.Cleanup(func() {
+		ssoProvider = original
+		server.Close()
+	})
+
+	return mock
+}
+
+// ssoLogin logs in with the mock identity provider and returns the response
+// from the callback handler. Cookies (i.e. an existing session) are only sent
+// when starting the login, like a browser following the provider's redirect.
+func ssoLogin(
+	t *testing.T,
+	mock *oidctest.Provider,
+	cookies ...*http.Cookie,
+) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, string(endpoints.SSOLogin)+"?next=/vault", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	SSOLoginHandler(recorder, req)
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("Unexpected login status %d: %s\n", recorder.Code, recorder.Body.String())
+	}
+
+	code, state, err := mock.Authorize(recorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := url.Values{"code": {code}, "state": {state}}
+	callbackReq := httptest.NewRequest(
+		http.MethodGet,
+		string(endpoints.SSOCallback)+"?"+query.Encode(),
+		nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		callbackReq.AddCookie(cookie)
+	}
+
+	callbackRecorder := httptest.NewRecorder()
+	SSOCallbackHandler(callbackRecorder, callbackReq)
+	return callbackRecorder
+}
+
+// sessionCookie logs in to an existing account and returns the session cookie
+func sessionCookie(t *testing.T, userID string) *http.Cookie {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, string(endpoints.Login), nil)
+	if err := session.SetSession(userID, recorder, req); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := getCookie(recorder, constants.AuthSessionStore)
+	if cookie == nil {
+		t.Fatalf("Expected session cookie to be set\n")
+	}
+
+	return cookie
+}
+
+func getCookie(recorder *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+func TestLocalRedirect(t *testing.T) {
+	paths := map[string]string{
+		"/vault":              "/vault",
+		"/pass?folder=1":      "/pass?folder=1",
+		"":                    "",
+		"https://example.com": "",
+		"//example.com":       "",
+		`/\example.com`:       "",
+		"javascript:alert(1)": "",
+		"vault":               "",
+	}
+
+	for path, expected := range paths {
+		if result := localRedirect(path); result != expected {
+			t.Fatalf("Expected %q for %q, got %q\n", expected, path, result)
+		}
+	}
+}
+
+func TestCheckSSOEmail(t *testing.T) {
+	original := config.YeetFileConfig.OIDC.AllowedDomains
+	defer func() { config.YeetFileConfig.OIDC.AllowedDomains = original }()
+
+	claims := oidc.Claims{Email: "user@example.com", EmailVerified: true}
+	config.YeetFileConfig.OIDC.AllowedDomains = nil
+	if err := checkSSOEmail(claims); err != nil {
+		t.Fatalf("Expected any domain to be allowed, got: %v\n", err)
+	}
+
+	config.YeetFileConfig.OIDC.AllowedDomains = []string{"example.com"}
+	claims.Email = "user@EXAMPLE.com"
+	if err := checkSSOEmail(claims); err != nil {
+		t.Fatalf("Expected domain to be allowed, got: %v\n", err)
+	}
+
+	claims.Email = "user@example.com.evil.com"
+	if err := checkSSOEmail(claims); err != SSODomainErr {
+		t.Fatalf("Expected domain error, got: %v\n", err)
+	}
+
+	claims.Email = "user@example.com"
+	claims.EmailVerified = false
+	if err := checkSSOEmail(claims); err != SSOEmailErr {
+		t.Fatalf("Expected unverified email error, got: %v\n", err)
+	}
+
+	claims = oidc.Claims{Email: "", EmailVerified: true}
+	if err := checkSSOEmail(claims); err != SSOEmailErr {
+		t.Fatalf("Expected missing email error, got: %v\n", err)
+	}
+}
+
+func TestSSOSignup(t *testing.T) {
+	mock := setupSSO(t)
+	mock.User = oidctest.User{
+		Subject:       "sso-signup-subject",
+		Email:         "sso-signup@example.com",
+		EmailVerified: true,
+	}
+
+	recorder := ssoLogin(t, mock)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Unexpected callback status %d: %s\n", recorder.Code, recorder.Body.String())
+	} else if !strings.Contains(recorder.Body.String(), "/sso?next=%2Fvault") {
+		t.Fatalf("Expected redirect to SSO page: %s\n", recorder.Body.String())
+	}
+
+	signupCookie := getCookie(recorder, ssoCookie)
+	if signupCookie == nil || len(signupCookie.Value) == 0 {
+		t.Fatalf("Expected signup cookie to be set\n")
+	}
+
+	// New users are asked to create a vault password
+	req := httptest.NewRequest(http.MethodGet, string(endpoints.SSOAccount), nil)
+	req.AddCookie(signupCookie)
+	recorder = httptest.NewRecorder()
+	SSOAccountHandler(recorder, req)
+
+	var account shared.SSOAccount
+	if err := json.NewDecoder(recorder.Body).Decode(&account); err != nil {
+		t.Fatal(err)
+	} else if !account.NewAccount || account.Identifier != mock.User.Email {
+		t.Fatalf("Unexpected SSO account: %+v\n", account)
+	}
+
+	body, _ := json.Marshal(shared.Signup{
+		LoginKeyHash:            []byte("sso-login-key-hash"),
+		PublicKey:               []byte("public-key"),
+		ProtectedPrivateKey:     []byte("protected-private-key"),
+		ProtectedVaultFolderKey: []byte("protected-vault-folder-key"),
+	})
+
+	req = httptest.NewRequest(http.MethodPost, string(endpoints.SSOAccount), bytes.NewReader(body))
+	req.AddCookie(signupCookie)
+	recorder = httptest.NewRecorder()
+	SSOAccountHandler(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Unexpected signup status %d: %s\n", recorder.Code, recorder.Body.String())
+	}
+
+	userID, err := db.GetUserIDByOIDCSubject(mock.User.Subject)
+	if err != nil || len(userID) == 0 {
+		t.Fatalf("Expected user to be linked to subject (error: %v)\n", err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+
+	// Pending signups can only be used once
+	req = httptest.NewRequest(http.MethodPost, string(endpoints.SSOAccount), bytes.NewReader(body))
+	req.AddCookie(signupCookie)
+	recorder = httptest.NewRecorder()
+	SSOAccountHandler(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected consumed signup to fail, got %d\n", recorder.Code)
+	}
+
+	// Logging in again uses the new account, and password logins are
+	// rejected for linked users
+	recorder = ssoLogin(t, mock)
+	if cookie := getCookie(recorder, ssoCookie); recorder.Code != http.StatusOK ||
+		cookie == nil || cookie.Value != "" {
+		t.Fatalf("Expected existing user to be logged in, got %d\n", recorder.Code)
+	} else if !requiresSSO(userID) {
+		t.Fatalf("Expected user to require single sign-on\n")
+	}
+}
+
+func TestSSOLinkAccount(t *testing.T) {
+	mock := setupSSO(t)
+	userID, err := db.NewUser(db.User{
+		Email:        "sso-link@example.com",
+		PasswordHash: []byte("hash"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+
+	// Unverified emails can't be used to take over an existing account
+	mock.User = oidctest.User{
+		Subject: "sso-link-subject",
+		Email:   "sso-link@example.com",
+	}
+
+	if recorder := ssoLogin(t, mock); recorder.Code != http.StatusForbidden {
+		t.Fatalf("Expected unverified email to be rejected, got %d\n", recorder.Code)
+	} else if requiresSSO(userID) {
+		t.Fatalf("Expected user to not be linked\n")
+	}
+
+	// Verified emails aren't enough to link an account either, since that
+	// would skip the account's password and second factor
+	mock.User.EmailVerified = true
+	if recorder := ssoLogin(t, mock); recorder.Code != http.StatusForbidden {
+		t.Fatalf("Expected link without logging in to be rejected, got %d\n",
+			recorder.Code)
+	} else if requiresSSO(userID) {
+		t.Fatalf("Expected user to not be linked\n")
+	}
+
+	// Users can't link their account to a provider user with another email
+	otherID, err := db.NewUser(db.User{
+		Email:        "sso-link-other@example.com",
+		PasswordHash: []byte("hash"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = db.DeleteUser(otherID) }()
+
+	if recorder := ssoLogin(t, mock, sessionCookie(t, otherID)); recorder.Code != http.StatusForbidden {
+		t.Fatalf("Expected mismatched email to be rejected, got %d\n", recorder.Code)
+	} else if requiresSSO(userID) || requiresSSO(otherID) {
+		t.Fatalf("Expected users to not be linked\n")
+	}
+
+	// Starting the login while logged in to the account links it
+	if recorder := ssoLogin(t, mock, sessionCookie(t, userID)); recorder.Code != http.StatusOK {
+		t.Fatalf("Unexpected callback status %d: %s\n", recorder.Code, recorder.Body.String())
+	} else if !requiresSSO(userID) {
+		t.Fatalf("Expected user to be linked\n")
+	}
+
+	// Logging in again doesn't require a session once the account is linked
+	if recorder := ssoLogin(t, mock); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected linked user to be logged in, got %d\n", recorder.Code)
+	}
+
+	// Other identity provider users with the same email can't log in to
+	// the linked account
+	mock.User.Subject = "sso-link-other-subject"
+	if recorder := ssoLogin(t, mock); recorder.Code != http.StatusForbidden {
+		t.Fatalf("Expected linked account to be rejected, got %d\n", recorder.Code)
+	}
+}
+
+func TestSSOSignupServerPassword(t *testing.T) {
+	mock := setupSSO(t)
+	mock.User = oidctest.User{
+		Subject:       "sso-server-password-subject",
+		Email:         "sso-server-password@example.com",
+		EmailVerified: true,
+	}
+
+	original := config.YeetFileConfig.PasswordHash
+	defer func() { config.YeetFileConfig.PasswordHash = original }()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("server-password"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.YeetFileConfig.PasswordHash = hash
+	signupCookie := getCookie(ssoLogin(t, mock), ssoCookie)
+	if signupCookie == nil || len(signupCookie.Value) == 0 {
+		t.Fatalf("Expected signup cookie to be set\n")
+	}
+
+	signup := func(serverPassword string) int {
+		body, _ := json.Marshal(shared.Signup{
+			LoginKeyHash:            []byte("sso-login-key-hash"),
+			PublicKey:               []byte("public-key"),
+			ProtectedPrivateKey:     []byte("protected-private-key"),
+			ProtectedVaultFolderKey: []byte("protected-vault-folder-key"),
+			ServerPassword:          serverPassword,
+		})
+
+		req := httptest.NewRequest(http.MethodPost, string(endpoints.SSOAccount), bytes.NewReader(body))
+		req.AddCookie(signupCookie)
+		recorder := httptest.NewRecorder()
+		SSOAccountHandler(recorder, req)
+		return recorder.Code
+	}
+
+	// Logging in with the identity provider doesn't skip the server password,
+	// and failed attempts don't use up the pending signup
+	for _, serverPassword := range []string{"", "incorrect"} {
+		if status := signup(serverPassword); status != http.StatusForbidden {
+			t.Fatalf("Expected signup with server password %q to be rejected, got %d\n",
+				serverPassword, status)
+		}
+	}
+
+	if status := signup("server-password"); status != http.StatusOK {
+		t.Fatalf("Unexpected signup status %d\n", status)
+	}
+
+	userID, err := db.GetUserIDByOIDCSubject(mock.User.Subject)
+	if err != nil || len(userID) == 0 {
+		t.Fatalf("Expected user to be linked to subject (error: %v)\n", err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+}
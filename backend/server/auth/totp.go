@@ -8,7 +8,7 @@ import (
 	"github.com/pquerna/otp/totp"
 	"golang.org/x/crypto/bcrypt"
 	"image/jpeg"
-	"log"
+	"log/slog"
 	"strings"
 	"yeetfile/backend/config"
 	"yeetfile/backend/crypto"
@@ -116,6 +116,8 @@ func validateTOTP(encSecret []byte, code, userID string) error {
 	}
 }
 
+// removeTOTP removes the user's TOTP secret after validating the provided code.
+// Recovery codes are kept if the user still has a security key registered.
 func removeTOTP(userID, code string) error {
 	encSecret, err := db.GetUserSecret(userID)
 	if err != nil {
@@ -127,6 +129,13 @@ func removeTOTP(userID, code string) error {
 		return err
 	}
 
+	keys, err := db.CountWebAuthnCredentials(userID)
+	if err != nil {
+		return err
+	} else if keys > 0 {
+		return db.RemoveUserTOTP(userID)
+	}
+
 	err = db.RemoveUser2FA(userID)
 	return err
 }
@@ -137,6 +146,31 @@ func setTOTP(userID string, set shared.SetTOTP) (shared.SetTOTPResponse, error)
 		return shared.SetTOTPResponse{}, IncorrectCodeErr
 	}
 
+	encSecret, err := crypto.Encrypt(set.Secret)
+	if err != nil {
+		return shared.SetTOTPResponse{}, err
+	}
+
+	err = db.SetUserSecret(userID, encSecret)
+	if err != nil {
+		return shared.SetTOTPResponse{}, err
+	}
+
+	recoveryCodes, err := setRecoveryCodes(userID)
+	if err != nil {
+		recoveryErr := db.RemoveUserTOTP(userID)
+		if recoveryErr != nil {
+			slog.Error("Error resetting user 2fa", "error", recoveryErr)
+		}
+		return shared.SetTOTPResponse{}, err
+	}
+
+	return shared.SetTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// setRecoveryCodes generates a new set of recovery codes for the user,
+// replacing any existing codes
+func setRecoveryCodes(userID string) ([6]string, error) {
 	var recoveryCodes [6]string
 	for i := range recoveryCodes {
 		code := shared.GenRandomString(constants.RecoveryCodeLen)
@@ -148,32 +182,16 @@ func setTOTP(userID string, set shared.SetTOTP) (shared.SetTOTPResponse, error)
 		byteCode := []byte(recoveryCodes[i])
 		hash, err := bcrypt.GenerateFromPassword(byteCode, 8)
 		if err != nil {
-			return shared.SetTOTPResponse{}, err
+			return [6]string{}, err
 		}
 
 		hashedCodes[i] = base64.StdEncoding.EncodeToString(hash)
 	}
 
-	encSecret, err := crypto.Encrypt(set.Secret)
-	if err != nil {
-		return shared.SetTOTPResponse{}, err
-	}
-
-	err = db.SetUserSecret(userID, encSecret)
+	err := db.SetUserRecoveryCodeHashes(userID, hashedCodes[:])
 	if err != nil {
-		return shared.SetTOTPResponse{}, err
+		return [6]string{}, err
 	}
 
-	err = db.SetUserRecoveryCodeHashes(userID, hashedCodes[:])
-	if err != nil {
-		recoveryErr := db.RemoveUser2FA(userID)
-		if recoveryErr != nil {
-			log.Printf(
-				"Error resetting user 2fa during err: %v\n",
-				recoveryErr)
-		}
-		return shared.SetTOTPResponse{}, err
-	}
-
-	return shared.SetTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+	return recoveryCodes, nil
 }
@@ -0,0 +1,364 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+	"yeetfile/backend/webauthn"
+	"yeetfile/shared"
+)
+
+const (
+	webAuthnTimeout    = 5 * time.Minute
+	maxWebAuthnKeyName = 64
+)
+
+var (
+	InvalidKeyNameErr     = errors.New("invalid security key name")
+	InvalidChallengeErr   = errors.New("invalid or expired challenge")
+	WebAuthnKeyMissingErr = errors.New("security key not found")
+)
+
+// relyingParty returns the WebAuthn relying party for the server, using the
+// configured YEETFILE_DOMAIN or the request's host if the domain isn't set
+func relyingParty(req *http.Request) webauthn.RelyingParty {
+	origin := config.YeetFileConfig.Domain
+	if len(origin) == 0 {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+
+		origin = scheme + "://" + req.Host
+	}
+
+	rp := webauthn.RelyingParty{Name: "YeetFile", Origin: strings.TrimSuffix(origin, "/")}
+	if u, err := url.Parse(origin); err == nil {
+		rp.ID = u.Hostname()
+		rp.Origin = u.Scheme + "://" + u.Host
+	}
+
+	return rp
+}
+
+// newWebAuthnChallenge creates and stores a single use challenge for the user
+func newWebAuthnChallenge(userID, purpose string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.NewWebAuthnChallenge(
+		webauthn.EncodeChallenge(challenge),
+		userID,
+		purpose,
+		time.Now().Add(webAuthnTimeout))
+	return challenge, err
+}
+
+// consumeWebAuthnChallenge returns the challenge included in the client data
+// if it was issued to the user for the provided purpose, removing it so that it
+// can't be reused
+func consumeWebAuthnChallenge(userID, purpose string, clientDataJSON []byte) ([]byte, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil {
+		return nil, InvalidChallengeErr
+	}
+
+	valid, err := db.ConsumeWebAuthnChallenge(clientData.Challenge, userID, purpose)
+	if err != nil {
+		return nil, err
+	} else if !valid {
+		return nil, InvalidChallengeErr
+	}
+
+	return challenge, nil
+}
+
+// webAuthnRegistrationOptions returns the options for registering a new
+// security key or passkey
+func webAuthnRegistrationOptions(
+	userID string,
+	rp webauthn.RelyingParty,
+) (shared.WebAuthnRegistrationOptions, error) {
+	userName, err := db.GetUserPublicName(userID)
+	if err != nil {
+		return shared.WebAuthnRegistrationOptions{}, err
+	}
+
+	exclude, err := webAuthnCredentialIDs(userID)
+	if err != nil {
+		return shared.WebAuthnRegistrationOptions{}, err
+	}
+
+	challenge, err := newWebAuthnChallenge(userID, db.WebAuthnRegisterChallenge)
+	if err != nil {
+		return shared.WebAuthnRegistrationOptions{}, err
+	}
+
+	// The user handle is stored on the authenticator, so the account ID is
+	// hashed rather than used directly
+	userHandle := sha256.Sum256([]byte(userID))
+
+	return shared.WebAuthnRegistrationOptions{
+		Challenge:          challenge,
+		RPID:               rp.ID,
+		RPName:             rp.Name,
+		UserID:             userHandle[:],
+		UserName:           userName,
+		Algorithms:         webauthn.Algorithms,
+		ExcludeCredentials: exclude,
+		Timeout:            int(webAuthnTimeout.Milliseconds()),
+	}, nil
+}
+
+// registerWebAuthnKey verifies and stores a new security key or passkey. If the
+// user doesn't have any recovery codes yet, new recovery codes are generated
+// and included in the response.
+func registerWebAuthnKey(
+	userID string,
+	rp webauthn.RelyingParty,
+	newKey shared.NewWebAuthnKey,
+) (shared.NewWebAuthnKeyResponse, error) {
+	name, err := validateKeyName(newKey.Name)
+	if err != nil {
+		return shared.NewWebAuthnKeyResponse{}, err
+	}
+
+	challenge, err := consumeWebAuthnChallenge(
+		userID,
+		db.WebAuthnRegisterChallenge,
+		newKey.ClientDataJSON)
+	if err != nil {
+		return shared.NewWebAuthnKeyResponse{}, err
+	}
+
+	credential, err := rp.VerifyRegistration(
+		challenge,
+		newKey.ClientDataJSON,
+		newKey.AttestationObject)
+	if err != nil {
+		return shared.NewWebAuthnKeyResponse{}, err
+	}
+
+	hashes, err := db.GetUserRecoveryCodeHashes(userID)
+	if err != nil {
+		return shared.NewWebAuthnKeyResponse{}, err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(credential.ID)
+	err = db.NewWebAuthnCredential(db.WebAuthnCredential{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+	})
+	if err != nil {
+		return shared.NewWebAuthnKeyResponse{}, err
+	}
+
+	response := shared.NewWebAuthnKeyResponse{
+		Key: shared.WebAuthnKey{ID: id, Name: name, Created: time.Now().UTC()},
+	}
+
+	if len(hashes) == 0 {
+		recoveryCodes, err := setRecoveryCodes(userID)
+		if err != nil {
+			return shared.NewWebAuthnKeyResponse{}, err
+		}
+
+		response.RecoveryCodes = recoveryCodes[:]
+	}
+
+	return response, nil
+}
+
+// webAuthnAssertionOptions returns the options for logging in with one of the
+// user's security keys or passkeys, or nil if they don't have any
+func webAuthnAssertionOptions(
+	userID string,
+	rp webauthn.RelyingParty,
+) (*shared.WebAuthnAssertionOptions, error) {
+	allow, err := webAuthnCredentialIDs(userID)
+	if err != nil || len(allow) == 0 {
+		return nil, err
+	}
+
+	challenge, err := newWebAuthnChallenge(userID, db.WebAuthnLoginChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &shared.WebAuthnAssertionOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		Timeout:          int(webAuthnTimeout.Milliseconds()),
+	}, nil
+}
+
+// twoFactorChallenge returns the second factors the user can log in with,
+// including a new assertion challenge if they have any security keys
+func twoFactorChallenge(
+	userID string,
+	rp webauthn.RelyingParty,
+) (shared.TwoFactorChallenge, error) {
+	secret, err := db.GetUserSecret(userID)
+	if err != nil {
+		return shared.TwoFactorChallenge{}, err
+	}
+
+	options, err := webAuthnAssertionOptions(userID, rp)
+	if err != nil {
+		return shared.TwoFactorChallenge{}, err
+	}
+
+	return shared.TwoFactorChallenge{TOTP: len(secret) > 0, WebAuthn: options}, nil
+}
+
+// validateWebAuthn checks an assertion made with one of the user's security
+// keys or passkeys in response to a login challenge
+func validateWebAuthn(
+	userID string,
+	rp webauthn.RelyingParty,
+	assertion shared.WebAuthnAssertion,
+) error {
+	challenge, err := consumeWebAuthnChallenge(
+		userID,
+		db.WebAuthnLoginChallenge,
+		assertion.ClientDataJSON)
+	if err != nil {
+		slog.Info("Invalid WebAuthn challenge", "error", err)
+		return Failed2FAErr
+	}
+
+	credentials, err := db.GetWebAuthnCredentials(userID)
+	if err != nil {
+		return err
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(assertion.CredentialID)
+	for _, credential := range credentials {
+		if credential.ID != id {
+			continue
+		}
+
+		signCount, err := rp.VerifyAssertion(
+			challenge,
+			webauthn.Credential{
+				ID:        assertion.CredentialID,
+				PublicKey: credential.PublicKey,
+				SignCount: credential.SignCount,
+			},
+			assertion.ClientDataJSON,
+			assertion.AuthenticatorData,
+			assertion.Signature)
+		if err != nil {
+			slog.Info("Invalid WebAuthn assertion", "error", err)
+			return Failed2FAErr
+		}
+
+		return db.UpdateWebAuthnSignCount(id, userID, signCount)
+	}
+
+	return Failed2FAErr
+}
+
+// GetWebAuthnKeys returns the user's registered security keys and passkeys
+func GetWebAuthnKeys(userID string) ([]shared.WebAuthnKey, error) {
+	credentials, err := db.GetWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]shared.WebAuthnKey, len(credentials))
+	for i, credential := range credentials {
+		keys[i] = shared.WebAuthnKey{
+			ID:       credential.ID,
+			Name:     credential.Name,
+			Created:  credential.Created,
+			LastUsed: credential.LastUsed,
+		}
+	}
+
+	return keys, nil
+}
+
+func renameWebAuthnKey(userID, id string, modify shared.ModifyWebAuthnKey) error {
+	name, err := validateKeyName(modify.Name)
+	if err != nil {
+		return err
+	}
+
+	err = db.RenameWebAuthnCredential(id, userID, name)
+	if err == sql.ErrNoRows {
+		return WebAuthnKeyMissingErr
+	}
+
+	return err
+}
+
+// removeWebAuthnKey revokes one of the user's security keys or passkeys. The
+// user's recovery codes are removed along with their last second factor.
+func removeWebAuthnKey(userID, id string) error {
+	err := db.DeleteWebAuthnCredential(id, userID)
+	if err == sql.ErrNoRows {
+		return WebAuthnKeyMissingErr
+	} else if err != nil {
+		return err
+	}
+
+	count, err := db.CountWebAuthnCredentials(userID)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	secret, err := db.GetUserSecret(userID)
+	if err != nil || len(secret) > 0 {
+		return err
+	}
+
+	return db.RemoveUser2FA(userID)
+}
+
+func webAuthnCredentialIDs(userID string) ([][]byte, error) {
+	credentials, err := db.GetWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(credential.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func validateKeyName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 || len(name) > maxWebAuthnKeyName {
+		return "", InvalidKeyNameErr
+	}
+
+	return name, nil
+}
@@ -0,0 +1,172 @@
+//go:build server_test
+
+package auth
+
+import (
+	"crypto/tls"
+	"golang.org/x/crypto/bcrypt"
+	"net/http/httptest"
+	"testing"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+	"yeetfile/backend/webauthn"
+	"yeetfile/backend/webauthn/webauthntest"
+	"yeetfile/shared"
+)
+
+func TestRelyingParty(t *testing.T) {
+	original := config.YeetFileConfig.Domain
+	defer func() { config.YeetFileConfig.Domain = original }()
+
+	config.YeetFileConfig.Domain = ""
+	req := httptest.NewRequest("GET", "/api/2fa/webauthn", nil)
+	req.Host = "localhost:8090"
+	rp := relyingParty(req)
+	if rp.ID != "localhost" || rp.Origin != "http://localhost:8090" {
+		t.Fatalf("Unexpected relying party from request: %+v\n", rp)
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	if rp = relyingParty(req); rp.Origin != "https://localhost:8090" {
+		t.Fatalf("Expected https origin, got %s\n", rp.Origin)
+	}
+
+	config.YeetFileConfig.Domain = "https://yeetfile.example.com/"
+	rp = relyingParty(req)
+	if rp.ID != "yeetfile.example.com" || rp.Origin != "https://yeetfile.example.com" {
+		t.Fatalf("Unexpected relying party from domain: %+v\n", rp)
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	rp := webauthn.RelyingParty{
+		ID:     "localhost",
+		Name:   "YeetFile",
+		Origin: "http://localhost:8090",
+	}
+
+	keyHash := []byte("webauthn-test-key-hash")
+	pwHash, err := bcrypt.GenerateFromPassword(keyHash, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := db.NewUser(db.User{PasswordHash: pwHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+
+	// Users without a second factor don't need to provide one
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{RP: rp})
+	if err != nil {
+		t.Fatalf("Unexpected error without 2FA: %v\n", err)
+	}
+
+	authenticator, err := webauthntest.NewAuthenticator(rp.ID, rp.Origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := webAuthnRegistrationOptions(userID, rp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientDataJSON, attestationObject := authenticator.Register(options.Challenge)
+	newKey := shared.NewWebAuthnKey{
+		Name:              " Test Key ",
+		ClientDataJSON:    clientDataJSON,
+		AttestationObject: attestationObject,
+	}
+
+	response, err := registerWebAuthnKey(userID, rp, newKey)
+	if err != nil {
+		t.Fatal(err)
+	} else if response.Key.Name != "Test Key" {
+		t.Fatalf("Expected key name to be trimmed, got %q\n", response.Key.Name)
+	} else if len(response.RecoveryCodes) != 6 {
+		t.Fatalf("Expected recovery codes for first key\n")
+	}
+
+	// Registration challenges can only be used once
+	_, err = registerWebAuthnKey(userID, rp, newKey)
+	if err != InvalidChallengeErr {
+		t.Fatalf("Expected challenge to be consumed, got: %v\n", err)
+	}
+
+	// Logging in without a second factor returns a challenge for the key
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{RP: rp})
+	if err != Missing2FAErr {
+		t.Fatalf("Expected missing 2FA, got: %v\n", err)
+	}
+
+	challenge, err := twoFactorChallenge(userID, rp)
+	if err != nil {
+		t.Fatal(err)
+	} else if challenge.TOTP || challenge.WebAuthn == nil {
+		t.Fatalf("Unexpected 2FA challenge: %+v\n", challenge)
+	}
+
+	clientDataJSON, authData, signature := authenticator.Assert(challenge.WebAuthn.Challenge)
+	assertion := &shared.WebAuthnAssertion{
+		CredentialID:      authenticator.CredentialID(),
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+	}
+
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{WebAuthn: assertion, RP: rp})
+	if err != nil {
+		t.Fatalf("Failed to log in with security key: %v\n", err)
+	}
+
+	// Replaying the same assertion fails, since the challenge was consumed
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{WebAuthn: assertion, RP: rp})
+	if err != Failed2FAErr {
+		t.Fatalf("Expected replayed assertion to fail, got: %v\n", err)
+	}
+
+	// TOTP codes are rejected when the user only has security keys, but
+	// recovery codes are accepted
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{Code: "123456", RP: rp})
+	if err != Failed2FAErr {
+		t.Fatalf("Expected TOTP code to fail, got: %v\n", err)
+	}
+
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{
+		Code: response.RecoveryCodes[0],
+		RP:   rp,
+	})
+	if err != nil {
+		t.Fatalf("Failed to log in with recovery code: %v\n", err)
+	}
+
+	keys, err := GetWebAuthnKeys(userID)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %d (error: %v)\n", len(keys), err)
+	}
+
+	err = renameWebAuthnKey(userID, keys[0].ID, shared.ModifyWebAuthnKey{Name: "Renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the last key disables 2FA for the user
+	if err = removeWebAuthnKey(userID, keys[0].ID); err != nil {
+		t.Fatal(err)
+	} else if err = removeWebAuthnKey(userID, keys[0].ID); err != WebAuthnKeyMissingErr {
+		t.Fatalf("Expected missing key, got: %v\n", err)
+	}
+
+	hashes, err := db.GetUserRecoveryCodeHashes(userID)
+	if err != nil || len(hashes) != 0 {
+		t.Fatalf("Expected recovery codes to be removed (error: %v)\n", err)
+	}
+
+	_, err = ValidateCredentials(userID, keyHash, &SecondFactor{RP: rp})
+	if err != nil {
+		t.Fatalf("Unexpected error after removing 2FA: %v\n", err)
+	}
+}
@@ -0,0 +1,169 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"yeetfile/backend/cache"
+	"yeetfile/backend/cron"
+	"yeetfile/backend/db"
+	"yeetfile/backend/storage"
+	"yeetfile/shared"
+)
+
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+	statusError    = "error"
+)
+
+// checkTimeout is the maximum amount of time to wait for all checks to finish
+const checkTimeout = 5 * time.Second
+
+var timeoutError = errors.New("check timed out")
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+
+	// Critical checks mark the server as not ready when they fail, while
+	// failures of other checks are only reported as degraded
+	critical bool
+}
+
+// checks are the dependencies verified by ReadyHandler:
+// - the database connection
+// - the storage backend's authorization status
+// - the ability to write to the download cache directory (if enabled)
+// - the cron task locks, which go stale if tasks stop running
+var checks = []check{
+	{
+		name:     "db",
+		fn:       db.Ping,
+		critical: true,
+	},
+	{
+		name: "storage",
+		fn: func(context.Context) error {
+			return storage.CheckAuthorization()
+		},
+		critical: true,
+	},
+	{
+		// Cache errors never interrupt downloads, so the server can still
+		// serve requests without a working cache
+		name: "cache",
+		fn: func(context.Context) error {
+			return cache.CheckWritable()
+		},
+	},
+	{
+		name: "cron",
+		fn: func(context.Context) error {
+			return cron.CheckLocks()
+		},
+	},
+}
+
+type result struct {
+	check    check
+	err      error
+	duration time.Duration
+}
+
+// LiveHandler is the liveness probe endpoint, which only verifies that the
+// server is able to respond to requests
+func LiveHandler(w http.ResponseWriter, _ *http.Request) {
+	writeResponse(w, http.StatusOK, shared.HealthResponse{Status: statusOK})
+}
+
+// ReadyHandler is the readiness probe endpoint, which verifies that each of the
+// server's dependencies are available. Responds with 503 if any critical check
+// fails.
+func ReadyHandler(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), checkTimeout)
+	defer cancel()
+
+	results := runChecks(ctx, checks)
+	response := shared.HealthResponse{
+		Status: statusOK,
+		Checks: make(map[string]shared.HealthCheck),
+	}
+
+	statusCode := http.StatusOK
+	for _, r := range results {
+		checkStatus := statusOK
+		if r.err != nil {
+			checkStatus = statusError
+			slog.ErrorContext(req.Context(), "Health check failed",
+				"check", r.check.name, "error", r.err)
+
+			if r.check.critical {
+				response.Status = statusError
+				statusCode = http.StatusServiceUnavailable
+			} else if response.Status == statusOK {
+				response.Status = statusDegraded
+			}
+		}
+
+		response.Checks[r.check.name] = shared.HealthCheck{
+			Status:     checkStatus,
+			Critical:   r.check.critical,
+			DurationMs: r.duration.Milliseconds(),
+		}
+	}
+
+	writeResponse(w, statusCode, response)
+}
+
+// runChecks runs each check in parallel, returning the results in the same
+// order as the checks. Checks that don't finish before the context is done are
+// reported as timed out.
+func runChecks(ctx context.Context, checks []check) []result {
+	type finished struct {
+		index  int
+		result result
+	}
+
+	done := make(chan finished, len(checks))
+	start := time.Now()
+
+	results := make([]result, len(checks))
+	for i, c := range checks {
+		results[i] = result{check: c, err: timeoutError}
+		go func() {
+			err := c.fn(ctx)
+			done <- finished{
+				index:  i,
+				result: result{check: c, err: err, duration: time.Since(start)},
+			}
+		}()
+	}
+
+	for range checks {
+		select {
+		case f := <-done:
+			results[f.index] = f.result
+		case <-ctx.Done():
+			for i := range results {
+				if results[i].err == timeoutError {
+					results[i].duration = time.Since(start)
+				}
+			}
+
+			return results
+		}
+	}
+
+	return results
+}
+
+func writeResponse(w http.ResponseWriter, statusCode int, response shared.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,83 @@
+//go:build server_test
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yeetfile/shared"
+)
+
+func checkReady(t *testing.T, testChecks []check) (int, shared.HealthResponse) {
+	original := checks
+	checks = testChecks
+	defer func() { checks = original }()
+
+	w := httptest.NewRecorder()
+	ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/up/ready", nil))
+
+	var response shared.HealthResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	return w.Code, response
+}
+
+func TestReadyHandler(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("unavailable") }
+
+	code, response := checkReady(t, []check{
+		{name: "db", fn: ok, critical: true},
+		{name: "cron", fn: ok},
+	})
+	if code != http.StatusOK || response.Status != statusOK {
+		t.Fatalf("expected healthy response, got %d %s", code, response.Status)
+	} else if len(response.Checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(response.Checks))
+	}
+
+	// Non-critical failures don't affect readiness
+	code, response = checkReady(t, []check{
+		{name: "db", fn: ok, critical: true},
+		{name: "cron", fn: fail},
+	})
+	if code != http.StatusOK || response.Status != statusDegraded {
+		t.Fatalf("expected degraded response, got %d %s", code, response.Status)
+	} else if response.Checks["cron"].Status != statusError {
+		t.Fatalf("expected cron check to fail, got %s", response.Checks["cron"].Status)
+	}
+
+	code, response = checkReady(t, []check{
+		{name: "db", fn: fail, critical: true},
+		{name: "cron", fn: fail},
+	})
+	if code != http.StatusServiceUnavailable || response.Status != statusError {
+		t.Fatalf("expected error response, got %d %s", code, response.Status)
+	}
+}
+
+func TestRunChecksTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	results := runChecks(ctx, []check{
+		{name: "fast", fn: func(context.Context) error { return nil }},
+		{name: "slow", fn: func(context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+	})
+
+	if results[0].err != nil {
+		t.Fatalf("expected fast check to pass, got %v", results[0].err)
+	} else if !errors.Is(results[1].err, timeoutError) {
+		t.Fatalf("expected slow check to time out, got %v", results[1].err)
+	}
+}
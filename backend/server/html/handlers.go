@@ -2,9 +2,8 @@ package html
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
@@ -57,7 +56,7 @@ func FileVaultPageHandler(w http.ResponseWriter, _ *http.Request, userID string)
 func PassVaultPageHandler(w http.ResponseWriter, _ *http.Request, userID string) {
 	passCount, maxPassCount, err := db.GetUserPassCount(userID)
 	if err != nil {
-		log.Println(passCount, maxPassCount, err)
+		slog.Error("Error fetching pass count", "error", err)
 		handleError(w, "Error fetching pass vault", http.StatusInternalServerError)
 		return
 	}
@@ -101,7 +100,8 @@ func SendPageHandler(w http.ResponseWriter, req *http.Request, _ string) {
 
 		sendUsed, sendAvailable, err = db.GetUserSendLimits(userID)
 		if err != nil {
-			log.Println("Error fetching user send limits", err)
+			slog.ErrorContext(req.Context(), "Error fetching user send limits",
+				"error", err)
 		}
 
 		showUpgradeLink = sendAvailable == config.YeetFileConfig.DefaultUserSend &&
@@ -151,8 +151,15 @@ func DownloadPageHandler(w http.ResponseWriter, req *http.Request) {
 	)
 }
 
-// SignupPageHandler returns the HTML page for signing up for an account
-func SignupPageHandler(w http.ResponseWriter, _ *http.Request) {
+// SignupPageHandler returns the HTML page for signing up for an account, or
+// redirects to the identity provider if accounts can only be created with
+// single sign-on
+func SignupPageHandler(w http.ResponseWriter, req *http.Request) {
+	if config.YeetFileConfig.OIDC.SignupOnly {
+		http.Redirect(w, req, string(endpoints.SSOLogin), http.StatusSeeOther)
+		return
+	}
+
 	_ = templates.ServeTemplate(
 		w,
 		templates.SignupHTML,
@@ -189,6 +196,26 @@ func LoginPageHandler(w http.ResponseWriter, _ *http.Request) {
 	)
 }
 
+// SSOPageHandler returns the HTML page for unlocking the vault (or creating a
+// vault password for a new account) after logging in with single sign-on
+func SSOPageHandler(w http.ResponseWriter, _ *http.Request) {
+	_ = templates.ServeTemplate(
+		w,
+		templates.SSOHTML,
+		templates.SSOTemplate{
+			Base: templates.BaseTemplate{
+				LoggedIn:   false,
+				Title:      "Single Sign-On",
+				Javascript: []string{"sso.js"},
+				CSS:        []string{"auth.css"},
+				Config:     config.HTMLConfig,
+				Endpoints:  endpoints.HTMLPageEndpoints,
+			},
+			ServerPasswordRequired: config.YeetFileConfig.PasswordHash != nil,
+		},
+	)
+}
+
 // AccountPageHandler returns the HTML page for a user managing their account
 func AccountPageHandler(w http.ResponseWriter, req *http.Request, userID string) {
 	user, err := db.GetUserByID(userID)
@@ -204,6 +231,16 @@ func AccountPageHandler(w http.ResponseWriter, req *http.Request, userID string)
 
 	isAdmin := auth.IsInstanceAdmin(userID)
 
+	keys, err := auth.GetWebAuthnKeys(userID)
+	if err != nil {
+		slog.Error("Error fetching security keys", "error", err)
+	}
+
+	isSSOUser, err := db.IsOIDCUser(userID)
+	if err != nil {
+		slog.Error("Error checking if user is linked to SSO", "error", err)
+	}
+
 	_ = templates.ServeTemplate(
 		w,
 		templates.AccountHTML,
@@ -229,6 +266,8 @@ func AccountPageHandler(w http.ResponseWriter, req *http.Request, userID string)
 			StorageUsed:      shared.ReadableFileSize(user.StorageUsed),
 			HasPasswordHint:  hasHint,
 			Has2FA:           user.Secret != nil && len(user.Secret) > 0,
+			IsSSOUser:        isSSOUser,
+			WebAuthnKeys:     keys,
 			ErrorMessage:     errorMsg,
 			SuccessMessage:   successMsg,
 			IsAdmin:          isAdmin,
@@ -311,8 +350,7 @@ func ChangeEmailPageHandler(w http.ResponseWriter, req *http.Request, id string)
 		handleError(w, "Unable to fetch user", http.StatusInternalServerError)
 		return
 	} else if len(email) > 0 {
-		pathSegments := strings.Split(req.URL.Path, "/")
-		changeID := pathSegments[len(pathSegments)-1]
+		changeID := req.PathValue("id")
 		valid := db.IsChangeIDValid(changeID, id)
 		if !valid {
 			handleError(w, "Invalid access", http.StatusUnauthorized)
@@ -28,6 +28,7 @@ const (
 	ServerInfoHTML       = "server_info.html"
 	CheckoutCompleteHTML = "checkout_complete.html"
 	AdminHTML            = "admin.html"
+	SSOHTML              = "sso.html"
 )
 
 //go:embed *.html
@@ -57,6 +58,11 @@ type SignupTemplate struct {
 	EmailConfigured        bool
 }
 
+type SSOTemplate struct {
+	Base                   BaseTemplate
+	ServerPasswordRequired bool
+}
+
 type LoginTemplate struct {
 	Base  BaseTemplate
 	Meter int
@@ -125,6 +131,8 @@ type AccountTemplate struct {
 	BillingConfigured bool
 	HasPasswordHint   bool
 	Has2FA            bool
+	IsSSOUser         bool
+	WebAuthnKeys      []shared.WebAuthnKey
 	ErrorMessage      string
 	SuccessMessage    string
 	IsAdmin           bool
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"yeetfile/backend/config"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation (see sd_listen_fds(3))
+const listenFdsStart = 3
+
+// listeners returns the listeners for the server to accept connections on,
+// preferring sockets inherited from systemd socket activation, then the
+// configured Unix socket, and finally a TCP listener on addr
+func listeners(addr string) ([]net.Listener, error) {
+	inherited, err := systemdListeners()
+	if err != nil {
+		return nil, fmt.Errorf("unable to use systemd sockets: %w", err)
+	} else if len(inherited) > 0 {
+		return inherited, nil
+	}
+
+	if len(config.UnixSocket) > 0 {
+		mode, err := strconv.ParseUint(config.UnixSocketMode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YEETFILE_UNIX_SOCKET_MODE value %q",
+				config.UnixSocketMode)
+		}
+
+		listener, err := unixListener(config.UnixSocket, os.FileMode(mode))
+		if err != nil {
+			return nil, err
+		}
+
+		return []net.Listener{listener}, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return []net.Listener{listener}, nil
+}
+
+// systemdListeners returns the listeners passed to the server by systemd, if
+// the server was started with socket activation. The environment variables
+// set by systemd are removed so that they aren't inherited by child processes.
+func systemdListeners() ([]net.Listener, error) {
+	pid := os.Getenv("LISTEN_PID")
+	fds := os.Getenv("LISTEN_FDS")
+	names := os.Getenv("LISTEN_FDNAMES")
+	if len(pid) == 0 || len(fds) == 0 {
+		return nil, nil
+	}
+
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid != strconv.Itoa(os.Getpid()) {
+		// Meant for a different process
+		return nil, nil
+	}
+
+	numFds, err := strconv.Atoi(fds)
+	if err != nil || numFds < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS value %q", fds)
+	}
+
+	fdNames := strings.Split(names, ":")
+	files := make([]*os.File, numFds)
+	for i := range files {
+		name := fmt.Sprintf("LISTEN_FD_%d", listenFdsStart+i)
+		if i < len(fdNames) && len(fdNames[i]) > 0 {
+			name = fdNames[i]
+		}
+
+		files[i] = os.NewFile(uintptr(listenFdsStart+i), name)
+	}
+
+	return fileListeners(files)
+}
+
+// fileListeners converts each file into a listener, closing the files
+// afterward (the listeners use their own copy of each file descriptor)
+func fileListeners(files []*os.File) ([]net.Listener, error) {
+	var result []net.Listener
+	var errs []error
+	for _, file := range files {
+		listener, err := net.FileListener(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.Name(), err))
+		} else {
+			result = append(result, listener)
+		}
+
+		_ = file.Close()
+	}
+
+	if len(errs) > 0 {
+		for _, listener := range result {
+			_ = listener.Close()
+		}
+
+		return nil, errors.Join(errs...)
+	}
+
+	return result, nil
+}
+
+// unixListener listens on a Unix domain socket at path, replacing a stale
+// socket left behind by a previous run. The socket is removed when the
+// listener is closed.
+func unixListener(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%s is already in use", path)
+		}
+
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Chmod(path, mode); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
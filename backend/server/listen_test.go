@@ -0,0 +1,184 @@
+//go:build server_test
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"yeetfile/backend/config"
+)
+
+// unixClient returns an HTTP client that sends every request over the Unix
+// socket at the provided path
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestUnixListener(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "yeetfile.sock")
+
+	// Stale sockets from a previous run are replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	listener, err := unixListener(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// Sockets that are still in use aren't replaced
+	if _, err = unixListener(path, 0600); err == nil {
+		t.Fatal("expected error listening on socket in use")
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(
+		func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("OK"))
+		})}
+	go func() { _ = server.Serve(listener) }()
+
+	resp, err := unixClient(path).Get("http://unix/up")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "OK" {
+		t.Fatalf("expected OK response, got %s", body)
+	}
+
+	// The socket is removed once the server stops
+	_ = server.Close()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected socket to be removed, got %v", err)
+	}
+
+	// Regular files are never replaced
+	if err = os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	} else if _, err = unixListener(path, 0600); err == nil {
+		t.Fatal("expected error listening on existing file")
+	}
+}
+
+func TestUnixListenerRateLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "yeetfile.sock")
+	listener, err := unixListener(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: LimiterMiddleware(
+		func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("OK"))
+		})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	client := unixClient(path)
+	get := func(forwardedFor string) int {
+		req, _ := http.NewRequest(http.MethodGet, "http://unix/api/limited", nil)
+		if len(forwardedFor) > 0 {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Requests over the socket don't include the client's address, so they
+	// share a rate limit unless the proxy sets X-Forwarded-For
+	for i := 0; i < config.YeetFileConfig.LimiterAttempts; i++ {
+		if status := get(""); status != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+		}
+	}
+
+	if status := get(""); status != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, status)
+	} else if status = get("203.0.113.1"); status != http.StatusOK {
+		t.Fatalf("expected status %d with X-Forwarded-For, got %d",
+			http.StatusOK, status)
+	}
+}
+
+func TestSystemdListeners(t *testing.T) {
+	// Sockets meant for another process are ignored
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	inherited, err := systemdListeners()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(inherited) != 0 {
+		t.Fatalf("expected no listeners, got %d", len(inherited))
+	} else if len(os.Getenv("LISTEN_FDS")) > 0 {
+		t.Fatal("expected LISTEN_FDS to be unset")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "invalid")
+	if _, err = systemdListeners(); err == nil {
+		t.Fatal("expected error for invalid LISTEN_FDS")
+	}
+}
+
+func TestFileListeners(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer tcpListener.Close()
+	file, err := tcpListener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := fileListeners([]*os.File{file})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(result) != 1 {
+		t.Fatalf("expected 1 listener, got %d", len(result))
+	}
+
+	defer result[0].Close()
+	if result[0].Addr().String() != tcpListener.Addr().String() {
+		t.Fatalf("expected listener on %s, got %s",
+			tcpListener.Addr(), result[0].Addr())
+	}
+
+	notSocket, err := os.CreateTemp(t.TempDir(), "file")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err = fileListeners([]*os.File{notSocket}); err == nil {
+		t.Fatal("expected error for non-socket file")
+	}
+}
@@ -4,13 +4,19 @@ import (
 	"fmt"
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/time/rate"
+	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 	"yeetfile/backend/config"
+	"yeetfile/backend/logging"
+	"yeetfile/backend/metrics"
 	"yeetfile/backend/server/auth"
 	"yeetfile/backend/server/session"
+	"yeetfile/backend/server/tokens"
 	"yeetfile/backend/utils"
+	"yeetfile/shared/constants"
 	"yeetfile/shared/endpoints"
 )
 
@@ -69,6 +75,8 @@ func LimiterMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		metrics.RecordLimiterRejection(metrics.IPLimiter)
+
 		http.Error(
 			w,
 			"Too many requests from this IP address -- please wait and try again",
@@ -92,10 +100,15 @@ func LockdownAuthMiddleware(next session.HandlerFunc) http.HandlerFunc {
 	return handler
 }
 
-// AuthMiddleware enforces that a particular request has a valid session before
-// handling.
+// AuthMiddleware enforces that a particular request has a valid session (or a
+// valid API token for the route) before handling.
 func AuthMiddleware(next session.HandlerFunc) http.HandlerFunc {
 	handler := func(w http.ResponseWriter, req *http.Request) {
+		if token := tokens.BearerToken(req); len(token) > 0 {
+			tokenAuth(w, req, token, next)
+			return
+		}
+
 		if session.IsValidSession(w, req) {
 			// Call the next handler
 			id, err := session.GetSessionAndUserID(req)
@@ -107,6 +120,13 @@ func AuthMiddleware(next session.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// API requests aren't redirected to the login page, so that clients
+		// can tell that the session has expired
+		if isAPIRequest(req) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		loginURL := fmt.Sprintf("%s?next=%s", endpoints.HTMLLogin, req.URL.Path)
 		redirect := fmt.Sprintf(`
 <html>
@@ -123,6 +143,12 @@ func AuthMiddleware(next session.HandlerFunc) http.HandlerFunc {
 	return handler
 }
 
+// isAPIRequest returns true if the request is for an API route, rather than an
+// HTML page
+func isAPIRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/api/")
+}
+
 // AdminMiddleware enforces that particular requests are only performed by those
 // marked as "admin" in the database.
 func AdminMiddleware(next session.HandlerFunc) http.HandlerFunc {
@@ -186,15 +212,57 @@ func DefaultHeadersMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 		w.Header().Set("Referrer-Policy", "no-referrer")
 		w.Header().Set("Permissions-Policy", "geolocation=(), camera=(), microphone=()")
+
+		// Assign an ID to the request, which is included in any logs
+		// written with the request context and returned to the client
+		requestID := logging.NewRequestID()
+		w.Header().Set(constants.RequestIDHeader, requestID)
+		r = r.WithContext(logging.WithRequestID(r.Context(), requestID))
+
+		if !isHealthCheck(r.URL.Path) {
+			slog.InfoContext(r.Context(), "Request",
+				"method", r.Method, "url", r.URL.String())
+		}
+
 		next.ServeHTTP(w, r)
 	}
 }
 
+// isHealthCheck returns true for the health check endpoints, which are polled
+// frequently enough by load balancers and orchestrators to flood the logs
+func isHealthCheck(path string) bool {
+	switch endpoints.Endpoint(path) {
+	case endpoints.Up, endpoints.Live, endpoints.Ready:
+		return true
+	}
+
+	return false
+}
+
 // AuthLimiterMiddleware is like AuthMiddleware, but also restricts requests to
-// the same config.LimiterAttempts per config.LimiterSeconds by session
-// (unlike LimiterMiddleware which limits by IP address)
+// the same config.LimiterAttempts per config.LimiterSeconds by user (unlike
+// LimiterMiddleware which limits by IP address)
 func AuthLimiterMiddleware(next session.HandlerFunc) http.HandlerFunc {
+	limited := func(w http.ResponseWriter, req *http.Request, id string) {
+		limiter := getVisitor(id, req.URL.Path)
+		if limiter.Allow() {
+			next(w, req, id)
+			return
+		}
+
+		metrics.RecordLimiterRejection(metrics.SessionLimiter)
+		http.Error(
+			w,
+			"Too many requests from this account -- please wait and try again",
+			http.StatusTooManyRequests)
+	}
+
 	handler := func(w http.ResponseWriter, req *http.Request) {
+		if token := tokens.BearerToken(req); len(token) > 0 {
+			tokenAuth(w, req, token, limited)
+			return
+		}
+
 		// Skip auth if the app is in debug mode, otherwise validate session
 		if session.IsValidSession(w, req) {
 			// Call the next handler
@@ -203,17 +271,8 @@ func AuthLimiterMiddleware(next session.HandlerFunc) http.HandlerFunc {
 				return
 			}
 
-			limiter := getVisitor(id, req.URL.Path)
-			if limiter.Allow() {
-				next(w, req, id)
-				return
-			} else {
-				http.Error(
-					w,
-					"Too many requests from this account -- please wait and try again",
-					http.StatusTooManyRequests)
-				return
-			}
+			limited(w, req, id)
+			return
 		}
 
 		http.Redirect(w, req, string(endpoints.HTMLLogin), http.StatusTemporaryRedirect)
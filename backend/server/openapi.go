@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"yeetfile/shared/openapi"
+)
+
+// openAPISpec is generated from the route table when the server starts
+var openAPISpec []byte
+
+// openAPIHandler returns the OpenAPI document describing the server's API
+func openAPIHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
+
+// apiRoutes returns each method and path of the API routes in defs, sorted by
+// path and method
+func apiRoutes(defs []RouteDef) []openapi.Route {
+	var routes []openapi.Route
+	for _, def := range defs {
+		if !strings.HasPrefix(string(def.Path), "/api/") {
+			continue
+		}
+
+		for methodInt, methodStr := range MethodMap {
+			if def.Methods&methodInt != 0 {
+				routes = append(routes, openapi.Route{
+					Method: methodStr,
+					Path:   def.Path,
+				})
+			}
+		}
+	}
+
+	openapi.SortRoutes(routes)
+	return routes
+}
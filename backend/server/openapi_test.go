@@ -0,0 +1,46 @@
+//go:build server_test
+
+package server
+
+import (
+	"slices"
+	"testing"
+	"yeetfile/shared/openapi"
+)
+
+// TestOpenAPIRoutes ensures every API route on the server is documented in
+// openapi.Operations, and that nothing is documented that isn't routed
+func TestOpenAPIRoutes(t *testing.T) {
+	routed := apiRoutes(routes())
+	documented := openapi.Routes()
+
+	for _, route := range routed {
+		if !slices.Contains(documented, route) {
+			t.Errorf("%s %s is not documented in openapi.Operations",
+				route.Method, route.Path)
+		}
+	}
+
+	for _, route := range documented {
+		if !slices.Contains(routed, route) {
+			t.Errorf("%s %s is documented but not routed",
+				route.Method, route.Path)
+		}
+	}
+}
+
+// TestOpenAPITokenScopes ensures the API token scopes documented for each
+// operation match the scopes checked by AuthMiddleware
+func TestOpenAPITokenScopes(t *testing.T) {
+	for _, route := range openapi.Routes() {
+		scopes := openapi.Operations[route.Path][route.Method].Scopes
+		tokenRoute, ok := tokenRoutes[route.Path][route.Method]
+		if !ok && len(scopes) > 0 {
+			t.Errorf("%s %s documents scopes but doesn't accept tokens",
+				route.Method, route.Path)
+		} else if ok && !slices.Equal(scopes, tokenRoute.scopes) {
+			t.Errorf("%s %s documents scopes %v, expected %v",
+				route.Method, route.Path, scopes, tokenRoute.scopes)
+		}
+	}
+}
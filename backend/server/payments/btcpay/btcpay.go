@@ -5,7 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"yeetfile/backend/config"
 	"yeetfile/backend/utils"
@@ -21,7 +21,7 @@ func IsValidRequest(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
 
 	reqBody, err := utils.LimitedReader(w, req.Body)
 	if err != nil {
-		log.Printf("Error reading BTCPay webhook body")
+		slog.ErrorContext(req.Context(), "Error reading BTCPay webhook body")
 		return nil, false
 	}
 
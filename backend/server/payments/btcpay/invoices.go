@@ -1,7 +1,7 @@
 package btcpay
 
 import (
-	"log"
+	"log/slog"
 	"strconv"
 	"time"
 	"yeetfile/backend/db"
@@ -46,7 +46,7 @@ func FinalizeInvoice(invoice Invoice) error {
 
 	hasInvoice, err := db.HasInvoice(invoice.InvoiceID)
 	if err != nil || hasInvoice {
-		log.Printf("Possible duplicate BTCPay invoice (err: %v)\n", err)
+		slog.Warn("Possible duplicate BTCPay invoice", "error", err)
 		return err
 	}
 
@@ -76,7 +76,7 @@ func FinalizeInvoice(invoice Invoice) error {
 	}
 
 	if err != nil {
-		log.Println("Error processing BTCPay upgrade in database", err)
+		slog.Error("Error processing BTCPay upgrade in database", "error", err)
 		return err
 	}
 
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"yeetfile/backend/db"
@@ -108,7 +108,8 @@ func StripeCheckout(w http.ResponseWriter, req *http.Request, id string) {
 
 	sendUpgrade, err := extractUpgrade("send")
 	if err != nil {
-		log.Println("Error processing requested send upgrade", err)
+		slog.ErrorContext(req.Context(), "Error processing requested send upgrade",
+			"error", err)
 		http.Error(w, "Error processing requested send upgrade", http.StatusBadRequest)
 		return
 	} else if len(sendUpgrade.Tag) > 0 {
@@ -117,7 +118,8 @@ func StripeCheckout(w http.ResponseWriter, req *http.Request, id string) {
 
 	vaultUpgrade, err := extractUpgrade("vault")
 	if err != nil {
-		log.Println("Error processing requested vault upgrade", err)
+		slog.ErrorContext(req.Context(), "Error processing requested vault upgrade",
+			"error", err)
 		http.Error(w, "Error processing requested vault upgrade", http.StatusBadRequest)
 		return
 	} else if len(vaultUpgrade.Tag) > 0 {
@@ -147,7 +149,7 @@ func StripeCheckout(w http.ResponseWriter, req *http.Request, id string) {
 func BTCPayWebhook(w http.ResponseWriter, req *http.Request) {
 	bodyBytes, isValid := btcpay.IsValidRequest(w, req)
 	if !isValid {
-		log.Printf("Error validating BTCPay webhook event, ignoring")
+		slog.ErrorContext(req.Context(), "Error validating BTCPay webhook event, ignoring")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -157,14 +159,15 @@ func BTCPayWebhook(w http.ResponseWriter, req *http.Request) {
 	var settledInvoice btcpay.Invoice
 	err := decoder.Decode(&settledInvoice)
 	if err != nil {
-		log.Printf("Error decoding BTCPay webhook request body: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error decoding BTCPay webhook request body",
+			"error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	err = btcpay.FinalizeInvoice(settledInvoice)
 	if err != nil {
-		log.Printf("Error finalizing BTCPay invoice: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error finalizing BTCPay invoice", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -7,7 +7,7 @@ import (
 	"github.com/stripe/stripe-go/v78"
 	"github.com/stripe/stripe-go/v78/checkout/session"
 	"github.com/stripe/stripe-go/v78/webhook"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -31,7 +31,7 @@ const (
 // processCheckoutEvent receives an incoming Stripe checkout event and converts the
 // event into a subscription for the user
 func processCheckoutEvent(event *stripe.EventData) error {
-	log.Println("Incoming 'checkout.session.completed' event from Stripe")
+	slog.Info("Incoming 'checkout.session.completed' event from Stripe")
 	var (
 		checkoutSession  stripe.CheckoutSession
 		emailDescription string
@@ -39,20 +39,20 @@ func processCheckoutEvent(event *stripe.EventData) error {
 
 	err := json.Unmarshal(event.Raw, &checkoutSession)
 	if err != nil {
-		log.Printf("Error parsing webhook JSON: %v\n", err)
+		slog.Error("Error parsing webhook JSON", "error", err)
 		return err
 	}
 
 	userPaymentID := checkoutSession.ClientReferenceID
 	upgradeTags, ok := checkoutSession.Metadata[productTagKey]
 	if !ok {
-		log.Printf("Stripe checkout missing upgrade tag!")
+		slog.Warn("Stripe checkout missing upgrade tag!")
 		return errors.New("missing upgrade tag")
 	}
 
 	hasInvoice, err := db.HasInvoice(checkoutSession.ID)
 	if err != nil || hasInvoice {
-		log.Printf("Possible duplicate Stripe event (err: %v)\n", err)
+		slog.Warn("Possible duplicate Stripe event", "error", err)
 		return err
 	}
 
@@ -61,7 +61,7 @@ func processCheckoutEvent(event *stripe.EventData) error {
 		var upgrade shared.Upgrade
 		upgrade, err = upgrades.GetUpgradeByTag(upgradeTag, upgrades.GetAllUpgrades())
 		if err != nil {
-			log.Printf("Error fetching upgrade ID for stripe order: %v\n", err)
+			slog.Error("Error fetching upgrade ID for stripe order", "error", err)
 			return err
 		}
 
@@ -94,7 +94,7 @@ func processCheckoutEvent(event *stripe.EventData) error {
 	if err == nil && len(email) != 0 {
 		err = mail.CreateOrderEmail(emailDescription, email).Send()
 		if err != nil {
-			log.Println("Error sending confirmation email")
+			slog.Error("Error sending confirmation email")
 		}
 	}
 
@@ -108,7 +108,7 @@ func ProcessEvent(event stripe.Event) error {
 	utils.LogStruct(event)
 
 	// Currently only successful checkouts are handled by the webhook
-	log.Println("Incoming ", event.Type)
+	slog.Info("Incoming Stripe event", "type", event.Type)
 	if event.Type == "checkout.session.completed" {
 		return processCheckoutEvent(event.Data)
 	}
@@ -140,7 +140,8 @@ func ValidateEvent(payload []byte, sig string) (stripe.Event, error) {
 func setUserSubscription(paymentID, productID string, quantity int) error {
 	upgrade, err := upgrades.GetUpgradeByTag(productID, upgrades.GetAllUpgrades())
 	if err != nil {
-		log.Printf("Error getting user upgrade product '%s': %v\n", productID, err)
+		slog.Error("Error getting user upgrade product",
+			"product_id", productID, "error", err)
 		return err
 	}
 
@@ -163,7 +164,7 @@ func setUserSubscription(paymentID, productID string, quantity int) error {
 	}
 
 	if err != nil {
-		log.Printf("Error processing user upgrade: %v\n", err)
+		slog.Error("Error processing user upgrade", "error", err)
 		return err
 	}
 
@@ -1,38 +1,99 @@
 package server
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
-	"yeetfile/shared"
+	"time"
+	"yeetfile/backend/metrics"
 	"yeetfile/shared/endpoints"
 )
 
-type Route struct {
-	Method string
-	Path   string
-}
-
 type RouteDef struct {
 	Methods HttpMethod
 	Path    endpoints.Endpoint
 	Handler http.HandlerFunc
 }
 
+// node is a single path segment in the routing tree. Each node can have any
+// number of static children, but only one parameter child ("{name}") and one
+// catch-all child ("{name...}"), which matches the remainder of the path.
+type node struct {
+	segment  string
+	static   map[string]*node
+	param    *node
+	catchAll *node
+
+	// Set for parameter and catch-all nodes
+	paramName string
+
+	// The full path of the route ending at this node, if any
+	pattern  string
+	handlers map[string]http.HandlerFunc
+}
+
 type router struct {
-	routes   map[Route]http.HandlerFunc
-	reserved []string
+	root *node
+}
+
+type pathParam struct {
+	name  string
+	value string
 }
 
+type routeKey struct{}
+
+func newRouter() *router {
+	return &router{root: &node{}}
+}
+
+// AddRoute adds a handler for a method and path to the routing tree. Path
+// segments wrapped in braces are parameters, which can be retrieved by handlers
+// using req.PathValue (i.e. "/api/vault/d/{id}" -> req.PathValue("id")).
+// Parameters ending in "..." match the rest of the path, and must be the final
+// segment in the path.
 func (r *router) AddRoute(method string, path string, handler http.HandlerFunc) {
-	route := Route{Path: path, Method: method}
-	r.routes[route] = handler
+	current := r.root
+	segments := splitPath(path)
+	for i, segment := range segments {
+		name, isParam, isCatchAll := parseSegment(segment)
+		switch {
+		case isCatchAll:
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("catch-all parameter must be last in %s", path))
+			}
+
+			current.catchAll = current.child(current.catchAll, segment, name, path)
+			current = current.catchAll
+		case isParam:
+			current.param = current.child(current.param, segment, name, path)
+			current = current.param
+		default:
+			if current.static == nil {
+				current.static = make(map[string]*node)
+			}
+
+			child, ok := current.static[segment]
+			if !ok {
+				child = &node{segment: segment}
+				current.static[segment] = child
+			}
 
-	// Reserve endpoint to help pattern matching on new requests
-	endpoint := strings.Split(route.Path, "/")[1]
-	if len(endpoint) > 0 && endpoint != "*" {
-		r.reserved = append(r.reserved, endpoint)
+			current = child
+		}
 	}
+
+	if current.handlers == nil {
+		current.handlers = make(map[string]http.HandlerFunc)
+	} else if _, ok := current.handlers[method]; ok {
+		panic(fmt.Sprintf("duplicate route: %s %s", method, path))
+	}
+
+	current.pattern = path
+	current.handlers[method] = handler
 }
 
 func (r *router) AddRoutes(routes []RouteDef) {
@@ -42,62 +103,180 @@ func (r *router) AddRoutes(routes []RouteDef) {
 				continue
 			}
 
-			path := string(route.Path)
 			handler := DefaultHeadersMiddleware(route.Handler)
-
-			// Check for paths with optional segments
-			if strings.Contains(path, "/?") {
-				optPath := strings.Replace(path, "/?", "", 1)
-				wildPath := strings.Replace(path, "/?", "/*", 1)
-				r.AddRoute(methodStr, optPath, handler)
-				r.AddRoute(methodStr, wildPath, handler)
-			} else {
-				r.AddRoute(methodStr, path, handler)
-			}
+			r.AddRoute(methodStr, string(route.Path), handler)
 		}
 	}
 }
 
-// ServeHTTP finds the proper routing handler for the provided path.
+// ServeHTTP finds the proper routing handler for the provided path. Requests
+// for a path that exists, but not for the requested method, are rejected with
+// 405 Method Not Allowed.
 func (r *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	for el, handler := range r.routes {
-		if r.matchPath(el.Path, req.URL.Path) && el.Method == req.Method {
-			if req.URL.Path != string(endpoints.Up) {
-				log.Printf("%s %s\n", req.Method, req.URL)
-			}
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	w = recorder
 
-			handler(w, req)
-			return
+	match, params := r.lookup(req.URL.Path, req.Method)
+	defer func() {
+		route := metrics.UnmatchedRoute
+		if match != nil {
+			route = match.pattern
 		}
+
+		metrics.ObserveRequest(route, req.Method, recorder.status, time.Since(start))
+	}()
+
+	if match == nil {
+		slog.InfoContext(req.Context(), "Not found",
+			"method", req.Method, "url", req.URL.String())
+		http.NotFound(w, req)
+		return
 	}
 
-	log.Printf("Error: %s %s", req.Method, req.URL)
-	http.NotFound(w, req)
+	handler, ok := match.handlers[req.Method]
+	if !ok {
+		slog.InfoContext(req.Context(), "Method not allowed",
+			"method", req.Method, "url", req.URL.String())
+		w.Header().Set("Allow", strings.Join(match.methods(), ", "))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), routeKey{}, match.pattern))
+	for _, param := range params {
+		req.SetPathValue(param.name, param.value)
+	}
+
+	handler(w, req)
 }
 
-// matchPath takes a URL path and determines if it's a match for a particular
-// handler. This allows differentiating between two paths where the only
-// difference is a wildcard (i.e. "/u" and "/u/*" for uploadInit and uploadData)
-func (r *router) matchPath(pattern, path string) bool {
-	parts := strings.Split(pattern, "/")
-	segments := strings.Split(path, "/")
+// routePattern returns the path of the route that matched the request
+// (i.e. "/api/vault/d/{id}" instead of "/api/vault/d/abc123")
+func routePattern(req *http.Request) endpoints.Endpoint {
+	pattern, _ := req.Context().Value(routeKey{}).(string)
+	return endpoints.Endpoint(pattern)
+}
 
-	isWildcard := parts[1] == "*"
-	isEndpoint := shared.ArrayContains(r.reserved, segments[1])
+// lookup returns the node matching the provided path, along with the values of
+// any parameters in the path. Static segments take priority over parameters,
+// which take priority over catch-all parameters. If no route matches both the
+// path and method, the first route matching the path is returned instead.
+func (r *router) lookup(path, method string) (*node, []pathParam) {
+	var fallback *node
+	var fallbackParams []pathParam
 
-	if len(parts) != len(segments) || (isWildcard && isEndpoint) {
-		return false
-	}
+	var search func(n *node, segments []string, params []pathParam) (*node, []pathParam)
+	search = func(n *node, segments []string, params []pathParam) (*node, []pathParam) {
+		if len(segments) == 0 {
+			if len(n.handlers) == 0 {
+				return nil, nil
+			} else if _, ok := n.handlers[method]; ok {
+				return n, params
+			} else if fallback == nil {
+				fallback, fallbackParams = n, slices.Clone(params)
+			}
+
+			return nil, nil
+		}
 
-	for i, part := range parts {
-		if part == "*" && len(path) > 1 {
-			continue
+		segment, rest := segments[0], segments[1:]
+		if child, ok := n.static[segment]; ok {
+			if match, matchParams := search(child, rest, params); match != nil {
+				return match, matchParams
+			}
 		}
 
-		if part != segments[i] {
-			return false
+		if n.param != nil {
+			params := append(params, pathParam{n.param.paramName, segment})
+			if match, matchParams := search(n.param, rest, params); match != nil {
+				return match, matchParams
+			}
 		}
+
+		if n.catchAll != nil {
+			value := strings.Join(segments, "/")
+			params := append(params, pathParam{n.catchAll.paramName, value})
+			if match, matchParams := search(n.catchAll, nil, params); match != nil {
+				return match, matchParams
+			}
+		}
+
+		return nil, nil
+	}
+
+	match, params := search(r.root, splitPath(path), nil)
+	if match == nil {
+		return fallback, fallbackParams
+	}
+
+	return match, params
+}
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap returns the original ResponseWriter, for use with
+// http.ResponseController
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// child returns the existing parameter child of a node, or creates a new one.
+// Parameters at the same position in different routes must use the same name.
+func (n *node) child(existing *node, segment, name, path string) *node {
+	if existing == nil {
+		return &node{segment: segment, paramName: name}
+	} else if existing.paramName != name {
+		panic(fmt.Sprintf("parameter %s in %s conflicts with existing "+
+			"parameter %s", segment, path, existing.segment))
+	}
+
+	return existing
+}
+
+// methods returns the sorted list of methods that have a handler for the node
+func (n *node) methods() []string {
+	var methods []string
+	for method := range n.handlers {
+		methods = append(methods, method)
+	}
+
+	slices.Sort(methods)
+	return methods
+}
+
+// parseSegment returns the parameter name for segments wrapped in braces, and
+// whether the parameter is a catch-all parameter
+func parseSegment(segment string) (string, bool, bool) {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return "", false, false
+	}
+
+	name := segment[1 : len(segment)-1]
+	if strings.HasSuffix(name, "...") {
+		return strings.TrimSuffix(name, "..."), true, true
+	}
+
+	return name, true, false
+}
+
+// splitPath splits a path into its segments, excluding the leading slash. A
+// trailing slash results in a final empty segment, which can be matched by a
+// parameter (i.e. "/api/vault/folder/" -> id == "").
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if len(path) == 0 {
+		return nil
 	}
 
-	return true
+	return strings.Split(path, "/")
 }
@@ -0,0 +1,108 @@
+//go:build server_test
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// routeRecorder returns a handler that records the route name and the provided
+// path parameters in the response body
+func routeRecorder(name string, params ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body := name
+		for _, param := range params {
+			body += " " + param + "=" + req.PathValue(param)
+		}
+
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := newRouter()
+	r.AddRoute(http.MethodGet, "/", routeRecorder("home"))
+	r.AddRoute(http.MethodGet, "/api/vault/d/{id}", routeRecorder("metadata", "id"))
+	r.AddRoute(http.MethodGet, "/api/vault/d/{id}/{chunk}", routeRecorder("chunk", "id", "chunk"))
+	r.AddRoute(http.MethodGet, "/api/vault/d/presign/{id}/{chunk}", routeRecorder("presign", "id", "chunk"))
+	r.AddRoute(http.MethodGet, "/api/vault/folder/{id}", routeRecorder("folder", "id"))
+	r.AddRoute(http.MethodPut, "/api/vault/folder/{id}", routeRecorder("modify", "id"))
+	r.AddRoute(http.MethodGet, "/static/{path...}", routeRecorder("static", "path"))
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/", http.StatusOK, "home"},
+		{http.MethodGet, "/api/vault/d/abc", http.StatusOK, "metadata id=abc"},
+		{http.MethodGet, "/api/vault/d/abc/2", http.StatusOK, "chunk id=abc chunk=2"},
+		{http.MethodGet, "/api/vault/d/presign/abc/2", http.StatusOK, "presign id=abc chunk=2"},
+
+		// Falls back to the parameter route when the static route doesn't match
+		{http.MethodGet, "/api/vault/d/presign/2", http.StatusOK, "chunk id=presign chunk=2"},
+
+		// Empty segments can be matched by parameters
+		{http.MethodGet, "/api/vault/folder/", http.StatusOK, "folder id="},
+		{http.MethodPut, "/api/vault/folder/xyz", http.StatusOK, "modify id=xyz"},
+
+		{http.MethodGet, "/static/js/app.js", http.StatusOK, "static path=js/app.js"},
+		{http.MethodGet, "/static/v1/js/app.js", http.StatusOK, "static path=v1/js/app.js"},
+
+		{http.MethodGet, "/api/vault/folder", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/vault/d/abc/2/3", http.StatusNotFound, ""},
+		{http.MethodGet, "/static", http.StatusNotFound, ""},
+		{http.MethodDelete, "/api/vault/folder/xyz", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Fatalf("%s %s: expected status %d, got %d\n",
+				test.method, test.path, test.status, w.Code)
+		} else if len(test.body) > 0 && w.Body.String() != test.body {
+			t.Fatalf("%s %s: expected '%s', got '%s'\n",
+				test.method, test.path, test.body, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/vault/folder/xyz", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT" {
+		t.Fatalf("Unexpected Allow header: %s\n", allow)
+	}
+}
+
+func TestRouterConflicts(t *testing.T) {
+	expectPanic := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("Expected panic for %s\n", name)
+			}
+		}()
+
+		fn()
+	}
+
+	r := newRouter()
+	r.AddRoute(http.MethodGet, "/api/{id}", routeRecorder("a"))
+
+	expectPanic("duplicate route", func() {
+		r.AddRoute(http.MethodGet, "/api/{id}", routeRecorder("b"))
+	})
+
+	expectPanic("conflicting parameter name", func() {
+		r.AddRoute(http.MethodGet, "/api/{name}/x", routeRecorder("c"))
+	})
+
+	expectPanic("catch-all before the end of a path", func() {
+		r.AddRoute(http.MethodGet, "/files/{path...}/x", routeRecorder("d"))
+	})
+}
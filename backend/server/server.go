@@ -2,27 +2,31 @@ package server
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	_ "net/http/pprof"
 	"os/signal"
-	"strings"
 	"syscall"
-	"yeetfile/backend/config"
+	"time"
+	"yeetfile/backend/metrics"
 	"yeetfile/backend/server/admin"
 	"yeetfile/backend/server/auth"
+	"yeetfile/backend/server/health"
 	"yeetfile/backend/server/html"
 	"yeetfile/backend/server/misc"
 	"yeetfile/backend/server/payments"
 	"yeetfile/backend/server/session"
+	"yeetfile/backend/server/tokens"
+	"yeetfile/backend/server/transfer"
 	"yeetfile/backend/server/transfer/send"
 	"yeetfile/backend/server/transfer/vault"
 	"yeetfile/backend/static"
 	"yeetfile/backend/utils"
 	"yeetfile/shared/endpoints"
+	"yeetfile/shared/openapi"
 )
 
 type HttpMethod int
@@ -35,6 +39,12 @@ const (
 	ALL = GET | PUT | POST | DELETE
 )
 
+const defaultShutdownTimeout = 30 // seconds
+
+// The fraction (1/n) of the shutdown timeout reserved for in-flight requests,
+// after waiting for pending uploads
+const shutdownRequestShare = 4
+
 var MethodMap = map[HttpMethod]string{
 	GET:    http.MethodGet,
 	PUT:    http.MethodPut,
@@ -42,14 +52,9 @@ var MethodMap = map[HttpMethod]string{
 	DELETE: http.MethodDelete,
 }
 
-// Run maps URL paths to handlers for the server and begins listening on the
-// configured port.
-func Run(host, port string) {
-	r := &router{
-		routes: make(map[Route]http.HandlerFunc),
-	}
-
-	r.AddRoutes([]RouteDef{
+// routes returns the URL paths and handlers for every route on the server
+func routes() []RouteDef {
+	return []RouteDef{
 		// YeetFile Send
 		{POST, endpoints.UploadSendFileMetadata, AuthMiddleware(send.UploadMetadataHandler)},
 		{POST, endpoints.UploadSendFileData, AuthMiddleware(send.UploadDataHandler)},
@@ -64,6 +69,8 @@ func Run(host, port string) {
 		{POST, endpoints.UploadVaultFileData, AuthMiddleware(vault.UploadDataHandler)},
 		{GET, endpoints.DownloadVaultFileMetadata, AuthLimiterMiddleware(vault.DownloadHandler)},
 		{GET, endpoints.DownloadVaultFileData, AuthMiddleware(vault.DownloadChunkHandler)},
+		{POST | PUT, endpoints.UploadVaultFilePresign, AuthMiddleware(vault.UploadPresignHandler)},
+		{GET, endpoints.DownloadVaultFilePresign, AuthMiddleware(vault.DownloadPresignHandler)},
 		{ALL, endpoints.ShareFile, AuthMiddleware(vault.ShareHandler(false))},
 		{ALL, endpoints.ShareFolder, AuthMiddleware(vault.ShareHandler(true))},
 
@@ -78,10 +85,16 @@ func Run(host, port string) {
 		{GET, endpoints.Session, session.SessionHandler},
 		{GET, endpoints.Logout, auth.LogoutHandler},
 		{GET | POST | DELETE, endpoints.TwoFactor, AuthMiddleware(auth.TwoFactorHandler)},
+		{GET | POST, endpoints.WebAuthn, AuthMiddleware(auth.WebAuthnHandler)},
+		{PUT | DELETE, endpoints.WebAuthnKey, AuthMiddleware(auth.WebAuthnKeyHandler)},
+		{GET | POST, endpoints.APITokens, AuthMiddleware(tokens.TokensHandler)},
+		{DELETE, endpoints.APIToken, AuthMiddleware(tokens.TokenHandler)},
 		{POST, endpoints.Login, LimiterMiddleware(auth.LoginHandler)},
 		{POST, endpoints.Signup, LimiterMiddleware(auth.SignupHandler)},
 		{GET | PUT | DELETE, endpoints.Account, AuthMiddleware(auth.AccountHandler)},
 		{GET, endpoints.AccountUsage, AuthMiddleware(auth.AccountUsageHandler)},
+		{GET, endpoints.AccountSessions, AuthMiddleware(session.ActiveSessionsHandler)},
+		{DELETE, endpoints.AccountSession, AuthMiddleware(session.ActiveSessionHandler)},
 		{POST, endpoints.Forgot, LimiterMiddleware(auth.ForgotPasswordHandler)},
 		{GET, endpoints.PubKey, AuthLimiterMiddleware(auth.PubKeyHandler)},
 		{GET, endpoints.ProtectedKey, AuthMiddleware(auth.ProtectedKeyHandler)},
@@ -90,9 +103,15 @@ func Run(host, port string) {
 		{POST, endpoints.ChangeHint, AuthMiddleware(auth.ChangeHintHandler)},
 		{PUT, endpoints.RecyclePaymentID, AuthMiddleware(auth.RecyclePaymentIDHandler)},
 
+		// Single sign-on (OpenID Connect)
+		{GET, endpoints.SSOLogin, LimiterMiddleware(auth.SSOLoginHandler)},
+		{GET, endpoints.SSOCallback, LimiterMiddleware(auth.SSOCallbackHandler)},
+		{GET | POST, endpoints.SSOAccount, LimiterMiddleware(auth.SSOAccountHandler)},
+
 		// Admin
 		{GET | DELETE, endpoints.AdminUserActions, AdminMiddleware(admin.UserActionHandler)},
 		{GET | DELETE, endpoints.AdminFileActions, AdminMiddleware(admin.FileActionHandler)},
+		{GET, endpoints.AdminStorageScrub, AdminMiddleware(admin.StorageScrubHandler)},
 
 		// Payments (Stripe, BTCPay)
 		{POST, endpoints.StripeWebhook, payments.StripeWebhook},
@@ -123,20 +142,19 @@ func Run(host, port string) {
 		{GET, endpoints.HTMLServerInfo, html.ServerInfoPageHandler},
 		{GET, endpoints.HTMLCheckoutComplete, html.CheckoutCompleteHandler},
 		{GET, endpoints.HTMLAdmin, AdminMiddleware(html.AdminPageHandler)},
+		{GET, endpoints.HTMLSSO, html.SSOPageHandler},
 
 		// Misc
-		{ // Static folder files
-			GET,
-			"/static/*/?/*",
-			misc.FileHandler("/static/", "", static.StaticFiles),
-		},
-		{ // Static subfolder files
+		{ // Static folder and subfolder files
 			GET,
-			"/static/*/?/*/*",
+			"/static/{path...}",
 			misc.FileHandler("/static/", "", static.StaticFiles),
 		},
 		{GET, endpoints.Up, misc.UpHandler},
+		{GET, endpoints.Live, health.LiveHandler},
+		{GET, endpoints.Ready, health.ReadyHandler},
 		{GET, endpoints.ServerInfo, misc.InfoHandler},
+		{GET, endpoints.OpenAPI, openAPIHandler},
 
 		// StreamSaver.js
 		// These routes serve files directly from the stream_saver submodule
@@ -160,7 +178,27 @@ func Run(host, port string) {
 			"/sw.js",
 			misc.FileHandler("", "/stream_saver/", static.StreamSaverFiles),
 		},
-	})
+	}
+}
+
+// Run maps URL paths to handlers for the server and begins listening on the
+// configured port.
+func Run(host, port string) {
+	defs := routes()
+
+	var err error
+	openAPISpec, err = openapi.Generate(apiRoutes(defs)).JSON()
+	if err != nil {
+		log.Fatalf("Error generating OpenAPI spec: %v", err)
+	}
+
+	r := newRouter()
+	r.AddRoutes(defs)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", host, port),
+		Handler: r,
+	}
 
 	ctx, stop := signal.NotifyContext(
 		context.Background(),
@@ -168,55 +206,97 @@ func Run(host, port string) {
 		syscall.SIGTERM)
 	defer stop()
 
-	go serve(r, host, port)
+	go serve(server)
 	<-ctx.Done()
 
-	log.Println("Shutting down...")
+	// Allow a second signal to stop the server immediately
+	stop()
+	shutdown(server)
 }
 
-func serve(r *router, host, port string) {
+func serve(server *http.Server) {
 	var err error
-	var cert tls.Certificate
 
 	if utils.GetEnvVarBool("YEETFILE_PROFILING", false) {
 		go func() {
 			endpoint := "http://localhost:6060/debug/pprof/"
-			log.Println("Profiling on:", endpoint)
+			slog.Info("Profiling enabled", "endpoint", endpoint)
 			_ = http.ListenAndServe("localhost:6060", nil)
 		}()
 	}
 
-	addr := fmt.Sprintf("%s:%s", host, port)
+	if utils.GetEnvVarBool("YEETFILE_METRICS", false) {
+		go metrics.Serve(utils.GetEnvVar("YEETFILE_METRICS_ADDR", "localhost:9090"))
+	}
 
-	if len(config.TLSCert) > 0 && len(config.TLSKey) > 0 {
-		config.TLSKey = strings.ReplaceAll(config.TLSKey, "\\n", "\n")
-		config.TLSCert = strings.ReplaceAll(config.TLSCert, "\\n", "\n")
+	server.TLSConfig, err = tlsConfig()
+	if err != nil {
+		log.Fatalf("Failed to load TLS config: %v", err)
+	}
 
-		cert, err = tls.X509KeyPair(
-			[]byte(config.TLSCert),
-			[]byte(config.TLSKey))
-		if err != nil {
-			log.Fatalf("Failed to load key pair: %v", err)
-		}
+	serverListeners, err := listeners(server.Addr)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
 
-		tlsConfig := &tls.Config{
-			Certificates: []tls.Certificate{cert},
-		}
+	scheme := "http://"
+	if server.TLSConfig != nil {
+		scheme = "https://"
+	}
 
-		server := &http.Server{
-			Addr:      addr,
-			TLSConfig: tlsConfig,
-			Handler:   r,
+	for _, listener := range serverListeners {
+		if addr := listener.Addr(); addr.Network() == "unix" {
+			slog.Info("Running", "socket", addr.String(), "tls", server.TLSConfig != nil)
+		} else {
+			slog.Info("Running", "url", scheme+addr.String())
 		}
 
-		log.Printf("Running on https://%s\n", addr)
-		err = server.ListenAndServeTLS("", "")
-	} else {
-		log.Printf("Running on http://%s\n", addr)
-		err = http.ListenAndServe(addr, r)
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(listener, "", "")
+			} else {
+				err = server.Serve(listener)
+			}
+
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("serve returned err: %v", err)
+			}
+		}()
+	}
+}
+
+// shutdown stops new uploads from being started, and then waits for pending
+// uploads and in-flight requests to finish before stopping the server. Uploads
+// that haven't finished within the drain window are canceled.
+func shutdown(server *http.Server) {
+	timeout := time.Duration(utils.GetEnvVarInt(
+		"YEETFILE_SHUTDOWN_TIMEOUT",
+		defaultShutdownTimeout)) * time.Second
+
+	slog.Info("Shutting down, waiting for transfers to finish", "timeout", timeout)
+
+	// Pending uploads can use most of the timeout, but the rest is reserved
+	// for in-flight requests to finish
+	deadline := time.Now().Add(timeout)
+	drainCtx, cancelDrain := context.WithDeadline(
+		context.Background(),
+		deadline.Add(-timeout/shutdownRequestShare))
+	remaining := transfer.Drain(drainCtx)
+	cancelDrain()
+
+	if remaining > 0 {
+		slog.Warn("Uploads didn't finish before shutdown", "remaining", remaining)
 	}
 
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("listen and serve returned err: %v", err)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error waiting for requests to finish", "error", err)
+		_ = server.Close()
 	}
+
+	transfer.AbortPending()
+	slog.Info("Shutdown complete")
 }
@@ -1,6 +1,10 @@
 package session
 
-import "net/http"
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
 
 // SessionHandler checks to see if the current request has a valid session
 // Returns OK (200) if the session is valid, otherwise Unauthorized (401)
@@ -11,3 +15,26 @@ func SessionHandler(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
 	}
 }
+
+// ActiveSessionsHandler returns all of the user's logged in sessions
+func ActiveSessionsHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	sessions, err := GetActiveSessions(req, userID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching sessions", "error", err)
+		http.Error(w, "Error fetching sessions", http.StatusInternalServerError)
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(sessions)
+}
+
+// ActiveSessionHandler handles revoking (DELETE) one of the user's sessions
+func ActiveSessionHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	err := RevokeSession(w, req, userID, req.PathValue("id"))
+	if err == SessionNotFoundErr {
+		http.Error(w, "Session not found", http.StatusNotFound)
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error revoking session", "error", err)
+		http.Error(w, "Error revoking session", http.StatusInternalServerError)
+	}
+}
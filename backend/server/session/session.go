@@ -1,35 +1,30 @@
 package session
 
 import (
+	"database/sql"
 	"errors"
-	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
-	"yeetfile/backend/utils"
 	"yeetfile/shared"
 	"yeetfile/shared/constants"
 )
 
 type HandlerFunc func(w http.ResponseWriter, req *http.Request, userID string)
 
-var (
-	authKey = utils.GetEnvVarBytesB64(
-		"YEETFILE_SESSION_AUTH_KEY",
-		securecookie.GenerateRandomKey(32))
-	encKey = utils.GetEnvVarBytesB64(
-		"YEETFILE_SESSION_ENC_KEY",
-		securecookie.GenerateRandomKey(32))
-	store = sessions.NewCookieStore(authKey, encKey)
-)
+var store = NewStore(
+	config.YeetFileConfig.SessionIdleTimeout,
+	config.YeetFileConfig.SessionMaxAge)
 
 const UserIDKey = "user"
 const UserSessionKey = "session"
 const UserSessionIDKey = "session_id"
 
+var SessionNotFoundErr = errors.New("session not found")
+
 func GetSession(req *http.Request) (*sessions.Session, error) {
 	return store.Get(req, constants.AuthSessionStore)
 }
@@ -48,6 +43,16 @@ func SetSession(id string, w http.ResponseWriter, req *http.Request) error {
 		}
 	}
 
+	// Replace the previous session in this browser (if any) instead of
+	// reusing its token
+	if len(session.ID) > 0 {
+		if err = db.ExpireSession(session.ID); err != nil {
+			return err
+		}
+
+		session.ID = ""
+	}
+
 	session.Values[UserIDKey] = id
 	session.Values[UserSessionKey] = sessionKey
 	session.Values[UserSessionIDKey] = shared.GenRandomNumbers(32)
@@ -111,7 +116,8 @@ func IsValidSession(w http.ResponseWriter, req *http.Request) bool {
 
 	dbKey, err := db.GetUserSessionKey(id)
 	if err != nil || sessionKey != dbKey {
-		log.Println("Session key", sessionKey, "does not match db key ", dbKey)
+		slog.WarnContext(req.Context(), "Session key does not match db key",
+			"session_key", sessionKey, "db_key", dbKey)
 		_ = RemoveSession(w, req)
 		return false
 	}
@@ -133,6 +139,11 @@ func InvalidateOtherSessions(w http.ResponseWriter, req *http.Request) error {
 		return err
 	}
 
+	err = db.DeleteOtherSessions(id, session.ID)
+	if err != nil {
+		return err
+	}
+
 	session.Values[UserSessionKey] = newSessionKey
 	return session.Save(req, w)
 }
@@ -151,6 +162,55 @@ func RemoveSession(w http.ResponseWriter, req *http.Request) error {
 	return nil
 }
 
+// GetActiveSessions returns all of the user's logged in sessions, marking the
+// session used for the request as the current session
+func GetActiveSessions(req *http.Request, userID string) ([]shared.ActiveSession, error) {
+	records, err := db.GetUserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentID := currentSessionID(req)
+	sessions := make([]shared.ActiveSession, len(records))
+	for i, record := range records {
+		sessions[i] = shared.ActiveSession{
+			ID:        record.ID,
+			UserAgent: record.UserAgent,
+			IPAddress: record.IPAddress,
+			Created:   record.Created,
+			LastSeen:  record.LastSeen,
+			Current:   record.ID == currentID,
+		}
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs the user out of one of their sessions. If the session is
+// the one used for the request, the session cookie is removed as well.
+func RevokeSession(w http.ResponseWriter, req *http.Request, userID, id string) error {
+	if id == currentSessionID(req) {
+		return RemoveSession(w, req)
+	}
+
+	err := db.DeleteSession(id, userID)
+	if err == sql.ErrNoRows {
+		return SessionNotFoundErr
+	}
+
+	return err
+}
+
+// currentSessionID returns the ID of the session used for the request
+func currentSessionID(req *http.Request) string {
+	session, err := GetSession(req)
+	if err != nil {
+		return ""
+	}
+
+	return session.ID
+}
+
 func GetSessionUserID(session *sessions.Session) string {
 	sessionVal := session.Values[UserIDKey]
 	if sessionVal != nil {
@@ -175,8 +235,6 @@ func GetSessionAndUserID(req *http.Request) (string, error) {
 }
 
 func init() {
-	store.Options.HttpOnly = true
-	store.Options.SameSite = http.SameSiteStrictMode
 	if strings.HasPrefix(config.YeetFileConfig.Domain, "https") {
 		store.Options.Secure = true
 	}
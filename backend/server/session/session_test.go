@@ -0,0 +1,147 @@
+//go:build server_test
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yeetfile/backend/db"
+)
+
+// newSessionRequest returns a request with a new session for the user, as if
+// the user had just logged in from the provided user agent
+func newSessionRequest(t *testing.T, userID, userAgent string) *http.Request {
+	req := httptest.NewRequest("POST", "/api/login", nil)
+	req.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	if err := SetSession(userID, w, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req = httptest.NewRequest("GET", "/api/account", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	return req
+}
+
+func TestActiveSessions(t *testing.T) {
+	userID, err := db.NewUser(db.User{PasswordHash: []byte("session-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+
+	laptop := newSessionRequest(t, userID, "laptop")
+	phone := newSessionRequest(t, userID, "phone")
+	if !IsValidSession(httptest.NewRecorder(), laptop) ||
+		!IsValidSession(httptest.NewRecorder(), phone) {
+		t.Fatalf("Expected both sessions to be valid\n")
+	}
+
+	sessions, err := GetActiveSessions(laptop, userID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d\n", len(sessions))
+	}
+
+	var laptopID, phoneID string
+	for _, session := range sessions {
+		if session.UserAgent == "laptop" {
+			laptopID = session.ID
+			if !session.Current {
+				t.Fatalf("Expected laptop session to be current\n")
+			}
+		} else if session.UserAgent == "phone" {
+			phoneID = session.ID
+		}
+	}
+
+	// Revoking one session doesn't affect the others
+	err = RevokeSession(httptest.NewRecorder(), laptop, userID, phoneID)
+	if err != nil {
+		t.Fatal(err)
+	} else if IsValidSession(httptest.NewRecorder(), phone) {
+		t.Fatalf("Expected revoked session to be invalid\n")
+	} else if !IsValidSession(httptest.NewRecorder(), laptop) {
+		t.Fatalf("Expected other session to still be valid\n")
+	}
+
+	err = RevokeSession(httptest.NewRecorder(), laptop, userID, phoneID)
+	if err != SessionNotFoundErr {
+		t.Fatalf("Expected missing session, got: %v\n", err)
+	}
+
+	// Sessions can only be revoked by the user that owns them
+	err = RevokeSession(httptest.NewRecorder(), phone, "other-user", laptopID)
+	if err != SessionNotFoundErr {
+		t.Fatalf("Expected missing session for other user, got: %v\n", err)
+	}
+}
+
+func TestStoreValues(t *testing.T) {
+	store := NewStore(time.Hour, time.Hour)
+	req := httptest.NewRequest("GET", "/", nil)
+	session, err := store.Get(req, "test")
+	if err != nil {
+		t.Fatal(err)
+	} else if !session.IsNew {
+		t.Fatalf("Expected new session without a cookie\n")
+	}
+
+	// Only string values can be stored
+	session.Values[UserIDKey] = 123
+	if err = session.Save(req, httptest.NewRecorder()); err == nil {
+		t.Fatalf("Expected error saving non-string session value\n")
+	}
+}
+
+func TestStoreTimeouts(t *testing.T) {
+	tests := map[string]*Store{
+		"valid":   NewStore(time.Hour, time.Hour),
+		"idle":    NewStore(0, time.Hour),
+		"expired": NewStore(time.Hour, 0),
+	}
+
+	for name, store := range tests {
+		req := httptest.NewRequest("POST", "/api/login", nil)
+		session, _ := store.New(req, "test")
+		session.Values[UserIDKey] = "store-test"
+
+		w := httptest.NewRecorder()
+		if err := store.Save(req, w, session); err != nil {
+			t.Fatal(err)
+		}
+
+		req = httptest.NewRequest("GET", "/", nil)
+		for _, cookie := range w.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+
+		time.Sleep(time.Millisecond)
+		loaded, err := store.New(req, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expired := name != "valid"
+		if loaded.IsNew != expired {
+			t.Fatalf("%s: expected expired=%v, got %v\n", name, expired, loaded.IsNew)
+		} else if !expired && loaded.Values[UserIDKey] != "store-test" {
+			t.Fatalf("%s: session values weren't loaded\n", name)
+		}
+
+		// Removing the session prevents it from being loaded again
+		loaded.Options.MaxAge = -1
+		if err = store.Save(req, httptest.NewRecorder(), loaded); err != nil {
+			t.Fatal(err)
+		} else if reloaded, _ := store.New(req, "test"); !reloaded.IsNew {
+			t.Fatalf("%s: expected removed session to be invalid\n", name)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"log/slog"
+	"net/http"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/backend/utils"
+	"yeetfile/shared"
+)
+
+const (
+	tokenSize       = 32
+	maxUserAgent    = 256
+	lastSeenRefresh = time.Minute
+)
+
+// Store is a sessions.Store that keeps session values in the database instead
+// of in the cookie, so that sessions are shared between server instances and
+// survive restarts. The session cookie only contains a random token, and only
+// a hash of the token is stored.
+//
+// Sessions expire after IdleTimeout without any requests, or after MaxAge
+// regardless of activity.
+type Store struct {
+	Options     *sessions.Options
+	IdleTimeout time.Duration
+	MaxAge      time.Duration
+}
+
+// NewStore returns a new database session store with the provided timeouts
+func NewStore(idleTimeout, maxAge time.Duration) *Store {
+	return &Store{
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(maxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		},
+		IdleTimeout: idleTimeout,
+		MaxAge:      maxAge,
+	}
+}
+
+// Get returns the session for the request, loading it from the database the
+// first time it's requested
+func (s *Store) Get(req *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(req).Get(s, name)
+}
+
+// New returns the session matching the request's session cookie, or a new
+// session if the cookie is missing or the session has expired
+func (s *Store) New(req *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := req.Cookie(name)
+	if err != nil || len(cookie.Value) == 0 {
+		return session, nil
+	}
+
+	record, err := db.GetSessionByHash(hashToken(cookie.Value))
+	if err == sql.ErrNoRows {
+		return session, nil
+	} else if err != nil {
+		return session, err
+	}
+
+	if s.isExpired(record) {
+		if err = db.ExpireSession(record.ID); err != nil {
+			slog.ErrorContext(req.Context(), "Error removing expired session",
+				"error", err)
+		}
+
+		return session, nil
+	}
+
+	var values map[string]string
+	if err = json.Unmarshal([]byte(record.Data), &values); err != nil {
+		return session, err
+	}
+
+	for key, value := range values {
+		session.Values[key] = value
+	}
+
+	session.ID = record.ID
+	session.IsNew = false
+
+	if time.Since(record.LastSeen) > lastSeenRefresh {
+		ip, _ := utils.GetReqSource(req)
+		if err = db.UpdateSessionLastSeen(record.ID, ip); err != nil {
+			slog.ErrorContext(req.Context(), "Error updating session last seen",
+				"error", err)
+		}
+	}
+
+	return session, nil
+}
+
+// Save stores the session's values, creating a new session (and cookie) if
+// needed. Sessions with a negative MaxAge are removed.
+func (s *Store) Save(req *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if len(session.ID) > 0 {
+			if err := db.ExpireSession(session.ID); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	values := make(map[string]string, len(session.Values))
+	for key, value := range session.Values {
+		keyStr, keyOK := key.(string)
+		valueStr, valueOK := value.(string)
+		if !keyOK || !valueOK {
+			return fmt.Errorf("unsupported session value for key %v", key)
+		}
+
+		values[keyStr] = valueStr
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	userID := values[UserIDKey]
+	if len(session.ID) > 0 {
+		return db.UpdateSessionData(session.ID, userID, string(data))
+	}
+
+	token := make([]byte, tokenSize)
+	if _, err = rand.Read(token); err != nil {
+		return err
+	}
+
+	tokenStr := base64.RawURLEncoding.EncodeToString(token)
+	now := time.Now().UTC()
+	record := db.Session{
+		ID:         shared.GenRandomString(16),
+		UserID:     userID,
+		TokenHash:  hashToken(tokenStr),
+		Data:       string(data),
+		UserAgent:  req.UserAgent(),
+		Created:    now,
+		Expiration: now.Add(s.MaxAge),
+	}
+
+	if len(record.UserAgent) > maxUserAgent {
+		record.UserAgent = record.UserAgent[:maxUserAgent]
+	}
+
+	record.IPAddress, _ = utils.GetReqSource(req)
+	if err = db.NewSession(record); err != nil {
+		return err
+	}
+
+	session.ID = record.ID
+	session.IsNew = false
+	http.SetCookie(w, sessions.NewCookie(session.Name(), tokenStr, session.Options))
+	return nil
+}
+
+// isExpired returns true if the session has passed its absolute expiration,
+// or hasn't been used within the idle timeout
+func (s *Store) isExpired(record db.Session) bool {
+	now := time.Now()
+	return now.After(record.Expiration) || now.Sub(record.LastSeen) > s.IdleTimeout
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
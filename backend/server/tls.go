@@ -0,0 +1,248 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"yeetfile/backend/config"
+)
+
+const certPollInterval = 30 * time.Second
+
+const (
+	requireClientCert  = "require"
+	optionalClientCert = "optional"
+)
+
+// certReloader loads the TLS cert, key, and client CA (if configured) from
+// files, and reloads them whenever the files change or the server receives
+// SIGHUP. If reloading fails, the previously loaded files remain in use.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+func newCertReloader(certFile, keyFile, caFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// reload loads the TLS files from disk, replacing the current cert and client
+// CAs if all files are loaded successfully
+func (r *certReloader) reload() error {
+	modTimes, err := r.readModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if len(r.caFile) > 0 {
+		clientCAs, err = loadCertPool(r.caFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed returns true if any of the TLS files were modified since they were
+// last loaded
+func (r *certReloader) changed() bool {
+	modTimes, err := r.readModTimes()
+	if err != nil {
+		// Files may be mid-replacement, try again on the next check
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *certReloader) readModTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if len(file) == 0 {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// watch reloads the TLS files when they change or the server receives SIGHUP
+func (r *certReloader) watch() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sighup:
+			slog.Info("Received SIGHUP, reloading TLS certificate")
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			slog.Info("TLS files changed, reloading certificate")
+		}
+
+		if err := r.reload(); err != nil {
+			slog.Error("Error reloading TLS certificate, using previous certificate",
+				"error", err)
+		}
+	}
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// tlsConfig returns the TLS config for the server, or nil if TLS isn't
+// configured. TLS files are preferred over YEETFILE_TLS_CERT/YEETFILE_TLS_KEY,
+// and are reloaded automatically.
+func tlsConfig() (*tls.Config, error) {
+	tlsConf := &tls.Config{}
+
+	var reloader *certReloader
+	if len(config.TLSCertFile) > 0 || len(config.TLSKeyFile) > 0 {
+		if len(config.TLSCertFile) == 0 || len(config.TLSKeyFile) == 0 {
+			return nil, errors.New("both YEETFILE_TLS_CERT_FILE and " +
+				"YEETFILE_TLS_KEY_FILE must be set")
+		}
+
+		var err error
+		reloader, err = newCertReloader(
+			config.TLSCertFile,
+			config.TLSKeyFile,
+			config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		go reloader.watch()
+		tlsConf.GetCertificate = reloader.GetCertificate
+	} else if len(config.TLSCert) > 0 && len(config.TLSKey) > 0 {
+		config.TLSKey = strings.ReplaceAll(config.TLSKey, "\\n", "\n")
+		config.TLSCert = strings.ReplaceAll(config.TLSCert, "\\n", "\n")
+
+		cert, err := tls.X509KeyPair(
+			[]byte(config.TLSCert),
+			[]byte(config.TLSKey))
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConf.Certificates = []tls.Certificate{cert}
+	} else if len(config.TLSClientCAFile) > 0 {
+		return nil, errors.New("client certificate verification requires TLS")
+	} else {
+		return nil, nil
+	}
+
+	if len(config.TLSClientCAFile) == 0 {
+		return tlsConf, nil
+	}
+
+	switch config.TLSClientAuth {
+	case requireClientCert:
+		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	case optionalClientCert:
+		tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid YEETFILE_TLS_CLIENT_AUTH value %q",
+			config.TLSClientAuth)
+	}
+
+	if reloader != nil {
+		// Use the latest client CAs for each new connection
+		tlsConf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientConf := tlsConf.Clone()
+			clientConf.GetConfigForClient = nil
+			clientConf.ClientCAs = reloader.ClientCAs()
+			return clientConf, nil
+		}
+	} else {
+		clientCAs, err := loadCertPool(config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConf.ClientCAs = clientCAs
+	}
+
+	return tlsConf, nil
+}
+
+// loadCertPool reads a file of PEM-encoded certificates into a cert pool
+func loadCertPool(file string) (*x509.CertPool, error) {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,198 @@
+//go:build server_test
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"yeetfile/backend/config"
+)
+
+// writeCert generates a self-signed cert, writing the cert and key to the
+// provided paths. If parent is set, the cert is signed by the parent instead.
+func writeCert(
+	t *testing.T,
+	certPath,
+	keyPath,
+	name string,
+	parent *tls.Certificate,
+) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+	}
+
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer = parent.Leaf
+		signerKey = parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err = os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert.Leaf, _ = x509.ParseCertificate(der)
+	return cert
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	original := writeCert(t, certPath, keyPath, "original", nil)
+	reloader, err := newCertReloader(certPath, keyPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != original.Leaf.Subject.CommonName {
+		t.Fatalf("expected original cert, got %s", cert.Leaf.Subject.CommonName)
+	}
+
+	if reloader.changed() {
+		t.Fatal("expected files to be unchanged")
+	}
+
+	// Replace the cert and make sure the change is detected regardless of
+	// the file system's timestamp resolution
+	writeCert(t, certPath, keyPath, "renewed", nil)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certPath, later, later)
+
+	if !reloader.changed() {
+		t.Fatal("expected files to be changed")
+	}
+
+	if err = reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ = reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "renewed" {
+		t.Fatalf("expected renewed cert, got %s", cert.Leaf.Subject.CommonName)
+	}
+
+	// An invalid cert shouldn't replace the working one
+	_ = os.WriteFile(certPath, []byte("invalid"), 0600)
+	if err = reloader.reload(); err == nil {
+		t.Fatal("expected error reloading invalid cert")
+	}
+
+	cert, _ = reloader.GetCertificate(nil)
+	if cert.Leaf.Subject.CommonName != "renewed" {
+		t.Fatalf("expected renewed cert to remain, got %s", cert.Leaf.Subject.CommonName)
+	}
+}
+
+func TestClientCertVerification(t *testing.T) {
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	ca := writeCert(t, caPath, filepath.Join(dir, "ca-key.pem"), "ca", nil)
+	writeCert(t, certPath, keyPath, "server", &ca)
+	clientCert := writeCert(t,
+		filepath.Join(dir, "client.pem"),
+		filepath.Join(dir, "client-key.pem"),
+		"client",
+		&ca)
+
+	config.TLSCertFile = certPath
+	config.TLSKeyFile = keyPath
+	config.TLSClientCAFile = caPath
+	config.TLSClientAuth = requireClientCert
+	defer func() {
+		config.TLSCertFile = ""
+		config.TLSKeyFile = ""
+		config.TLSClientCAFile = ""
+	}()
+
+	tlsConf, err := tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte(req.TLS.PeerCertificates[0].Subject.CommonName))
+		}))
+	server.TLS = tlsConf
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+
+	if _, err = newClient().Get(server.URL); err == nil {
+		t.Fatal("expected request without a client cert to fail")
+	}
+
+	resp, err := newClient(clientCert).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+}
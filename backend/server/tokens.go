@@ -0,0 +1,137 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"yeetfile/backend/server/session"
+	"yeetfile/backend/server/tokens"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+// tokenResource identifies which path parameter (if any) must be checked
+// against a token's folder restrictions
+type tokenResource int
+
+const (
+	noResource tokenResource = iota
+	folderResource
+	fileResource
+	downloadResource
+)
+
+// tokenRoute is the scope needed to access a route with an API token. Tokens
+// with any of the listed scopes are allowed.
+type tokenRoute struct {
+	scopes   []string
+	resource tokenResource
+}
+
+var (
+	vaultRead  = []string{constants.ScopeVaultRead}
+	vaultWrite = []string{constants.ScopeVaultWrite}
+	passRead   = []string{constants.ScopePassRead}
+	sendCreate = []string{constants.ScopeSendCreate}
+)
+
+// tokenRoutes lists every route that accepts API tokens in place of a session.
+// Routes that aren't listed here (account management, sharing, etc) can only be
+// accessed by logging in. Routes that create items check the folder the item is
+// being created in when handling the request.
+var tokenRoutes = map[endpoints.Endpoint]map[string]tokenRoute{
+	endpoints.VaultFolder: {
+		http.MethodGet:    {vaultRead, folderResource},
+		http.MethodPost:   {vaultWrite, noResource},
+		http.MethodPut:    {vaultWrite, folderResource},
+		http.MethodDelete: {vaultWrite, folderResource},
+	},
+	endpoints.VaultFile: {
+		http.MethodGet:    {vaultRead, fileResource},
+		http.MethodPut:    {vaultWrite, fileResource},
+		http.MethodDelete: {vaultWrite, fileResource},
+	},
+	endpoints.UploadVaultFileMetadata: {
+		http.MethodPost: {vaultWrite, noResource},
+	},
+	endpoints.UploadVaultFileData: {
+		http.MethodPost: {vaultWrite, fileResource},
+	},
+	endpoints.UploadVaultFilePresign: {
+		http.MethodPost: {vaultWrite, fileResource},
+		http.MethodPut:  {vaultWrite, fileResource},
+	},
+	endpoints.DownloadVaultFileMetadata: {
+		http.MethodGet: {vaultRead, fileResource},
+	},
+	endpoints.DownloadVaultFileData: {
+		http.MethodGet: {vaultRead, downloadResource},
+	},
+	endpoints.DownloadVaultFilePresign: {
+		http.MethodGet: {vaultRead, downloadResource},
+	},
+	endpoints.PassFolder: {
+		http.MethodGet: {passRead, folderResource},
+	},
+	endpoints.UploadSendFileMetadata: {
+		http.MethodPost: {sendCreate, noResource},
+	},
+	endpoints.UploadSendFileData: {
+		http.MethodPost: {sendCreate, noResource},
+	},
+	endpoints.UploadSendText: {
+		http.MethodPost: {sendCreate, noResource},
+	},
+	endpoints.ProtectedKey: {
+		http.MethodGet: {
+			[]string{
+				constants.ScopeVaultRead,
+				constants.ScopeVaultWrite,
+				constants.ScopePassRead,
+			},
+			noResource,
+		},
+	},
+}
+
+// tokenAuth authenticates a request using an API token instead of a session,
+// checking that the token has the scope required for the route and is allowed
+// to access the requested folder or file
+func tokenAuth(w http.ResponseWriter, req *http.Request, token string, next session.HandlerFunc) {
+	route, ok := tokenRoutes[routePattern(req)][req.Method]
+	if !ok {
+		http.Error(w, "API tokens can't be used for this request", http.StatusForbidden)
+		return
+	}
+
+	apiToken, err := tokens.Authenticate(token)
+	if err == tokens.InvalidTokenErr {
+		http.Error(w, "Invalid or expired API token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error authenticating API token", "error", err)
+		http.Error(w, "Error authenticating API token", http.StatusInternalServerError)
+		return
+	}
+
+	if !tokens.HasScope(apiToken, route.scopes...) {
+		http.Error(w, "API token is missing the required scope", http.StatusForbidden)
+		return
+	}
+
+	ctx := tokens.NewContext(req.Context(), apiToken)
+	switch route.resource {
+	case folderResource:
+		err = tokens.CheckFolder(ctx, apiToken.UserID, req.PathValue("id"))
+	case fileResource:
+		err = tokens.CheckFile(ctx, apiToken.UserID, req.PathValue("id"))
+	case downloadResource:
+		err = tokens.CheckDownload(ctx, apiToken.UserID, req.PathValue("id"))
+	}
+
+	if err != nil {
+		http.Error(w, "API token can't access this folder", http.StatusForbidden)
+		return
+	}
+
+	next(w, req.WithContext(ctx), apiToken.UserID)
+}
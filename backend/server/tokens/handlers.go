@@ -0,0 +1,62 @@
+package tokens
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"yeetfile/backend/utils"
+	"yeetfile/shared"
+)
+
+// TokensHandler handles listing (GET) and creating (POST) the user's personal
+// API tokens
+func TokensHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	switch req.Method {
+	case http.MethodGet:
+		tokens, err := getTokens(userID)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "Error fetching API tokens", "error", err)
+			http.Error(w, "Error fetching API tokens", http.StatusInternalServerError)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(tokens)
+	case http.MethodPost:
+		var newToken shared.NewAPIToken
+		if err := utils.LimitedJSONReader(w, req.Body).Decode(&newToken); err != nil {
+			http.Error(w, "Error decoding request body", http.StatusBadRequest)
+			return
+		}
+
+		response, err := createToken(userID, newToken)
+		switch err {
+		case nil:
+		case InvalidNameErr:
+			http.Error(w, "Token name must be 1-64 characters", http.StatusBadRequest)
+			return
+		case InvalidScopeErr, InvalidExpErr, InvalidFolderErr, TokenLimitErr:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		default:
+			slog.ErrorContext(req.Context(), "Error creating API token", "error", err)
+			http.Error(w, "Error creating API token", http.StatusInternalServerError)
+			return
+		}
+
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			http.Error(w, "Error sending response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// TokenHandler handles revoking (DELETE) one of the user's API tokens
+func TokenHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	err := revokeToken(userID, req.PathValue("id"))
+	if err == TokenNotFoundErr {
+		http.Error(w, "Token not found", http.StatusNotFound)
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error revoking API token", "error", err)
+		http.Error(w, "Error revoking API token", http.StatusInternalServerError)
+	}
+}
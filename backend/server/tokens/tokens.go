@@ -0,0 +1,277 @@
+// Package tokens manages personal API tokens, which allow scripts and CI jobs
+// to access a limited part of a user's account without logging in.
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+)
+
+const (
+	maxTokens       = 25
+	maxTokenName    = 64
+	maxFolderDepth  = 100
+	lastUsedRefresh = time.Minute
+)
+
+// Scopes lists every scope that can be granted to a token
+var Scopes = []string{
+	constants.ScopeVaultRead,
+	constants.ScopeVaultWrite,
+	constants.ScopePassRead,
+	constants.ScopeSendCreate,
+}
+
+var (
+	InvalidTokenErr  = errors.New("invalid or expired API token")
+	InvalidNameErr   = errors.New("invalid token name")
+	InvalidScopeErr  = errors.New("invalid token scope")
+	InvalidExpErr    = errors.New("token expiration must be in the future")
+	InvalidFolderErr = errors.New("folder not found")
+	TokenLimitErr    = errors.New("token limit reached")
+	TokenNotFoundErr = errors.New("token not found")
+	FolderDeniedErr  = errors.New("token can't access this folder")
+	MissingScopeErr  = errors.New("token is missing the required scope")
+)
+
+type contextKey struct{}
+
+var tokenContextKey = contextKey{}
+
+// BearerToken returns the API token included in the request's Authorization
+// header, if any
+func BearerToken(req *http.Request) string {
+	header := req.Header.Get("Authorization")
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || !strings.HasPrefix(token, constants.APITokenPrefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// Authenticate returns the stored token matching the value sent by the client,
+// as long as it hasn't expired
+func Authenticate(token string) (db.APIToken, error) {
+	apiToken, err := db.GetAPITokenByHash(hashToken(token))
+	if err == sql.ErrNoRows {
+		return db.APIToken{}, InvalidTokenErr
+	} else if err != nil {
+		return db.APIToken{}, err
+	}
+
+	if !apiToken.Expiration.IsZero() && time.Now().After(apiToken.Expiration) {
+		return db.APIToken{}, InvalidTokenErr
+	}
+
+	if time.Since(apiToken.LastUsed) > lastUsedRefresh {
+		if err = db.UpdateAPITokenLastUsed(apiToken.ID); err != nil {
+			slog.Error("Error updating token last used", "error", err)
+		}
+	}
+
+	return apiToken, nil
+}
+
+// HasScope returns true if the token was granted any of the provided scopes
+func HasScope(token db.APIToken, scopes ...string) bool {
+	for _, scope := range scopes {
+		if slices.Contains(token.Scopes, scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewContext returns a copy of the context with the token used to
+// authenticate the request
+func NewContext(ctx context.Context, token db.APIToken) context.Context {
+	return context.WithValue(ctx, tokenContextKey, token)
+}
+
+// FromContext returns the token used to authenticate the request, if the
+// request was authenticated with a token instead of a session
+func FromContext(ctx context.Context) (db.APIToken, bool) {
+	token, ok := ctx.Value(tokenContextKey).(db.APIToken)
+	return token, ok
+}
+
+// CheckFolder returns FolderDeniedErr if the request was authenticated with a
+// token that is restricted to folders other than the provided folder (or one
+// of its parents). An empty folder ID refers to the user's root folder.
+func CheckFolder(ctx context.Context, userID, folderID string) error {
+	token, ok := FromContext(ctx)
+	if !ok || len(token.FolderIDs) == 0 {
+		return nil
+	}
+
+	if len(folderID) == 0 {
+		folderID = userID
+	}
+
+	for i := 0; i < maxFolderDepth; i++ {
+		if slices.Contains(token.FolderIDs, folderID) {
+			return nil
+		}
+
+		parentID, err := db.GetParentFolderID(folderID)
+		if err != nil || len(parentID) == 0 || parentID == folderID {
+			break
+		}
+
+		folderID = parentID
+	}
+
+	return FolderDeniedErr
+}
+
+// CheckFile is like CheckFolder, but checks the folder containing a file
+func CheckFile(ctx context.Context, userID, fileID string) error {
+	token, ok := FromContext(ctx)
+	if !ok || len(token.FolderIDs) == 0 {
+		return nil
+	}
+
+	folderID, err := db.GetFileFolderID(fileID, userID)
+	if err != nil {
+		return FolderDeniedErr
+	}
+
+	return CheckFolder(ctx, userID, folderID)
+}
+
+// CheckDownload is like CheckFile, but checks the file being downloaded with a
+// download ID (created when fetching the file's metadata) instead of a file ID
+func CheckDownload(ctx context.Context, userID, downloadID string) error {
+	token, ok := FromContext(ctx)
+	if !ok || len(token.FolderIDs) == 0 {
+		return nil
+	}
+
+	fileID, err := db.GetDownload(downloadID, userID)
+	if err != nil {
+		return FolderDeniedErr
+	}
+
+	return CheckFile(ctx, userID, fileID)
+}
+
+// createToken generates and stores a new token for the user. The token value
+// is only included in the response, and can't be retrieved afterward.
+func createToken(
+	userID string,
+	newToken shared.NewAPIToken,
+) (shared.NewAPITokenResponse, error) {
+	name := strings.TrimSpace(newToken.Name)
+	if len(name) == 0 || len(name) > maxTokenName {
+		return shared.NewAPITokenResponse{}, InvalidNameErr
+	} else if len(newToken.Scopes) == 0 {
+		return shared.NewAPITokenResponse{}, InvalidScopeErr
+	} else if !newToken.Expiration.IsZero() && newToken.Expiration.Before(time.Now()) {
+		return shared.NewAPITokenResponse{}, InvalidExpErr
+	}
+
+	for _, scope := range newToken.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return shared.NewAPITokenResponse{}, InvalidScopeErr
+		}
+	}
+
+	for _, folderID := range newToken.FolderIDs {
+		owner, err := db.GetFolderOwner(folderID)
+		if err != nil || owner != userID {
+			return shared.NewAPITokenResponse{}, InvalidFolderErr
+		}
+	}
+
+	count, err := db.CountAPITokens(userID)
+	if err != nil {
+		return shared.NewAPITokenResponse{}, err
+	} else if count >= maxTokens {
+		return shared.NewAPITokenResponse{}, TokenLimitErr
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return shared.NewAPITokenResponse{}, err
+	}
+
+	token := constants.APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	scopes := slices.Clone(newToken.Scopes)
+	slices.Sort(scopes)
+
+	apiToken := db.APIToken{
+		ID:         shared.GenRandomString(16),
+		UserID:     userID,
+		Name:       name,
+		TokenHash:  hashToken(token),
+		Scopes:     slices.Compact(scopes),
+		FolderIDs:  newToken.FolderIDs,
+		Created:    time.Now().UTC(),
+		Expiration: newToken.Expiration,
+	}
+
+	if apiToken.FolderIDs == nil {
+		apiToken.FolderIDs = []string{}
+	}
+
+	if err = db.NewAPIToken(apiToken); err != nil {
+		return shared.NewAPITokenResponse{}, err
+	}
+
+	return shared.NewAPITokenResponse{Token: token, Info: tokenInfo(apiToken)}, nil
+}
+
+// getTokens returns info about all of the user's tokens
+func getTokens(userID string) ([]shared.APIToken, error) {
+	apiTokens, err := db.GetAPITokens(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]shared.APIToken, len(apiTokens))
+	for i, apiToken := range apiTokens {
+		tokens[i] = tokenInfo(apiToken)
+	}
+
+	return tokens, nil
+}
+
+func revokeToken(userID, id string) error {
+	err := db.DeleteAPIToken(id, userID)
+	if err == sql.ErrNoRows {
+		return TokenNotFoundErr
+	}
+
+	return err
+}
+
+func tokenInfo(apiToken db.APIToken) shared.APIToken {
+	return shared.APIToken{
+		ID:         apiToken.ID,
+		Name:       apiToken.Name,
+		Scopes:     apiToken.Scopes,
+		FolderIDs:  apiToken.FolderIDs,
+		Created:    apiToken.Created,
+		Expiration: apiToken.Expiration,
+		LastUsed:   apiToken.LastUsed,
+	}
+}
+
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -0,0 +1,131 @@
+//go:build server_test
+
+package tokens
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+)
+
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"Bearer yft_abc123":    "yft_abc123",
+		"Bearer other_abc123":  "",
+		"Basic yft_abc123":     "",
+		"bearer yft_abc123":    "",
+		"Bearer yft_abc123 \t": "yft_abc123",
+	}
+
+	for header, expected := range tests {
+		req := httptest.NewRequest("GET", "/api/vault/folder/", nil)
+		if len(header) > 0 {
+			req.Header.Set("Authorization", header)
+		}
+
+		if token := BearerToken(req); token != expected {
+			t.Fatalf("Header '%s': expected '%s', got '%s'\n", header, expected, token)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	token := db.APIToken{Scopes: []string{constants.ScopeVaultRead}}
+	if !HasScope(token, constants.ScopeVaultRead, constants.ScopeVaultWrite) {
+		t.Fatalf("Expected token to have vault:read scope\n")
+	} else if HasScope(token, constants.ScopeVaultWrite) {
+		t.Fatalf("Token shouldn't have vault:write scope\n")
+	} else if HasScope(token) {
+		t.Fatalf("Token shouldn't match an empty scope list\n")
+	}
+
+	// Requests authenticated with a session aren't restricted to any folder
+	if err := CheckFolder(context.Background(), "user", "folder"); err != nil {
+		t.Fatalf("Unexpected error without token: %v\n", err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	userID, err := db.NewUser(db.User{PasswordHash: []byte("tokens-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+
+	if err = db.NewRootFolder(userID, []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []shared.NewAPIToken{
+		{Name: " ", Scopes: []string{constants.ScopeVaultRead}},
+		{Name: "Test"},
+		{Name: "Test", Scopes: []string{"vault:admin"}},
+		{Name: "Test", Scopes: []string{constants.ScopeVaultRead}, FolderIDs: []string{"missing"}},
+		{
+			Name:       "Test",
+			Scopes:     []string{constants.ScopeVaultRead},
+			Expiration: time.Now().Add(-time.Hour),
+		},
+	}
+
+	for _, newToken := range invalid {
+		if _, err = createToken(userID, newToken); err == nil {
+			t.Fatalf("Expected error creating token: %+v\n", newToken)
+		}
+	}
+
+	response, err := createToken(userID, shared.NewAPIToken{
+		Name: "CI",
+		Scopes: []string{
+			constants.ScopeVaultWrite,
+			constants.ScopeVaultRead,
+			constants.ScopeVaultRead,
+		},
+		FolderIDs:  []string{userID},
+		Expiration: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(response.Info.Scopes) != 2 {
+		t.Fatalf("Expected duplicate scopes to be removed: %v\n", response.Info.Scopes)
+	}
+
+	apiToken, err := Authenticate(response.Token)
+	if err != nil {
+		t.Fatal(err)
+	} else if apiToken.UserID != userID {
+		t.Fatalf("Token authenticated as the wrong user\n")
+	}
+
+	ctx := NewContext(context.Background(), apiToken)
+	if err = CheckFolder(ctx, userID, ""); err != nil {
+		t.Fatalf("Expected root folder access: %v\n", err)
+	} else if err = CheckFolder(ctx, userID, "missing"); err != FolderDeniedErr {
+		t.Fatalf("Expected denied folder access, got: %v\n", err)
+	}
+
+	if _, err = Authenticate(response.Token + "x"); err != InvalidTokenErr {
+		t.Fatalf("Expected invalid token, got: %v\n", err)
+	}
+
+	tokens, err := getTokens(userID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("Expected 1 token, got %d (error: %v)\n", len(tokens), err)
+	}
+
+	if err = revokeToken(userID, tokens[0].ID); err != nil {
+		t.Fatal(err)
+	} else if err = revokeToken(userID, tokens[0].ID); err != TokenNotFoundErr {
+		t.Fatalf("Expected missing token, got: %v\n", err)
+	}
+
+	if _, err = Authenticate(response.Token); err != InvalidTokenErr {
+		t.Fatalf("Expected revoked token to be invalid, got: %v\n", err)
+	}
+}
@@ -0,0 +1,153 @@
+//go:build server_test
+
+package server
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+func TestTokenAuthRoutes(t *testing.T) {
+	r := newRouter()
+	handler := AuthMiddleware(func(w http.ResponseWriter, req *http.Request, userID string) {
+		t.Fatalf("Handler shouldn't be reached with an unsupported token\n")
+	})
+
+	r.AddRoute(http.MethodGet, string(endpoints.Account), handler)
+	r.AddRoute(http.MethodGet, string(endpoints.APITokens), handler)
+	r.AddRoute(http.MethodPost, string(endpoints.PassFolder), handler)
+
+	// Tokens can't be used for routes missing from tokenRoutes, regardless of
+	// the token's scopes
+	for _, path := range []string{"/api/account", "/api/tokens", "/api/pass/folder/abc"} {
+		method := http.MethodGet
+		if path == "/api/pass/folder/abc" {
+			method = http.MethodPost
+		}
+
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer yft_invalid")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: expected status %d, got %d\n",
+				method, path, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+func TestAuthMiddlewareExpiredSession(t *testing.T) {
+	r := newRouter()
+	handler := AuthMiddleware(func(w http.ResponseWriter, req *http.Request, userID string) {
+		t.Fatalf("Handler shouldn't be reached without a valid session\n")
+	})
+
+	r.AddRoute(http.MethodGet, string(endpoints.DownloadVaultFileData), handler)
+	r.AddRoute(http.MethodGet, string(endpoints.HTMLVault), handler)
+
+	// API routes respond with 401 so that clients can tell the session has
+	// expired, while HTML pages redirect to the login page
+	req := httptest.NewRequest(http.MethodGet, "/api/vault/d/abc/1", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status %d for API route, got %d\n",
+			http.StatusUnauthorized, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/vault", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/login?next=/vault") {
+		t.Fatalf("Expected redirect to login page, got %d: %s\n", w.Code, w.Body.String())
+	}
+}
+
+func TestTokenDownload(t *testing.T) {
+	userID, err := db.NewUser(db.User{PasswordHash: []byte("token-download-test")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = db.DeleteUser(userID) }()
+
+	if err = db.NewRootFolder(userID, []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files are downloaded using a download ID from the file's metadata,
+	// which has to be resolved to the file before checking its folder
+	downloadIDs := make(map[string]string)
+	for _, name := range []string{"allowed", "denied"} {
+		folderID, err := db.NewFolder(shared.NewVaultFolder{
+			Name:         name,
+			ProtectedKey: []byte("key"),
+		}, userID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fileID, err := db.AddVaultItem(userID, shared.VaultUpload{
+			Name:         name,
+			Length:       1,
+			Chunks:       1,
+			FolderID:     folderID,
+			ProtectedKey: []byte("key"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		downloadIDs[name], err = db.InitDownload(fileID, userID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name == "allowed" {
+			token := sha256.Sum256([]byte("yft_download_test"))
+			err = db.NewAPIToken(db.APIToken{
+				ID:        shared.GenRandomString(16),
+				UserID:    userID,
+				Name:      "Download",
+				TokenHash: token[:],
+				Scopes:    []string{constants.ScopeVaultRead},
+				FolderIDs: []string{folderID},
+				Created:   time.Now().UTC(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	r := newRouter()
+	r.AddRoute(http.MethodGet, string(endpoints.DownloadVaultFileData), AuthMiddleware(
+		func(w http.ResponseWriter, req *http.Request, id string) {
+			_, _ = w.Write([]byte("chunk"))
+		}))
+
+	download := func(downloadID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/vault/d/"+downloadID+"/1", nil)
+		req.Header.Set("Authorization", "Bearer yft_download_test")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if status := download(downloadIDs["allowed"]); status != http.StatusOK {
+		t.Fatalf("Expected download in token's folder to succeed, got %d\n", status)
+	} else if status = download(downloadIDs["denied"]); status != http.StatusForbidden {
+		t.Fatalf("Expected download outside token's folder to be denied, got %d\n", status)
+	} else if status = download("missing"); status != http.StatusForbidden {
+		t.Fatalf("Expected missing download to be denied, got %d\n", status)
+	}
+}
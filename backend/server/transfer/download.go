@@ -1,7 +1,10 @@
 package transfer
 
 import (
+	"io"
+	"log/slog"
 	"yeetfile/backend/cache"
+	"yeetfile/backend/metrics"
 	"yeetfile/backend/storage"
 	"yeetfile/shared/constants"
 )
@@ -10,16 +13,93 @@ type DownloadRequest struct {
 	Password string `json:"password"`
 }
 
-func DownloadFile(b2ID, filename string, length int64, chunk int) (bool, []byte) {
-	start, end, eof := getReadBoundaries(chunk, length)
-	data, _ := storage.Interface.PartialDownloadById(b2ID, filename, start, end)
-	return eof, data
+// ChunkStream is a single chunk of a file being streamed from the storage
+// backend (or the cache) to the client
+type ChunkStream struct {
+	reader  io.ReadCloser
+	cacheID string
+	start   int64
+
+	Size int64
+	EOF  bool
 }
 
-func DownloadFileFromCache(fileID string, length int64, chunk int) (bool, []byte) {
+// OpenChunk returns a stream for a chunk of a file, using the cached copy of
+// the chunk if one exists. Chunks read from the storage backend are written to
+// the cache as they're streamed to the client, and the chunks that follow are
+// prefetched into the cache.
+func OpenChunk(fileID, b2ID, filename string, length int64, chunk int) (*ChunkStream, error) {
 	start, end, eof := getReadBoundaries(chunk, length)
-	data, _ := cache.Read(fileID, start, end)
-	return eof, data
+	stream := ChunkStream{start: start, Size: end - start + 1, EOF: eof}
+
+	prefetch.wait(fileID, chunk)
+	if cache.HasFile(fileID, length) || cache.HasRange(fileID, start, end) {
+		reader, err := cache.Read(fileID, start, end)
+		if err == nil {
+			metrics.RecordCacheLookup(true)
+			stream.reader = reader
+			prefetch.after(fileID, b2ID, filename, length, chunk)
+			return &stream, nil
+		}
+
+		slog.Error("Error reading from cache, using storage instead", "error", err)
+	} else {
+		if cache.IsEnabled() {
+			metrics.RecordCacheLookup(false)
+		}
+
+		cache.PrepCache(fileID, length)
+		stream.cacheID = fileID
+	}
+
+	reader, err := storage.Interface.PartialDownloadById(b2ID, filename, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	stream.reader = reader
+	prefetch.after(fileID, b2ID, filename, length, chunk)
+	return &stream, nil
+}
+
+// WriteTo copies the chunk to the provided writer (and the cache, if needed),
+// and closes the chunk once finished. Returns the number of bytes written.
+func (stream *ChunkStream) WriteTo(w io.Writer) (int64, error) {
+	defer stream.reader.Close()
+
+	var cacheWriter *cache.FileWriter
+	if len(stream.cacheID) > 0 {
+		cacheWriter = cache.NewWriter(stream.cacheID, stream.start)
+	}
+
+	dst := w
+	if cacheWriter != nil {
+		dst = io.MultiWriter(w, cacheWriter)
+	}
+
+	n, err := io.Copy(dst, stream.reader)
+	if err == nil && n != stream.Size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if cacheWriter != nil {
+		if err != nil {
+			cacheWriter.Abort()
+		} else {
+			_ = cacheWriter.Close()
+		}
+	}
+
+	return n, err
+}
+
+// PresignChunk returns a presigned request that the client can use to download
+// a chunk of a file directly from the storage backend, along with the size of
+// the chunk
+func PresignChunk(b2ID, filename string, length int64, chunk int) (storage.PresignedRequest, int64, error) {
+	start, end, _ := getReadBoundaries(chunk, length)
+	req, err := storage.PresignDownload(b2ID, filename, start, end)
+	return req, end - start + 1, err
 }
 
 // getReadBoundaries calculates the correct start and end bytes to read from for
@@ -0,0 +1,213 @@
+//go:build server_test
+
+package transfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"yeetfile/backend/cache"
+	"yeetfile/backend/db"
+	"yeetfile/backend/storage"
+	"yeetfile/shared/constants"
+)
+
+var readFailedError = errors.New("read failed")
+
+// storageBackend matches the storage interface, so that the configured
+// backend can be embedded in testStorage
+type storageBackend interface {
+	Authorize() error
+	Reauthorize() error
+	InitUpload(metadataID string) error
+	InitLargeUpload(filename, metadataID string) error
+	UploadSingleChunk(chunk storage.FileChunk, upload db.Upload) error
+	UploadMultiChunk(chunk storage.FileChunk, upload db.Upload) (bool, error)
+	CancelLargeFile(remoteID, filename string) (bool, error)
+	DeleteFile(remoteID, filename string) (bool, error)
+	FinishLargeUpload(remoteID, filename string, checksums []string) (string, int64, error)
+	PartialDownloadById(remoteID, filename string, start, end int64) (io.ReadCloser, error)
+	List(fn func(object storage.StoredObject) error) error
+}
+
+// testStorage serves downloads from files held in memory, optionally
+// returning fewer bytes than requested or failing partway through a read
+type testStorage struct {
+	storageBackend
+	files    map[string][]byte
+	truncate int64
+	fail     bool
+}
+
+func (s *testStorage) PartialDownloadById(remoteID, _ string, start, end int64) (io.ReadCloser, error) {
+	data, ok := s.files[remoteID]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", remoteID)
+	}
+
+	section := data[start:min(end+1, int64(len(data)))]
+	if s.truncate > 0 {
+		section = section[:int64(len(section))-s.truncate]
+	}
+
+	var reader io.Reader = bytes.NewReader(section)
+	if s.fail {
+		reader = io.MultiReader(
+			bytes.NewReader(section[:len(section)/2]),
+			&failingReader{})
+	}
+
+	return io.NopCloser(reader), nil
+}
+
+type failingReader struct{}
+
+func (*failingReader) Read(_ []byte) (int, error) {
+	return 0, readFailedError
+}
+
+// useTestStorage replaces the storage interface with a testStorage containing
+// a single random file, and disables prefetching until the test has finished
+func useTestStorage(t *testing.T, fileID string, length int) (*testStorage, []byte) {
+	data := make([]byte, length)
+	_, _ = rand.Read(data)
+
+	backend := &testStorage{
+		storageBackend: storage.Interface,
+		files:          map[string][]byte{fileID: data},
+	}
+
+	originalStorage := storage.Interface
+	originalPrefetch := prefetch
+	storage.Interface = backend
+	prefetch = newPrefetcher(0, 1, 0)
+
+	t.Cleanup(func() {
+		storage.Interface = originalStorage
+		prefetch = originalPrefetch
+	})
+
+	return backend, data
+}
+
+func enableTestCache(t *testing.T) {
+	err := cache.Configure(t.TempDir(), 1024*1024*100, 1024*1024*100)
+	if err != nil {
+		t.Fatalf("Error configuring cache: %v\n", err)
+	}
+}
+
+// downloadChunk serves a chunk of a file the same way as the download
+// handlers, returning the response and body received by the client
+func downloadChunk(t *testing.T, fileID string, length int64, chunk int) (*http.Response, []byte, error) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		stream, err := OpenChunk(fileID, fileID, "download-test", length, chunk)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.FormatInt(stream.Size, 10))
+		_, _ = stream.WriteTo(w)
+	}))
+
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Error requesting chunk: %v\n", err)
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+func TestChunkContentLength(t *testing.T) {
+	chunkSize := constants.ChunkSize + constants.TotalOverhead
+	fileID := "content-length-test"
+	_, data := useTestStorage(t, fileID, chunkSize*2+1000)
+
+	for chunk := 1; chunk <= 3; chunk++ {
+		resp, body, err := downloadChunk(t, fileID, int64(len(data)), chunk)
+		if err != nil {
+			t.Fatalf("Error reading chunk %d: %v\n", chunk, err)
+		}
+
+		start := (chunk - 1) * chunkSize
+		expected := data[start:min(start+chunkSize, len(data))]
+		if resp.ContentLength != int64(len(body)) {
+			t.Fatalf("Content-Length %d does not match %d streamed bytes\n",
+				resp.ContentLength, len(body))
+		} else if !bytes.Equal(body, expected) {
+			t.Fatalf("Chunk %d does not match file data\n", chunk)
+		}
+	}
+}
+
+func TestChunkCacheWrite(t *testing.T) {
+	enableTestCache(t)
+	fileID := "cache-write-test"
+	backend, data := useTestStorage(t, fileID, 5000)
+	length := int64(len(data))
+
+	stream, err := OpenChunk(fileID, fileID, "download-test", length, 1)
+	if err != nil {
+		t.Fatalf("Error opening chunk: %v\n", err)
+	}
+
+	var buf bytes.Buffer
+	if n, err := stream.WriteTo(&buf); err != nil || n != length {
+		t.Fatalf("Unexpected write result (n: %d, err: %v)\n", n, err)
+	} else if !cache.HasFile(fileID, length) {
+		t.Fatalf("Expected file to be cached after complete read\n")
+	}
+
+	// The next read should come from the cache instead of storage
+	delete(backend.files, fileID)
+	resp, body, err := downloadChunk(t, fileID, length, 1)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Error reading cached chunk (status: %d, err: %v)\n", resp.StatusCode, err)
+	} else if !bytes.Equal(body, data) {
+		t.Fatalf("Cached chunk does not match file data\n")
+	}
+}
+
+func TestChunkCacheIncompleteRead(t *testing.T) {
+	enableTestCache(t)
+	length := int64(5000)
+
+	for _, test := range []struct {
+		name     string
+		truncate int64
+		fail     bool
+		expected error
+	}{
+		{"short-read", 100, false, io.ErrUnexpectedEOF},
+		{"failed-read", 0, true, readFailedError},
+	} {
+		fileID := "cache-" + test.name
+		backend, _ := useTestStorage(t, fileID, int(length))
+		backend.truncate = test.truncate
+		backend.fail = test.fail
+
+		stream, err := OpenChunk(fileID, fileID, "download-test", length, 1)
+		if err != nil {
+			t.Fatalf("Error opening chunk: %v\n", err)
+		}
+
+		if _, err = stream.WriteTo(io.Discard); !errors.Is(err, test.expected) {
+			t.Fatalf("%s: expected %v, got %v\n", test.name, test.expected, err)
+		} else if cache.HasFile(fileID, length) || cache.HasRange(fileID, 0, 0) {
+			t.Fatalf("%s: incomplete chunk should not be cached\n", test.name)
+		} else if cache.IsPending(fileID) {
+			t.Fatalf("%s: cache entry should be removed\n", test.name)
+		}
+	}
+}
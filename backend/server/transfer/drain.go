@@ -0,0 +1,237 @@
+package transfer
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+	"yeetfile/backend/db"
+)
+
+const (
+	// Uploads that haven't received a chunk on this instance recently are
+	// likely abandoned, and aren't waited on when shutting down
+	pendingUploadIdle = 5 * time.Minute
+
+	// Uploads are no longer tracked after this, whether or not they finished
+	pendingUploadTTL = 24 * time.Hour
+
+	// How often to check for uploads that were finished (or taken over) by
+	// another instance while draining
+	drainPollInterval = time.Second
+)
+
+var ShuttingDownError = errors.New("server is shutting down")
+
+// instanceID identifies this server in the pending uploads table, so that
+// uploads that were continued on another instance (i.e. behind a load
+// balancer) aren't aborted when this instance shuts down
+var instanceID = newInstanceID()
+
+// pendingUpload is an upload that has been initialized, but hasn't received
+// all of its chunks yet
+type pendingUpload struct {
+	abort   func(uploaded int64)
+	started time.Time
+	updated time.Time
+}
+
+// uploads tracks every pending upload, so that the server can wait for them to
+// finish before shutting down (and clean up the ones that don't finish)
+var uploads = struct {
+	mu       sync.Mutex
+	draining bool
+	pending  map[string]*pendingUpload
+	changed  chan struct{}
+}{
+	pending: make(map[string]*pendingUpload),
+	changed: make(chan struct{}),
+}
+
+// TrackUpload records a newly initialized upload. The abort function is called
+// with the total size of the chunks received (on any instance) if the upload is
+// still pending when the server shuts down. Returns ShuttingDownError if the
+// server is draining, in which case new uploads shouldn't be started.
+func TrackUpload(id string, abort func(uploaded int64)) error {
+	now := time.Now()
+
+	uploads.mu.Lock()
+	if uploads.draining {
+		uploads.mu.Unlock()
+		return ShuttingDownError
+	}
+
+	expireUploads(now)
+	uploads.pending[id] = &pendingUpload{
+		abort:   abort,
+		started: now,
+		updated: now,
+	}
+	uploads.mu.Unlock()
+
+	err := db.AddPendingUpload(id, instanceID, now.Add(pendingUploadTTL))
+	if err != nil {
+		slog.Error("Error recording pending upload", "id", id, "error", err)
+	}
+
+	return nil
+}
+
+// ChunkReceived records a chunk that was successfully uploaded for a pending
+// upload, along with the amount of storage the chunk used
+func ChunkReceived(id string, size int64) {
+	uploads.mu.Lock()
+	if upload, ok := uploads.pending[id]; ok {
+		upload.updated = time.Now()
+	}
+	uploads.mu.Unlock()
+
+	// The upload may have been started on another instance, which shouldn't
+	// abort it anymore
+	err := db.AddPendingUploadChunk(id, instanceID, size)
+	if err != nil {
+		slog.Error("Error updating pending upload", "id", id, "error", err)
+	}
+}
+
+// UntrackUpload removes an upload once it has either finished or been aborted
+func UntrackUpload(id string) {
+	// The upload is removed from the database even if it was started on
+	// another instance
+	if err := db.RemovePendingUpload(id); err != nil {
+		slog.Error("Error removing pending upload", "id", id, "error", err)
+	}
+
+	uploads.mu.Lock()
+	defer uploads.mu.Unlock()
+
+	untrack(id)
+}
+
+// IsDraining returns true once the server has started shutting down
+func IsDraining() bool {
+	uploads.mu.Lock()
+	defer uploads.mu.Unlock()
+
+	return uploads.draining
+}
+
+// Drain stops new uploads from being started and waits for pending uploads to
+// finish, or until the context is done. Uploads that are idle, or that have
+// been finished or continued by another instance, aren't waited on. Returns
+// the number of uploads that are still pending.
+func Drain(ctx context.Context) int {
+	uploads.mu.Lock()
+	uploads.draining = true
+	uploads.mu.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		releaseUploads()
+
+		uploads.mu.Lock()
+		remaining := 0
+		cutoff := time.Now().Add(-pendingUploadIdle)
+		for _, upload := range uploads.pending {
+			if upload.updated.After(cutoff) {
+				remaining += 1
+			}
+		}
+
+		changed := uploads.changed
+		uploads.mu.Unlock()
+
+		if remaining == 0 {
+			return 0
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return remaining
+		}
+	}
+}
+
+// AbortPending cancels every upload that is still pending on this instance,
+// removing any data that was already uploaded for the file
+func AbortPending() {
+	uploads.mu.Lock()
+	pending := uploads.pending
+	uploads.pending = make(map[string]*pendingUpload)
+	uploads.mu.Unlock()
+
+	for id, upload := range pending {
+		uploaded, err := db.ClaimPendingUpload(id, instanceID)
+		if err == sql.ErrNoRows {
+			slog.Info("Upload was finished or continued by another instance",
+				"id", id)
+			continue
+		} else if err != nil {
+			slog.Error("Error checking pending upload", "id", id, "error", err)
+			continue
+		}
+
+		slog.Info("Canceling unfinished upload", "id", id, "uploaded", uploaded)
+		upload.abort(uploaded)
+	}
+}
+
+// releaseUploads stops tracking uploads that have finished on (or were
+// continued by) another instance
+func releaseUploads() {
+	uploads.mu.Lock()
+	var ids []string
+	for id := range uploads.pending {
+		ids = append(ids, id)
+	}
+	uploads.mu.Unlock()
+
+	for _, id := range ids {
+		owner, err := db.IsPendingUploadOwner(id, instanceID)
+		if err != nil || owner {
+			continue
+		}
+
+		uploads.mu.Lock()
+		untrack(id)
+		uploads.mu.Unlock()
+	}
+}
+
+// expireUploads stops tracking uploads that were started more than
+// pendingUploadTTL ago. Must be called with uploads.mu held.
+func expireUploads(now time.Time) {
+	for id, upload := range uploads.pending {
+		if now.Sub(upload.started) > pendingUploadTTL {
+			untrack(id)
+		}
+	}
+}
+
+// untrack removes an upload from the pending uploads. Must be called with
+// uploads.mu held.
+func untrack(id string) {
+	if _, ok := uploads.pending[id]; !ok {
+		return
+	}
+
+	delete(uploads.pending, id)
+
+	// Wake up anything waiting on the pending uploads to finish
+	close(uploads.changed)
+	uploads.changed = make(chan struct{})
+}
+
+func newInstanceID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,196 @@
+//go:build server_test
+
+package transfer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/shared"
+)
+
+// resetUploads stops draining and removes any uploads left over from a test
+func resetUploads(t *testing.T) {
+	t.Cleanup(func() {
+		uploads.mu.Lock()
+		uploads.draining = false
+		uploads.pending = make(map[string]*pendingUpload)
+		uploads.mu.Unlock()
+	})
+}
+
+func TestDrain(t *testing.T) {
+	resetUploads(t)
+
+	aborted := make(map[string]int64)
+	abortFn := func(id string) func(int64) {
+		return func(uploaded int64) {
+			aborted[id] = uploaded
+		}
+	}
+
+	for _, id := range []string{"finished", "unfinished"} {
+		if err := TrackUpload(id, abortFn(id)); err != nil {
+			t.Fatalf("Unexpected error tracking upload: %v\n", err)
+		}
+	}
+
+	// Retried chunks are counted again, since they're charged again
+	ChunkReceived("unfinished", 100)
+	ChunkReceived("unfinished", 200)
+	ChunkReceived("unfinished", 200)
+
+	// Finish one of the uploads partway through the drain window
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ChunkReceived("finished", 100)
+		UntrackUpload("finished")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if remaining := Drain(ctx); remaining != 1 {
+		t.Fatalf("Expected 1 remaining upload, got %d\n", remaining)
+	}
+
+	if err := TrackUpload("new", abortFn("new")); !errors.Is(err, ShuttingDownError) {
+		t.Fatalf("Expected new uploads to be rejected, got %v\n", err)
+	}
+
+	AbortPending()
+	if len(aborted) != 1 || aborted["unfinished"] != 500 {
+		t.Fatalf("Unexpected aborted uploads: %v\n", aborted)
+	}
+}
+
+func TestDrainOtherInstance(t *testing.T) {
+	resetUploads(t)
+
+	finishedID := shared.GenRandomString(12)
+	continuedID := shared.GenRandomString(12)
+	localID := shared.GenRandomString(12)
+
+	aborted := make(map[string]bool)
+	for _, id := range []string{finishedID, continuedID, localID} {
+		id := id
+		err := TrackUpload(id, func(int64) { aborted[id] = true })
+		if err != nil {
+			t.Fatalf("Unexpected error tracking upload: %v\n", err)
+		}
+	}
+
+	defer func() { _ = db.RemovePendingUpload(continuedID) }()
+
+	// Another instance receives the final chunk of one upload, and continues
+	// receiving chunks for the other
+	if err := db.RemovePendingUpload(finishedID); err != nil {
+		t.Fatal(err)
+	} else if err = db.AddPendingUploadChunk(continuedID, "other-instance", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		UntrackUpload(localID)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*drainPollInterval)
+	defer cancel()
+
+	if remaining := Drain(ctx); remaining != 0 {
+		t.Fatalf("Expected uploads on other instances to be released, got %d\n",
+			remaining)
+	}
+
+	AbortPending()
+	if len(aborted) != 0 {
+		t.Fatalf("Expected no uploads to be aborted, got %v\n", aborted)
+	}
+}
+
+func TestExpireUploads(t *testing.T) {
+	resetUploads(t)
+
+	idleID := shared.GenRandomString(12)
+	expiredID := shared.GenRandomString(12)
+
+	aborted := make(map[string]bool)
+	for _, id := range []string{idleID, expiredID} {
+		id := id
+		err := TrackUpload(id, func(int64) { aborted[id] = true })
+		if err != nil {
+			t.Fatalf("Unexpected error tracking upload: %v\n", err)
+		}
+	}
+
+	defer func() { _ = db.RemovePendingUpload(expiredID) }()
+
+	uploads.mu.Lock()
+	uploads.pending[idleID].updated = time.Now().Add(-pendingUploadIdle)
+	uploads.pending[expiredID].started = time.Now().Add(-pendingUploadTTL)
+	uploads.mu.Unlock()
+
+	// Expired uploads are removed when another upload is tracked
+	newID := shared.GenRandomString(12)
+	if err := TrackUpload(newID, func(int64) { aborted[newID] = true }); err != nil {
+		t.Fatalf("Unexpected error tracking upload: %v\n", err)
+	}
+
+	UntrackUpload(newID)
+
+	uploads.mu.Lock()
+	_, tracked := uploads.pending[expiredID]
+	uploads.mu.Unlock()
+	if tracked {
+		t.Fatalf("Expected expired upload to be removed\n")
+	}
+
+	// Idle uploads aren't waited on, but are still aborted
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if remaining := Drain(ctx); remaining != 0 {
+		t.Fatalf("Expected idle upload to be skipped, got %d\n", remaining)
+	} else if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("Expected drain to return without waiting\n")
+	}
+
+	AbortPending()
+	if len(aborted) != 1 || !aborted[idleID] {
+		t.Fatalf("Unexpected aborted uploads: %v\n", aborted)
+	}
+}
+
+func TestAbortUploadedSize(t *testing.T) {
+	resetUploads(t)
+
+	id := shared.GenRandomString(12)
+	var aborted []int64
+	err := TrackUpload(id, func(uploaded int64) { aborted = append(aborted, uploaded) })
+	if err != nil {
+		t.Fatalf("Unexpected error tracking upload: %v\n", err)
+	}
+
+	// Chunks received by other instances are refunded along with the ones
+	// received by this instance, as long as this instance received the most
+	// recent chunk
+	ChunkReceived(id, 100)
+	if err = db.AddPendingUploadChunk(id, "other-instance", 200); err != nil {
+		t.Fatal(err)
+	}
+
+	ChunkReceived(id, 300)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	Drain(ctx)
+
+	AbortPending()
+	if len(aborted) != 1 || aborted[0] != 600 {
+		t.Fatalf("Expected 600 bytes to be refunded, got %v\n", aborted)
+	}
+}
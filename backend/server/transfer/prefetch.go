@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+	"yeetfile/backend/cache"
+	"yeetfile/backend/storage"
+	"yeetfile/backend/utils"
+)
+
+const (
+	defaultPrefetchChunks      = 2
+	defaultPrefetchConcurrency = 4
+	defaultPrefetchMaxBytes    = 1024 * 1024 * 100 // 100 mb
+
+	// The max amount of time to wait for an in-progress prefetch of a chunk
+	// before reading the chunk from storage instead
+	prefetchWaitTimeout = 30 * time.Second
+)
+
+// prefetcher reads the chunks following a requested chunk into the cache ahead
+// of time, so that the latency of the storage backend isn't paid for every
+// chunk of a download. Prefetching is skipped (rather than queued) when the
+// concurrency or byte limits have been reached.
+type prefetcher struct {
+	chunks   int
+	maxBytes int64
+	slots    chan struct{}
+
+	mu       sync.Mutex
+	bytes    int64
+	inFlight map[string]chan struct{}
+}
+
+var prefetch = newPrefetcher(
+	utils.GetEnvVarInt("YEETFILE_PREFETCH_CHUNKS", defaultPrefetchChunks),
+	utils.GetEnvVarInt("YEETFILE_PREFETCH_CONCURRENCY", defaultPrefetchConcurrency),
+	utils.GetEnvVarInt64("YEETFILE_PREFETCH_MAX_BYTES", defaultPrefetchMaxBytes))
+
+// after starts prefetching the chunks that follow the requested chunk of a
+// file, if the file is being written to the cache
+func (p *prefetcher) after(fileID, b2ID, filename string, length int64, chunk int) {
+	if p.chunks <= 0 || !cache.IsPending(fileID) {
+		return
+	}
+
+	for next := chunk + 1; next <= chunk+p.chunks; next++ {
+		start, end, _ := getReadBoundaries(next, length)
+		if start >= length {
+			return
+		}
+
+		if cache.HasRange(fileID, start, end) {
+			continue
+		}
+
+		done, ok := p.reserve(fileID, next, end-start+1)
+		if !ok {
+			continue
+		}
+
+		go func() {
+			defer p.release(fileID, next, end-start+1, done)
+			err := fetchToCache(fileID, b2ID, filename, start, end)
+			if err != nil {
+				slog.Error("Error prefetching chunk",
+					"id", fileID, "chunk", next, "error", err)
+			}
+		}()
+	}
+}
+
+// wait blocks until an in-progress prefetch of a chunk has finished (if there
+// is one), or until the wait timeout has been reached
+func (p *prefetcher) wait(fileID string, chunk int) {
+	p.mu.Lock()
+	done, ok := p.inFlight[prefetchKey(fileID, chunk)]
+	p.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(prefetchWaitTimeout):
+	}
+}
+
+// reserve claims a concurrency slot and size bytes of the prefetch limit for a
+// chunk. Returns false if the chunk is already being prefetched or if either
+// limit has been reached.
+func (p *prefetcher) reserve(fileID string, chunk int, size int64) (chan struct{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := prefetchKey(fileID, chunk)
+	if _, ok := p.inFlight[key]; ok || p.bytes+size > p.maxBytes {
+		return nil, false
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return nil, false
+	}
+
+	done := make(chan struct{})
+	p.inFlight[key] = done
+	p.bytes += size
+	return done, true
+}
+
+func (p *prefetcher) release(fileID string, chunk int, size int64, done chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.inFlight, prefetchKey(fileID, chunk))
+	p.bytes -= size
+	<-p.slots
+	close(done)
+}
+
+// fetchToCache reads a range of a file from the storage backend and writes it
+// to the cache
+func fetchToCache(fileID, b2ID, filename string, start, end int64) error {
+	cacheWriter := cache.NewWriter(fileID, start)
+	if cacheWriter == nil {
+		return nil
+	}
+
+	reader, err := storage.Interface.PartialDownloadById(b2ID, filename, start, end)
+	if err != nil {
+		cacheWriter.Abort()
+		return err
+	}
+
+	defer reader.Close()
+
+	n, err := io.Copy(cacheWriter, reader)
+	if err == nil && n != end-start+1 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		cacheWriter.Abort()
+		return err
+	}
+
+	return cacheWriter.Close()
+}
+
+func prefetchKey(fileID string, chunk int) string {
+	return fmt.Sprintf("%s/%d", fileID, chunk)
+}
+
+func newPrefetcher(chunks, concurrency int, maxBytes int64) *prefetcher {
+	return &prefetcher{
+		chunks:   chunks,
+		maxBytes: maxBytes,
+		slots:    make(chan struct{}, max(concurrency, 1)),
+		inFlight: make(map[string]chan struct{}),
+	}
+}
@@ -0,0 +1,58 @@
+//go:build server_test
+
+package transfer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrefetchLimits(t *testing.T) {
+	p := newPrefetcher(4, 2, 300)
+
+	doneA, ok := p.reserve("file", 2, 100)
+	if !ok {
+		t.Fatalf("Expected to reserve first chunk\n")
+	}
+
+	if _, ok = p.reserve("file", 2, 100); ok {
+		t.Fatalf("Chunk should only be prefetched once\n")
+	}
+
+	if _, ok = p.reserve("file", 3, 250); ok {
+		t.Fatalf("Expected byte limit to be reached\n")
+	}
+
+	doneB, ok := p.reserve("file", 3, 100)
+	if !ok {
+		t.Fatalf("Expected to reserve second chunk\n")
+	}
+
+	if _, ok = p.reserve("file", 4, 100); ok {
+		t.Fatalf("Expected concurrency limit to be reached\n")
+	}
+
+	// Waiting on a chunk returns once its prefetch has been released
+	go p.release("file", 2, 100, doneA)
+	waited := make(chan struct{})
+	go func() {
+		p.wait("file", 2)
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for prefetch to finish\n")
+	}
+
+	if _, ok = p.reserve("file", 4, 100); !ok {
+		t.Fatalf("Expected to reserve chunk after release\n")
+	}
+
+	p.release("file", 3, 100, doneB)
+	if p.bytes != 100 || len(p.inFlight) != 1 {
+		t.Fatalf("Unexpected prefetch state (bytes: %d, in flight: %d)\n",
+			p.bytes, len(p.inFlight))
+	}
+}
@@ -4,14 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
-	"yeetfile/backend/cache"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
+	"yeetfile/backend/metrics"
 	"yeetfile/backend/server/transfer"
 	"yeetfile/backend/storage"
 	"yeetfile/backend/utils"
@@ -26,13 +25,15 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 	data, _ := utils.LimitedReader(w, req.Body)
 	err := json.Unmarshal(data, &meta)
 	if err != nil {
-		log.Printf("%v\n", req.Body)
-		log.Printf("Error: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error decoding request body", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if meta.Chunks == 0 {
+	if transfer.IsDraining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	} else if meta.Chunks == 0 {
 		http.Error(w, "# of chunks cannot be 0", http.StatusBadRequest)
 		return
 	} else if meta.Downloads == 0 {
@@ -52,7 +53,7 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 	id, _ := db.InsertMetadata(meta.Chunks, userID, meta.Name, false)
 	err = db.CreateNewUpload(id, meta.Name)
 	if err != nil {
-		log.Printf("Error initializing new upload: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error initializing new upload", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -60,7 +61,7 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 	exp := utils.StrToDuration(meta.Expiration, config.IsDebugMode)
 	err = db.SetFileExpiry(id, meta.Downloads, time.Now().Add(exp).UTC())
 	if err != nil {
-		log.Printf("Error setting file expiry: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error setting file expiry", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -72,11 +73,20 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 	}
 
 	if err != nil {
-		log.Println("Error initializing storage", err)
+		slog.ErrorContext(req.Context(), "Error initializing storage", "error", err)
 		http.Error(w, "Error initializing storage", http.StatusInternalServerError)
 		return
 	}
 
+	err = transfer.TrackUpload(id, func(uploaded int64) {
+		abortPendingUpload(id, userID, uploaded)
+	})
+	if err != nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		abortPendingUpload(id, userID, 0)
+		return
+	}
+
 	err = json.NewEncoder(w).Encode(shared.MetadataUploadResponse{ID: id})
 	if err != nil {
 		http.Error(w, "Error sending response", http.StatusInternalServerError)
@@ -87,9 +97,8 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 // UploadDataHandler handles the process of uploading file chunks to the server,
 // after having already initialized the file metadata beforehand.
 func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string) {
-	segments := strings.Split(req.URL.Path, "/")
-	id := segments[len(segments)-2]
-	chunkNum, err := strconv.Atoi(segments[len(segments)-1])
+	id := req.PathValue("id")
+	chunkNum, err := strconv.Atoi(req.PathValue("chunk"))
 	if err != nil {
 		http.Error(w, "Invalid upload URL", http.StatusBadRequest)
 		return
@@ -97,14 +106,15 @@ func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string)
 
 	data, err := utils.LimitedChunkReader(w, req.Body)
 	if err != nil {
-		log.Printf("[YF Send] Chunk reader err: %v\n", err)
+		slog.ErrorContext(req.Context(), "Chunk reader err",
+			"service", "send", "error", err)
 		http.Error(w, "Error", http.StatusBadRequest)
 		return
 	}
 
 	metadata, err := db.RetrieveMetadata(id)
 	if err != nil || metadata.Expiration.Before(time.Now().UTC()) {
-		log.Printf("[YF Send] Metadata err: %v\n", err)
+		slog.ErrorContext(req.Context(), "Metadata err", "service", "send", "error", err)
 		http.Error(w, "No metadata found for file", http.StatusBadRequest)
 		return
 	}
@@ -120,7 +130,8 @@ func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string)
 		abortUpload(metadata, userID, meterAmount, chunkNum)
 		return
 	} else if err != nil {
-		log.Printf("[YF Send] Error updating meter: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error updating meter",
+			"service", "send", "error", err)
 	}
 
 	// Upload content
@@ -135,13 +146,17 @@ func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string)
 	}
 
 	if err != nil {
-		log.Printf("[YF Send] Chunk upload err: %v\n", err)
+		slog.ErrorContext(req.Context(), "Chunk upload err",
+			"service", "send", "error", err)
 		http.Error(w, "Upload error", http.StatusBadRequest)
 		abortUpload(metadata, userID, meterAmount, chunkNum)
 		return
 	}
 
+	metrics.AddTransferBytes(metrics.Send, metrics.Upload, int64(len(data)))
+	transfer.ChunkReceived(id, int64(meterAmount))
 	if finishedUploading {
+		transfer.UntrackUpload(id)
 		_, _ = io.WriteString(w, id)
 	}
 }
@@ -152,7 +167,7 @@ func UploadPlaintextHandler(w http.ResponseWriter, req *http.Request, _ string)
 	var plaintextUpload shared.PlaintextUpload
 	err := utils.LimitedJSONReader(w, req.Body).Decode(&plaintextUpload)
 	if err != nil {
-		log.Printf("Error: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error decoding request body", "error", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -164,14 +179,15 @@ func UploadPlaintextHandler(w http.ResponseWriter, req *http.Request, _ string)
 
 	id, err := db.InsertMetadata(1, "", plaintextUpload.Name, true)
 	if err != nil {
-		log.Printf("Error inserting new text-only upload metadata: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error inserting new text-only upload metadata",
+			"error", err)
 		http.Error(w, "Unable to init metadata", http.StatusInternalServerError)
 		return
 	}
 
 	err = db.CreateNewUpload(id, plaintextUpload.Name)
 	if err != nil {
-		log.Printf("Error initializing new upload: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error initializing new upload", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -179,7 +195,7 @@ func UploadPlaintextHandler(w http.ResponseWriter, req *http.Request, _ string)
 	exp := utils.StrToDuration(plaintextUpload.Expiration, config.IsDebugMode)
 	err = db.SetFileExpiry(id, plaintextUpload.Downloads, time.Now().UTC().Add(exp))
 	if err != nil {
-		log.Printf("Error setting file expiry: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error setting file expiry", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -214,8 +230,7 @@ func UploadPlaintextHandler(w http.ResponseWriter, req *http.Request, _ string)
 // DownloadHandler fetches metadata for downloading a file, such as the name of
 // the file, the number of chunks, expiration, etc.
 func DownloadHandler(w http.ResponseWriter, req *http.Request) {
-	segments := strings.Split(req.URL.Path, "/")
-	id := segments[len(segments)-1]
+	id := req.PathValue("id")
 
 	metadata, err := db.RetrieveMetadata(id)
 	if err != nil || metadata.Expiration.Before(time.Now().UTC()) {
@@ -244,15 +259,8 @@ func DownloadHandler(w http.ResponseWriter, req *http.Request) {
 // num from the file path and the decryption key in the header.
 // Ex: /d/abc123/2 -- download the second chunk of file with id "abc123"
 func DownloadChunkHandler(w http.ResponseWriter, req *http.Request) {
-	segments := strings.Split(req.URL.Path, "/")
-
-	if len(segments) < 3 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
-		return
-	}
-
-	id := segments[len(segments)-2]
-	chunk, _ := strconv.Atoi(segments[len(segments)-1])
+	id := req.PathValue("id")
+	chunk, _ := strconv.Atoi(req.PathValue("chunk"))
 	if chunk <= 0 {
 		chunk = 1 // Downloads begin with chunk #1
 	}
@@ -263,39 +271,41 @@ func DownloadChunkHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	var (
-		eof   bool
-		bytes []byte
-	)
-
-	if cache.HasFile(id, metadata.Length) {
-		eof, bytes = transfer.DownloadFileFromCache(id, metadata.Length, chunk)
-	} else {
-		cache.PrepCache(id, metadata.Length)
-		eof, bytes = transfer.DownloadFile(
-			metadata.B2ID,
-			metadata.Name,
-			metadata.Length,
-			chunk)
-		_ = cache.Write(id, bytes)
+	stream, err := transfer.OpenChunk(
+		id,
+		metadata.B2ID,
+		metadata.Name,
+		metadata.Length,
+		chunk)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error opening file chunk", "error", err)
+		http.Error(w, "Error downloading file", http.StatusInternalServerError)
+		return
 	}
 
 	// If the file is finished downloading, decrease the download counter
 	// for that file, and delete if 0 are remaining
 	rem := -1
-	if eof {
+	if stream.EOF {
 		exp := db.GetFileExpiry(metadata.ID)
 		rem = db.DecrementDownloads(metadata.ID)
 
-		if rem == 0 {
-			storage.DeleteFileByMetadata(metadata)
-		}
-
 		if rem >= 0 {
 			w.Header().Set("Downloads", strconv.Itoa(rem))
 		}
 		w.Header().Set("Date", fmt.Sprintf("%s", exp.Date.String()))
 	}
 
-	_, _ = w.Write(bytes)
+	w.Header().Set("Content-Length", strconv.FormatInt(stream.Size, 10))
+	written, err := stream.WriteTo(w)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error streaming file chunk", "error", err)
+	}
+
+	metrics.AddTransferBytes(metrics.Send, metrics.Download, written)
+
+	// The file can only be removed once the final chunk has been streamed
+	if rem == 0 {
+		storage.DeleteFileByMetadata(metadata)
+	}
 }
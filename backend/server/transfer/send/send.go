@@ -1,13 +1,15 @@
 package send
 
 import (
-	"log"
+	"log/slog"
 	"yeetfile/backend/db"
+	"yeetfile/backend/server/transfer"
 	"yeetfile/backend/storage"
 	"yeetfile/shared/constants"
 )
 
 func abortUpload(metadata db.FileMetadata, id string, dataLen, chunk int) {
+	transfer.UntrackUpload(metadata.ID)
 	storage.DeleteFileByMetadata(metadata)
 	totalSize := dataLen
 	for chunk > 1 {
@@ -17,6 +19,19 @@ func abortUpload(metadata db.FileMetadata, id string, dataLen, chunk int) {
 
 	err := UpdateUserMeter(-totalSize, id)
 	if err != nil {
-		log.Printf("Error updating user's meter during abort: %v\n", err)
+		slog.Error("Error updating user's meter during abort", "error", err)
 	}
 }
+
+// abortPendingUpload cancels an upload that was still in progress when the
+// server was shut down, refunding the user's send meter for the chunks received
+func abortPendingUpload(id, userID string, uploaded int64) {
+	metadata, err := db.RetrieveMetadata(id)
+	if err != nil {
+		slog.Error("Error fetching metadata for pending upload", "error", err)
+		return
+	}
+
+	metadata.B2ID = db.GetUploadValues(id).UploadID
+	abortUpload(metadata, userID, int(uploaded), 1)
+}
@@ -2,7 +2,7 @@ package send
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
@@ -28,10 +28,12 @@ func UserCanSend(size int64, req *http.Request) (bool, error) {
 	id := session.GetSessionUserID(s)
 	usedSend, availableSend, err := db.GetUserSendLimits(id)
 	if err != nil {
-		log.Printf("Error validating ability to upload: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error validating ability to upload",
+			"error", err)
 		return false, err
 	} else if availableSend-usedSend < size {
-		log.Printf("[Send] Out of space: %d - %d > %d", availableSend, usedSend, size)
+		slog.InfoContext(req.Context(), "Out of send space",
+			"available", availableSend, "used", usedSend, "size", size)
 		return false, OutOfSpaceError
 	}
 
@@ -43,7 +45,7 @@ func UserCanSend(size int64, req *http.Request) (bool, error) {
 func UpdateUserMeter(size int, id string) error {
 	err := db.UpdateUserSendUsed(id, size)
 	if err != nil {
-		log.Printf("Error while updating user storage: %v\n", err)
+		slog.Error("Error while updating user storage", "error", err)
 		return err
 	}
 
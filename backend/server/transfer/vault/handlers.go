@@ -3,20 +3,19 @@ package vault
 import (
 	"encoding/json"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"strings"
-	"yeetfile/backend/cache"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
+	"yeetfile/backend/metrics"
 	"yeetfile/backend/server/session"
+	"yeetfile/backend/server/tokens"
 	"yeetfile/backend/server/transfer"
 	"yeetfile/backend/storage"
 	"yeetfile/backend/utils"
 	"yeetfile/shared"
 	"yeetfile/shared/constants"
-	"yeetfile/shared/endpoints"
 )
 
 type vaultType int
@@ -65,20 +64,14 @@ func FolderHandler(vType vaultType) session.HandlerFunc {
 // folder ID wasn't included in the request, the user's root level folder
 // (distinguished by having the same ID as their account) is returned.
 func folderViewHandler(w http.ResponseWriter, req *http.Request, userID string, passVault bool) {
-	var folderID string
-	segments := utils.GetTrailingURLSegments(
-		req.URL.Path,
-		endpoints.VaultFolder,
-		endpoints.PassFolder)
-	if len(segments) == 0 || len(segments[0]) == 0 {
+	folderID := req.PathValue("id")
+	if len(folderID) == 0 {
 		folderID = userID
-	} else {
-		folderID = segments[0]
 	}
 
 	items, ownership, err := db.GetVaultItems(userID, folderID, passVault)
 	if err != nil {
-		log.Printf("Error fetching vault items: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching vault items", "error", err)
 
 		if err == db.AccessError {
 			http.Error(w, "Unauthorized access",
@@ -93,21 +86,21 @@ func folderViewHandler(w http.ResponseWriter, req *http.Request, userID string,
 
 	folder, err := db.GetFolderInfo(folderID, userID, ownership, false)
 	if err != nil {
-		log.Printf("Error fetching folder info: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching folder info", "error", err)
 		http.Error(w, "Error fetching folder info", http.StatusInternalServerError)
 		return
 	}
 
 	folders, err := db.GetSubfolders(folderID, userID, ownership, passVault)
 	if err != nil {
-		log.Printf("Error fetching subfolders: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching subfolders", "error", err)
 		http.Error(w, "Error fetching subfolders", http.StatusInternalServerError)
 		return
 	}
 
 	keySequence, err := db.GetKeySequence(folderID, userID)
 	if err != nil {
-		log.Printf("Error fetching key sequence: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching key sequence", "error", err)
 		http.Error(w, "Error fetching key sequence", http.StatusInternalServerError)
 		return
 	}
@@ -125,14 +118,19 @@ func newFolderHandler(w http.ResponseWriter, req *http.Request, userID string, p
 	var folder shared.NewVaultFolder
 	err := utils.LimitedJSONReader(w, req.Body).Decode(&folder)
 	if err != nil {
-		log.Printf("Error decoding request body: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error decoding request body", "error", err)
 		http.Error(w, "Error decoding request body", http.StatusBadRequest)
 		return
 	}
 
+	if err = tokens.CheckFolder(req.Context(), userID, folder.ParentID); err != nil {
+		http.Error(w, "API token can't access this folder", http.StatusForbidden)
+		return
+	}
+
 	folderID, err := db.NewFolder(folder, userID, passVault)
 	if err != nil {
-		log.Printf("Error creating new folder: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error creating new folder", "error", err)
 		http.Error(w, "Error creating new folder", http.StatusInternalServerError)
 		return
 	}
@@ -146,9 +144,7 @@ func newFolderHandler(w http.ResponseWriter, req *http.Request, userID string, p
 
 // modifyFolderHandler receives request to change or delete an existing folder.
 func modifyFolderHandler(w http.ResponseWriter, req *http.Request, userID string, passVault bool) {
-	segments := strings.Split(req.URL.Path, "/")
-	idPart := strings.Split(segments[len(segments)-1], "?")
-	id := idPart[0]
+	id := req.PathValue("id")
 
 	isShared := len(req.URL.Query().Get("shared")) > 0
 
@@ -166,7 +162,7 @@ func modifyFolderHandler(w http.ResponseWriter, req *http.Request, userID string
 	case http.MethodDelete:
 		freed, err := DeleteVaultFolder(id, userID, isShared, passVault)
 		if err != nil {
-			log.Printf("Error deleting folder: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error deleting folder", "error", err)
 			http.Error(w, "Error deleting folder", http.StatusInternalServerError)
 			return
 		}
@@ -186,13 +182,11 @@ func modifyFolderHandler(w http.ResponseWriter, req *http.Request, userID string
 
 // GetFileHandler handlers requests for information related to a vault file
 func GetFileHandler(w http.ResponseWriter, req *http.Request, userID string) {
-	segments := strings.Split(req.URL.Path, "/")
-	idPart := strings.Split(segments[len(segments)-1], "?")
-	id := idPart[0]
+	id := req.PathValue("id")
 
 	info, err := db.RetrieveFullItemInfo(id, userID)
 	if err != nil {
-		log.Printf("Error retrieving file info: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error retrieving file info", "error", err)
 		http.Error(w, "Error retrieving file info", http.StatusBadRequest)
 		return
 	}
@@ -206,9 +200,7 @@ func GetFileHandler(w http.ResponseWriter, req *http.Request, userID string) {
 
 // ModifyFileHandler handles requests to modify an existing file in the user's vault
 func ModifyFileHandler(w http.ResponseWriter, req *http.Request, userID string) {
-	segments := strings.Split(req.URL.Path, "/")
-	idPart := strings.Split(segments[len(segments)-1], "?")
-	id := idPart[0]
+	id := req.PathValue("id")
 
 	isShared := len(req.URL.Query().Get("shared")) > 0
 
@@ -219,7 +211,7 @@ func ModifyFileHandler(w http.ResponseWriter, req *http.Request, userID string)
 		var fileMod shared.ModifyVaultItem
 		modErr = utils.LimitedJSONReader(w, req.Body).Decode(&fileMod)
 		if modErr != nil {
-			log.Printf("Error decoding request: %v\n", modErr)
+			slog.ErrorContext(req.Context(), "Error decoding request", "error", modErr)
 			break
 		}
 		modErr = updateVaultFile(id, userID, fileMod)
@@ -235,7 +227,7 @@ func ModifyFileHandler(w http.ResponseWriter, req *http.Request, userID string)
 	}
 
 	if modErr != nil {
-		log.Printf("Error modifying file: %v\n", modErr)
+		slog.ErrorContext(req.Context(), "Error modifying file", "error", modErr)
 		http.Error(w, "Error modifying file", http.StatusBadRequest)
 	} else if modResponse != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -252,10 +244,22 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 		return
 	}
 
-	if upload.PasswordData == nil || len(upload.PasswordData) == 0 {
+	if err = tokens.CheckFolder(req.Context(), userID, upload.FolderID); err != nil {
+		http.Error(w, "API token can't access this folder", http.StatusForbidden)
+		return
+	}
+
+	isFile := upload.PasswordData == nil || len(upload.PasswordData) == 0
+	if isFile && transfer.IsDraining() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if isFile {
 		err = CanUserUpload(upload.Length, userID, upload.FolderID)
 		if err != nil {
-			log.Printf("Error checking if user can upload file: %v\n", err)
+			slog.ErrorContext(req.Context(), "Error checking if user can upload file",
+				"error", err)
 			http.Error(w, "Not enough storage available", http.StatusBadRequest)
 			return
 		}
@@ -263,7 +267,7 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 
 	itemID, err := db.AddVaultItem(userID, upload)
 	if err != nil {
-		log.Printf("Error initializing vault upload: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error initializing vault upload", "error", err)
 		http.Error(w, "Error initializing vault upload", http.StatusBadRequest)
 		return
 	}
@@ -280,7 +284,7 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 
 	err = db.CreateNewUpload(itemID, upload.Name)
 	if err != nil {
-		log.Printf("Error initializing new upload: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error initializing new upload", "error", err)
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
@@ -297,7 +301,19 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(shared.MetadataUploadResponse{ID: itemID})
+	err = transfer.TrackUpload(itemID, func(uploaded int64) {
+		abortPendingUpload(itemID, userID, uploaded)
+	})
+	if err != nil {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		abortPendingUpload(itemID, userID, 0)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(shared.MetadataUploadResponse{
+		ID:        itemID,
+		Presigned: storage.CanPresign(),
+	})
 	if err != nil {
 		http.Error(w, "Error sending response", http.StatusInternalServerError)
 		return
@@ -307,9 +323,8 @@ func UploadMetadataHandler(w http.ResponseWriter, req *http.Request, userID stri
 // UploadDataHandler processes incoming chunks of encrypted file data for a
 // vault file
 func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string) {
-	segments := strings.Split(req.URL.Path, "/")
-	id := segments[len(segments)-2]
-	chunkNum, err := strconv.Atoi(segments[len(segments)-1])
+	id := req.PathValue("id")
+	chunkNum, err := strconv.Atoi(req.PathValue("chunk"))
 	if err != nil {
 		http.Error(w, "Invalid upload URL", http.StatusBadRequest)
 		return
@@ -317,21 +332,24 @@ func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string)
 
 	metadata, err := db.RetrieveVaultMetadata(id, userID)
 	if err != nil {
-		log.Printf("[YF Vault] Error fetching metadata: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching metadata",
+			"service", "vault", "error", err)
 		http.Error(w, "No metadata found", http.StatusBadRequest)
 		return
 	}
 
 	data, err := utils.LimitedChunkReader(w, req.Body)
 	if err != nil {
-		log.Printf("[YF Vault] Error reading uploaded data: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error reading uploaded data",
+			"service", "vault", "error", err)
 		http.Error(w, "Error reading request", http.StatusBadRequest)
 		abortUpload(metadata, userID, 0, chunkNum)
 		return
 	}
 
 	if chunkNum > metadata.Chunks {
-		log.Printf("[YF Vault] User uploading beyond stated # of chunks")
+		slog.WarnContext(req.Context(), "User uploading beyond stated # of chunks",
+			"service", "vault")
 		http.Error(w, "Attempting to upload more chunks than specified",
 			http.StatusBadRequest)
 		abortUpload(metadata, userID, 0, chunkNum)
@@ -375,12 +393,207 @@ func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string)
 
 	if err != nil {
 		http.Error(w, "Error uploading file", http.StatusBadRequest)
-		log.Printf("[YF Vault] Error uploading file: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error uploading file",
+			"service", "vault", "error", err)
 		abortUpload(metadata, userID, totalSize, chunkNum)
 		return
 	}
 
+	metrics.AddTransferBytes(metrics.Vault, metrics.Upload, int64(len(data)))
+	transfer.ChunkReceived(id, totalSize)
+	if finishedUploading {
+		transfer.UntrackUpload(id)
+		_, _ = io.WriteString(w, id)
+	}
+}
+
+// UploadPresignHandler handles requests for presigned chunk uploads, which
+// allow the client to upload encrypted file data directly to the storage
+// backend. Each chunk is requested (POST) before uploading, and confirmed (PUT)
+// after the upload has finished.
+func UploadPresignHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	if !storage.CanPresign() {
+		http.Error(w, "Presigned uploads are not enabled", http.StatusNotFound)
+		return
+	}
+
+	var fn session.HandlerFunc
+	switch req.Method {
+	case http.MethodPost:
+		fn = presignUploadHandler
+	case http.MethodPut:
+		fn = finishPresignedUploadHandler
+	}
+
+	fn(w, req, userID)
+}
+
+// presignUploadHandler returns a presigned request for uploading a chunk of a
+// vault file. Storage is accounted for when the request is created, since the
+// chunk size is part of the request signature.
+func presignUploadHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	id := req.PathValue("id")
+	chunkNum, err := strconv.Atoi(req.PathValue("chunk"))
+	if err != nil || chunkNum <= 0 {
+		http.Error(w, "Invalid upload URL", http.StatusBadRequest)
+		return
+	}
+
+	var presignReq shared.PresignedChunkRequest
+	err = utils.LimitedJSONReader(w, req.Body).Decode(&presignReq)
+	if err != nil {
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := db.RetrieveVaultMetadata(id, userID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching metadata",
+			"service", "vault", "error", err)
+		http.Error(w, "No metadata found", http.StatusBadRequest)
+		return
+	}
+
+	if chunkNum > metadata.Chunks {
+		slog.WarnContext(req.Context(), "User uploading beyond stated # of chunks",
+			"service", "vault")
+		http.Error(w, "Attempting to upload more chunks than specified",
+			http.StatusBadRequest)
+		abortPresignedUpload(metadata)
+		return
+	}
+
+	maxSize := int64(constants.ChunkSize + constants.TotalOverhead)
+	if presignReq.Size <= int64(constants.TotalOverhead) || presignReq.Size > maxSize {
+		http.Error(w, "Invalid chunk size", http.StatusBadRequest)
+		return
+	}
+
+	chargedUserID := userID
+	if !metadata.OwnsParentFolder {
+		chargedUserID, err = db.GetFolderOwner(metadata.FolderID)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "Error fetching folder owner",
+				"service", "vault", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Each chunk is only charged the first time it's presigned, and the
+	// charge is recorded so that the same amount is refunded if the upload
+	// is aborted
+	totalSize := presignReq.Size - int64(constants.TotalOverhead)
+	newChunk, err := db.AddPresignedChunk(metadata.ID, chunkNum, totalSize, chargedUserID)
+	if err == db.PresignedChunkSizeErr {
+		http.Error(w, "Chunk was already requested with a different size",
+			http.StatusBadRequest)
+		return
+	} else if err != nil {
+		slog.ErrorContext(req.Context(), "Error recording presigned chunk",
+			"service", "vault", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if newChunk {
+		if metadata.OwnsParentFolder {
+			err = db.UpdateStorageUsed(userID, totalSize)
+		} else {
+			err = db.UpdateFolderOwnerStorage(metadata.FolderID, totalSize)
+		}
+	}
+
+	if err != nil {
+		// Storage is still updated when the limit is exceeded, so the
+		// chunk is only removed if the user wasn't charged for it
+		if err != db.UserStorageExceeded {
+			_ = db.RemovePresignedChunk(metadata.ID, chunkNum)
+		}
+
+		abortPresignedUpload(metadata)
+		http.Error(w, "Attempting to upload beyond max storage",
+			http.StatusBadRequest)
+		return
+	}
+
+	fileChunk, uploadValues, err := transfer.PrepareUpload(metadata, chunkNum, nil)
+	if err != nil {
+		http.Error(w, "Unable to initialize chunk upload",
+			http.StatusBadRequest)
+		abortPresignedUpload(metadata)
+		return
+	}
+
+	presigned, err := storage.PresignUpload(fileChunk, uploadValues, presignReq.Size)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error presigning upload",
+			"service", "vault", "error", err)
+		http.Error(w, "Error presigning upload", http.StatusInternalServerError)
+		abortPresignedUpload(metadata)
+		return
+	}
+
+	writePresignedChunk(w, presigned)
+}
+
+// finishPresignedUploadHandler records a chunk that was uploaded using a
+// presigned request. Once the final chunk has been recorded, the ID of the file
+// is returned (matching the response from UploadDataHandler).
+func finishPresignedUploadHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	id := req.PathValue("id")
+	chunkNum, err := strconv.Atoi(req.PathValue("chunk"))
+	if err != nil || chunkNum <= 0 {
+		http.Error(w, "Invalid upload URL", http.StatusBadRequest)
+		return
+	}
+
+	var result shared.PresignedChunkResult
+	err = utils.LimitedJSONReader(w, req.Body).Decode(&result)
+	if err != nil {
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := db.RetrieveVaultMetadata(id, userID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching metadata",
+			"service", "vault", "error", err)
+		http.Error(w, "No metadata found", http.StatusBadRequest)
+		return
+	} else if chunkNum > metadata.Chunks {
+		http.Error(w, "Invalid chunk", http.StatusBadRequest)
+		return
+	}
+
+	fileChunk, uploadValues, err := transfer.PrepareUpload(metadata, chunkNum, nil)
+	if err != nil {
+		http.Error(w, "Unable to finish chunk upload",
+			http.StatusBadRequest)
+		return
+	}
+
+	finishedUploading, err := storage.FinishPresignedUpload(
+		fileChunk,
+		uploadValues,
+		result.ETag)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error finishing presigned upload",
+			"service", "vault", "error", err)
+		http.Error(w, "Error uploading file", http.StatusBadRequest)
+		abortPresignedUpload(metadata)
+		return
+	}
+
+	// Presigned chunks are refunded from presigned_chunks instead
+	transfer.ChunkReceived(id, 0)
 	if finishedUploading {
+		transfer.UntrackUpload(id)
+		if _, err = db.RemovePresignedChunks(metadata.ID); err != nil {
+			slog.ErrorContext(req.Context(), "Error removing presigned chunks",
+				"service", "vault", "error", err)
+		}
+
 		_, _ = io.WriteString(w, id)
 	}
 }
@@ -388,12 +601,11 @@ func UploadDataHandler(w http.ResponseWriter, req *http.Request, userID string)
 // DownloadHandler handles incoming requests for metadata pertaining to a file
 // in the vault that a user wants to download
 func DownloadHandler(w http.ResponseWriter, req *http.Request, userID string) {
-	segments := strings.Split(req.URL.Path, "/")
-	id := segments[len(segments)-1]
+	id := req.PathValue("id")
 
 	metadata, err := db.RetrieveVaultMetadata(id, userID)
 	if err != nil {
-		log.Println("Error fetching metadata:", err)
+		slog.ErrorContext(req.Context(), "Error fetching metadata", "error", err)
 		http.Error(w, "Error fetching metadata", http.StatusBadRequest)
 		return
 	}
@@ -403,11 +615,11 @@ func DownloadHandler(w http.ResponseWriter, req *http.Request, userID string) {
 	if config.YeetFileConfig.DefaultUserStorage > 0 {
 		bandwidth, err := db.GetUserBandwidth(userID)
 		if err != nil {
-			log.Println("Server error:", err)
+			slog.ErrorContext(req.Context(), "Server error", "error", err)
 			http.Error(w, "Server error", http.StatusInternalServerError)
 			return
 		} else if bandwidth < metadata.Length {
-			log.Printf("Bandwidth limit triggered")
+			slog.InfoContext(req.Context(), "Bandwidth limit triggered")
 			http.Error(w, "Bandwidth limit reached -- contact YeetFile "+
 				"support or try again tomorrow.", http.StatusForbidden)
 			return
@@ -418,7 +630,7 @@ func DownloadHandler(w http.ResponseWriter, req *http.Request, userID string) {
 	if metadata.PasswordData == nil || len(metadata.PasswordData) == 0 {
 		downloadID, err = db.InitDownload(metadata.RefID, userID, metadata.Chunks)
 		if err != nil {
-			log.Println("Error initializing download:", err)
+			slog.ErrorContext(req.Context(), "Error initializing download", "error", err)
 			http.Error(w, "Error initializing download", http.StatusInternalServerError)
 			return
 		}
@@ -431,6 +643,7 @@ func DownloadHandler(w http.ResponseWriter, req *http.Request, userID string) {
 		Size:         metadata.Length,
 		ProtectedKey: metadata.ProtectedKey,
 		PasswordData: metadata.PasswordData,
+		Presigned:    len(downloadID) > 0 && storage.CanPresign(),
 	}
 
 	jsonData, _ := json.Marshal(response)
@@ -442,65 +655,136 @@ func DownloadHandler(w http.ResponseWriter, req *http.Request, userID string) {
 // DownloadChunkHandler handles requests for encrypted file data for a file in
 // the user's vault
 func DownloadChunkHandler(w http.ResponseWriter, req *http.Request, userID string) {
-	segments := strings.Split(req.URL.Path, "/")
+	id := req.PathValue("id")
+	chunk, _ := strconv.Atoi(req.PathValue("chunk"))
+	if chunk <= 0 {
+		chunk = 1 // Downloads always begin with chunk 1
+	}
 
-	if len(segments) < 3 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+	metadataID, err := db.GetDownload(id, userID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching download ID", "error", err)
+		http.Error(w, "Error fetching download info", http.StatusInternalServerError)
 		return
 	}
 
-	id := segments[len(segments)-2]
-	chunk, _ := strconv.Atoi(segments[len(segments)-1])
+	metadata, err := db.RetrieveVaultMetadata(metadataID, userID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error fetching metadata", "error", err)
+		http.Error(w, "No metadata found", http.StatusBadRequest)
+		return
+	}
+
+	stream, err := transfer.OpenChunk(
+		id,
+		metadata.B2ID,
+		metadata.Name,
+		metadata.Length,
+		chunk)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error opening file chunk", "error", err)
+		http.Error(w, "Error downloading file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(stream.Size, 10))
+	written, err := stream.WriteTo(w)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error streaming file chunk", "error", err)
+	}
+
+	metrics.AddTransferBytes(metrics.Vault, metrics.Download, written)
+
+	err = db.UpdateDownload(id)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error updating download", "error", err)
+	}
+
+	err = db.UpdateBandwidth(userID, written-int64(constants.TotalOverhead))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error updating bandwidth", "error", err)
+	}
+}
+
+// DownloadPresignHandler returns a presigned request for downloading a chunk
+// of a vault file directly from the storage backend. Download progress and
+// bandwidth are updated when the request is created, since the server isn't
+// involved in the transfer itself.
+func DownloadPresignHandler(w http.ResponseWriter, req *http.Request, userID string) {
+	if !storage.CanPresign() {
+		http.Error(w, "Presigned downloads are not enabled", http.StatusNotFound)
+		return
+	}
+
+	id := req.PathValue("id")
+	chunk, _ := strconv.Atoi(req.PathValue("chunk"))
 	if chunk <= 0 {
 		chunk = 1 // Downloads always begin with chunk 1
 	}
 
 	metadataID, err := db.GetDownload(id, userID)
 	if err != nil {
-		log.Printf("Error fetching download ID: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching download ID", "error", err)
 		http.Error(w, "Error fetching download info", http.StatusInternalServerError)
 		return
 	}
 
 	metadata, err := db.RetrieveVaultMetadata(metadataID, userID)
 	if err != nil {
-		log.Printf("Error fetching metadata: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error fetching metadata", "error", err)
 		http.Error(w, "No metadata found", http.StatusBadRequest)
 		return
+	} else if chunk > metadata.Chunks {
+		http.Error(w, "Invalid chunk", http.StatusBadRequest)
+		return
 	}
 
-	var bytes []byte
-	if cache.HasFile(id, metadata.Length) {
-		_, bytes = transfer.DownloadFileFromCache(id, metadata.Length, chunk)
-	} else {
-		cache.PrepCache(id, metadata.Length)
-		_, bytes = transfer.DownloadFile(
-			metadata.B2ID,
-			metadata.Name,
-			metadata.Length,
-			chunk)
-		_ = cache.Write(id, bytes)
+	presigned, size, err := transfer.PresignChunk(
+		metadata.B2ID,
+		metadata.Name,
+		metadata.Length,
+		chunk)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "Error presigning file chunk", "error", err)
+		http.Error(w, "Error downloading file", http.StatusInternalServerError)
+		return
 	}
 
 	err = db.UpdateDownload(id)
 	if err != nil {
-		log.Printf("Error updating download: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error updating download", "error", err)
 	}
 
-	err = db.UpdateBandwidth(userID, int64(len(bytes)-constants.TotalOverhead))
+	err = db.UpdateBandwidth(userID, size-int64(constants.TotalOverhead))
 	if err != nil {
-		log.Printf("Error updating bandwidth: %v\n", err)
+		slog.ErrorContext(req.Context(), "Error updating bandwidth", "error", err)
+	}
+
+	writePresignedChunk(w, presigned)
+}
+
+// writePresignedChunk sends a presigned storage request to the client
+func writePresignedChunk(w http.ResponseWriter, presigned storage.PresignedRequest) {
+	headers := make(map[string]string)
+	for key := range presigned.Headers {
+		headers[key] = presigned.Headers.Get(key)
 	}
 
-	_, _ = w.Write(bytes)
+	jsonData, _ := json.Marshal(shared.PresignedChunk{
+		URL:     presigned.URL,
+		Method:  presigned.Method,
+		Headers: headers,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(jsonData)
 }
 
 // ShareHandler handles requests to share files or folders within the user's
 // vault, as well as modifying the shared state of those files/folders
 func ShareHandler(isFolder bool) session.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request, userID string) {
-		segments := strings.Split(req.URL.Path, "/")
-		itemID := segments[len(segments)-1]
+		itemID := req.PathValue("id")
 
 		if len(itemID) != db.VaultIDLength {
 			http.Error(w, "Invalid item ID", http.StatusBadRequest)
@@ -559,7 +843,7 @@ func ShareHandler(isFolder bool) session.HandlerFunc {
 		}
 
 		if shareErr != nil {
-			log.Printf("Error with shared content: %v\n", shareErr)
+			slog.Error("Error with shared content", "error", shareErr)
 			http.Error(w, "Error with shared content", http.StatusBadRequest)
 			return
 		}
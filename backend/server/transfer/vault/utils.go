@@ -2,7 +2,7 @@ package vault
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
 )
@@ -31,7 +31,7 @@ func CanUserUpload(size int64, userID, folderID string) error {
 	}
 
 	if err != nil {
-		log.Printf("Error validating ability to upload: %v\n", err)
+		slog.Error("Error validating ability to upload", "error", err)
 		return err
 	} else if availableStorage-usedStorage < size {
 		return OutOfSpaceError
@@ -2,9 +2,10 @@ package vault
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"strings"
 	"yeetfile/backend/db"
+	"yeetfile/backend/server/transfer"
 	"yeetfile/backend/storage"
 	"yeetfile/shared"
 	"yeetfile/shared/constants"
@@ -160,28 +161,25 @@ func deleteVaultFile(id, userID string, isShared bool) (int64, error) {
 
 	deleted, err := storage.Interface.DeleteFile(metadata.B2ID, metadata.Name)
 	if !deleted || err != nil {
-		log.Printf(
-			"Unable to delete vault file from remote storage: '%s'",
-			metadata.ID)
+		slog.Error("Unable to delete vault file from remote storage", "id", metadata.ID)
 		return 0, err
 	}
 
 	if !db.DeleteUploads(metadata.ID) {
-		log.Printf(
-			"Failed to delete b2 records for vault file: '%s'",
-			metadata.ID)
+		slog.Error("Failed to delete b2 records for vault file", "id", metadata.ID)
 	}
 
 	vaultDeleteErr := db.DeleteVaultFile(id, userID)
 	if vaultDeleteErr != nil {
-		log.Printf("Failed to delete vault file from database: '%s' -- %v", id, vaultDeleteErr)
+		slog.Error("Failed to delete vault file from database",
+			"id", id, "error", vaultDeleteErr)
 		return 0, errors.New("failed to delete")
 	}
 
 	totalUploadSize := metadata.Length - int64(constants.TotalOverhead*metadata.Chunks)
 	err = db.UpdateStorageUsed(userID, -totalUploadSize)
 	if err != nil {
-		log.Printf("Failed to update storage for user: %v\n", err)
+		slog.Error("Failed to update storage for user", "error", err)
 	}
 
 	_ = db.RemoveDownloadByFileID(id, userID)
@@ -191,14 +189,55 @@ func deleteVaultFile(id, userID string, isShared bool) (int64, error) {
 }
 
 func abortUpload(metadata db.FileMetadata, userID string, chunkLen int64, chunkNum int) {
+	transfer.UntrackUpload(metadata.ID)
 	storage.DeleteFileByMetadata(metadata)
 	totalSize := chunkLen
 	for chunkNum > 1 {
 		totalSize += int64(constants.ChunkSize)
+		chunkNum -= 1
 	}
 
 	err := db.UpdateStorageUsed(userID, -totalSize)
 	if err != nil {
-		log.Printf("Error adjusting user storage during abort: %v\n", err)
+		slog.Error("Error adjusting user storage during abort", "error", err)
 	}
 }
+
+// abortPresignedUpload cancels an upload that used presigned chunks, refunding
+// the exact amount charged for each chunk to the user that was charged for it
+func abortPresignedUpload(metadata db.FileMetadata) {
+	transfer.UntrackUpload(metadata.ID)
+	chunks, err := db.RemovePresignedChunks(metadata.ID)
+	if err != nil {
+		slog.Error("Error fetching presigned chunks during abort", "error", err)
+	}
+
+	storage.DeleteFileByMetadata(metadata)
+	for _, chunk := range chunks {
+		err = db.UpdateStorageUsed(chunk.UserID, -chunk.Size)
+		if err != nil {
+			slog.Error("Error adjusting user storage during abort", "error", err)
+		}
+	}
+}
+
+// abortPendingUpload cancels an upload that was still in progress when the
+// server was shut down, refunding the storage used by the chunks received
+func abortPendingUpload(id, userID string, uploaded int64) {
+	metadata, err := db.RetrieveVaultMetadata(id, userID)
+	if err != nil {
+		slog.Error("Error fetching metadata for pending upload", "error", err)
+		return
+	}
+
+	presigned, err := db.HasPresignedChunks(id)
+	if err != nil {
+		slog.Error("Error checking for presigned chunks", "error", err)
+		return
+	} else if presigned {
+		abortPresignedUpload(metadata)
+		return
+	}
+
+	abortUpload(metadata, userID, uploaded, 1)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"log/slog"
 	"os"
 	"sort"
 	"time"
@@ -97,8 +98,7 @@ func init() {
 	finalizeUpgrades(upgrades.VaultUpgrades, true)
 
 	if len(upgrades.SendUpgrades) > 0 || len(upgrades.VaultUpgrades) > 0 {
-		log.Printf("-- Loaded %d send upgrades and %d vault upgrades\n",
-			len(upgrades.SendUpgrades),
-			len(upgrades.VaultUpgrades))
+		slog.Info("Loaded upgrades",
+			"send", len(upgrades.SendUpgrades), "vault", len(upgrades.VaultUpgrades))
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/fs"
 	"log"
+	"log/slog"
 	"path/filepath"
 	"strings"
 	"yeetfile/backend/config"
@@ -73,7 +74,7 @@ func minifyStaticFiles(assetType string, fn minifyFn) {
 }
 
 func init() {
-	log.Println("Minifying static assets...")
+	slog.Info("Minifying static assets...")
 	MinifiedFiles = make(map[string][]byte)
 	minifyStaticFiles("js", js.Minify)
 	minifyStaticFiles("css", css.Minify)
@@ -2,29 +2,42 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"github.com/benbusby/b2"
+	b2utils "github.com/benbusby/b2/utils"
+	"io"
 	"log"
-	"os"
-	"strconv"
+	"log/slog"
+	"net/http"
+	"time"
 	"yeetfile/backend/db"
 	"yeetfile/backend/utils"
 )
 
-const defaultStoragePath = "uploads"
+const b2ListPageSize = 1000
+
+// b2DownloadClient is used for streaming file downloads from B2. Unlike the B2
+// library's client, it doesn't limit the total duration of a request, since
+// the response body is only read as fast as the receiving client reads it.
+var b2DownloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
 
 type B2 struct {
 	client      *b2.Service
 	bucketID    string
 	bucketKeyID string
 	bucketKey   string
-
-	local bool
 }
 
 func (b2Backend *B2) Authorize() error {
 	tmp, _, err := b2.AuthorizeAccount(b2Backend.bucketKeyID, b2Backend.bucketKey)
 	if err != nil {
-		log.Println("Error authorizing B2 account", err)
+		slog.Error("Error authorizing B2 account", "error", err)
 		return err
 	}
 
@@ -32,21 +45,19 @@ func (b2Backend *B2) Authorize() error {
 	return nil
 }
 
-func (b2Backend *B2) Reauthorize() {
-	if b2Backend.local {
-		return
-	}
-
-	log.Println("Re-authenticating with Backblaze B2...")
+func (b2Backend *B2) Reauthorize() error {
+	slog.Info("Re-authenticating with Backblaze B2...")
 	prevToken := b2Backend.client.AuthorizationToken
 	err := b2Backend.Authorize()
 	if err != nil {
-		log.Printf("ERROR: Unable to reauthorize B2 client: %v\n", err)
+		slog.Error("Unable to reauthorize B2 client", "error", err)
 	} else if b2Backend.client.AuthorizationToken != prevToken {
-		log.Printf("Backblaze B2 re-authentication successful!")
+		slog.Info("Backblaze B2 re-authentication successful!")
 	} else {
-		log.Println("WARNING: Backblaze B2 re-auth finished, but token did not change!")
+		slog.Warn("Backblaze B2 re-auth finished, but token did not change!")
 	}
+
+	return err
 }
 
 func (b2Backend *B2) InitUpload(metadataID string) error {
@@ -101,7 +112,7 @@ func (b2Backend *B2) UploadSingleChunk(chunk FileChunk, upload db.Upload) error
 	_, checksum := utils.GenChecksum(chunk.Data)
 	_, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
 	if err != nil {
-		log.Printf("Error updating checksums: %v\n", err)
+		slog.Error("Error updating checksums", "error", err)
 		return err
 	}
 
@@ -112,7 +123,7 @@ func (b2Backend *B2) UploadSingleChunk(chunk FileChunk, upload db.Upload) error
 		chunk.Data)
 
 	if err != nil {
-		log.Printf("Error uploading to B2: %v\n", err)
+		slog.Error("Error uploading to B2", "error", err)
 		return err
 	}
 
@@ -128,7 +139,7 @@ func (b2Backend *B2) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool,
 	_, checksum := utils.GenChecksum(chunk.Data)
 	checksums, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
 	if err != nil {
-		log.Printf("Failed to update checksums: %v\n", err)
+		slog.Error("Failed to update checksums", "error", err)
 		return false, err
 	}
 
@@ -153,7 +164,7 @@ func (b2Backend *B2) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool,
 			chunk.Data)
 
 		if err != nil {
-			log.Printf("Error: %v\n", err)
+			slog.Error("Error uploading file part", "error", err)
 			return err
 		}
 
@@ -165,7 +176,7 @@ func (b2Backend *B2) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool,
 	for err != nil && attempt < MaxUploadAttempts {
 		// Try again
 		attempt += 1
-		log.Printf("Retrying (attempt %d)\n", attempt+1)
+		slog.Info("Retrying upload", "attempt", attempt+1)
 		err = uploadChunk()
 	}
 
@@ -201,12 +212,12 @@ func (b2Backend *B2) FinishLargeUpload(b2ID, _ string, checksums []string) (stri
 	largeFile, err := finalize()
 	for err != nil && attempt < MaxUploadAttempts {
 		attempt += 1
-		log.Printf("Retrying finalizing large file (attempt %d)\n", attempt+1)
+		slog.Info("Retrying finalizing large file", "attempt", attempt+1)
 		largeFile, err = finalize()
 	}
 
 	if err != nil {
-		log.Printf("Failed to finalize large file: %v\n", err)
+		slog.Error("Failed to finalize large file", "error", err)
 		return "", 0, err
 	}
 
@@ -218,53 +229,90 @@ func (b2Backend *B2) CancelLargeFile(remoteID, _ string) (bool, error) {
 }
 
 func (b2Backend *B2) DeleteFile(remoteID, filename string) (bool, error) {
-	if len(remoteID) == 0 && !b2Backend.local {
+	if len(remoteID) == 0 {
 		return false, errors.New("b2 ID cannot be empty")
 	}
 	return b2Backend.client.DeleteFile(remoteID, filename)
 }
 
-func (b2Backend *B2) PartialDownloadById(remoteID, _ string, start, end int64) ([]byte, error) {
-	return b2Backend.client.PartialDownloadById(remoteID, start, end)
-}
+// PartialDownloadById requests a range of a file from B2 and returns the
+// response body without reading it into memory first
+func (b2Backend *B2) PartialDownloadById(remoteID, _ string, start, end int64) (io.ReadCloser, error) {
+	reqURL := b2utils.FormatB2URL(
+		b2Backend.client.APIURL,
+		b2Backend.client.APIVersion,
+		b2.APIDownloadById)
 
-// =============================================================================
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	q := req.URL.Query()
+	q.Add("fileId", remoteID)
+	req.URL.RawQuery = q.Encode()
+
+	req.Header.Set("Authorization", b2Backend.client.AuthorizationToken)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	res, err := b2DownloadClient.Do(req)
+	if err != nil {
+		slog.Error("Error downloading from B2", "error", err)
+		return nil, err
+	} else if res.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("B2 download failed (%d): %s",
+			res.StatusCode, body)
+	}
+
+	return res.Body, nil
+}
 
-// initLocalStorage configures the backblaze B2 Go library to store files locally
-// rather than actually storing in B2. This allows the same functionality as
-// remote storage without having to change or add any upload logic.
-func initLocalStorage() storage {
-	var (
-		client *b2.Service
-		err    error
-	)
-
-	log.Println("Setting up local storage...")
-	// Storage will bypass B2 and just store encrypted files on the
-	// machine in the specified path or "uploads/"
-	var limit int64
-	limitStr := os.Getenv("YEETFILE_LOCAL_STORAGE_LIMIT")
-	path := utils.GetEnvVar("YEETFILE_LOCAL_STORAGE_PATH", defaultStoragePath)
-
-	if len(limitStr) > 0 {
-		limit, err = strconv.ParseInt(limitStr, 10, 64)
+// List returns every file version in the bucket, including large files that
+// were started but never finished
+func (b2Backend *B2) List(fn func(object StoredObject) error) error {
+	var startName, startID string
+	for {
+		fileList, err := b2Backend.client.ListFiles(
+			b2Backend.bucketID,
+			b2ListPageSize,
+			startName,
+			startID)
 		if err != nil {
-			log.Fatalf("Invalid storage limit \"%s\"", limitStr)
+			return err
 		}
-	}
 
-	if limit > 0 {
-		client, err = b2.AuthorizeLimitedDummyAccount(path, limit)
-	} else {
-		client, err = b2.AuthorizeDummyAccount(path)
-	}
+		for _, file := range fileList.Files {
+			if file.Action != "upload" && file.Action != "start" {
+				// Hidden files and folders don't have stored content
+				continue
+			}
+
+			err = fn(StoredObject{
+				RemoteID:   file.FileID,
+				Name:       file.FileName,
+				Size:       file.ContentLength,
+				Modified:   time.UnixMilli(int64(file.UploadTimestamp)),
+				Unfinished: file.Action == "start",
+				store:      b2Backend,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(fileList.NextFileName) == 0 {
+			return nil
+		}
 
-	return &B2{
-		client: client,
-		local:  true,
+		startName = fileList.NextFileName
+		startID = fileList.NextFileID
 	}
 }
 
+// =============================================================================
+
 // initB2 initializes the Backblaze B2 storage backend and fetches an authorization
 // token using the provided credentials.
 func initB2() storage {
@@ -282,12 +330,11 @@ func initB2() storage {
 			len(bucketKey) > 0)
 	}
 
-	log.Println("Authorizing B2 account...")
+	slog.Info("Authorizing B2 account...")
 	b2Backend := &B2{
 		bucketID:    bucketID,
 		bucketKeyID: bucketKeyID,
 		bucketKey:   bucketKey,
-		local:       false,
 	}
 
 	err := b2Backend.Authorize()
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+	"yeetfile/shared"
+)
+
+// Objects newer than this may belong to an upload that hasn't been recorded in
+// the database yet, and are never removed
+const gcMinAge = 24 * time.Hour
+
+var gcRunning sync.Mutex
+
+// CollectOrphanedObjects lists the contents of the storage backend and removes
+// any objects that aren't referenced by a send, vault, or upload entry in the
+// database. This catches files that failed to be deleted from the backend, as
+// well as large uploads that were never finished or canceled. If
+// YEETFILE_GC_DRY_RUN is enabled, orphaned objects are only logged.
+func CollectOrphanedObjects() {
+	if !gcRunning.TryLock() {
+		return
+	}
+
+	defer gcRunning.Unlock()
+
+	refs, err := db.GetStoredObjectRefs()
+	if err != nil {
+		slog.Error("Error fetching stored file references", "error", err)
+		return
+	}
+
+	collectOrphanedObjects(Interface, refs, config.YeetFileConfig.GCDryRun)
+}
+
+// collectOrphanedObjects removes the objects listed by the backend that are
+// older than gcMinAge and aren't included in refs
+func collectOrphanedObjects(backend storage, refs db.StoredObjectRefs, dryRun bool) {
+	expandMirrorRefs(refs)
+
+	var listed, orphaned, removed int
+	var orphanedSize int64
+	cutoff := time.Now().Add(-gcMinAge)
+	err := backend.List(func(object StoredObject) error {
+		listed += 1
+		if object.Modified.After(cutoff) || isReferenced(object, refs) {
+			return nil
+		}
+
+		orphaned += 1
+		orphanedSize += object.Size
+
+		if dryRun {
+			slog.Info("Storage GC (dry run): found orphaned object",
+				"object", describeObject(object))
+			return nil
+		}
+
+		err := removeObject(object)
+		if err != nil {
+			slog.Error("Storage GC: error removing orphaned object",
+				"object", describeObject(object), "error", err)
+			return nil
+		}
+
+		slog.Info("Storage GC: removed orphaned object", "object", describeObject(object))
+		removed += 1
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Error listing stored files", "error", err)
+	}
+
+	if dryRun {
+		slog.Info("Storage GC (dry run) finished",
+			"listed", listed, "orphaned", orphaned,
+			"orphaned_size", shared.ReadableFileSize(orphanedSize))
+	} else {
+		slog.Info("Storage GC finished",
+			"listed", listed, "orphaned", orphaned, "removed", removed,
+			"orphaned_size", shared.ReadableFileSize(orphanedSize))
+	}
+}
+
+// expandMirrorRefs adds the primary and secondary remote IDs of mirrored files
+// to the set of referenced IDs
+func expandMirrorRefs(refs db.StoredObjectRefs) {
+	var mirrored []string
+	for remoteID := range refs.RemoteIDs {
+		if strings.HasPrefix(remoteID, mirrorRemoteIDPrefix) {
+			mirrored = append(mirrored, remoteID)
+		}
+	}
+
+	for _, remoteID := range mirrored {
+		for _, id := range splitMirrorID(remoteID) {
+			refs.RemoteIDs[id] = true
+		}
+	}
+}
+
+// isReferenced checks if an object's remote ID or name is used by any file in
+// the database. Some backends (S3) store files by name instead of by ID.
+func isReferenced(object StoredObject, refs db.StoredObjectRefs) bool {
+	if len(object.RemoteID) > 0 && refs.RemoteIDs[object.RemoteID] {
+		return true
+	}
+
+	return len(object.Name) > 0 && refs.Names[object.Name]
+}
+
+// removeObject deletes an orphaned object from the backend that listed it
+func removeObject(object StoredObject) error {
+	var ok bool
+	var err error
+	if object.Unfinished {
+		ok, err = object.store.CancelLargeFile(object.RemoteID, object.Name)
+	} else {
+		ok, err = object.store.DeleteFile(object.RemoteID, object.Name)
+	}
+
+	if err == nil && !ok {
+		err = ObjectNotRemovedError
+	}
+
+	return err
+}
+
+func describeObject(object StoredObject) string {
+	kind := "object"
+	if object.Unfinished {
+		kind = "unfinished upload"
+	}
+
+	return fmt.Sprintf("%s '%s' (id: '%s', %s, modified %s)",
+		kind,
+		object.Name,
+		object.RemoteID,
+		shared.ReadableFileSize(object.Size),
+		object.Modified.UTC().Format(time.RFC3339))
+}
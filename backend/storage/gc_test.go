@@ -0,0 +1,155 @@
+//go:build server_test
+
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+)
+
+const gcTestAge = gcMinAge + time.Hour
+
+// storeAgedObject stores a finished file in the backend that was last modified
+// `age` ago
+func storeAgedObject(backend *Memory, remoteID string, age time.Duration) {
+	backend.objects[remoteID] = memoryObject{
+		data:     []byte(remoteID),
+		modified: time.Now().Add(-age),
+	}
+}
+
+// stageAgedUpload stages an unfinished large upload in the backend that was
+// started `age` ago
+func stageAgedUpload(backend *Memory, uploadID string, age time.Duration) {
+	backend.partial[uploadID] = &memoryUpload{
+		parts:   map[int][]byte{1: []byte(uploadID)},
+		started: time.Now().Add(-age),
+	}
+}
+
+func newTestRefs(remoteIDs ...string) db.StoredObjectRefs {
+	refs := db.StoredObjectRefs{
+		RemoteIDs: make(map[string]bool),
+		Names:     make(map[string]bool),
+	}
+
+	for _, remoteID := range remoteIDs {
+		refs.RemoteIDs[remoteID] = true
+	}
+
+	return refs
+}
+
+// checkObjects verifies which finished and unfinished objects are left in the
+// backend after collecting orphaned objects
+func checkObjects(t *testing.T, backend *Memory, objects, uploads []string) {
+	t.Helper()
+	if len(backend.objects) != len(objects) || len(backend.partial) != len(uploads) {
+		t.Fatalf("Expected %d objects and %d uploads, found %d and %d\n",
+			len(objects), len(uploads), len(backend.objects), len(backend.partial))
+	}
+
+	for _, remoteID := range objects {
+		if _, ok := backend.objects[remoteID]; !ok {
+			t.Fatalf("Expected object %s to be kept\n", remoteID)
+		}
+	}
+
+	for _, uploadID := range uploads {
+		if _, ok := backend.partial[uploadID]; !ok {
+			t.Fatalf("Expected upload %s to be kept\n", uploadID)
+		}
+	}
+}
+
+func TestGCDryRunDefault(t *testing.T) {
+	if len(os.Getenv("YEETFILE_GC_DRY_RUN")) == 0 && !config.YeetFileConfig.GCDryRun {
+		t.Fatalf("Expected dry run to be enabled by default\n")
+	}
+
+	backend := newMemory(0)
+	storeAgedObject(backend, "orphaned", gcTestAge)
+	stageAgedUpload(backend, "orphaned-upload", gcTestAge)
+
+	collectOrphanedObjects(backend, newTestRefs(), true)
+	checkObjects(t, backend, []string{"orphaned"}, []string{"orphaned-upload"})
+}
+
+func TestGCMinAge(t *testing.T) {
+	backend := newMemory(0)
+	storeAgedObject(backend, "referenced", gcTestAge)
+	storeAgedObject(backend, "orphaned", gcTestAge)
+	storeAgedObject(backend, "recent", gcMinAge-time.Hour)
+	stageAgedUpload(backend, "orphaned-upload", gcTestAge)
+	stageAgedUpload(backend, "recent-upload", time.Minute)
+
+	collectOrphanedObjects(backend, newTestRefs("referenced"), false)
+	checkObjects(t, backend,
+		[]string{"referenced", "recent"},
+		[]string{"recent-upload"})
+}
+
+func TestGCMigration(t *testing.T) {
+	source := newMemory(0)
+	destination := newMemory(0)
+	m := &Migration{
+		source:          source,
+		destination:     destination,
+		sourceType:      config.MemStorage,
+		destinationType: config.MemStorage,
+	}
+
+	// Files that haven't been migrated yet only exist in the source backend,
+	// and are still referenced by their source remote ID. Files that are
+	// being copied are referenced by the temporary upload entry.
+	storeAgedObject(source, "not-migrated", gcTestAge)
+	storeAgedObject(source, "source-orphan", gcTestAge)
+	storeAgedObject(destination, "migrated", gcTestAge)
+	storeAgedObject(destination, "destination-orphan", gcTestAge)
+	stageAgedUpload(destination, db.MigrationIDPrefix+"copying", gcTestAge)
+
+	refs := newTestRefs("not-migrated", "migrated", db.MigrationIDPrefix+"copying")
+	collectOrphanedObjects(m, refs, false)
+
+	// The source backend isn't listed, since copied files are left in place
+	// until the migration has finished
+	checkObjects(t, source, []string{"not-migrated", "source-orphan"}, nil)
+	checkObjects(t, destination,
+		[]string{"migrated"},
+		[]string{db.MigrationIDPrefix + "copying"})
+}
+
+func TestGCMirror(t *testing.T) {
+	primary := newMemory(0)
+	secondary := newMemory(0)
+	m := &Mirror{
+		primary:       primary,
+		secondary:     secondary,
+		primaryType:   config.MemStorage,
+		secondaryType: config.MemStorage,
+	}
+
+	// Finished files are referenced by the combined remote ID, and files that
+	// are still uploading by each backend's temporary upload entry
+	primaryUpload := mirrorTempID(0, "uploading")
+	secondaryUpload := mirrorTempID(1, "uploading")
+	storeAgedObject(primary, "primary-id", gcTestAge)
+	storeAgedObject(secondary, "secondary-id", gcTestAge)
+	storeAgedObject(primary, "legacy", gcTestAge)
+	storeAgedObject(secondary, "secondary-orphan", gcTestAge)
+	stageAgedUpload(primary, primaryUpload, gcTestAge)
+	stageAgedUpload(secondary, secondaryUpload, gcTestAge)
+
+	refs := newTestRefs(
+		joinMirrorID("primary-id", "secondary-id"),
+		"legacy",
+		primaryUpload,
+		secondaryUpload)
+	collectOrphanedObjects(m, refs, false)
+
+	checkObjects(t, primary, []string{"primary-id", "legacy"}, []string{primaryUpload})
+	checkObjects(t, secondary, []string{"secondary-id"}, []string{secondaryUpload})
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"io"
+	"yeetfile/backend/db"
+	"yeetfile/backend/metrics"
+)
+
+// instrumented wraps the configured storage backend and records any errors
+// returned from it in the server metrics
+type instrumented struct {
+	inner       storage
+	storageType string
+}
+
+func (i *instrumented) record(operation string, err error) {
+	if err != nil {
+		metrics.RecordStorageError(i.storageType, operation)
+	}
+}
+
+func (i *instrumented) Authorize() error {
+	err := i.inner.Authorize()
+	i.record("authorize", err)
+	setAuthorization(err)
+	return err
+}
+
+func (i *instrumented) Reauthorize() error {
+	err := i.inner.Reauthorize()
+	i.record("authorize", err)
+	setAuthorization(err)
+	return err
+}
+
+func (i *instrumented) InitUpload(metadataID string) error {
+	err := i.inner.InitUpload(metadataID)
+	i.record("init_upload", err)
+	return err
+}
+
+func (i *instrumented) InitLargeUpload(filename, metadataID string) error {
+	err := i.inner.InitLargeUpload(filename, metadataID)
+	i.record("init_large_upload", err)
+	return err
+}
+
+func (i *instrumented) UploadSingleChunk(chunk FileChunk, upload db.Upload) error {
+	err := i.inner.UploadSingleChunk(chunk, upload)
+	i.record("upload", err)
+	return err
+}
+
+func (i *instrumented) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool, error) {
+	finished, err := i.inner.UploadMultiChunk(chunk, upload)
+	i.record("upload", err)
+	return finished, err
+}
+
+func (i *instrumented) CancelLargeFile(remoteID, filename string) (bool, error) {
+	ok, err := i.inner.CancelLargeFile(remoteID, filename)
+	i.record("cancel", err)
+	return ok, err
+}
+
+func (i *instrumented) DeleteFile(remoteID, filename string) (bool, error) {
+	ok, err := i.inner.DeleteFile(remoteID, filename)
+	i.record("delete", err)
+	return ok, err
+}
+
+func (i *instrumented) FinishLargeUpload(remoteID, filename string, checksums []string) (string, int64, error) {
+	id, length, err := i.inner.FinishLargeUpload(remoteID, filename, checksums)
+	i.record("finish_upload", err)
+	return id, length, err
+}
+
+func (i *instrumented) PartialDownloadById(remoteID, filename string, start, end int64) (io.ReadCloser, error) {
+	reader, err := i.inner.PartialDownloadById(remoteID, filename, start, end)
+	i.record("download", err)
+	return reader, err
+}
+
+func (i *instrumented) List(fn func(object StoredObject) error) error {
+	err := i.inner.List(fn)
+	i.record("list", err)
+	return err
+}
+
+// CanPresign passes through the presigned transfer support of the wrapped
+// backend, so that instrumenting the backend doesn't disable presigning
+func (i *instrumented) CanPresign() bool {
+	p, ok := i.inner.(presigner)
+	return ok && p.CanPresign()
+}
+
+func (i *instrumented) PresignUpload(chunk FileChunk, upload db.Upload, size int64) (PresignedRequest, error) {
+	presigned, err := i.inner.(presigner).PresignUpload(chunk, upload, size)
+	i.record("presign_upload", err)
+	return presigned, err
+}
+
+func (i *instrumented) FinishPresignedUpload(chunk FileChunk, upload db.Upload, checksum string) (bool, error) {
+	finished, err := i.inner.(presigner).FinishPresignedUpload(chunk, upload, checksum)
+	i.record("finish_presigned_upload", err)
+	return finished, err
+}
+
+func (i *instrumented) PresignDownload(remoteID, filename string, start, end int64) (PresignedRequest, error) {
+	presigned, err := i.inner.(presigner).PresignDownload(remoteID, filename, start, end)
+	i.record("presign_download", err)
+	return presigned, err
+}
@@ -0,0 +1,557 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"yeetfile/backend/db"
+	"yeetfile/backend/utils"
+)
+
+const (
+	defaultStoragePath = "uploads"
+	partialUploadDir   = ".partial"
+	tmpFilePrefix      = ".tmp-"
+)
+
+var (
+	StorageLimitError = errors.New("local storage limit has been exceeded")
+	InvalidRemoteID   = errors.New("invalid remote file id")
+)
+
+// LocalFS stores encrypted file content directly on the machine running the
+// server. Files are stored by their remote ID in a sharded directory layout
+// (<root>/ab/cd/<id>) to avoid very large flat directories, and all writes go
+// through a temp file that is fsync'd and renamed into place so that a crash
+// never leaves a partially written file behind.
+type LocalFS struct {
+	root  string
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+func (localBackend *LocalFS) Authorize() error {
+	err := os.MkdirAll(filepath.Join(localBackend.root, partialUploadDir), 0755)
+	if err != nil {
+		return err
+	}
+
+	if localBackend.limit > 0 {
+		used, err := utils.CheckDirSize(localBackend.root)
+		if err != nil {
+			return err
+		}
+
+		localBackend.used = used
+	}
+
+	return nil
+}
+
+func (localBackend *LocalFS) Reauthorize() error {
+	return nil
+}
+
+func (localBackend *LocalFS) InitUpload(metadataID string) error {
+	// Single chunk files use the metadata ID as the remote ID
+	return db.UpdateUploadValues(metadataID, "", "", metadataID, true)
+}
+
+func (localBackend *LocalFS) InitLargeUpload(_, metadataID string) error {
+	err := os.MkdirAll(localBackend.partialPath(metadataID), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = db.SetVaultItemRemoteID(metadataID, metadataID)
+	if err != nil {
+		return err
+	}
+
+	// Multi-chunk files also use the metadata ID, but chunks are written to
+	// a separate staging directory until the upload is finished
+	return db.UpdateUploadValues(metadataID, "", "", metadataID, true)
+}
+
+func (localBackend *LocalFS) UploadSingleChunk(chunk FileChunk, upload db.Upload) error {
+	remoteID := chunk.FileID
+	size := int64(len(chunk.Data))
+	if err := localBackend.reserve(size); err != nil {
+		return err
+	}
+
+	_, checksum := utils.GenChecksum(chunk.Data)
+	_, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
+	if err != nil {
+		slog.Error("Error updating checksums", "error", err)
+		localBackend.release(size)
+		return err
+	}
+
+	path, err := localBackend.objectPath(remoteID)
+	if err != nil {
+		localBackend.release(size)
+		return err
+	}
+
+	// Account for files that are being re-uploaded
+	var prevSize int64
+	if info, err := os.Stat(path); err == nil {
+		prevSize = info.Size()
+	}
+
+	err = writeFileAtomic(path, chunk.Data)
+	if err != nil {
+		slog.Error("Error writing file to local storage", "error", err)
+		localBackend.release(size)
+		return err
+	}
+
+	localBackend.release(prevSize)
+	return db.UpdateMetadata(upload.MetadataID, remoteID, size)
+}
+
+func (localBackend *LocalFS) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool, error) {
+	size := int64(len(chunk.Data))
+	if err := localBackend.reserve(size); err != nil {
+		_, _ = localBackend.CancelLargeFile(upload.UploadID, chunk.Filename)
+		return false, err
+	}
+
+	if err := validateRemoteID(upload.UploadID); err != nil {
+		localBackend.release(size)
+		return false, err
+	}
+
+	partPath := filepath.Join(
+		localBackend.partialPath(upload.UploadID),
+		strconv.Itoa(chunk.ChunkNum))
+
+	// Account for chunks that are being re-uploaded
+	var prevSize int64
+	if info, err := os.Stat(partPath); err == nil {
+		prevSize = info.Size()
+	}
+
+	err := writeFileAtomic(partPath, chunk.Data)
+	if err != nil {
+		slog.Error("Error writing file chunk to local storage", "error", err)
+		localBackend.release(size)
+		return false, err
+	}
+
+	localBackend.release(prevSize)
+
+	_, checksum := utils.GenChecksum(chunk.Data)
+	checksums, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
+	if err != nil {
+		slog.Error("Failed to update checksums", "error", err)
+		return false, err
+	}
+
+	if len(checksums) == chunk.TotalChunks && checksums[0] != db.ChecksumPlaceholder {
+		// All chunks accounted for, finalize the upload
+		remoteID, length, err := localBackend.FinishLargeUpload(
+			upload.UploadID,
+			chunk.Filename,
+			checksums)
+		if err != nil {
+			return false, err
+		}
+
+		return true, db.UpdateMetadata(upload.MetadataID, remoteID, length)
+	}
+
+	return false, nil
+}
+
+// FinishLargeUpload assembles the staged chunks of a multi-chunk upload into a
+// single file, verifying each chunk against its recorded checksum along the way.
+func (localBackend *LocalFS) FinishLargeUpload(remoteID, _ string, checksums []string) (string, int64, error) {
+	path, err := localBackend.objectPath(remoteID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	partialDir := localBackend.partialPath(remoteID)
+
+	var length int64
+	err = writeAtomic(path, func(f *os.File) error {
+		for i, checksum := range checksums {
+			n, err := appendPart(f, filepath.Join(partialDir, strconv.Itoa(i+1)), checksum)
+			if err != nil {
+				return err
+			}
+
+			length += n
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Failed to finalize large file", "error", err)
+		return "", 0, err
+	}
+
+	if err = os.RemoveAll(partialDir); err != nil {
+		slog.Error("Error removing staged chunks", "remote_id", remoteID, "error", err)
+	}
+
+	return remoteID, length, nil
+}
+
+func (localBackend *LocalFS) CancelLargeFile(remoteID, _ string) (bool, error) {
+	if validateRemoteID(remoteID) != nil {
+		return false, nil
+	}
+
+	partialDir := localBackend.partialPath(remoteID)
+	if _, err := os.Stat(partialDir); err != nil {
+		// Not an in-progress large file
+		return false, nil
+	}
+
+	size, _ := utils.CheckDirSize(partialDir)
+	if err := os.RemoveAll(partialDir); err != nil {
+		return false, err
+	}
+
+	localBackend.release(size)
+	return true, nil
+}
+
+func (localBackend *LocalFS) DeleteFile(remoteID, _ string) (bool, error) {
+	if len(remoteID) == 0 {
+		return false, nil
+	}
+
+	path, err := localBackend.resolvePath(remoteID)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if err = os.Remove(path); err != nil {
+		return false, err
+	}
+
+	localBackend.release(info.Size())
+	return true, nil
+}
+
+func (localBackend *LocalFS) PartialDownloadById(remoteID, _ string, start, end int64) (io.ReadCloser, error) {
+	path, err := localBackend.resolvePath(remoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	if end >= info.Size() {
+		end = info.Size() - 1
+	}
+
+	if start < 0 || start > end {
+		_ = file.Close()
+		return nil, fmt.Errorf("invalid range %d-%d for %s", start, end, remoteID)
+	}
+
+	return &fileSection{
+		SectionReader: io.NewSectionReader(file, start, end-start+1),
+		file:          file,
+	}, nil
+}
+
+// List walks the storage directory, returning each stored file along with any
+// large uploads that still have chunks in the staging directory
+func (localBackend *LocalFS) List(fn func(object StoredObject) error) error {
+	partialRoot := filepath.Join(localBackend.root, partialUploadDir)
+	return filepath.WalkDir(localBackend.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if path == partialRoot {
+			return localBackend.listPartial(partialRoot, fn)
+		} else if d.IsDir() || strings.HasPrefix(d.Name(), tmpFilePrefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return fn(StoredObject{
+			RemoteID: d.Name(),
+			Name:     d.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			store:    localBackend,
+		})
+	})
+}
+
+// listPartial returns each in-progress large upload in the staging directory,
+// and then skips the directory for the rest of the walk
+func (localBackend *LocalFS) listPartial(partialRoot string, fn func(object StoredObject) error) error {
+	entries, err := os.ReadDir(partialRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		size, _ := utils.CheckDirSize(filepath.Join(partialRoot, entry.Name()))
+		err = fn(StoredObject{
+			RemoteID:   entry.Name(),
+			Name:       entry.Name(),
+			Size:       size,
+			Modified:   info.ModTime(),
+			Unfinished: true,
+			store:      localBackend,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return filepath.SkipDir
+}
+
+// fileSection reads a range of a stored file, closing the file once finished
+type fileSection struct {
+	*io.SectionReader
+	file io.Closer
+}
+
+func (section *fileSection) Close() error {
+	return section.file.Close()
+}
+
+// objectPath returns the sharded path for a file with the provided remote ID
+func (localBackend *LocalFS) objectPath(remoteID string) (string, error) {
+	if err := validateRemoteID(remoteID); err != nil {
+		return "", err
+	}
+
+	shard := fmt.Sprintf("%x", sha1.Sum([]byte(remoteID)))
+	return filepath.Join(localBackend.root, shard[0:2], shard[2:4], remoteID), nil
+}
+
+// resolvePath returns the path to an existing file with the provided remote ID,
+// falling back to the flat layout used by the previous local storage
+// implementation if the file hasn't been written to a sharded path.
+func (localBackend *LocalFS) resolvePath(remoteID string) (string, error) {
+	path, err := localBackend.objectPath(remoteID)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = os.Stat(path); err != nil && errors.Is(err, os.ErrNotExist) {
+		legacyPath := filepath.Join(localBackend.root, remoteID)
+		if _, legacyErr := os.Stat(legacyPath); legacyErr == nil {
+			return legacyPath, nil
+		}
+	}
+
+	return path, nil
+}
+
+func (localBackend *LocalFS) partialPath(remoteID string) string {
+	return filepath.Join(localBackend.root, partialUploadDir, remoteID)
+}
+
+// reserve accounts for size bytes of new content, returning an error if this
+// would exceed the configured storage limit
+func (localBackend *LocalFS) reserve(size int64) error {
+	if localBackend.limit <= 0 {
+		return nil
+	}
+
+	localBackend.mu.Lock()
+	defer localBackend.mu.Unlock()
+
+	if localBackend.used+size > localBackend.limit {
+		return StorageLimitError
+	}
+
+	localBackend.used += size
+	return nil
+}
+
+func (localBackend *LocalFS) release(size int64) {
+	if localBackend.limit <= 0 {
+		return
+	}
+
+	localBackend.mu.Lock()
+	defer localBackend.mu.Unlock()
+
+	localBackend.used -= size
+	if localBackend.used < 0 {
+		localBackend.used = 0
+	}
+}
+
+// validateRemoteID ensures that a remote ID can't be used to read or write
+// outside the storage directory
+func validateRemoteID(remoteID string) error {
+	if len(remoteID) == 0 ||
+		remoteID == "." ||
+		strings.Contains(remoteID, "..") ||
+		strings.ContainsAny(remoteID, `/\`) {
+		return InvalidRemoteID
+	}
+
+	return nil
+}
+
+// appendPart copies a staged chunk into the destination file, returning an
+// error if the chunk doesn't match the expected checksum
+func appendPart(dst io.Writer, partPath, checksum string) (int64, error) {
+	part, err := os.Open(partPath)
+	if err != nil {
+		return 0, err
+	}
+
+	defer part.Close()
+	return copyPart(dst, part, partPath, checksum)
+}
+
+// copyPart copies a staged chunk into the destination, returning an error if
+// the chunk doesn't match the expected (SHA1) checksum
+func copyPart(dst io.Writer, part io.Reader, partPath, checksum string) (int64, error) {
+	h := sha1.New()
+	n, err := io.Copy(io.MultiWriter(dst, h), part)
+	if err != nil {
+		return 0, err
+	}
+
+	if fmt.Sprintf("%x", h.Sum(nil)) != checksum {
+		return 0, fmt.Errorf("checksum mismatch for %s", partPath)
+	}
+
+	return n, nil
+}
+
+// writeFileAtomic writes data to the provided path, creating any missing
+// parent directories
+func writeFileAtomic(path string, data []byte) error {
+	return writeAtomic(path, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+// writeAtomic creates a temp file alongside the provided path, passes it to
+// writeFn, and then syncs and renames the temp file into place once writeFn
+// has finished without error.
+func writeAtomic(path string, writeFn func(f *os.File) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, tmpFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() {
+		// No-op if the rename was successful
+		_ = os.Remove(tmpName)
+	}()
+
+	if err = writeFn(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes directory entries to disk so that a rename survives a
+// crash. Not all platforms support syncing a directory, so this is best-effort.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// initLocalStorage sets up a LocalFS storage backend in the specified path
+// (or "uploads/" by default), with an optional limit for the total size of
+// all stored files.
+func initLocalStorage() storage {
+	var limit int64
+	var err error
+
+	slog.Info("Setting up local storage...")
+	limitStr := utils.GetEnvVar("YEETFILE_LOCAL_STORAGE_LIMIT", "")
+	path := utils.GetEnvVar("YEETFILE_LOCAL_STORAGE_PATH", defaultStoragePath)
+
+	if len(limitStr) > 0 {
+		limit, err = strconv.ParseInt(limitStr, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid storage limit \"%s\"", limitStr)
+		}
+	}
+
+	localBackend := &LocalFS{
+		root:  path,
+		limit: limit,
+	}
+
+	err = localBackend.Authorize()
+	if err != nil {
+		log.Fatalf("Unable to initialize local storage: %v\n", err)
+	}
+
+	return localBackend
+}
@@ -0,0 +1,316 @@
+//go:build server_test
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"yeetfile/backend/db"
+	"yeetfile/backend/utils"
+)
+
+const localTestLimit = 1024 * 1024 * 10
+
+func newTestLocalFS(t *testing.T) *LocalFS {
+	backend := &LocalFS{
+		root:  t.TempDir(),
+		limit: localTestLimit,
+	}
+
+	if err := backend.Authorize(); err != nil {
+		t.Fatalf("Error initializing local storage: %v\n", err)
+	}
+
+	return backend
+}
+
+// newLocalUpload creates the metadata and upload entries needed for uploading
+// a file to local storage
+func newLocalUpload(t *testing.T, chunks int) db.Upload {
+	id, err := db.InsertMetadata(chunks, "", "local-test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		db.DeleteMetadata(id)
+		db.DeleteUploads(id)
+	})
+
+	if err = db.CreateNewUpload(id, "local-test"); err != nil {
+		t.Fatalf("Error creating upload: %v\n", err)
+	}
+
+	return db.Upload{MetadataID: id, UploadID: id}
+}
+
+// stageLocalParts writes random chunks for a large upload to the staging
+// directory, returning the combined chunk data and the checksum for each chunk
+func stageLocalParts(t *testing.T, backend *LocalFS, uploadID string, sizes ...int) ([]byte, []string) {
+	var data []byte
+	var checksums []string
+	for i, size := range sizes {
+		part := make([]byte, size)
+		_, _ = rand.Read(part)
+
+		if err := backend.reserve(int64(size)); err != nil {
+			t.Fatalf("Error reserving part %d: %v\n", i+1, err)
+		}
+
+		partPath := filepath.Join(backend.partialPath(uploadID), strconv.Itoa(i+1))
+		if err := writeFileAtomic(partPath, part); err != nil {
+			t.Fatalf("Error writing part %d: %v\n", i+1, err)
+		}
+
+		_, checksum := utils.GenChecksum(part)
+		checksums = append(checksums, checksum)
+		data = append(data, part...)
+	}
+
+	return data, checksums
+}
+
+func readLocalRange(t *testing.T, backend *LocalFS, remoteID string, start, end int64) []byte {
+	reader, err := backend.PartialDownloadById(remoteID, "", start, end)
+	if err != nil {
+		t.Fatalf("Error reading range %d-%d: %v\n", start, end, err)
+	}
+
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Error reading range %d-%d: %v\n", start, end, err)
+	}
+
+	return data
+}
+
+func TestLocalSingleChunk(t *testing.T) {
+	backend := newTestLocalFS(t)
+	upload := newLocalUpload(t, 1)
+
+	data := make([]byte, 5000)
+	_, _ = rand.Read(data)
+
+	chunk := FileChunk{
+		FileID:      upload.MetadataID,
+		Filename:    "local-test",
+		Data:        data,
+		ChunkNum:    1,
+		TotalChunks: 1,
+	}
+
+	if err := backend.UploadSingleChunk(chunk, upload); err != nil {
+		t.Fatalf("Error uploading file: %v\n", err)
+	} else if backend.used != int64(len(data)) {
+		t.Fatalf("Expected %d bytes used, got %d\n", len(data), backend.used)
+	}
+
+	path, _ := backend.objectPath(upload.MetadataID)
+	if stored, err := os.ReadFile(path); err != nil || !bytes.Equal(stored, data) {
+		t.Fatalf("File was not stored at sharded path (err: %v)\n", err)
+	}
+
+	remoteID, length, err := db.GetMetadataRemoteID(upload.MetadataID)
+	if err != nil {
+		t.Fatal(err)
+	} else if remoteID != upload.MetadataID || length != int64(len(data)) {
+		t.Fatalf("Unexpected metadata (id: %s, length: %d)\n", remoteID, length)
+	}
+
+	// Re-uploading the same file should replace the previous reservation
+	chunk.Data = data[:3000]
+	if err = backend.UploadSingleChunk(chunk, upload); err != nil {
+		t.Fatalf("Error re-uploading file: %v\n", err)
+	} else if backend.used != 3000 {
+		t.Fatalf("Expected 3000 bytes used after re-upload, got %d\n", backend.used)
+	}
+
+	read := readLocalRange(t, backend, upload.MetadataID, 0, 2999)
+	if !bytes.Equal(read, data[:3000]) {
+		t.Fatalf("Re-uploaded file does not match\n")
+	}
+}
+
+func TestLocalMultiChunk(t *testing.T) {
+	backend := newTestLocalFS(t)
+	upload := newLocalUpload(t, 3)
+
+	if err := backend.InitLargeUpload("local-test", upload.MetadataID); err != nil {
+		t.Fatalf("Error starting large upload: %v\n", err)
+	}
+
+	sizes := []int{4096, 4096, 1000}
+	var data []byte
+	for i, size := range sizes {
+		part := make([]byte, size)
+		_, _ = rand.Read(part)
+		data = append(data, part...)
+
+		finished, err := backend.UploadMultiChunk(FileChunk{
+			FileID:      upload.MetadataID,
+			Filename:    "local-test",
+			Data:        part,
+			ChunkNum:    i + 1,
+			TotalChunks: len(sizes),
+		}, upload)
+		if err != nil {
+			t.Fatalf("Error uploading chunk %d: %v\n", i+1, err)
+		} else if finished != (i == len(sizes)-1) {
+			t.Fatalf("Unexpected finished state after chunk %d: %v\n", i+1, finished)
+		}
+	}
+
+	if backend.used != int64(len(data)) {
+		t.Fatalf("Expected %d bytes used, got %d\n", len(data), backend.used)
+	} else if _, err := os.Stat(backend.partialPath(upload.MetadataID)); !os.IsNotExist(err) {
+		t.Fatalf("Staged chunks were not removed (err: %v)\n", err)
+	}
+
+	_, length, err := db.GetMetadataRemoteID(upload.MetadataID)
+	if err != nil {
+		t.Fatal(err)
+	} else if length != int64(len(data)) {
+		t.Fatalf("Expected length %d, got %d\n", len(data), length)
+	}
+
+	read := readLocalRange(t, backend, upload.MetadataID, 4000, 9000)
+	if !bytes.Equal(read, data[4000:9001]) {
+		t.Fatalf("Range does not match uploaded data\n")
+	}
+}
+
+func TestLocalFinishLargeUploadChecksumMismatch(t *testing.T) {
+	backend := newTestLocalFS(t)
+	remoteID := "mismatched-upload"
+
+	_, checksums := stageLocalParts(t, backend, remoteID, 100, 100)
+	checksums[1] = checksums[0]
+
+	_, _, err := backend.FinishLargeUpload(remoteID, "", checksums)
+	if err == nil {
+		t.Fatalf("Expected checksum mismatch error\n")
+	}
+
+	path, _ := backend.objectPath(remoteID)
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Mismatched upload should not be stored (err: %v)\n", err)
+	}
+}
+
+func TestLocalRangedRead(t *testing.T) {
+	backend := newTestLocalFS(t)
+	remoteID := "ranged-read"
+
+	data, checksums := stageLocalParts(t, backend, remoteID, 2000)
+	if _, _, err := backend.FinishLargeUpload(remoteID, "", checksums); err != nil {
+		t.Fatalf("Error finishing large upload: %v\n", err)
+	}
+
+	if read := readLocalRange(t, backend, remoteID, 0, 0); !bytes.Equal(read, data[:1]) {
+		t.Fatalf("Single byte range does not match\n")
+	} else if read = readLocalRange(t, backend, remoteID, 1500, 1999); !bytes.Equal(read, data[1500:]) {
+		t.Fatalf("Trailing range does not match\n")
+	}
+
+	// Ranges past the end of the file are truncated
+	if read := readLocalRange(t, backend, remoteID, 1900, 5000); !bytes.Equal(read, data[1900:]) {
+		t.Fatalf("Expected truncated range, got %d bytes\n", len(read))
+	}
+
+	if _, err := backend.PartialDownloadById(remoteID, "", 2500, 3000); err == nil {
+		t.Fatalf("Expected error for range starting past the end of the file\n")
+	} else if _, err = backend.PartialDownloadById("missing", "", 0, 10); err == nil {
+		t.Fatalf("Expected error for missing file\n")
+	} else if _, err = backend.PartialDownloadById("../escape", "", 0, 10); !errors.Is(err, InvalidRemoteID) {
+		t.Fatalf("Expected invalid remote ID error, got %v\n", err)
+	}
+}
+
+func TestLocalLegacyPath(t *testing.T) {
+	backend := newTestLocalFS(t)
+	remoteID := "legacy-file"
+
+	data := make([]byte, 1000)
+	_, _ = rand.Read(data)
+
+	// Files stored by the previous implementation are in the storage root
+	err := os.WriteFile(filepath.Join(backend.root, remoteID), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.used = int64(len(data))
+
+	if read := readLocalRange(t, backend, remoteID, 100, 199); !bytes.Equal(read, data[100:200]) {
+		t.Fatalf("Legacy file range does not match\n")
+	}
+
+	if deleted, err := backend.DeleteFile(remoteID, ""); !deleted || err != nil {
+		t.Fatalf("Unable to delete legacy file (deleted: %v, err: %v)\n", deleted, err)
+	} else if backend.used != 0 {
+		t.Fatalf("Expected 0 bytes used after deleting, got %d\n", backend.used)
+	}
+
+	if _, err = os.Stat(filepath.Join(backend.root, remoteID)); !os.IsNotExist(err) {
+		t.Fatalf("Legacy file was not deleted (err: %v)\n", err)
+	}
+}
+
+func TestLocalCancelLargeUpload(t *testing.T) {
+	backend := newTestLocalFS(t)
+	remoteID := "canceled-upload"
+
+	stageLocalParts(t, backend, remoteID, 100, 100)
+	if backend.used != 200 {
+		t.Fatalf("Expected 200 bytes used, got %d\n", backend.used)
+	}
+
+	if canceled, err := backend.CancelLargeFile(remoteID, ""); !canceled || err != nil {
+		t.Fatalf("Unable to cancel upload (canceled: %v, err: %v)\n", canceled, err)
+	} else if backend.used != 0 {
+		t.Fatalf("Expected 0 bytes used after canceling, got %d\n", backend.used)
+	} else if _, err = os.Stat(backend.partialPath(remoteID)); !os.IsNotExist(err) {
+		t.Fatalf("Staged chunks were not removed (err: %v)\n", err)
+	}
+
+	// Canceling a missing or invalid upload is a no-op
+	if canceled, err := backend.CancelLargeFile(remoteID, ""); canceled || err != nil {
+		t.Fatalf("Unexpected cancel result (canceled: %v, err: %v)\n", canceled, err)
+	} else if canceled, err = backend.CancelLargeFile("..", ""); canceled || err != nil {
+		t.Fatalf("Unexpected cancel result (canceled: %v, err: %v)\n", canceled, err)
+	}
+}
+
+func TestLocalDelete(t *testing.T) {
+	backend := newTestLocalFS(t)
+	remoteID := "deleted-file"
+
+	_, checksums := stageLocalParts(t, backend, remoteID, 500, 500)
+	if _, _, err := backend.FinishLargeUpload(remoteID, "", checksums); err != nil {
+		t.Fatalf("Error finishing large upload: %v\n", err)
+	}
+
+	if deleted, err := backend.DeleteFile(remoteID, ""); !deleted || err != nil {
+		t.Fatalf("Unable to delete file (deleted: %v, err: %v)\n", deleted, err)
+	} else if backend.used != 0 {
+		t.Fatalf("Expected 0 bytes used after deleting, got %d\n", backend.used)
+	}
+
+	path, _ := backend.objectPath(remoteID)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("File was not deleted (err: %v)\n", err)
+	}
+
+	if deleted, err := backend.DeleteFile(remoteID, ""); deleted || err == nil {
+		t.Fatalf("Expected error deleting missing file (deleted: %v)\n", deleted)
+	} else if deleted, err = backend.DeleteFile("", ""); deleted || err != nil {
+		t.Fatalf("Unexpected result for empty remote ID (deleted: %v, err: %v)\n", deleted, err)
+	}
+}
@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/backend/utils"
+)
+
+// Memory stores encrypted file content in memory, and is intended for
+// integration tests and throwaway instances. All stored files are lost when the
+// server is stopped. Like LocalFS, files are stored by their metadata ID, and
+// the chunks of large uploads are staged separately until the upload has
+// finished.
+type Memory struct {
+	limit int64
+
+	mu      sync.RWMutex
+	used    int64
+	objects map[string]memoryObject
+	partial map[string]*memoryUpload
+}
+
+type memoryObject struct {
+	data     []byte
+	modified time.Time
+}
+
+type memoryUpload struct {
+	parts   map[int][]byte
+	started time.Time
+}
+
+func (memBackend *Memory) Authorize() error {
+	return nil
+}
+
+func (memBackend *Memory) Reauthorize() error {
+	return nil
+}
+
+func (memBackend *Memory) InitUpload(metadataID string) error {
+	// Single chunk files use the metadata ID as the remote ID
+	return db.UpdateUploadValues(metadataID, "", "", metadataID, true)
+}
+
+func (memBackend *Memory) InitLargeUpload(_, metadataID string) error {
+	memBackend.startUpload(metadataID)
+
+	err := db.SetVaultItemRemoteID(metadataID, metadataID)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdateUploadValues(metadataID, "", "", metadataID, true)
+}
+
+func (memBackend *Memory) UploadSingleChunk(chunk FileChunk, upload db.Upload) error {
+	_, checksum := utils.GenChecksum(chunk.Data)
+	_, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
+	if err != nil {
+		slog.Error("Error updating checksums", "error", err)
+		return err
+	}
+
+	err = memBackend.writeObject(chunk.FileID, bytes.Clone(chunk.Data))
+	if err != nil {
+		return err
+	}
+
+	return db.UpdateMetadata(upload.MetadataID, chunk.FileID, int64(len(chunk.Data)))
+}
+
+func (memBackend *Memory) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool, error) {
+	err := memBackend.writePart(upload.UploadID, chunk.ChunkNum, chunk.Data)
+	if err != nil {
+		return false, err
+	}
+
+	_, checksum := utils.GenChecksum(chunk.Data)
+	checksums, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
+	if err != nil {
+		slog.Error("Failed to update checksums", "error", err)
+		return false, err
+	}
+
+	if len(checksums) == chunk.TotalChunks && checksums[0] != db.ChecksumPlaceholder {
+		// All chunks accounted for, finalize the upload
+		remoteID, length, err := memBackend.FinishLargeUpload(
+			upload.UploadID,
+			chunk.Filename,
+			checksums)
+		if err != nil {
+			return false, err
+		}
+
+		return true, db.UpdateMetadata(upload.MetadataID, remoteID, length)
+	}
+
+	return false, nil
+}
+
+// FinishLargeUpload combines the staged chunks of a multi-chunk upload into a
+// single file, verifying each chunk against its recorded checksum
+func (memBackend *Memory) FinishLargeUpload(remoteID, _ string, checksums []string) (string, int64, error) {
+	memBackend.mu.Lock()
+	defer memBackend.mu.Unlock()
+
+	upload, ok := memBackend.partial[remoteID]
+	if !ok {
+		return "", 0, fmt.Errorf("no large upload found for %s", remoteID)
+	}
+
+	var data bytes.Buffer
+	for i, checksum := range checksums {
+		part, ok := upload.parts[i+1]
+		if !ok {
+			return "", 0, fmt.Errorf("missing chunk %d for %s", i+1, remoteID)
+		}
+
+		partName := fmt.Sprintf("%s/%d", remoteID, i+1)
+		if _, err := copyPart(&data, bytes.NewReader(part), partName, checksum); err != nil {
+			slog.Error("Failed to finalize large file", "error", err)
+			return "", 0, err
+		}
+	}
+
+	// The combined file replaces the staged chunks, which have already been
+	// checked against the storage limit
+	delete(memBackend.partial, remoteID)
+	memBackend.used -= upload.size()
+	memBackend.replaceObject(remoteID, data.Bytes())
+
+	return remoteID, int64(data.Len()), nil
+}
+
+func (memBackend *Memory) CancelLargeFile(remoteID, _ string) (bool, error) {
+	memBackend.mu.Lock()
+	defer memBackend.mu.Unlock()
+
+	upload, ok := memBackend.partial[remoteID]
+	if !ok {
+		// Not an in-progress large file
+		return false, nil
+	}
+
+	delete(memBackend.partial, remoteID)
+	memBackend.used -= upload.size()
+	return true, nil
+}
+
+func (memBackend *Memory) DeleteFile(remoteID, _ string) (bool, error) {
+	memBackend.mu.Lock()
+	defer memBackend.mu.Unlock()
+
+	object, ok := memBackend.objects[remoteID]
+	if !ok {
+		return false, fmt.Errorf("file %s not found", remoteID)
+	}
+
+	delete(memBackend.objects, remoteID)
+	memBackend.used -= int64(len(object.data))
+	return true, nil
+}
+
+func (memBackend *Memory) PartialDownloadById(remoteID, _ string, start, end int64) (io.ReadCloser, error) {
+	memBackend.mu.RLock()
+	object, ok := memBackend.objects[remoteID]
+	memBackend.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", remoteID)
+	}
+
+	size := int64(len(object.data))
+	if end >= size {
+		end = size - 1
+	}
+
+	if start < 0 || start > end {
+		return nil, fmt.Errorf("invalid range %d-%d for %s", start, end, remoteID)
+	}
+
+	// Stored data is never modified in place, so it's safe to read without
+	// holding the lock
+	return io.NopCloser(bytes.NewReader(object.data[start : end+1])), nil
+}
+
+// List returns each stored file, followed by any unfinished large uploads
+func (memBackend *Memory) List(fn func(object StoredObject) error) error {
+	var objects []StoredObject
+
+	memBackend.mu.RLock()
+	for remoteID, object := range memBackend.objects {
+		objects = append(objects, StoredObject{
+			RemoteID: remoteID,
+			Name:     remoteID,
+			Size:     int64(len(object.data)),
+			Modified: object.modified,
+			store:    memBackend,
+		})
+	}
+
+	for remoteID, upload := range memBackend.partial {
+		objects = append(objects, StoredObject{
+			RemoteID:   remoteID,
+			Name:       remoteID,
+			Size:       upload.size(),
+			Modified:   upload.started,
+			Unfinished: true,
+			store:      memBackend,
+		})
+	}
+	memBackend.mu.RUnlock()
+
+	// The callback may remove objects, so it's called without holding the lock
+	for _, object := range objects {
+		if err := fn(object); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeObject stores a single-chunk file
+func (memBackend *Memory) writeObject(remoteID string, data []byte) error {
+	memBackend.mu.Lock()
+	defer memBackend.mu.Unlock()
+
+	prevSize := int64(len(memBackend.objects[remoteID].data))
+	if err := memBackend.reserve(int64(len(data)) - prevSize); err != nil {
+		return err
+	}
+
+	memBackend.replaceObject(remoteID, data)
+	return nil
+}
+
+// startUpload creates (or restarts) a large upload, which uses the metadata ID
+// as the remote ID
+func (memBackend *Memory) startUpload(remoteID string) {
+	memBackend.mu.Lock()
+	defer memBackend.mu.Unlock()
+
+	if prev, ok := memBackend.partial[remoteID]; ok {
+		memBackend.used -= prev.size()
+	}
+
+	memBackend.partial[remoteID] = &memoryUpload{
+		parts:   make(map[int][]byte),
+		started: time.Now(),
+	}
+}
+
+// writePart stages a single chunk of a large upload
+func (memBackend *Memory) writePart(uploadID string, chunkNum int, data []byte) error {
+	memBackend.mu.Lock()
+	defer memBackend.mu.Unlock()
+
+	upload, ok := memBackend.partial[uploadID]
+	if !ok {
+		return fmt.Errorf("no large upload found for %s", uploadID)
+	}
+
+	// Account for chunks that are being re-uploaded
+	prevSize := int64(len(upload.parts[chunkNum]))
+	if err := memBackend.reserve(int64(len(data)) - prevSize); err != nil {
+		return err
+	}
+
+	upload.parts[chunkNum] = bytes.Clone(data)
+	memBackend.used += int64(len(data)) - prevSize
+	return nil
+}
+
+// replaceObject stores data for a remote ID, releasing the space used by any
+// previous object with the same ID. Must be called with memBackend.mu held.
+func (memBackend *Memory) replaceObject(remoteID string, data []byte) {
+	if prev, ok := memBackend.objects[remoteID]; ok {
+		memBackend.used -= int64(len(prev.data))
+	}
+
+	memBackend.objects[remoteID] = memoryObject{data: data, modified: time.Now()}
+	memBackend.used += int64(len(data))
+}
+
+// reserve checks that size bytes of new content can be stored without
+// exceeding the configured limit. Must be called with memBackend.mu held.
+func (memBackend *Memory) reserve(size int64) error {
+	if memBackend.limit > 0 && memBackend.used+size > memBackend.limit {
+		return StorageLimitError
+	}
+
+	return nil
+}
+
+func (upload *memoryUpload) size() int64 {
+	var size int64
+	for _, part := range upload.parts {
+		size += int64(len(part))
+	}
+
+	return size
+}
+
+func newMemory(limit int64) *Memory {
+	return &Memory{
+		limit:   limit,
+		objects: make(map[string]memoryObject),
+		partial: make(map[string]*memoryUpload),
+	}
+}
+
+// initMemoryStorage sets up an in-memory storage backend, with an optional
+// limit for the total size of all stored files
+func initMemoryStorage() storage {
+	limit := utils.GetEnvVarInt64("YEETFILE_MEMORY_STORAGE_LIMIT", 0)
+
+	slog.Info("Setting up in-memory storage (files will not persist after the server is stopped)...")
+	return newMemory(limit)
+}
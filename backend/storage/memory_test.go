@@ -0,0 +1,128 @@
+//go:build server_test
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"yeetfile/backend/utils"
+)
+
+// stageMemoryParts starts a large upload and writes random chunks for it,
+// returning the combined chunk data and the checksum for each chunk
+func stageMemoryParts(t *testing.T, backend *Memory, uploadID string, sizes ...int) ([]byte, []string) {
+	backend.startUpload(uploadID)
+
+	var data []byte
+	var checksums []string
+	for i, size := range sizes {
+		part := make([]byte, size)
+		_, _ = rand.Read(part)
+
+		err := backend.writePart(uploadID, i+1, part)
+		if err != nil {
+			t.Fatalf("Error writing part %d: %v\n", i+1, err)
+		}
+
+		_, checksum := utils.GenChecksum(part)
+		checksums = append(checksums, checksum)
+		data = append(data, part...)
+	}
+
+	return data, checksums
+}
+
+func TestMemoryFinishLargeUpload(t *testing.T) {
+	backend := newMemory(0)
+	remoteID := "large-upload"
+
+	data, checksums := stageMemoryParts(t, backend, remoteID, 4096, 4096, 1000)
+	id, length, err := backend.FinishLargeUpload(remoteID, "", checksums)
+	if err != nil {
+		t.Fatalf("Error finishing large upload: %v\n", err)
+	} else if id != remoteID || length != int64(len(data)) {
+		t.Fatalf("Unexpected result (id: %s, length: %d)\n", id, length)
+	} else if backend.used != int64(len(data)) {
+		t.Fatalf("Expected %d bytes used, got %d\n", len(data), backend.used)
+	}
+
+	// The upload can't be canceled once it has been finished
+	if canceled, err := backend.CancelLargeFile(remoteID, ""); canceled || err != nil {
+		t.Fatalf("Unexpected cancel result (canceled: %v, err: %v)\n",
+			canceled, err)
+	}
+
+	reader, err := backend.PartialDownloadById(remoteID, "", 4000, 9000)
+	if err != nil {
+		t.Fatalf("Error reading range: %v\n", err)
+	}
+
+	read, _ := io.ReadAll(reader)
+	if !bytes.Equal(read, data[4000:9001]) {
+		t.Fatalf("Range does not match uploaded data\n")
+	}
+
+	if deleted, err := backend.DeleteFile(remoteID, ""); !deleted || err != nil {
+		t.Fatalf("Unable to delete file (deleted: %v, err: %v)\n", deleted, err)
+	} else if backend.used != 0 {
+		t.Fatalf("Expected 0 bytes used after deleting, got %d\n", backend.used)
+	}
+}
+
+func TestMemoryCancelLargeUpload(t *testing.T) {
+	backend := newMemory(0)
+	remoteID := "canceled-upload"
+
+	_, checksums := stageMemoryParts(t, backend, remoteID, 100, 100)
+	checksums[0] = fmt.Sprintf("%040d", 0)
+
+	if _, _, err := backend.FinishLargeUpload(remoteID, "", checksums); err == nil {
+		t.Fatalf("Expected checksum mismatch error\n")
+	}
+
+	var unfinished int
+	_ = backend.List(func(object StoredObject) error {
+		if object.Unfinished && object.RemoteID == remoteID {
+			unfinished += 1
+		}
+
+		return nil
+	})
+
+	if unfinished != 1 {
+		t.Fatalf("Expected unfinished upload to be listed\n")
+	}
+
+	if canceled, err := backend.CancelLargeFile(remoteID, ""); !canceled || err != nil {
+		t.Fatalf("Unable to cancel upload (canceled: %v, err: %v)\n", canceled, err)
+	} else if backend.used != 0 {
+		t.Fatalf("Expected 0 bytes used after canceling, got %d\n", backend.used)
+	}
+
+	if _, _, err := backend.FinishLargeUpload(remoteID, "", checksums); err == nil {
+		t.Fatalf("Expected error finishing a canceled upload\n")
+	}
+}
+
+func TestMemoryStorageLimit(t *testing.T) {
+	backend := newMemory(150)
+	backend.startUpload("limited")
+
+	if err := backend.writePart("limited", 1, make([]byte, 100)); err != nil {
+		t.Fatalf("Unexpected error writing part: %v\n", err)
+	}
+
+	// Re-uploading a chunk only counts the difference in size
+	if err := backend.writePart("limited", 1, make([]byte, 120)); err != nil {
+		t.Fatalf("Unexpected error rewriting part: %v\n", err)
+	}
+
+	err := backend.writePart("limited", 2, make([]byte, 50))
+	if !errors.Is(err, StorageLimitError) {
+		t.Fatalf("Expected storage limit error, got %v\n", err)
+	}
+}
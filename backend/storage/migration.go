@@ -0,0 +1,318 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/shared/constants"
+)
+
+const (
+	migrationBatchSize = 50
+
+	// Files modified more recently than this may still be uploading, and are
+	// skipped until a later migration run
+	migrationSettleTime = time.Hour
+)
+
+var migration *Migration
+
+// Migration is used as the storage interface while files are being moved from
+// one storage backend to another. All new uploads go to the destination
+// backend, and reads for files that haven't been copied yet fall back to the
+// source backend.
+type Migration struct {
+	source          storage
+	destination     storage
+	sourceType      string
+	destinationType string
+
+	running  sync.Mutex
+	finished bool
+}
+
+func (m *Migration) Authorize() error {
+	return m.destination.Authorize()
+}
+
+func (m *Migration) Reauthorize() error {
+	return errors.Join(m.source.Reauthorize(), m.destination.Reauthorize())
+}
+
+func (m *Migration) InitUpload(metadataID string) error {
+	return m.destination.InitUpload(metadataID)
+}
+
+func (m *Migration) InitLargeUpload(filename, metadataID string) error {
+	return m.destination.InitLargeUpload(filename, metadataID)
+}
+
+func (m *Migration) UploadSingleChunk(chunk FileChunk, upload db.Upload) error {
+	return m.destination.UploadSingleChunk(chunk, upload)
+}
+
+func (m *Migration) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool, error) {
+	return m.destination.UploadMultiChunk(chunk, upload)
+}
+
+func (m *Migration) CancelLargeFile(remoteID, filename string) (bool, error) {
+	return m.destination.CancelLargeFile(remoteID, filename)
+}
+
+// DeleteFile removes the file from both backends, since the file may not have
+// been copied to the destination yet (or the source copy may still exist).
+func (m *Migration) DeleteFile(remoteID, filename string) (bool, error) {
+	dstOK, dstErr := m.destination.DeleteFile(remoteID, filename)
+	srcOK, srcErr := m.source.DeleteFile(remoteID, filename)
+
+	if dstOK || srcOK {
+		return true, nil
+	}
+
+	return false, errors.Join(dstErr, srcErr)
+}
+
+func (m *Migration) FinishLargeUpload(remoteID, filename string, checksums []string) (string, int64, error) {
+	return m.destination.FinishLargeUpload(remoteID, filename, checksums)
+}
+
+func (m *Migration) PartialDownloadById(remoteID, filename string, start, end int64) (io.ReadCloser, error) {
+	reader, err := m.destination.PartialDownloadById(remoteID, filename, start, end)
+	if err == nil {
+		return reader, nil
+	}
+
+	return m.source.PartialDownloadById(remoteID, filename, start, end)
+}
+
+// List only returns objects from the destination backend. Files that have been
+// copied are no longer referenced in the source backend, but are intentionally
+// left in place until the source backend is removed.
+func (m *Migration) List(fn func(object StoredObject) error) error {
+	return m.destination.List(fn)
+}
+
+// MigrateFiles copies a batch of files that haven't been migrated yet from the
+// source storage backend to the destination backend. Progress is recorded in
+// the database, so the migration can be resumed after a restart.
+func MigrateFiles() {
+	if migration == nil || !migration.running.TryLock() {
+		return
+	}
+
+	defer migration.running.Unlock()
+
+	items, err := db.GetPendingMigrationItems(
+		migration.sourceType,
+		migration.destinationType,
+		migrationBatchSize,
+		MaxUploadAttempts,
+		time.Now().UTC().Add(-migrationSettleTime))
+	if err != nil {
+		slog.Error("Error fetching files to migrate", "error", err)
+		return
+	}
+
+	migrated := 0
+	for _, item := range items {
+		err = migration.migrateItem(item)
+		if err != nil {
+			slog.Error("Error migrating file",
+				"table", item.Table, "id", item.ID,
+				"destination", migration.destinationType, "error", err)
+			err = db.SetMigrationItemStatus(
+				item,
+				migration.sourceType,
+				migration.destinationType,
+				db.MigrationStatusFailed,
+				err.Error())
+			if err != nil {
+				slog.Error("Error updating migration status", "error", err)
+			}
+			continue
+		}
+
+		migrated += 1
+	}
+
+	remaining, err := db.CountPendingMigrationItems(
+		migration.sourceType,
+		migration.destinationType,
+		MaxUploadAttempts)
+	if err != nil {
+		slog.Error("Error counting remaining files to migrate", "error", err)
+		return
+	}
+
+	if remaining > 0 || len(items) > 0 {
+		slog.Info("Storage migration progress",
+			"migrated", migrated, "remaining", remaining)
+	}
+
+	if remaining == 0 && !migration.finished {
+		migration.finished = true
+		slog.Info("Storage migration is complete. Check the storage_migration "+
+			"table for any failed files, then unset YEETFILE_STORAGE_MIGRATE_FROM.",
+			"source", migration.sourceType, "destination", migration.destinationType)
+	}
+}
+
+// migrateItem copies a single file from the source backend to the destination
+// backend and updates the file's remote ID once the copy has finished.
+func (m *Migration) migrateItem(item db.MigrationItem) error {
+	// The file may have already been copied (or uploaded after the migration
+	// began), in which case it only needs to be marked as migrated
+	reader, err := m.destination.PartialDownloadById(item.B2ID, item.Name, 0, 0)
+	if err == nil {
+		_ = reader.Close()
+		return m.completeItem(item, item.B2ID)
+	}
+
+	// The file is copied using a temporary metadata entry so that the
+	// original entry isn't modified until the copy is finished
+	tmpID := db.MigrationIDPrefix + item.ID
+	cleanUp := func() {
+		_ = db.DeleteMetadata(tmpID)
+		_ = db.DeleteUploads(tmpID)
+	}
+
+	cleanUp()
+	defer cleanUp()
+
+	chunkSize := int64(constants.ChunkSize + constants.TotalOverhead)
+	totalChunks := int((item.Length + chunkSize - 1) / chunkSize)
+
+	err = db.InsertTempMetadata(tmpID, item.Name, totalChunks)
+	if err != nil {
+		return err
+	}
+
+	err = db.CreateNewUpload(tmpID, item.Name)
+	if err != nil {
+		return err
+	}
+
+	if totalChunks == 1 {
+		err = m.destination.InitUpload(tmpID)
+	} else {
+		err = m.destination.InitLargeUpload(item.Name, tmpID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	upload := db.GetUploadValues(tmpID)
+	finished, err := m.copyChunks(item, tmpID, totalChunks, upload)
+	if err != nil || !finished {
+		if totalChunks > 1 {
+			_, _ = m.destination.CancelLargeFile(upload.UploadID, item.Name)
+		}
+
+		if err == nil {
+			err = errors.New("upload did not finish")
+		}
+
+		return err
+	}
+
+	newB2ID, newLength, err := db.GetMetadataRemoteID(tmpID)
+	if err != nil {
+		return err
+	} else if newLength != item.Length {
+		_, _ = m.destination.DeleteFile(newB2ID, item.Name)
+		return fmt.Errorf("copied length %d does not match %d",
+			newLength, item.Length)
+	}
+
+	return m.completeItem(item, newB2ID)
+}
+
+// copyChunks reads each chunk of a file from the source backend and uploads it
+// to the destination backend, returning true once the upload has finished.
+func (m *Migration) copyChunks(
+	item db.MigrationItem,
+	tmpID string,
+	totalChunks int,
+	upload db.Upload,
+) (bool, error) {
+	chunkSize := int64(constants.ChunkSize + constants.TotalOverhead)
+
+	finished := false
+	for chunkNum := 1; chunkNum <= totalChunks; chunkNum++ {
+		start := int64(chunkNum-1) * chunkSize
+		end := min(start+chunkSize, item.Length) - 1
+
+		data, err := readRange(m.source, item.B2ID, item.Name, start, end)
+		if err != nil {
+			return false, err
+		}
+
+		chunk := FileChunk{
+			FileID:      tmpID,
+			Filename:    item.Name,
+			Data:        data,
+			ChunkNum:    chunkNum,
+			TotalChunks: totalChunks,
+		}
+
+		if totalChunks == 1 {
+			err = m.destination.UploadSingleChunk(chunk, upload)
+			finished = err == nil
+		} else {
+			finished, err = m.destination.UploadMultiChunk(chunk, upload)
+		}
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return finished, nil
+}
+
+// completeItem updates the file's remote ID and marks the file as migrated. If
+// the file was deleted while being copied, the copy is removed.
+func (m *Migration) completeItem(item db.MigrationItem, newB2ID string) error {
+	updated, err := db.CompleteMigrationItem(
+		item,
+		newB2ID,
+		m.sourceType,
+		m.destinationType)
+	if err != nil {
+		return err
+	} else if updated {
+		return nil
+	}
+
+	if newB2ID != item.B2ID {
+		_, _ = m.destination.DeleteFile(newB2ID, item.Name)
+	}
+
+	return db.SetMigrationItemStatus(
+		item,
+		m.sourceType,
+		m.destinationType,
+		db.MigrationStatusSkipped,
+		"file was removed during migration")
+}
+
+// initMigration sets up the source storage backend for a migration and wraps
+// it with the (already initialized) destination backend.
+func initMigration(sourceType, destinationType string, destination storage) storage {
+	slog.Info("Migrating stored files",
+		"source", sourceType, "destination", destinationType)
+
+	migration = &Migration{
+		source:          initStorage(sourceType),
+		destination:     destination,
+		sourceType:      sourceType,
+		destinationType: destinationType,
+	}
+
+	return migration
+}
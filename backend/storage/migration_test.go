@@ -0,0 +1,258 @@
+//go:build server_test
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+	"yeetfile/shared/constants"
+)
+
+// interruptedStorage wraps an in-memory backend, allowing reads to be
+// inspected or failed partway through a migration
+type interruptedStorage struct {
+	*Memory
+	onRead func(start int64) error
+}
+
+func (s *interruptedStorage) PartialDownloadById(remoteID, filename string, start, end int64) (io.ReadCloser, error) {
+	if s.onRead != nil {
+		if err := s.onRead(start); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.Memory.PartialDownloadById(remoteID, filename, start, end)
+}
+
+// storeMigrationFile stores random data in the source backend for a new send
+// file, returning the file's migration item and contents
+func storeMigrationFile(t *testing.T, source *Memory, size int) (db.MigrationItem, []byte) {
+	chunkSize := constants.ChunkSize + constants.TotalOverhead
+	chunks := (size + chunkSize - 1) / chunkSize
+
+	id, err := db.InsertMetadata(chunks, "", "migration-test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.DeleteMetadata(id) })
+
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	if err = source.writeObject(id, data); err != nil {
+		t.Fatal(err)
+	} else if err = db.UpdateMetadata(id, id, int64(size)); err != nil {
+		t.Fatal(err)
+	}
+
+	return db.MigrationItem{
+		ID:     id,
+		Table:  db.MigrationTableMetadata,
+		Name:   "migration-test",
+		B2ID:   id,
+		Length: int64(size),
+		Chunks: chunks,
+	}, data
+}
+
+func readMigrationFile(t *testing.T, backend storage, remoteID string, length int64) []byte {
+	data, err := readRange(backend, remoteID, "migration-test", 0, length-1)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v\n", remoteID, err)
+	}
+
+	return data
+}
+
+func TestMigrateSingleChunk(t *testing.T) {
+	source := newMemory(0)
+	destination := newMemory(0)
+	m := &Migration{
+		source:          source,
+		destination:     destination,
+		sourceType:      config.MemStorage,
+		destinationType: config.MemStorage,
+	}
+
+	item, data := storeMigrationFile(t, source, 1000)
+	if err := m.migrateItem(item); err != nil {
+		t.Fatalf("Error migrating file: %v\n", err)
+	}
+
+	newB2ID, length, err := db.GetMetadataRemoteID(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if newB2ID == item.B2ID || length != item.Length {
+		t.Fatalf("Unexpected metadata after migrating (b2_id: %s, length: %d)\n",
+			newB2ID, length)
+	}
+
+	if !bytes.Equal(readMigrationFile(t, destination, newB2ID, length), data) {
+		t.Fatalf("Migrated file does not match the original\n")
+	} else if db.MetadataIDExists(db.MigrationIDPrefix + item.ID) {
+		t.Fatalf("Expected temporary metadata to be removed\n")
+	}
+}
+
+func TestMigrateResume(t *testing.T) {
+	source := &interruptedStorage{Memory: newMemory(0)}
+	destination := newMemory(0)
+	m := &Migration{
+		source:          source,
+		destination:     destination,
+		sourceType:      config.MemStorage,
+		destinationType: config.MemStorage,
+	}
+
+	chunkSize := int64(constants.ChunkSize + constants.TotalOverhead)
+	item, data := storeMigrationFile(t, source.Memory, int(chunkSize)+1000)
+
+	// Files that haven't been copied yet are read from the source backend
+	if !bytes.Equal(readMigrationFile(t, m, item.B2ID, item.Length), data) {
+		t.Fatalf("File does not match before migrating\n")
+	}
+
+	// Interrupt the copy after the first chunk, checking that the file can
+	// still be read while it's being copied
+	var readDuringCopy []byte
+	interruptErr := errors.New("interrupted")
+	source.onRead = func(start int64) error {
+		if start < chunkSize {
+			return nil
+		}
+
+		readDuringCopy = readMigrationFile(t, m, item.B2ID, item.Length)
+		return interruptErr
+	}
+
+	if err := m.migrateItem(item); !errors.Is(err, interruptErr) {
+		t.Fatalf("Expected interrupted migration, got: %v\n", err)
+	} else if !bytes.Equal(readDuringCopy, data) {
+		t.Fatalf("File does not match during migration\n")
+	}
+
+	b2ID, _, err := db.GetMetadataRemoteID(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if b2ID != item.B2ID {
+		t.Fatalf("Expected b2_id to be unchanged after interruption, got %s\n", b2ID)
+	} else if db.MetadataIDExists(db.MigrationIDPrefix + item.ID) {
+		t.Fatalf("Expected temporary metadata to be removed\n")
+	} else if len(destination.partial) != 0 || len(destination.objects) != 0 {
+		t.Fatalf("Expected partial copy to be canceled\n")
+	}
+
+	// Resuming copies the whole file
+	source.onRead = nil
+	if err = m.migrateItem(item); err != nil {
+		t.Fatalf("Error resuming migration: %v\n", err)
+	}
+
+	newB2ID, length, err := db.GetMetadataRemoteID(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if newB2ID == item.B2ID || length != item.Length {
+		t.Fatalf("Unexpected metadata after migrating (b2_id: %s, length: %d)\n",
+			newB2ID, length)
+	}
+
+	if !bytes.Equal(readMigrationFile(t, destination, newB2ID, length), data) {
+		t.Fatalf("Migrated file does not match the original\n")
+	} else if !bytes.Equal(readMigrationFile(t, m, newB2ID, length), data) {
+		t.Fatalf("File does not match after migrating\n")
+	}
+
+	// The source copy is left in place until the source backend is removed
+	if !bytes.Equal(readMigrationFile(t, source, item.B2ID, item.Length), data) {
+		t.Fatalf("Expected source copy to be left in place\n")
+	}
+}
+
+// isPendingMigration returns true if the file still needs to be copied from
+// the source to the destination backend
+func isPendingMigration(t *testing.T, item db.MigrationItem, source, destination string) bool {
+	items, err := db.GetPendingMigrationItems(
+		source,
+		destination,
+		1000,
+		MaxUploadAttempts,
+		time.Now().UTC().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pending := range items {
+		if pending.ID == item.ID && pending.Table == item.Table {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestMigrationPendingPerBackend(t *testing.T) {
+	item, _ := storeMigrationFile(t, newMemory(0), 1000)
+	if !isPendingMigration(t, item, config.LocalStorage, config.S3Storage) {
+		t.Fatalf("Expected file to be pending before migrating\n")
+	}
+
+	err := db.SetMigrationItemStatus(
+		item,
+		config.LocalStorage,
+		config.S3Storage,
+		db.MigrationStatusDone,
+		"")
+	if err != nil {
+		t.Fatal(err)
+	} else if isPendingMigration(t, item, config.LocalStorage, config.S3Storage) {
+		t.Fatalf("Expected migrated file to no longer be pending\n")
+	}
+
+	// A later migration away from the new backend copies the file again
+	if !isPendingMigration(t, item, config.S3Storage, config.SFTPStorage) {
+		t.Fatalf("Expected file to be pending for a new migration\n")
+	}
+
+	count, err := db.CountPendingMigrationItems(
+		config.S3Storage,
+		config.SFTPStorage,
+		MaxUploadAttempts)
+	if err != nil {
+		t.Fatal(err)
+	} else if count == 0 {
+		t.Fatalf("Expected pending files for a new migration\n")
+	}
+
+	// Failed attempts from the previous migration aren't counted against the
+	// new one
+	for i := 0; i < MaxUploadAttempts; i++ {
+		err = db.SetMigrationItemStatus(
+			item,
+			config.LocalStorage,
+			config.S3Storage,
+			db.MigrationStatusFailed,
+			"failed")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.SetMigrationItemStatus(
+		item,
+		config.S3Storage,
+		config.SFTPStorage,
+		db.MigrationStatusFailed,
+		"failed")
+	if err != nil {
+		t.Fatal(err)
+	} else if !isPendingMigration(t, item, config.S3Storage, config.SFTPStorage) {
+		t.Fatalf("Expected failed file to be retried\n")
+	}
+}
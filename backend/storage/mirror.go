@@ -0,0 +1,328 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"yeetfile/backend/db"
+)
+
+// mirrorRemoteIDPrefix identifies remote IDs that contain the IDs of a file in
+// both the primary and secondary storage backends
+const mirrorRemoteIDPrefix = "mirror:"
+
+var MirrorFinishError = errors.New("mirrored uploads are finished by each backend")
+
+// Mirror writes every file to both a primary and secondary storage backend,
+// and reads from the primary backend with a fallback to the secondary backend.
+//
+// Each backend writes its upload values and remote ID to its own temporary
+// metadata entry, and once a file has finished uploading to both backends, the
+// remote IDs from each are combined into a single ID for the original file.
+type Mirror struct {
+	primary       storage
+	secondary     storage
+	primaryType   string
+	secondaryType string
+}
+
+func (m *Mirror) Authorize() error {
+	return errors.Join(m.primary.Authorize(), m.secondary.Authorize())
+}
+
+func (m *Mirror) Reauthorize() error {
+	return errors.Join(m.primary.Reauthorize(), m.secondary.Reauthorize())
+}
+
+func (m *Mirror) InitUpload(metadataID string) error {
+	for i, backend := range m.backends() {
+		tmpID := mirrorTempID(i, metadataID)
+		err := initMirrorTempUpload(tmpID, "", 1)
+		if err != nil {
+			return err
+		}
+
+		if err = backend.InitUpload(tmpID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mirror) InitLargeUpload(filename, metadataID string) error {
+	var uploadIDs [2]string
+	for i, backend := range m.backends() {
+		tmpID := mirrorTempID(i, metadataID)
+		err := initMirrorTempUpload(tmpID, filename, 0)
+		if err != nil {
+			return err
+		}
+
+		if err = backend.InitLargeUpload(filename, tmpID); err != nil {
+			return err
+		}
+
+		uploadIDs[i] = db.GetUploadValues(tmpID).UploadID
+	}
+
+	remoteID := joinMirrorID(uploadIDs[0], uploadIDs[1])
+	err := db.SetVaultItemRemoteID(metadataID, remoteID)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdateUploadValues(metadataID, "", "", remoteID, false)
+}
+
+func (m *Mirror) UploadSingleChunk(chunk FileChunk, upload db.Upload) error {
+	for i, backend := range m.backends() {
+		tmpChunk, tmpUpload := mirrorTempChunk(i, chunk, upload)
+		err := backend.UploadSingleChunk(tmpChunk, tmpUpload)
+		if err != nil {
+			slog.Error("Error uploading to mirrored backend",
+				"backend", m.backendType(i), "error", err)
+			return err
+		}
+	}
+
+	return finishMirrorUpload(upload.MetadataID)
+}
+
+func (m *Mirror) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool, error) {
+	var finished [2]bool
+	for i, backend := range m.backends() {
+		var err error
+		tmpChunk, tmpUpload := mirrorTempChunk(i, chunk, upload)
+		finished[i], err = backend.UploadMultiChunk(tmpChunk, tmpUpload)
+		if err != nil {
+			slog.Error("Error uploading to mirrored backend",
+				"backend", m.backendType(i), "error", err)
+			return false, err
+		}
+	}
+
+	if !finished[0] && !finished[1] {
+		return false, nil
+	} else if finished[0] != finished[1] {
+		i := 0
+		if finished[1] {
+			i = 1
+		}
+
+		return false, fmt.Errorf("upload only finished on %s backend '%s'",
+			mirrorRole(i), m.backendType(i))
+	}
+
+	return true, finishMirrorUpload(upload.MetadataID)
+}
+
+func (m *Mirror) CancelLargeFile(remoteID, filename string) (bool, error) {
+	var canceled bool
+	var errs []error
+	for i, id := range splitMirrorID(remoteID) {
+		ok, err := m.backends()[i].CancelLargeFile(id, filename)
+		if ok && err == nil {
+			canceled = true
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+
+		err = db.DeleteTempUploadByUploadID(id, db.MirrorIDPrefix)
+		if err != nil {
+			slog.Error("Error removing mirrored upload values", "error", err)
+		}
+	}
+
+	if canceled {
+		return true, nil
+	}
+
+	return false, errors.Join(errs...)
+}
+
+func (m *Mirror) DeleteFile(remoteID, filename string) (bool, error) {
+	var deleted bool
+	var errs []error
+	for i, id := range splitMirrorID(remoteID) {
+		ok, err := m.backends()[i].DeleteFile(id, filename)
+		if ok && err == nil {
+			deleted = true
+			continue
+		}
+
+		slog.Error("Unable to delete file from mirrored backend",
+			"backend", m.backendType(i), "error", err)
+		errs = append(errs, err)
+	}
+
+	if deleted {
+		return true, nil
+	}
+
+	return false, errors.Join(errs...)
+}
+
+// FinishLargeUpload isn't used for mirrored files, since each backend uses its
+// own checksums and finishes its upload after receiving the final chunk.
+func (m *Mirror) FinishLargeUpload(_, _ string, _ []string) (string, int64, error) {
+	return "", 0, MirrorFinishError
+}
+
+// PartialDownloadById falls back to the secondary backend if the file can't be
+// opened from the primary backend. Errors that occur after the primary backend
+// has started returning data are passed through to the reader.
+func (m *Mirror) PartialDownloadById(remoteID, filename string, start, end int64) (io.ReadCloser, error) {
+	ids := splitMirrorID(remoteID)
+	reader, err := m.primary.PartialDownloadById(ids[0], filename, start, end)
+	if err == nil {
+		return reader, nil
+	}
+
+	slog.Warn("Error reading from primary backend, falling back to secondary",
+		"primary", m.primaryType, "secondary", m.secondaryType, "error", err)
+	return m.secondary.PartialDownloadById(ids[1], filename, start, end)
+}
+
+// List returns the objects stored in both the primary and secondary backends
+func (m *Mirror) List(fn func(object StoredObject) error) error {
+	for _, backend := range m.backends() {
+		if err := backend.List(fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mirror) backends() [2]storage {
+	return [2]storage{m.primary, m.secondary}
+}
+
+func (m *Mirror) backendType(i int) string {
+	return [2]string{m.primaryType, m.secondaryType}[i]
+}
+
+func mirrorRole(i int) string {
+	return [2]string{"primary", "secondary"}[i]
+}
+
+// mirrorTempID returns the ID of the temporary metadata entry used by the
+// primary (0) or secondary (1) backend for the provided metadata ID
+func mirrorTempID(i int, metadataID string) string {
+	return fmt.Sprintf("%s%s-%s", db.MirrorIDPrefix, mirrorRole(i), metadataID)
+}
+
+// mirrorTempChunk returns a copy of a chunk and its upload values that points
+// to the temporary metadata entry for the primary (0) or secondary (1) backend
+func mirrorTempChunk(i int, chunk FileChunk, upload db.Upload) (FileChunk, db.Upload) {
+	tmpID := mirrorTempID(i, upload.MetadataID)
+	tmpChunk := chunk
+	tmpChunk.FileID = tmpID
+	return tmpChunk, db.GetUploadValues(tmpID)
+}
+
+// initMirrorTempUpload (re)creates the temporary metadata and upload entries
+// for one of the mirrored backends
+func initMirrorTempUpload(tmpID, name string, chunks int) error {
+	removeMirrorTempUpload(tmpID)
+
+	err := db.InsertTempMetadata(tmpID, name, chunks)
+	if err != nil {
+		return err
+	}
+
+	return db.CreateNewUpload(tmpID, name)
+}
+
+func removeMirrorTempUpload(tmpID string) {
+	_ = db.DeleteMetadata(tmpID)
+	_ = db.DeleteUploads(tmpID)
+}
+
+// finishMirrorUpload combines the remote IDs of a file that has finished
+// uploading to both backends and updates the original file's metadata
+func finishMirrorUpload(metadataID string) error {
+	var remoteIDs [2]string
+	var lengths [2]int64
+	for i := range remoteIDs {
+		tmpID := mirrorTempID(i, metadataID)
+
+		var err error
+		remoteIDs[i], lengths[i], err = db.GetMetadataRemoteID(tmpID)
+		if err != nil {
+			return err
+		}
+
+		defer removeMirrorTempUpload(tmpID)
+	}
+
+	if lengths[0] != lengths[1] {
+		return fmt.Errorf("mirrored file lengths do not match (%d != %d)",
+			lengths[0], lengths[1])
+	}
+
+	// Keep the checksums from the primary backend so that the file can
+	// still be verified after the temporary entries are removed
+	checksums := db.GetUploadValues(mirrorTempID(0, metadataID)).Checksums
+	err := db.SetChecksums(metadataID, checksums)
+	if err != nil {
+		return err
+	}
+
+	return db.UpdateMetadata(
+		metadataID,
+		joinMirrorID(remoteIDs[0], remoteIDs[1]),
+		lengths[0])
+}
+
+// joinMirrorID combines the remote IDs from the primary and secondary backends
+// into a single ID
+func joinMirrorID(primaryID, secondaryID string) string {
+	return mirrorRemoteIDPrefix +
+		base64.RawURLEncoding.EncodeToString([]byte(primaryID)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(secondaryID))
+}
+
+// splitMirrorID returns the primary and secondary remote IDs from an ID created
+// with joinMirrorID. IDs for files that were uploaded before mirroring was
+// enabled are returned as-is for both backends.
+func splitMirrorID(remoteID string) [2]string {
+	fallback := [2]string{remoteID, remoteID}
+	if !strings.HasPrefix(remoteID, mirrorRemoteIDPrefix) {
+		return fallback
+	}
+
+	parts := strings.Split(strings.TrimPrefix(remoteID, mirrorRemoteIDPrefix), ".")
+	if len(parts) != 2 {
+		return fallback
+	}
+
+	primaryID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fallback
+	}
+
+	secondaryID, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fallback
+	}
+
+	return [2]string{string(primaryID), string(secondaryID)}
+}
+
+// initMirror sets up the secondary storage backend and wraps it with the
+// (already initialized) primary backend.
+func initMirror(primaryType, secondaryType string, primary storage) storage {
+	slog.Info("Mirroring stored files", "backend", secondaryType)
+
+	return &Mirror{
+		primary:       primary,
+		secondary:     initStorage(secondaryType),
+		primaryType:   primaryType,
+		secondaryType: secondaryType,
+	}
+}
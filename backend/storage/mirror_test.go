@@ -0,0 +1,262 @@
+//go:build server_test
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+)
+
+func newTestMirror() (*Mirror, *Memory, *Memory) {
+	primary := newMemory(0)
+	secondary := newMemory(0)
+	return &Mirror{
+		primary:       primary,
+		secondary:     secondary,
+		primaryType:   config.MemStorage,
+		secondaryType: config.MemStorage,
+	}, primary, secondary
+}
+
+// newMirrorUpload creates the metadata and upload entries for a new file,
+// removing them (and any leftover temporary entries) once the test finishes
+func newMirrorUpload(t *testing.T, chunks int) string {
+	id, err := db.InsertMetadata(chunks, "", "mirror-test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		for _, metadataID := range []string{id, mirrorTempID(0, id), mirrorTempID(1, id)} {
+			db.DeleteMetadata(metadataID)
+			db.DeleteUploads(metadataID)
+		}
+	})
+
+	if err = db.CreateNewUpload(id, "mirror-test"); err != nil {
+		t.Fatalf("Error creating upload: %v\n", err)
+	}
+
+	return id
+}
+
+// checkMirrorTempRemoved ensures that the temporary entries used by each
+// backend were removed once the upload finished
+func checkMirrorTempRemoved(t *testing.T, metadataID string) {
+	for i := range 2 {
+		if db.MetadataIDExists(mirrorTempID(i, metadataID)) {
+			t.Fatalf("Temporary %s metadata was not removed\n", mirrorRole(i))
+		} else if len(db.GetUploadValues(mirrorTempID(i, metadataID)).MetadataID) > 0 {
+			t.Fatalf("Temporary %s upload was not removed\n", mirrorRole(i))
+		}
+	}
+}
+
+func TestMirrorID(t *testing.T) {
+	for _, ids := range [][2]string{
+		{"primary-id", "secondary-id"},
+		{"4_z123.file", "path/with:mirror:prefix"},
+		{"", "secondary-only"},
+	} {
+		remoteID := joinMirrorID(ids[0], ids[1])
+		if !strings.HasPrefix(remoteID, mirrorRemoteIDPrefix) {
+			t.Fatalf("Missing mirror prefix: %s\n", remoteID)
+		} else if strings.Count(remoteID, ".") != 1 {
+			t.Fatalf("Expected a single separator in %s\n", remoteID)
+		} else if split := splitMirrorID(remoteID); split != ids {
+			t.Fatalf("Expected %v, got %v\n", ids, split)
+		}
+	}
+
+	// IDs from before mirroring was enabled, or that can't be decoded, are
+	// used as-is for both backends
+	for _, remoteID := range []string{
+		"legacy-id",
+		mirrorRemoteIDPrefix + "bm8tc2VwYXJhdG9y",
+		mirrorRemoteIDPrefix + "a.b.c",
+		mirrorRemoteIDPrefix + "!!!.c2Vjb25kYXJ5",
+		mirrorRemoteIDPrefix + "cHJpbWFyeQ.!!!",
+	} {
+		if split := splitMirrorID(remoteID); split != [2]string{remoteID, remoteID} {
+			t.Fatalf("Expected fallback for %s, got %v\n", remoteID, split)
+		}
+	}
+}
+
+func TestMirrorReadFallback(t *testing.T) {
+	m, primary, secondary := newTestMirror()
+
+	primaryData := []byte("primary data")
+	secondaryData := []byte("secondary!!!")
+	_ = primary.writeObject("primary-id", primaryData)
+	_ = secondary.writeObject("secondary-id", secondaryData)
+	_ = secondary.writeObject("legacy", secondaryData)
+
+	remoteID := joinMirrorID("primary-id", "secondary-id")
+	if read, err := readRange(m, remoteID, "", 0, 11); err != nil {
+		t.Fatalf("Error reading mirrored file: %v\n", err)
+	} else if !bytes.Equal(read, primaryData) {
+		t.Fatalf("Expected file to be read from primary backend\n")
+	}
+
+	// Files missing from the primary backend are read from the secondary
+	_, _ = primary.DeleteFile("primary-id", "")
+	if read, err := readRange(m, remoteID, "", 0, 11); err != nil {
+		t.Fatalf("Error reading from secondary backend: %v\n", err)
+	} else if !bytes.Equal(read, secondaryData) {
+		t.Fatalf("Expected file to be read from secondary backend\n")
+	}
+
+	if read, err := readRange(m, "legacy", "", 0, 11); err != nil {
+		t.Fatalf("Error reading legacy file: %v\n", err)
+	} else if !bytes.Equal(read, secondaryData) {
+		t.Fatalf("Expected legacy file to be read from secondary backend\n")
+	}
+
+	if _, err := m.PartialDownloadById(joinMirrorID("a", "b"), "", 0, 100); err == nil {
+		t.Fatalf("Expected error when file is missing from both backends\n")
+	}
+}
+
+func TestMirrorSingleChunk(t *testing.T) {
+	m, primary, secondary := newTestMirror()
+	id := newMirrorUpload(t, 1)
+
+	if err := m.InitUpload(id); err != nil {
+		t.Fatalf("Error starting upload: %v\n", err)
+	}
+
+	data := make([]byte, 5000)
+	_, _ = rand.Read(data)
+
+	err := m.UploadSingleChunk(FileChunk{
+		FileID:      id,
+		Filename:    "mirror-test",
+		Data:        data,
+		ChunkNum:    1,
+		TotalChunks: 1,
+	}, db.GetUploadValues(id))
+	if err != nil {
+		t.Fatalf("Error uploading file: %v\n", err)
+	}
+
+	remoteID, length, err := db.GetMetadataRemoteID(id)
+	if err != nil {
+		t.Fatal(err)
+	} else if length != int64(len(data)) {
+		t.Fatalf("Expected length %d, got %d\n", len(data), length)
+	} else if !strings.HasPrefix(remoteID, mirrorRemoteIDPrefix) {
+		t.Fatalf("Expected mirrored remote ID, got %s\n", remoteID)
+	}
+
+	checkMirrorTempRemoved(t, id)
+	if checksums := db.GetUploadValues(id).Checksums; len(checksums) != 1 {
+		t.Fatalf("Expected checksums to be kept, got %v\n", checksums)
+	}
+
+	ids := splitMirrorID(remoteID)
+	for i, backend := range []*Memory{primary, secondary} {
+		if read, err := readRange(backend, ids[i], "", 0, length-1); err != nil {
+			t.Fatalf("Error reading from %s backend: %v\n", mirrorRole(i), err)
+		} else if !bytes.Equal(read, data) {
+			t.Fatalf("File in %s backend does not match\n", mirrorRole(i))
+		}
+	}
+
+	if deleted, err := m.DeleteFile(remoteID, ""); !deleted || err != nil {
+		t.Fatalf("Unable to delete file (deleted: %v, err: %v)\n", deleted, err)
+	} else if len(primary.objects) > 0 || len(secondary.objects) > 0 {
+		t.Fatalf("File was not deleted from both backends\n")
+	}
+}
+
+func TestMirrorMultiChunk(t *testing.T) {
+	m, primary, secondary := newTestMirror()
+	id := newMirrorUpload(t, 3)
+
+	if err := m.InitLargeUpload("mirror-test", id); err != nil {
+		t.Fatalf("Error starting large upload: %v\n", err)
+	}
+
+	sizes := []int{4096, 4096, 1000}
+	var data []byte
+	for i, size := range sizes {
+		part := make([]byte, size)
+		_, _ = rand.Read(part)
+		data = append(data, part...)
+
+		finished, err := m.UploadMultiChunk(FileChunk{
+			FileID:      id,
+			Filename:    "mirror-test",
+			Data:        part,
+			ChunkNum:    i + 1,
+			TotalChunks: len(sizes),
+		}, db.GetUploadValues(id))
+		if err != nil {
+			t.Fatalf("Error uploading chunk %d: %v\n", i+1, err)
+		} else if finished != (i == len(sizes)-1) {
+			t.Fatalf("Unexpected finished state after chunk %d: %v\n", i+1, finished)
+		}
+	}
+
+	checkMirrorTempRemoved(t, id)
+	if len(primary.partial) > 0 || len(secondary.partial) > 0 {
+		t.Fatalf("Staged chunks were not removed\n")
+	}
+
+	remoteID, length, err := db.GetMetadataRemoteID(id)
+	if err != nil {
+		t.Fatal(err)
+	} else if length != int64(len(data)) {
+		t.Fatalf("Expected length %d, got %d\n", len(data), length)
+	}
+
+	if read, err := readRange(m, remoteID, "", 4000, 9000); err != nil {
+		t.Fatalf("Error reading mirrored file: %v\n", err)
+	} else if !bytes.Equal(read, data[4000:9001]) {
+		t.Fatalf("Range does not match uploaded data\n")
+	}
+
+	// Remove the file from the primary backend to read the full file from
+	// the secondary backend
+	ids := splitMirrorID(remoteID)
+	_, _ = primary.DeleteFile(ids[0], "")
+	if read, err := readRange(m, remoteID, "", 0, length-1); err != nil {
+		t.Fatalf("Error reading from secondary backend: %v\n", err)
+	} else if !bytes.Equal(read, data) {
+		t.Fatalf("File in secondary backend does not match\n")
+	}
+}
+
+func TestMirrorCancelLargeUpload(t *testing.T) {
+	m, primary, secondary := newTestMirror()
+	id := newMirrorUpload(t, 2)
+
+	if err := m.InitLargeUpload("mirror-test", id); err != nil {
+		t.Fatalf("Error starting large upload: %v\n", err)
+	}
+
+	upload := db.GetUploadValues(id)
+	_, err := m.UploadMultiChunk(FileChunk{
+		FileID:      id,
+		Filename:    "mirror-test",
+		Data:        []byte("first chunk"),
+		ChunkNum:    1,
+		TotalChunks: 2,
+	}, upload)
+	if err != nil {
+		t.Fatalf("Error uploading chunk: %v\n", err)
+	}
+
+	if canceled, err := m.CancelLargeFile(upload.UploadID, "mirror-test"); !canceled || err != nil {
+		t.Fatalf("Unable to cancel upload (canceled: %v, err: %v)\n", canceled, err)
+	} else if len(primary.partial) > 0 || len(secondary.partial) > 0 {
+		t.Fatalf("Staged chunks were not removed\n")
+	}
+
+	checkMirrorTempRemoved(t, id)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+	"yeetfile/backend/db"
+)
+
+var PresignUnavailableError = errors.New("presigned transfers are not enabled")
+
+// PresignedRequest is a short-lived request that a client can use to upload or
+// download a file chunk directly to/from the storage backend
+type PresignedRequest struct {
+	URL     string
+	Method  string
+	Headers http.Header
+}
+
+// presigner is implemented by storage backends that can hand out presigned
+// requests, so that encrypted file data doesn't need to pass through the server
+type presigner interface {
+	CanPresign() bool
+	PresignUpload(chunk FileChunk, upload db.Upload, size int64) (PresignedRequest, error)
+	FinishPresignedUpload(chunk FileChunk, upload db.Upload, checksum string) (bool, error)
+	PresignDownload(remoteID, filename string, start, end int64) (PresignedRequest, error)
+}
+
+// CanPresign checks if the current storage backend has presigned transfers
+// enabled. Wrapped backends (mirrored or migrating storage) always require
+// chunks to be transferred through the server.
+func CanPresign() bool {
+	p, ok := Interface.(presigner)
+	return ok && p.CanPresign()
+}
+
+// PresignUpload returns a request that the client can use to upload a chunk of
+// the provided size directly to the storage backend
+func PresignUpload(chunk FileChunk, upload db.Upload, size int64) (PresignedRequest, error) {
+	if !CanPresign() {
+		return PresignedRequest{}, PresignUnavailableError
+	}
+
+	return Interface.(presigner).PresignUpload(chunk, upload, size)
+}
+
+// FinishPresignedUpload records a chunk that the client has uploaded using a
+// presigned request, and returns true once all chunks of the file have been
+// uploaded. The checksum is the value returned by the storage backend when the
+// chunk was uploaded.
+func FinishPresignedUpload(chunk FileChunk, upload db.Upload, checksum string) (bool, error) {
+	if !CanPresign() {
+		return false, PresignUnavailableError
+	}
+
+	return Interface.(presigner).FinishPresignedUpload(chunk, upload, checksum)
+}
+
+// PresignDownload returns a request that the client can use to download a range
+// of bytes directly from the storage backend
+func PresignDownload(remoteID, filename string, start, end int64) (PresignedRequest, error) {
+	if !CanPresign() {
+		return PresignedRequest{}, PresignUnavailableError
+	}
+
+	return Interface.(presigner).PresignDownload(remoteID, filename, start, end)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -12,8 +13,10 @@ import (
 	smithy "github.com/aws/smithy-go/endpoints"
 	"io"
 	"log"
+	"log/slog"
 	"net/url"
 	"strings"
+	"time"
 	"yeetfile/backend/db"
 	"yeetfile/backend/utils"
 )
@@ -30,6 +33,10 @@ type S3 struct {
 	secretKey   string
 	bucketName  string
 	regionName  string
+
+	// Presigned transfers are only enabled if presignExpiry is set
+	presignClient *s3.PresignClient
+	presignExpiry time.Duration
 }
 
 type S3Resolver struct {
@@ -55,7 +62,7 @@ func (r *S3Resolver) ResolveEndpoint(_ context.Context, params s3.EndpointParame
 }
 
 func (s3Backend *S3) Authorize() error {
-	log.Println("Authorizing S3 backend...")
+	slog.Info("Authorizing S3 backend...")
 	credsProvider := credentials.NewStaticCredentialsProvider(
 		s3Backend.accessKeyID,
 		s3Backend.secretKey,
@@ -88,10 +95,18 @@ func (s3Backend *S3) Authorize() error {
 	}
 
 	s3Backend.client = client
+	if s3Backend.presignExpiry > 0 {
+		s3Backend.presignClient = s3.NewPresignClient(
+			client,
+			s3.WithPresignExpires(s3Backend.presignExpiry))
+	}
+
 	return nil
 }
 
-func (s3Backend *S3) Reauthorize() {}
+func (s3Backend *S3) Reauthorize() error {
+	return nil
+}
 
 func (s3Backend *S3) InitUpload(_ string) error {
 	// No initialization needed for single-chunk uploads
@@ -106,7 +121,7 @@ func (s3Backend *S3) InitLargeUpload(filename, metadataID string) error {
 
 	output, err := s3Backend.client.CreateMultipartUpload(context.TODO(), input)
 	if err != nil {
-		log.Printf("Error initiating multipart upload: %v\n", err)
+		slog.Error("Error initiating multipart upload", "error", err)
 		return err
 	}
 
@@ -128,7 +143,7 @@ func (s3Backend *S3) UploadSingleChunk(chunk FileChunk, _ db.Upload) error {
 
 	_, err := s3Backend.client.PutObject(context.TODO(), input)
 	if err != nil {
-		log.Printf("Failed to upload chunk: %v\n", err)
+		slog.Error("Failed to upload chunk", "error", err)
 		return err
 	}
 
@@ -153,13 +168,19 @@ func (s3Backend *S3) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool,
 
 	uploadOutput, err := s3Backend.client.UploadPart(ctx, uploadInput)
 	if err != nil {
-		log.Printf("Failed to upload file chunk: %v\n", err)
+		slog.Error("Failed to upload file chunk", "error", err)
 		return false, err
 	}
 
-	checksums, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, *uploadOutput.ETag)
+	return s3Backend.recordPart(chunk, upload, *uploadOutput.ETag)
+}
+
+// recordPart stores the ETag for an uploaded part of a multipart upload, and
+// completes the upload once all parts have been uploaded
+func (s3Backend *S3) recordPart(chunk FileChunk, upload db.Upload, etag string) (bool, error) {
+	checksums, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, etag)
 	if err != nil {
-		log.Printf("Failed to update S3 ETags: %v\n", err)
+		slog.Error("Failed to update S3 ETags", "error", err)
 		return false, err
 	}
 
@@ -171,7 +192,7 @@ func (s3Backend *S3) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool,
 			checksums)
 
 		if err != nil {
-			log.Printf("Failed to finalize multipart upload: %v\n", err)
+			slog.Error("Failed to finalize multipart upload", "error", err)
 			return false, err
 		}
 
@@ -200,7 +221,7 @@ func (s3Backend *S3) DeleteFile(_, filename string) (bool, error) {
 
 	_, err := s3Backend.client.DeleteObject(context.TODO(), input)
 	if err != nil {
-		log.Printf("Failed to delete file: %v\n", err)
+		slog.Error("Failed to delete file", "error", err)
 		return false, err
 	}
 
@@ -228,7 +249,7 @@ func (s3Backend *S3) FinishLargeUpload(remoteID, filename string, checksums []st
 
 	_, err := s3Backend.client.CompleteMultipartUpload(ctx, completeInput)
 	if err != nil {
-		log.Printf("Failed to finalize multipart upload: %v\n", err)
+		slog.Error("Failed to finalize multipart upload", "error", err)
 		return "", 0, err
 	}
 
@@ -244,7 +265,7 @@ func (s3Backend *S3) FinishLargeUpload(remoteID, filename string, checksums []st
 	return "", *headOutput.ContentLength, nil
 }
 
-func (s3Backend *S3) PartialDownloadById(_, name string, start, end int64) ([]byte, error) {
+func (s3Backend *S3) PartialDownloadById(_, name string, start, end int64) (io.ReadCloser, error) {
 	ctx := context.TODO()
 
 	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, end)
@@ -256,20 +277,162 @@ func (s3Backend *S3) PartialDownloadById(_, name string, start, end int64) ([]by
 
 	output, err := s3Backend.client.GetObject(ctx, input)
 	if err != nil {
-		log.Printf("Error fetching object bytes: %v\n", err)
+		slog.Error("Error fetching object bytes", "error", err)
 		return nil, err
 	}
 
-	defer output.Body.Close()
+	return output.Body, nil
+}
+
+func (s3Backend *S3) CanPresign() bool {
+	return s3Backend.presignClient != nil
+}
+
+// PresignUpload signs a request for uploading a single chunk of a file. The
+// chunk size is included in the signature, so the client can't upload more
+// data than the server accounted for.
+func (s3Backend *S3) PresignUpload(chunk FileChunk, upload db.Upload, size int64) (PresignedRequest, error) {
+	var (
+		req *v4.PresignedHTTPRequest
+		err error
+		ctx = context.TODO()
+	)
+
+	if chunk.TotalChunks == 1 {
+		req, err = s3Backend.presignClient.PresignPutObject(ctx, &s3.PutObjectInput{
+			Bucket:        aws.String(s3Backend.bucketName),
+			Key:           aws.String(chunk.Filename),
+			ContentLength: aws.Int64(size),
+		})
+	} else {
+		req, err = s3Backend.presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(s3Backend.bucketName),
+			Key:           aws.String(chunk.Filename),
+			UploadId:      aws.String(upload.UploadID),
+			PartNumber:    aws.Int32(int32(chunk.ChunkNum)),
+			ContentLength: aws.Int64(size),
+		})
+	}
 
-	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, output.Body)
 	if err != nil {
-		log.Printf("Failed to copy over bytes from response: %v\n", err)
-		return nil, err
+		slog.Error("Error presigning upload", "error", err)
+		return PresignedRequest{}, err
 	}
 
-	return buf.Bytes(), nil
+	return newPresignedRequest(req), nil
+}
+
+// FinishPresignedUpload records the ETag of a part uploaded by the client, or
+// updates the file's metadata if the file was uploaded as a single object
+func (s3Backend *S3) FinishPresignedUpload(chunk FileChunk, upload db.Upload, checksum string) (bool, error) {
+	if chunk.TotalChunks > 1 {
+		return s3Backend.recordPart(chunk, upload, checksum)
+	}
+
+	headOutput, err := s3Backend.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s3Backend.bucketName),
+		Key:    aws.String(chunk.Filename),
+	})
+
+	if err != nil {
+		slog.Error("Error checking uploaded object", "error", err)
+		return false, err
+	}
+
+	return true, db.UpdateMetadata(
+		chunk.FileID,
+		"",
+		aws.ToInt64(headOutput.ContentLength))
+}
+
+// PresignDownload signs a request for a range of bytes in a file. The range is
+// included in the signature, and must be sent as-is by the client.
+func (s3Backend *S3) PresignDownload(_, name string, start, end int64) (PresignedRequest, error) {
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, end)
+	req, err := s3Backend.presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s3Backend.bucketName),
+		Key:    aws.String(name),
+		Range:  aws.String(rangeHeader),
+	})
+
+	if err != nil {
+		slog.Error("Error presigning download", "error", err)
+		return PresignedRequest{}, err
+	}
+
+	return newPresignedRequest(req), nil
+}
+
+func newPresignedRequest(req *v4.PresignedHTTPRequest) PresignedRequest {
+	// The host is part of the URL, and is set by the client automatically
+	headers := req.SignedHeader.Clone()
+	headers.Del("Host")
+
+	return PresignedRequest{
+		URL:     req.URL,
+		Method:  req.Method,
+		Headers: headers,
+	}
+}
+
+// List returns every object in the bucket, followed by any multipart uploads
+// that haven't been completed or aborted
+func (s3Backend *S3) List(fn func(object StoredObject) error) error {
+	ctx := context.TODO()
+	objects := s3.NewListObjectsV2Paginator(s3Backend.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3Backend.bucketName),
+	})
+
+	for objects.HasMorePages() {
+		page, err := objects.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range page.Contents {
+			if aws.ToString(object.Key) == testFileName {
+				continue
+			}
+
+			// Objects are stored by name, so there isn't a separate
+			// remote ID for finished uploads
+			err = fn(StoredObject{
+				Name:     aws.ToString(object.Key),
+				Size:     aws.ToInt64(object.Size),
+				Modified: aws.ToTime(object.LastModified),
+				store:    s3Backend,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	uploads := s3.NewListMultipartUploadsPaginator(s3Backend.client, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s3Backend.bucketName),
+	})
+
+	for uploads.HasMorePages() {
+		page, err := uploads.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, upload := range page.Uploads {
+			err = fn(StoredObject{
+				RemoteID:   aws.ToString(upload.UploadId),
+				Name:       aws.ToString(upload.Key),
+				Modified:   aws.ToTime(upload.Initiated),
+				Unfinished: true,
+				store:      s3Backend,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
 func initS3() storage {
@@ -279,6 +442,9 @@ func initS3() storage {
 		secretKey   = utils.GetEnvVar("YEETFILE_S3_SECRET_KEY", "")
 		bucketName  = utils.GetEnvVar("YEETFILE_S3_BUCKET_NAME", "")
 		regionName  = utils.GetEnvVar("YEETFILE_S3_REGION_NAME", "")
+
+		presigned     = utils.GetEnvVarBool("YEETFILE_S3_PRESIGNED", false)
+		presignExpiry = utils.GetEnvVarInt("YEETFILE_S3_PRESIGN_EXPIRY", 300)
 	)
 
 	if utils.IsAnyStringMissing(endpoint, accessKeyID, secretKey, bucketName) {
@@ -301,9 +467,13 @@ func initS3() storage {
 		regionName:  regionName,
 	}
 
+	if presigned && presignExpiry > 0 {
+		s3Backend.presignExpiry = time.Duration(presignExpiry) * time.Second
+	}
+
 	err := s3Backend.Authorize()
 	if err != nil {
-		log.Println("Unable to authorize S3 backend")
+		slog.Error("Unable to authorize S3 backend")
 		log.Fatal(err)
 	}
 
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"yeetfile/backend/config"
+	"yeetfile/backend/db"
+	"yeetfile/backend/mail"
+	"yeetfile/shared/constants"
+)
+
+const (
+	scrubBatchSize = 20
+	scrubReadSize  = 256 * 1024
+
+	// Each run stops before the next one is scheduled to begin
+	scrubRunTime = 50 * time.Minute
+)
+
+var scrubRunning sync.Mutex
+
+// scrubber keeps track of a single run of the storage integrity check
+type scrubber struct {
+	start     time.Time
+	bytesRead int64
+	rateLimit int64
+	failures  []string
+}
+
+// ScrubFiles re-reads stored files through the storage interface and verifies
+// each chunk against the checksums recorded when the file was uploaded. Reads
+// are limited to YEETFILE_SCRUB_RATE_LIMIT bytes per second, and files are
+// rechecked every YEETFILE_SCRUB_RECHECK_DAYS days. Corrupted or missing files
+// are recorded in the database and reported to the instance admin.
+func ScrubFiles() {
+	if !scrubRunning.TryLock() {
+		return
+	}
+
+	defer scrubRunning.Unlock()
+
+	err := db.DeleteStaleScrubResults()
+	if err != nil {
+		slog.Error("Error removing stale scrub results", "error", err)
+	}
+
+	s := scrubber{
+		start:     time.Now(),
+		rateLimit: config.YeetFileConfig.ScrubRateLimit,
+	}
+
+	recheckAge := time.Duration(config.YeetFileConfig.ScrubRecheckDays) * 24 * time.Hour
+
+	checked := 0
+	for time.Since(s.start) < scrubRunTime {
+		items, err := db.GetScrubItems(
+			scrubBatchSize,
+			time.Now().UTC().Add(-recheckAge))
+		if err != nil {
+			slog.Error("Error fetching files to scrub", "error", err)
+			break
+		} else if len(items) == 0 {
+			break
+		}
+
+		for _, item := range items {
+			status, errMsg := s.scrubItem(item)
+			err = db.SetScrubResult(item, status, errMsg)
+			if err != nil {
+				slog.Error("Error recording scrub result", "error", err)
+				return
+			}
+
+			checked += 1
+			if time.Since(s.start) >= scrubRunTime {
+				break
+			}
+		}
+	}
+
+	if checked > 0 {
+		slog.Info("Storage scrub finished", "checked", checked, "failed", len(s.failures))
+	}
+
+	if len(s.failures) > 0 {
+		reportScrubFailures(s.failures)
+	}
+}
+
+// scrubItem reads each chunk of a file and returns the resulting scrub status,
+// along with an error message if the file is corrupted or missing.
+func (s *scrubber) scrubItem(item db.ScrubItem) (string, string) {
+	status := db.ScrubStatusOK
+	err := s.verifyItem(item)
+	if errors.Is(err, checksumMismatchError) || errors.Is(err, lengthMismatchError) {
+		status = db.ScrubStatusCorrupt
+	} else if err != nil {
+		status = db.ScrubStatusMissing
+	}
+
+	if status == db.ScrubStatusOK {
+		return status, ""
+	}
+
+	slog.Error("Storage scrub failure",
+		"table", item.Table, "id", item.ID, "status", status, "error", err)
+
+	// Only report files that weren't already known to be failing
+	if item.LastStatus != status {
+		s.failures = append(s.failures, fmt.Sprintf(
+			"%s %s (%s): %v", item.Table, item.ID, status, err))
+	}
+
+	return status, err.Error()
+}
+
+var (
+	checksumMismatchError = errors.New("checksum mismatch")
+	lengthMismatchError   = errors.New("length mismatch")
+)
+
+// verifyItem reads every chunk of a file, comparing each chunk to its recorded
+// checksum (if available).
+func (s *scrubber) verifyItem(item db.ScrubItem) error {
+	chunkSize := int64(constants.ChunkSize + constants.TotalOverhead)
+	totalChunks := int((item.Length + chunkSize - 1) / chunkSize)
+
+	// Checksums are only usable if one was recorded for every chunk
+	checksums := item.Checksums
+	if len(checksums) != totalChunks {
+		checksums = nil
+	}
+
+	for chunkNum := 1; chunkNum <= totalChunks; chunkNum++ {
+		start := int64(chunkNum-1) * chunkSize
+		end := min(start+chunkSize, item.Length) - 1
+
+		checksum := ""
+		if checksums != nil {
+			checksum = checksums[chunkNum-1]
+		}
+
+		err := s.verifyChunk(item, start, end, checksum)
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", chunkNum, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyChunk streams a single chunk of a file from storage, hashing the chunk
+// as it's read instead of holding the full chunk in memory
+func (s *scrubber) verifyChunk(item db.ScrubItem, start, end int64, checksum string) error {
+	reader, err := Interface.PartialDownloadById(item.B2ID, item.Name, start, end)
+	if err != nil {
+		return err
+	}
+
+	defer reader.Close()
+
+	sha1Hash := sha1.New()
+	md5Hash := md5.New()
+
+	var n int64
+	buf := make([]byte, scrubReadSize)
+	for {
+		read, err := reader.Read(buf)
+		if read > 0 {
+			n += int64(read)
+			sha1Hash.Write(buf[:read])
+			md5Hash.Write(buf[:read])
+			s.throttle(read)
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if n != end-start+1 {
+		return fmt.Errorf("%w (read %d bytes, expected %d)",
+			lengthMismatchError, n, end-start+1)
+	}
+
+	matched, verified := checksumMatches(sha1Hash.Sum(nil), md5Hash.Sum(nil), checksum)
+	if !verified {
+		if len(checksum) > 0 {
+			slog.Warn("Unable to verify chunk with unrecognized checksum format",
+				"table", item.Table, "id", item.ID, "start", start,
+				"checksum", checksum)
+		}
+	} else if !matched {
+		return checksumMismatchError
+	}
+
+	return nil
+}
+
+// throttle pauses the scrubber long enough to keep reads below the configured
+// rate limit
+func (s *scrubber) throttle(n int) {
+	s.bytesRead += int64(n)
+	expected := time.Duration(float64(s.bytesRead) / float64(s.rateLimit) *
+		float64(time.Second))
+	if wait := expected - time.Since(s.start); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// checksumMatches compares a chunk's hashes to its recorded checksum. Local and
+// B2 storage record SHA1 checksums, and S3 records each part's ETag (an MD5
+// checksum). Checksums in any other format can't be verified, which is
+// indicated by the second return value.
+func checksumMatches(sha1Sum, md5Sum []byte, checksum string) (bool, bool) {
+	checksum = strings.ToLower(strings.Trim(checksum, `"`))
+	if _, err := hex.DecodeString(checksum); err != nil {
+		return false, false
+	}
+
+	switch len(checksum) {
+	case sha1.Size * 2:
+		return hex.EncodeToString(sha1Sum) == checksum, true
+	case md5.Size * 2:
+		return hex.EncodeToString(md5Sum) == checksum, true
+	default:
+		return false, false
+	}
+}
+
+// reportScrubFailures emails the list of newly failed files to the instance
+// admin, if an admin is configured
+func reportScrubFailures(failures []string) {
+	adminEmail := config.InstanceAdmin
+	if len(adminEmail) == 0 {
+		return
+	} else if !strings.Contains(adminEmail, "@") {
+		var err error
+		adminEmail, err = db.GetUserEmailByID(adminEmail)
+		if err != nil || len(adminEmail) == 0 {
+			slog.Error("Unable to find instance admin email for scrub report")
+			return
+		}
+	}
+
+	_ = mail.SendStorageScrubEmail(adminEmail, failures)
+}
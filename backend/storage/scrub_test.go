@@ -0,0 +1,140 @@
+//go:build server_test
+
+package storage
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"yeetfile/backend/db"
+)
+
+// useScrubBackend replaces the storage interface with a memory backend
+// containing a single file, restoring the original interface once the test
+// has finished
+func useScrubBackend(t *testing.T, data []byte) db.ScrubItem {
+	backend := newMemory(0)
+	_ = backend.writeObject("scrub-test", data)
+
+	original := Interface
+	Interface = backend
+	t.Cleanup(func() { Interface = original })
+
+	return db.ScrubItem{
+		ID:     "scrub-test",
+		Table:  "metadata",
+		Name:   "scrub-test",
+		B2ID:   "scrub-test",
+		Length: int64(len(data)),
+	}
+}
+
+func TestChecksumMatches(t *testing.T) {
+	data := []byte("scrub test data")
+	sha1Sum := sha1.Sum(data)
+	md5Sum := md5.Sum(data)
+	sha1Hex := fmt.Sprintf("%x", sha1Sum)
+	md5Hex := fmt.Sprintf("%x", md5Sum)
+
+	for _, test := range []struct {
+		checksum string
+		matched  bool
+		verified bool
+	}{
+		{sha1Hex, true, true},
+		{strings.ToUpper(sha1Hex), true, true},
+		{md5Hex, true, true},
+		{`"` + md5Hex + `"`, true, true},
+		{fmt.Sprintf("%x", sha1.Sum([]byte("other"))), false, true},
+		{`"` + fmt.Sprintf("%x", md5.Sum([]byte("other"))) + `"`, false, true},
+		{"", false, false},
+		{db.ChecksumPlaceholder, false, false},
+		{md5Hex + "-2", false, false},
+		{strings.Repeat("z", sha1.Size*2), false, false},
+		{sha1Hex + md5Hex, false, false},
+	} {
+		matched, verified := checksumMatches(sha1Sum[:], md5Sum[:], test.checksum)
+		if matched != test.matched || verified != test.verified {
+			t.Fatalf("Unexpected result for %q (matched: %v, verified: %v)\n",
+				test.checksum, matched, verified)
+		}
+	}
+}
+
+func TestVerifyChunk(t *testing.T) {
+	data := make([]byte, 4096)
+	_, _ = rand.Read(data)
+	item := useScrubBackend(t, data)
+
+	s := scrubber{start: time.Now(), rateLimit: 1024 * 1024 * 1024}
+	sha1Hex := fmt.Sprintf("%x", sha1.Sum(data[1000:2000]))
+	md5Hex := fmt.Sprintf("%x", md5.Sum(data[1000:2000]))
+
+	if err := s.verifyChunk(item, 1000, 1999, sha1Hex); err != nil {
+		t.Fatalf("Error verifying SHA1 checksum: %v\n", err)
+	} else if err = s.verifyChunk(item, 1000, 1999, `"`+md5Hex+`"`); err != nil {
+		t.Fatalf("Error verifying ETag checksum: %v\n", err)
+	} else if err = s.verifyChunk(item, 1000, 1999, "unknown"); err != nil {
+		t.Fatalf("Unverifiable checksum should not fail: %v\n", err)
+	} else if s.bytesRead != 3000 {
+		t.Fatalf("Expected 3000 bytes read, got %d\n", s.bytesRead)
+	}
+
+	if err := s.verifyChunk(item, 0, 999, sha1Hex); !errors.Is(err, checksumMismatchError) {
+		t.Fatalf("Expected checksum mismatch, got %v\n", err)
+	} else if err = s.verifyChunk(item, 4000, 4999, ""); !errors.Is(err, lengthMismatchError) {
+		t.Fatalf("Expected length mismatch, got %v\n", err)
+	}
+
+	item.B2ID = "missing"
+	if err := s.verifyChunk(item, 0, 999, ""); err == nil {
+		t.Fatalf("Expected error for missing file\n")
+	}
+}
+
+func TestScrubItemStatus(t *testing.T) {
+	data := make([]byte, 1000)
+	_, _ = rand.Read(data)
+	item := useScrubBackend(t, data)
+
+	s := scrubber{start: time.Now(), rateLimit: 1024 * 1024 * 1024}
+
+	item.Checksums = []string{fmt.Sprintf("%x", sha1.Sum(data))}
+	if status, _ := s.scrubItem(item); status != db.ScrubStatusOK {
+		t.Fatalf("Expected %s, got %s\n", db.ScrubStatusOK, status)
+	}
+
+	item.Checksums = []string{fmt.Sprintf("%x", sha1.Sum(data[1:]))}
+	if status, _ := s.scrubItem(item); status != db.ScrubStatusCorrupt {
+		t.Fatalf("Expected %s, got %s\n", db.ScrubStatusCorrupt, status)
+	}
+
+	item.B2ID = "missing"
+	if status, _ := s.scrubItem(item); status != db.ScrubStatusMissing {
+		t.Fatalf("Expected %s, got %s\n", db.ScrubStatusMissing, status)
+	} else if len(s.failures) != 2 {
+		t.Fatalf("Expected 2 failures, got %d\n", len(s.failures))
+	}
+}
+
+func TestScrubThrottle(t *testing.T) {
+	s := scrubber{start: time.Now(), rateLimit: 1000}
+
+	// 100 bytes at 1000 bytes/s should take at least 100ms
+	s.throttle(100)
+	if elapsed := time.Since(s.start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Expected throttle to wait at least 100ms, waited %s\n", elapsed)
+	}
+
+	// Reads that are already below the rate limit aren't delayed
+	s = scrubber{start: time.Now().Add(-time.Second), rateLimit: 1000}
+	s.throttle(100)
+	if elapsed := time.Since(s.start); elapsed > 1100*time.Millisecond {
+		t.Fatalf("Expected no throttle delay, waited %s\n", elapsed-time.Second)
+	}
+}
@@ -0,0 +1,591 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yeetfile/backend/db"
+	"yeetfile/backend/utils"
+	"yeetfile/shared"
+)
+
+const (
+	defaultSFTPPath    = "yeetfile"
+	defaultSFTPPort    = "22"
+	sftpConnectTimeout = 30 * time.Second
+)
+
+// SFTP stores encrypted file content on a remote server over SSH, using the
+// same sharded layout as LocalFS (<root>/ab/cd/<id>). Writes go through a temp
+// file that is renamed into place once finished, and the chunks of large
+// uploads are staged in a separate directory until the upload is finished.
+type SFTP struct {
+	addr   string
+	root   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+func (sftpBackend *SFTP) Authorize() error {
+	sftpBackend.mu.Lock()
+	defer sftpBackend.mu.Unlock()
+
+	return sftpBackend.connect()
+}
+
+// Reauthorize replaces the current connection to the SFTP server
+func (sftpBackend *SFTP) Reauthorize() error {
+	sftpBackend.mu.Lock()
+	defer sftpBackend.mu.Unlock()
+
+	sftpBackend.disconnect()
+	err := sftpBackend.connect()
+	if err != nil {
+		slog.Error("Error reconnecting to SFTP server", "error", err)
+	}
+
+	return err
+}
+
+func (sftpBackend *SFTP) InitUpload(metadataID string) error {
+	// Single chunk files use the metadata ID as the remote ID
+	return db.UpdateUploadValues(metadataID, "", "", metadataID, false)
+}
+
+func (sftpBackend *SFTP) InitLargeUpload(_, metadataID string) error {
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return err
+	}
+
+	err = client.MkdirAll(sftpBackend.partialPath(metadataID))
+	if err != nil {
+		return err
+	}
+
+	err = db.SetVaultItemRemoteID(metadataID, metadataID)
+	if err != nil {
+		return err
+	}
+
+	// Multi-chunk files also use the metadata ID, but chunks are written to
+	// a separate staging directory until the upload is finished
+	return db.UpdateUploadValues(metadataID, "", "", metadataID, false)
+}
+
+func (sftpBackend *SFTP) UploadSingleChunk(chunk FileChunk, upload db.Upload) error {
+	remoteID := chunk.FileID
+	_, checksum := utils.GenChecksum(chunk.Data)
+	_, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
+	if err != nil {
+		slog.Error("Error updating checksums", "error", err)
+		return err
+	}
+
+	objectPath, err := sftpBackend.objectPath(remoteID)
+	if err != nil {
+		return err
+	}
+
+	err = sftpBackend.writeAtomic(objectPath, func(f *sftp.File) error {
+		_, err := f.Write(chunk.Data)
+		return err
+	})
+
+	if err != nil {
+		slog.Error("Error writing file to SFTP storage", "error", err)
+		return err
+	}
+
+	return db.UpdateMetadata(upload.MetadataID, remoteID, int64(len(chunk.Data)))
+}
+
+func (sftpBackend *SFTP) UploadMultiChunk(chunk FileChunk, upload db.Upload) (bool, error) {
+	err := sftpBackend.writePart(upload.UploadID, chunk.ChunkNum, chunk.Data)
+	if err != nil {
+		slog.Error("Error writing file chunk to SFTP storage", "error", err)
+		return false, err
+	}
+
+	_, checksum := utils.GenChecksum(chunk.Data)
+	checksums, err := db.UpdateChecksums(chunk.FileID, chunk.ChunkNum, checksum)
+	if err != nil {
+		slog.Error("Failed to update checksums", "error", err)
+		return false, err
+	}
+
+	if len(checksums) == chunk.TotalChunks && checksums[0] != db.ChecksumPlaceholder {
+		// All chunks accounted for, finalize the upload
+		remoteID, length, err := sftpBackend.FinishLargeUpload(
+			upload.UploadID,
+			chunk.Filename,
+			checksums)
+		if err != nil {
+			return false, err
+		}
+
+		return true, db.UpdateMetadata(upload.MetadataID, remoteID, length)
+	}
+
+	return false, nil
+}
+
+// FinishLargeUpload assembles the staged chunks of a multi-chunk upload into a
+// single file, verifying each chunk against its recorded checksum along the
+// way. Chunks are copied through the YeetFile server, since SFTP doesn't have a
+// way to concatenate files on the remote server.
+func (sftpBackend *SFTP) FinishLargeUpload(remoteID, _ string, checksums []string) (string, int64, error) {
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return "", 0, err
+	}
+
+	objectPath, err := sftpBackend.objectPath(remoteID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	partialDir := sftpBackend.partialPath(remoteID)
+
+	var length int64
+	err = sftpBackend.writeAtomic(objectPath, func(f *sftp.File) error {
+		for i, checksum := range checksums {
+			partPath := path.Join(partialDir, strconv.Itoa(i+1))
+			part, err := client.Open(partPath)
+			if err != nil {
+				return err
+			}
+
+			n, err := copyPart(f, part, partPath, checksum)
+			_ = part.Close()
+			if err != nil {
+				return err
+			}
+
+			length += n
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Failed to finalize large file", "error", err)
+		return "", 0, err
+	}
+
+	if err = client.RemoveAll(partialDir); err != nil {
+		slog.Error("Error removing staged chunks", "remote_id", remoteID, "error", err)
+	}
+
+	return remoteID, length, nil
+}
+
+func (sftpBackend *SFTP) CancelLargeFile(remoteID, _ string) (bool, error) {
+	if validateRemoteID(remoteID) != nil {
+		return false, nil
+	}
+
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return false, err
+	}
+
+	partialDir := sftpBackend.partialPath(remoteID)
+	if _, err = client.Stat(partialDir); err != nil {
+		// Not an in-progress large file
+		return false, nil
+	}
+
+	if err = client.RemoveAll(partialDir); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (sftpBackend *SFTP) DeleteFile(remoteID, _ string) (bool, error) {
+	if len(remoteID) == 0 {
+		return false, nil
+	}
+
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return false, err
+	}
+
+	objectPath, err := sftpBackend.objectPath(remoteID)
+	if err != nil {
+		return false, err
+	}
+
+	if err = client.Remove(objectPath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PartialDownloadById returns a reader for a range of bytes in a stored file.
+// Only the requested range is read from the SFTP server.
+func (sftpBackend *SFTP) PartialDownloadById(remoteID, _ string, start, end int64) (io.ReadCloser, error) {
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	objectPath, err := sftpBackend.objectPath(remoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := client.Open(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	if end >= info.Size() {
+		end = info.Size() - 1
+	}
+
+	if start < 0 || start > end {
+		_ = file.Close()
+		return nil, fmt.Errorf("invalid range %d-%d for %s", start, end, remoteID)
+	}
+
+	return &fileSection{
+		SectionReader: io.NewSectionReader(file, start, end-start+1),
+		file:          file,
+	}, nil
+}
+
+// List walks the storage directory on the SFTP server, returning each stored
+// file along with any large uploads that still have chunks in the staging
+// directory
+func (sftpBackend *SFTP) List(fn func(object StoredObject) error) error {
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return err
+	}
+
+	partialRoot := path.Join(sftpBackend.root, partialUploadDir)
+	walker := client.Walk(sftpBackend.root)
+	for walker.Step() {
+		if err = walker.Err(); err != nil {
+			return err
+		}
+
+		info := walker.Stat()
+		if walker.Path() == partialRoot {
+			walker.SkipDir()
+			if err = sftpBackend.listPartial(client, partialRoot, fn); err != nil {
+				return err
+			}
+
+			continue
+		} else if info.IsDir() || strings.HasPrefix(info.Name(), tmpFilePrefix) {
+			continue
+		}
+
+		err = fn(StoredObject{
+			RemoteID: info.Name(),
+			Name:     info.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			store:    sftpBackend,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listPartial returns each in-progress large upload in the staging directory
+func (sftpBackend *SFTP) listPartial(
+	client *sftp.Client,
+	partialRoot string,
+	fn func(object StoredObject) error,
+) error {
+	entries, err := client.ReadDir(partialRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		var size int64
+		parts, _ := client.ReadDir(path.Join(partialRoot, entry.Name()))
+		for _, part := range parts {
+			size += part.Size()
+		}
+
+		err = fn(StoredObject{
+			RemoteID:   entry.Name(),
+			Name:       entry.Name(),
+			Size:       size,
+			Modified:   entry.ModTime(),
+			Unfinished: true,
+			store:      sftpBackend,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePart stages a single chunk of a large upload
+func (sftpBackend *SFTP) writePart(uploadID string, chunkNum int, data []byte) error {
+	if err := validateRemoteID(uploadID); err != nil {
+		return err
+	}
+
+	partPath := path.Join(sftpBackend.partialPath(uploadID), strconv.Itoa(chunkNum))
+	return sftpBackend.writeAtomic(partPath, func(f *sftp.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+// writeAtomic creates a temp file alongside the provided path, passes it to
+// writeFn, and then renames the temp file into place once writeFn has finished
+// without error.
+func (sftpBackend *SFTP) writeAtomic(filePath string, writeFn func(f *sftp.File) error) error {
+	client, err := sftpBackend.sftpClient()
+	if err != nil {
+		return err
+	}
+
+	dir := path.Dir(filePath)
+	if err = client.MkdirAll(dir); err != nil {
+		return err
+	}
+
+	tmpName := path.Join(dir, tmpFilePrefix+shared.GenRandomString(16))
+	tmp, err := client.OpenFile(tmpName, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// No-op if the rename was successful
+		_ = client.Remove(tmpName)
+	}()
+
+	if err = writeFn(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return client.PosixRename(tmpName, filePath)
+}
+
+// objectPath returns the sharded path for a file with the provided remote ID
+func (sftpBackend *SFTP) objectPath(remoteID string) (string, error) {
+	if err := validateRemoteID(remoteID); err != nil {
+		return "", err
+	}
+
+	shard := fmt.Sprintf("%x", sha1.Sum([]byte(remoteID)))
+	return path.Join(sftpBackend.root, shard[0:2], shard[2:4], remoteID), nil
+}
+
+func (sftpBackend *SFTP) partialPath(remoteID string) string {
+	return path.Join(sftpBackend.root, partialUploadDir, remoteID)
+}
+
+// sftpClient returns the current SFTP client, reconnecting to the server if the
+// previous connection was closed
+func (sftpBackend *SFTP) sftpClient() (*sftp.Client, error) {
+	sftpBackend.mu.Lock()
+	defer sftpBackend.mu.Unlock()
+
+	if sftpBackend.client == nil {
+		if err := sftpBackend.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	return sftpBackend.client, nil
+}
+
+// connect opens a new connection to the SFTP server and ensures that the
+// storage directory exists. Must be called with sftpBackend.mu held.
+func (sftpBackend *SFTP) connect() error {
+	conn, err := ssh.Dial("tcp", sftpBackend.addr, sftpBackend.config)
+	if err != nil {
+		return err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	err = client.MkdirAll(path.Join(sftpBackend.root, partialUploadDir))
+	if err != nil {
+		_ = client.Close()
+		_ = conn.Close()
+		return err
+	}
+
+	sftpBackend.conn = conn
+	sftpBackend.client = client
+
+	// Clear the client if the connection drops, so that the next operation
+	// reconnects to the server
+	go func() {
+		_ = conn.Wait()
+
+		sftpBackend.mu.Lock()
+		defer sftpBackend.mu.Unlock()
+		if sftpBackend.conn == conn {
+			sftpBackend.conn = nil
+			sftpBackend.client = nil
+		}
+	}()
+
+	return nil
+}
+
+// disconnect closes the current connection to the SFTP server (if any). Must be
+// called with sftpBackend.mu held.
+func (sftpBackend *SFTP) disconnect() {
+	if sftpBackend.client != nil {
+		_ = sftpBackend.client.Close()
+	}
+
+	if sftpBackend.conn != nil {
+		_ = sftpBackend.conn.Close()
+	}
+
+	sftpBackend.conn = nil
+	sftpBackend.client = nil
+}
+
+// newSFTP creates an SFTP storage backend for the server at addr, storing files
+// in the root directory
+func newSFTP(
+	addr,
+	user,
+	root string,
+	auth []ssh.AuthMethod,
+	hostKeyCallback ssh.HostKeyCallback,
+) *SFTP {
+	return &SFTP{
+		addr: addr,
+		root: root,
+		config: &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         sftpConnectTimeout,
+		},
+	}
+}
+
+// initSFTP sets up an SFTP storage backend using either password or private
+// key authentication. The server's public host key is required in order to
+// verify the server.
+func initSFTP() storage {
+	var (
+		host     = utils.GetEnvVar("YEETFILE_SFTP_HOST", "")
+		port     = utils.GetEnvVar("YEETFILE_SFTP_PORT", defaultSFTPPort)
+		user     = utils.GetEnvVar("YEETFILE_SFTP_USER", "")
+		password = utils.GetEnvVar("YEETFILE_SFTP_PASSWORD", "")
+		keyPath  = utils.GetEnvVar("YEETFILE_SFTP_KEY_PATH", "")
+		hostKey  = utils.GetEnvVar("YEETFILE_SFTP_HOST_KEY", "")
+		root     = utils.GetEnvVar("YEETFILE_SFTP_PATH", defaultSFTPPath)
+	)
+
+	if utils.IsAnyStringMissing(host, user, hostKey) {
+		log.Fatalf("Missing a required SFTP environment variable. Must set:\n" +
+			"- YEETFILE_SFTP_HOST\n" +
+			"- YEETFILE_SFTP_USER\n" +
+			"- YEETFILE_SFTP_HOST_KEY\n")
+	} else if len(password) == 0 && len(keyPath) == 0 {
+		log.Fatalf("Either YEETFILE_SFTP_PASSWORD or YEETFILE_SFTP_KEY_PATH " +
+			"must be set for SFTP storage")
+	}
+
+	serverKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		log.Fatalf("Invalid YEETFILE_SFTP_HOST_KEY: %v\n", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if len(keyPath) > 0 {
+		signer, err := loadSFTPKey(keyPath)
+		if err != nil {
+			log.Fatalf("Unable to load SFTP private key: %v\n", err)
+		}
+
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if len(password) > 0 {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	slog.Info("Setting up SFTP storage...")
+	sftpBackend := newSFTP(
+		net.JoinHostPort(host, port),
+		user,
+		root,
+		auth,
+		ssh.FixedHostKey(serverKey))
+
+	err = sftpBackend.Authorize()
+	if err != nil {
+		slog.Error("Unable to connect to SFTP server")
+		log.Fatal(err)
+	}
+
+	return sftpBackend
+}
+
+func loadSFTPKey(keyPath string) (ssh.Signer, error) {
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missingPassphrase *ssh.PassphraseMissingError
+	if errors.As(err, &missingPassphrase) {
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+
+	return signer, err
+}
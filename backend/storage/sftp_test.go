@@ -0,0 +1,307 @@
+//go:build server_test
+
+// The storage package connects to the YeetFile database on init, so these tests
+// are only run alongside the other server tests.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"testing"
+	"time"
+	"yeetfile/backend/utils"
+)
+
+const (
+	testSFTPUser     = "yeetfile"
+	testSFTPPassword = "password"
+)
+
+// startSFTPServer runs an in-process SSH server that serves the local
+// filesystem over SFTP, returning a backend connected to it that stores files
+// in a temporary directory
+func startSFTPServer(t *testing.T) *SFTP {
+	_, hostPrivKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating host key: %v\n", err)
+	}
+
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivKey)
+	if err != nil {
+		t.Fatalf("Error creating host key signer: %v\n", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testSFTPUser && string(password) == testSFTPPassword {
+				return nil, nil
+			}
+
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting SSH listener: %v\n", err)
+	}
+
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSFTP(conn, serverConfig)
+		}
+	}()
+
+	backend := newSFTP(
+		listener.Addr().String(),
+		testSFTPUser,
+		t.TempDir(),
+		[]ssh.AuthMethod{ssh.Password(testSFTPPassword)},
+		ssh.FixedHostKey(hostSigner.PublicKey()))
+
+	if err = backend.Authorize(); err != nil {
+		t.Fatalf("Error connecting to SFTP server: %v\n", err)
+	}
+
+	t.Cleanup(func() {
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		backend.disconnect()
+	})
+
+	return backend
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range channelRequests {
+				// Payload is a length-prefixed subsystem name
+				isSFTP := req.Type == "subsystem" &&
+					len(req.Payload) > 4 &&
+					string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(isSFTP, nil)
+			}
+		}()
+
+		go func() {
+			defer channel.Close()
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+
+			_ = server.Serve()
+		}()
+	}
+}
+
+// stageTestParts writes random chunks to the staging directory for an upload,
+// returning the combined chunk data and the checksum for each chunk
+func stageTestParts(t *testing.T, backend *SFTP, uploadID string, sizes ...int) ([]byte, []string) {
+	var data []byte
+	var checksums []string
+	for i, size := range sizes {
+		part := make([]byte, size)
+		_, _ = rand.Read(part)
+
+		err := backend.writePart(uploadID, i+1, part)
+		if err != nil {
+			t.Fatalf("Error writing part %d: %v\n", i+1, err)
+		}
+
+		_, checksum := utils.GenChecksum(part)
+		checksums = append(checksums, checksum)
+		data = append(data, part...)
+	}
+
+	return data, checksums
+}
+
+func TestSFTPFinishLargeUpload(t *testing.T) {
+	backend := startSFTPServer(t)
+	remoteID := "large-upload"
+
+	data, checksums := stageTestParts(t, backend, remoteID, 4096, 4096, 1000)
+	id, length, err := backend.FinishLargeUpload(remoteID, "", checksums)
+	if err != nil {
+		t.Fatalf("Error finishing large upload: %v\n", err)
+	} else if id != remoteID {
+		t.Fatalf("Expected remote ID '%s', got '%s'\n", remoteID, id)
+	} else if length != int64(len(data)) {
+		t.Fatalf("Expected length %d, got %d\n", len(data), length)
+	}
+
+	// Staged chunks should be removed once the upload is finished
+	canceled, err := backend.CancelLargeFile(remoteID, "")
+	if err != nil || canceled {
+		t.Fatalf("Staged chunks weren't removed (canceled: %v, err: %v)\n",
+			canceled, err)
+	}
+
+	ranges := [][2]int64{
+		{0, 4095},                    // First chunk
+		{4000, 5000},                 // Across chunk boundary
+		{8192, int64(len(data)) - 1}, // Last chunk
+		{int64(len(data)) - 10, int64(len(data)) + 100}, // Past end of file
+	}
+
+	for _, r := range ranges {
+		reader, err := backend.PartialDownloadById(remoteID, "", r[0], r[1])
+		if err != nil {
+			t.Fatalf("Error reading range %d-%d: %v\n", r[0], r[1], err)
+		}
+
+		read, err := io.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			t.Fatalf("Error reading range %d-%d: %v\n", r[0], r[1], err)
+		}
+
+		end := min(r[1], int64(len(data))-1)
+		if !bytes.Equal(read, data[r[0]:end+1]) {
+			t.Fatalf("Range %d-%d does not match uploaded data\n", r[0], r[1])
+		}
+	}
+
+	_, err = backend.PartialDownloadById(remoteID, "", int64(len(data))+1, int64(len(data))+10)
+	if err == nil {
+		t.Fatalf("Expected error reading beyond the end of the file\n")
+	}
+}
+
+func TestSFTPFinishLargeUploadChecksumMismatch(t *testing.T) {
+	backend := startSFTPServer(t)
+	remoteID := "corrupt-upload"
+
+	_, checksums := stageTestParts(t, backend, remoteID, 100, 100)
+	checksums[1] = fmt.Sprintf("%040d", 0)
+
+	_, _, err := backend.FinishLargeUpload(remoteID, "", checksums)
+	if err == nil {
+		t.Fatalf("Expected checksum mismatch error\n")
+	}
+
+	// The assembled file should never be written, and the staged chunks
+	// should still be available to cancel
+	if _, err = backend.PartialDownloadById(remoteID, "", 0, 10); err == nil {
+		t.Fatalf("Expected file to be missing after failed upload\n")
+	}
+
+	canceled, err := backend.CancelLargeFile(remoteID, "")
+	if err != nil || !canceled {
+		t.Fatalf("Unable to cancel upload (canceled: %v, err: %v)\n",
+			canceled, err)
+	}
+}
+
+func TestSFTPListAndDelete(t *testing.T) {
+	backend := startSFTPServer(t)
+
+	_, checksums := stageTestParts(t, backend, "finished", 10, 20)
+	_, _, err := backend.FinishLargeUpload("finished", "", checksums)
+	if err != nil {
+		t.Fatalf("Error finishing large upload: %v\n", err)
+	}
+
+	stageTestParts(t, backend, "unfinished", 30)
+
+	objects := make(map[string]StoredObject)
+	err = backend.List(func(object StoredObject) error {
+		objects[object.RemoteID] = object
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error listing objects: %v\n", err)
+	}
+
+	if len(objects) != 2 {
+		t.Fatalf("Expected 2 objects, got %d: %v\n", len(objects), objects)
+	} else if obj := objects["finished"]; obj.Unfinished || obj.Size != 30 {
+		t.Fatalf("Unexpected finished object: %+v\n", obj)
+	} else if obj = objects["unfinished"]; !obj.Unfinished || obj.Size != 30 {
+		t.Fatalf("Unexpected unfinished object: %+v\n", obj)
+	}
+
+	for _, object := range objects {
+		if err = removeObject(object); err != nil {
+			t.Fatalf("Error removing %s: %v\n", object.RemoteID, err)
+		}
+	}
+
+	err = backend.List(func(object StoredObject) error {
+		return fmt.Errorf("unexpected object after removal: %+v", object)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSFTPReconnect(t *testing.T) {
+	backend := startSFTPServer(t)
+	stageTestParts(t, backend, "reconnect", 10)
+
+	// Drop the connection without going through Reauthorize
+	backend.mu.Lock()
+	conn := backend.conn
+	backend.mu.Unlock()
+	_ = conn.Close()
+
+	// Wait for the dropped connection to be cleared
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		backend.mu.Lock()
+		cleared := backend.client == nil
+		backend.mu.Unlock()
+		if cleared {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := backend.writePart("reconnect", 2, []byte("data"))
+	if err != nil {
+		t.Fatalf("Unable to write after reconnecting: %v\n", err)
+	}
+
+	backend.Reauthorize()
+	canceled, err := backend.CancelLargeFile("reconnect", "")
+	if err != nil || !canceled {
+		t.Fatalf("Unable to cancel upload (canceled: %v, err: %v)\n",
+			canceled, err)
+	}
+}
@@ -2,7 +2,12 @@ package storage
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"sync"
+	"time"
 	"yeetfile/backend/cache"
 	"yeetfile/backend/config"
 	"yeetfile/backend/db"
@@ -12,10 +17,19 @@ const MaxUploadAttempts = 5
 
 var Interface storage
 var ExceededMaximumAttemptsError = errors.New("exceeded maximum attempts")
+var ObjectNotRemovedError = errors.New("object was not removed")
+
+// authorization holds the result of the most recent attempt to (re)authorize
+// with the storage backend. Backends are authorized before the server starts,
+// so the status is only updated afterward by the reauthorization task.
+var authorization struct {
+	mu  sync.RWMutex
+	err error
+}
 
 type storage interface {
 	Authorize() error
-	Reauthorize()
+	Reauthorize() error
 	InitUpload(metadataID string) error
 	InitLargeUpload(filename, metadataID string) error
 	UploadSingleChunk(chunk FileChunk, upload db.Upload) error
@@ -23,7 +37,21 @@ type storage interface {
 	CancelLargeFile(remoteID, filename string) (bool, error)
 	DeleteFile(remoteID, filename string) (bool, error)
 	FinishLargeUpload(remoteID, filename string, checksums []string) (string, int64, error)
-	PartialDownloadById(remoteID, filename string, start, end int64) ([]byte, error)
+	PartialDownloadById(remoteID, filename string, start, end int64) (io.ReadCloser, error)
+	List(fn func(object StoredObject) error) error
+}
+
+// StoredObject is a single object returned when listing the contents of a
+// storage backend
+type StoredObject struct {
+	RemoteID   string
+	Name       string
+	Size       int64
+	Modified   time.Time
+	Unfinished bool // An in-progress (or abandoned) large upload
+
+	// The backend that listed the object, used for removing it
+	store storage
 }
 
 type FileChunk struct {
@@ -36,46 +64,108 @@ type FileChunk struct {
 
 // DeleteFileByMetadata removes a file from B2 matching the provided file ID
 func DeleteFileByMetadata(metadata db.FileMetadata) {
-	log.Println("Deleting file by metadata (B2 errors are OK)")
+	slog.Info("Deleting file by metadata (B2 errors are OK)")
 	if err := cache.RemoveFile(metadata.ID); err != nil {
-		log.Printf("Error removing cached file: %v\n", metadata.ID)
+		slog.Error("Error removing cached file", "id", metadata.ID, "error", err)
 	} else {
-		log.Printf("%s deleted from cache\n", metadata.ID)
+		slog.Info("Deleted from cache", "id", metadata.ID)
 	}
 
 	if ok, err := Interface.CancelLargeFile(metadata.B2ID, metadata.Name); ok && err == nil {
-		log.Printf("%s (large B2 upload) canceled\n", metadata.ID)
+		slog.Info("Large upload canceled", "id", metadata.ID)
 		db.ClearDatabase(metadata.ID)
 	} else if ok, err = Interface.DeleteFile(metadata.B2ID, metadata.Name); ok && err == nil {
-		log.Printf("%s deleted from B2\n", metadata.ID)
+		slog.Info("Deleted from storage", "id", metadata.ID)
 		db.ClearDatabase(metadata.ID)
 	} else {
 		if len(metadata.B2ID) == 0 {
 			db.ClearDatabase(metadata.ID)
 		} else {
-			log.Printf("Failed to delete B2 file (id: %s, "+
-				"metadata id: %s)\n",
-				metadata.B2ID, metadata.ID)
+			slog.Error("Failed to delete file from storage",
+				"remote_id", metadata.B2ID, "id", metadata.ID)
 			db.ClearDatabase(metadata.ID)
 		}
 	}
 }
 
-func init() {
-	storageType := config.YeetFileConfig.StorageType
+// CheckAuthorization returns the error from the most recent attempt to
+// authorize with the storage backend, or nil if it was successful
+func CheckAuthorization() error {
+	authorization.mu.RLock()
+	defer authorization.mu.RUnlock()
+	return authorization.err
+}
+
+func setAuthorization(err error) {
+	authorization.mu.Lock()
+	defer authorization.mu.Unlock()
+	authorization.err = err
+}
+
+// readRange reads the bytes between start and end (inclusive) of a stored file
+// into memory, returning an error if the full range couldn't be read
+func readRange(backend storage, remoteID, filename string, start, end int64) ([]byte, error) {
+	reader, err := backend.PartialDownloadById(remoteID, filename, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	} else if int64(len(data)) != end-start+1 {
+		return nil, fmt.Errorf("read %d bytes, expected %d",
+			len(data), end-start+1)
+	}
+
+	return data, nil
+}
 
+// initStorage initializes the storage backend matching the provided type
+func initStorage(storageType string) storage {
 	switch storageType {
 	case config.LocalStorage:
-		Interface = initLocalStorage()
+		return initLocalStorage()
 	case config.B2Storage:
-		Interface = initB2()
+		return initB2()
 	case config.S3Storage:
-		Interface = initS3()
+		return initS3()
+	case config.SFTPStorage:
+		return initSFTP()
+	case config.MemStorage:
+		return initMemoryStorage()
 	default:
 		log.Fatalf("Invalid storage type '%s', "+
-			"should be either '%s', '%s', or '%s'",
+			"should be either '%s', '%s', '%s', '%s', or '%s'",
+			storageType,
+			config.B2Storage, config.S3Storage, config.SFTPStorage,
+			config.LocalStorage, config.MemStorage)
+	}
+
+	return nil
+}
+
+func init() {
+	Interface = initStorage(config.YeetFileConfig.StorageType)
+
+	if len(config.YeetFileConfig.MirrorStorage) > 0 {
+		Interface = initMirror(
+			config.YeetFileConfig.StorageType,
+			config.YeetFileConfig.MirrorStorage,
+			Interface)
+	}
+
+	if len(config.YeetFileConfig.MigrateStorageFrom) > 0 {
+		Interface = initMigration(
+			config.YeetFileConfig.MigrateStorageFrom,
 			config.YeetFileConfig.StorageType,
-			config.B2Storage, config.S3Storage, config.LocalStorage)
+			Interface)
+	}
 
+	Interface = &instrumented{
+		inner:       Interface,
+		storageType: config.YeetFileConfig.StorageType,
 	}
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
@@ -18,7 +19,6 @@ import (
 	"strings"
 	"time"
 	"yeetfile/shared/constants"
-	"yeetfile/shared/endpoints"
 )
 
 // GetEnvVar is the primary method for reading variables from the environment.
@@ -64,7 +64,7 @@ func GetEnvVarInt(key string, fallback int) int {
 
 	num, err := strconv.Atoi(value)
 	if err != nil {
-		log.Printf("WARNING: Value for %s is not a valid number, using fallback...\n", key)
+		slog.Warn("Value is not a valid number, using fallback", "key", key)
 		return fallback
 	}
 
@@ -135,8 +135,7 @@ func GenChecksum(data []byte) ([]byte, string) {
 }
 
 func LogStruct(v any) {
-	s, _ := json.MarshalIndent(v, "", "\t")
-	log.Println(string(s))
+	slog.Info("Struct contents", "type", fmt.Sprintf("%T", v), "value", v)
 }
 
 // DayDiff returns the number of days between two dates
@@ -212,7 +211,7 @@ func ParseSizeString(str string) int64 {
 		numStr := matches[1]
 		num, err := strconv.Atoi(numStr)
 		if err != nil {
-			log.Printf("Error converting number: %v\n", err)
+			slog.Error("Error converting number", "error", err)
 			return 0
 		}
 
@@ -232,7 +231,7 @@ func ParseSizeString(str string) int64 {
 			return i64num
 		}
 	} else {
-		log.Printf("No match found for size string: %s\n", str)
+		slog.Warn("No match found for size string", "value", str)
 	}
 
 	return 0
@@ -265,31 +264,21 @@ func limitedJSONReader(w http.ResponseWriter, body io.ReadCloser, limit int) *js
 	return json.NewDecoder(limitedBody)
 }
 
-func GetTrailingURLSegments(path string, strip ...endpoints.Endpoint) []string {
-	if strings.HasSuffix(path, "/") {
-		path = path[0 : len(path)-1]
-	}
-
-	for _, endpoint := range strip {
-		endpointBase := strings.ReplaceAll(string(endpoint), "/*", "")
-		path = strings.Replace(path, endpointBase, "", 1)
-		if strings.HasSuffix(path, string(endpoint)) {
-			// There is no trailing segment, it ends with the base endpoint
-			return []string{}
-		}
-	}
-
-	path = strings.TrimPrefix(path, "/")
-	return strings.Split(path, "/")
-}
-
+// GetReqSource returns the address a request was sent from, preferring the
+// X-Forwarded-For header if set. Requests over a Unix socket don't have a host
+// and port (the remote address is just "@"), so the remote address is returned
+// as-is for those.
 func GetReqSource(req *http.Request) (string, error) {
 	ip := req.Header.Get("X-Forwarded-For")
 
 	if len(ip) == 0 {
 		fallbackIP, _, err := net.SplitHostPort(req.RemoteAddr)
 		if err != nil {
-			return "", err
+			if len(req.RemoteAddr) == 0 {
+				return "", err
+			}
+
+			fallbackIP = req.RemoteAddr
 		}
 
 		ip = fallbackIP
@@ -0,0 +1,155 @@
+package webauthn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth limits how deeply arrays and maps can be nested, which is far
+// more than any attestation object or COSE key needs
+const maxCBORDepth = 16
+
+var InvalidCBORErr = errors.New("invalid CBOR")
+
+// decodeCBOR decodes a single CBOR item from the start of data, returning the
+// decoded value and the number of bytes read. Only the subset of CBOR used by
+// WebAuthn is supported: integers, byte and text strings, arrays, maps, and
+// simple values. Maps are decoded to map[any]any with int64 or string keys.
+func decodeCBOR(data []byte) (any, int, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return value, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: max depth exceeded", InvalidCBORErr)
+	}
+
+	major, arg, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", InvalidCBORErr)
+		}
+
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", InvalidCBORErr)
+		}
+
+		return -1 - int64(arg), nil
+	case 2, 3:
+		value, err := d.read(arg)
+		if err != nil {
+			return nil, err
+		} else if major == 3 {
+			return string(value), nil
+		}
+
+		return append([]byte{}, value...), nil
+	case 4:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: array too long", InvalidCBORErr)
+		}
+
+		array := make([]any, arg)
+		for i := range array {
+			if array[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return array, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: map too long", InvalidCBORErr)
+		}
+
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key", InvalidCBORErr)
+			}
+
+			if m[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return m, nil
+	case 7:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unsupported type %d", InvalidCBORErr, major)
+}
+
+// readHeader reads the major type and argument of the next item. Indefinite
+// length items aren't supported.
+func (d *cborDecoder) readHeader() (byte, uint64, error) {
+	header, err := d.read(1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	major := header[0] >> 5
+	info := header[0] & 0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		value, err := d.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+
+		var arg uint64
+		for _, b := range value {
+			arg = arg<<8 | uint64(b)
+		}
+
+		return major, arg, nil
+	}
+
+	return 0, 0, fmt.Errorf("%w: unsupported length encoding", InvalidCBORErr)
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("%w: unexpected end of data", InvalidCBORErr)
+	}
+
+	value := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return value, nil
+}
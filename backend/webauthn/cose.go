@@ -0,0 +1,129 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE key parameters and algorithms (see RFC 9053)
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1
+	coseX         = -2
+	coseY         = -3
+	coseRSAN      = -1
+	coseRSAE      = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// Supported COSE signature algorithms, in order of preference
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+var Algorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+var UnsupportedKeyErr = errors.New("unsupported public key")
+
+// parsePublicKey decodes a COSE encoded public key, returning an error if the
+// key type or algorithm isn't supported
+func parsePublicKey(coseKey []byte) (crypto.PublicKey, error) {
+	decoded, n, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	} else if n != len(coseKey) {
+		return nil, UnsupportedKeyErr
+	}
+
+	key, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, UnsupportedKeyErr
+	}
+
+	kty, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseAlgorithm)].(int64)
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		y, _ := key[int64(coseY)].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, UnsupportedKeyErr
+		}
+
+		// Ensure the point is valid before using it
+		point := append(append([]byte{4}, x...), y...)
+		if _, err = ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, UnsupportedKeyErr
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseCurve)].(int64)
+		x, _ := key[int64(coseX)].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, UnsupportedKeyErr
+		}
+
+		return ed25519.PublicKey(x), nil
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := key[int64(coseRSAN)].([]byte)
+		e, _ := key[int64(coseRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, UnsupportedKeyErr
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(exponent.Int64()),
+		}, nil
+	}
+
+	return nil, UnsupportedKeyErr
+}
+
+// verifySignature checks a signature over data using a COSE encoded public key
+func verifySignature(coseKey, data, signature []byte) error {
+	publicKey, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(data)
+	valid := false
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, hash[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	}
+
+	if !valid {
+		return InvalidSignatureErr
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+// Package webauthn verifies WebAuthn credential registrations and assertions,
+// which allows security keys and passkeys to be used as a second factor.
+//
+// Attestation statements aren't verified, since credentials are always
+// requested with "none" attestation. The authenticator data is still fully
+// validated.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	ChallengeLen = 32
+
+	createType = "webauthn.create"
+	getType    = "webauthn.get"
+
+	// Authenticator data flags
+	flagUserPresent  = 0x01
+	flagAttestedData = 0x40
+)
+
+var (
+	InvalidClientDataErr     = errors.New("invalid client data")
+	ChallengeMismatchErr     = errors.New("challenge mismatch")
+	OriginMismatchErr        = errors.New("origin mismatch")
+	RPIDMismatchErr          = errors.New("relying party ID mismatch")
+	UserNotPresentErr        = errors.New("user not present")
+	InvalidAuthDataErr       = errors.New("invalid authenticator data")
+	InvalidSignatureErr      = errors.New("invalid signature")
+	SignCountErr             = errors.New("sign count did not increase, authenticator may be cloned")
+	InvalidAttestationErr    = errors.New("invalid attestation object")
+	MissingCredentialDataErr = errors.New("missing attested credential data")
+)
+
+// RelyingParty is the server that credentials are registered with. The ID is
+// the domain of the server (without a scheme or port), and the origin is the
+// full origin that the web interface is loaded from.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// Credential is a registered WebAuthn credential
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded
+	SignCount uint32
+}
+
+// ClientData is the client data collected by the browser during registration
+// or assertion
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+type authData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+
+	// Only set when registering a credential
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a random challenge to include in registration or
+// assertion options
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeLen)
+	_, err := rand.Read(challenge)
+	return challenge, err
+}
+
+// EncodeChallenge returns the challenge as it appears in the client data
+func EncodeChallenge(challenge []byte) string {
+	return base64.RawURLEncoding.EncodeToString(challenge)
+}
+
+// ParseClientData decodes the client data JSON sent by the browser, which can be
+// used to look up the challenge before verifying the rest of the response
+func ParseClientData(clientDataJSON []byte) (ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return ClientData{}, fmt.Errorf("%w: %w", InvalidClientDataErr, err)
+	}
+
+	return clientData, nil
+}
+
+// VerifyRegistration verifies the response from registering a new credential,
+// returning the credential to store if successful
+func (rp RelyingParty) VerifyRegistration(
+	challenge []byte,
+	clientDataJSON []byte,
+	attestationObject []byte,
+) (Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, createType, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %w", InvalidAttestationErr, err)
+	}
+
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return Credential{}, InvalidAttestationErr
+	}
+
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, InvalidAttestationErr
+	}
+
+	data, err := rp.verifyAuthData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	} else if data.flags&flagAttestedData == 0 {
+		return Credential{}, MissingCredentialDataErr
+	}
+
+	if _, err = parsePublicKey(data.publicKey); err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        data.credentialID,
+		PublicKey: data.publicKey,
+		SignCount: data.signCount,
+	}, nil
+}
+
+// VerifyAssertion verifies an assertion made with a registered credential,
+// returning the updated sign count to store for the credential if successful
+func (rp RelyingParty) VerifyAssertion(
+	challenge []byte,
+	credential Credential,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, getType, challenge); err != nil {
+		return 0, err
+	}
+
+	data, err := rp.verifyAuthData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if err = verifySignature(credential.PublicKey, signed, signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators that don't support sign counts always return 0
+	if (data.signCount != 0 || credential.SignCount != 0) &&
+		data.signCount <= credential.SignCount {
+		return 0, SignCountErr
+	}
+
+	return data.signCount, nil
+}
+
+func (rp RelyingParty) verifyClientData(
+	clientDataJSON []byte,
+	expectedType string,
+	challenge []byte,
+) error {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	} else if clientData.Type != expectedType {
+		return fmt.Errorf("%w: unexpected type %q", InvalidClientDataErr, clientData.Type)
+	} else if clientData.Challenge != EncodeChallenge(challenge) {
+		return ChallengeMismatchErr
+	} else if clientData.Origin != rp.Origin || clientData.CrossOrigin {
+		return OriginMismatchErr
+	}
+
+	return nil
+}
+
+func (rp RelyingParty) verifyAuthData(rawAuthData []byte) (authData, error) {
+	data, err := parseAuthData(rawAuthData)
+	if err != nil {
+		return authData{}, err
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return authData{}, RPIDMismatchErr
+	} else if data.flags&flagUserPresent == 0 {
+		return authData{}, UserNotPresentErr
+	}
+
+	return data, nil
+}
+
+// parseAuthData parses the authenticator data returned by the authenticator:
+//
+//	rpIDHash (32) | flags (1) | signCount (4) | [attested credential data]
+//
+// where the attested credential data is:
+//
+//	aaguid (16) | credentialIDLen (2) | credentialID | COSE public key
+func parseAuthData(rawAuthData []byte) (authData, error) {
+	if len(rawAuthData) < 37 {
+		return authData{}, InvalidAuthDataErr
+	}
+
+	data := authData{
+		rpIDHash:  rawAuthData[:32],
+		flags:     rawAuthData[32],
+		signCount: binary.BigEndian.Uint32(rawAuthData[33:37]),
+	}
+
+	if data.flags&flagAttestedData == 0 {
+		return data, nil
+	}
+
+	rest := rawAuthData[37:]
+	if len(rest) < 18 {
+		return authData{}, InvalidAuthDataErr
+	}
+
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return authData{}, InvalidAuthDataErr
+	}
+
+	data.credentialID = append([]byte{}, rest[:idLen]...)
+	rest = rest[idLen:]
+
+	_, keyLen, err := decodeCBOR(rest)
+	if err != nil {
+		return authData{}, fmt.Errorf("%w: %w", InvalidAuthDataErr, err)
+	}
+
+	data.publicKey = append([]byte{}, rest[:keyLen]...)
+	return data, nil
+}
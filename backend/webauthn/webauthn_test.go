@@ -0,0 +1,127 @@
+package webauthn
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"yeetfile/backend/webauthn/webauthntest"
+)
+
+var testRP = RelyingParty{
+	ID:     "localhost",
+	Name:   "YeetFile",
+	Origin: "http://localhost:8090",
+}
+
+func register(t *testing.T, authenticator *webauthntest.Authenticator) Credential {
+	challenge, err := NewChallenge()
+	assert.Nil(t, err)
+
+	clientDataJSON, attestationObject := authenticator.Register(challenge)
+	credential, err := testRP.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return credential
+}
+
+func TestRegistration(t *testing.T) {
+	authenticator, err := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	assert.Nil(t, err)
+
+	credential := register(t, authenticator)
+	assert.Equal(t, authenticator.CredentialID(), credential.ID)
+	assert.Equal(t, uint32(0), credential.SignCount)
+
+	challenge, _ := NewChallenge()
+	clientDataJSON, attestationObject := authenticator.Register(challenge)
+
+	// The challenge must match the one sent to the client
+	otherChallenge, _ := NewChallenge()
+	_, err = testRP.VerifyRegistration(otherChallenge, clientDataJSON, attestationObject)
+	assert.ErrorIs(t, err, ChallengeMismatchErr)
+
+	// Credentials registered for another site are rejected
+	otherRP := testRP
+	otherRP.ID = "example.com"
+	_, err = otherRP.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	assert.ErrorIs(t, err, RPIDMismatchErr)
+
+	otherRP = testRP
+	otherRP.Origin = "https://example.com"
+	_, err = otherRP.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	assert.ErrorIs(t, err, OriginMismatchErr)
+
+	_, err = testRP.VerifyRegistration(challenge, clientDataJSON, attestationObject[:20])
+	assert.ErrorIs(t, err, InvalidAttestationErr)
+}
+
+func TestAssertion(t *testing.T) {
+	authenticator, err := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	assert.Nil(t, err)
+
+	credential := register(t, authenticator)
+
+	challenge, _ := NewChallenge()
+	clientDataJSON, authData, signature := authenticator.Assert(challenge)
+	signCount, err := testRP.VerifyAssertion(
+		challenge, credential, clientDataJSON, authData, signature)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), signCount)
+	credential.SignCount = signCount
+
+	// Registration responses can't be used as assertions
+	registerData, attestationObject := authenticator.Register(challenge)
+	_, err = testRP.VerifyAssertion(
+		challenge, credential, registerData, attestationObject, signature)
+	assert.ErrorIs(t, err, InvalidClientDataErr)
+
+	// Signatures from another key are rejected
+	other, _ := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	other.SignCount = 10
+	clientDataJSON, authData, signature = other.Assert(challenge)
+	_, err = testRP.VerifyAssertion(
+		challenge, credential, clientDataJSON, authData, signature)
+	assert.ErrorIs(t, err, InvalidSignatureErr)
+
+	// Replaying an old sign count indicates a cloned authenticator
+	authenticator.SignCount = 0
+	clientDataJSON, authData, signature = authenticator.Assert(challenge)
+	_, err = testRP.VerifyAssertion(
+		challenge, credential, clientDataJSON, authData, signature)
+	assert.ErrorIs(t, err, SignCountErr)
+}
+
+func TestAssertionWithoutSignCount(t *testing.T) {
+	authenticator, err := webauthntest.NewAuthenticator(testRP.ID, testRP.Origin)
+	assert.Nil(t, err)
+	authenticator.FixedSignCount = true
+
+	credential := register(t, authenticator)
+	for i := 0; i < 2; i++ {
+		challenge, _ := NewChallenge()
+		clientDataJSON, authData, signature := authenticator.Assert(challenge)
+		signCount, err := testRP.VerifyAssertion(
+			challenge, credential, clientDataJSON, authData, signature)
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(0), signCount)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// {1: -7, "a": [h'0102', true, null]}
+	data := []byte{0xa2, 0x01, 0x26, 0x61, 'a', 0x83, 0x42, 0x01, 0x02, 0xf5, 0xf6, 0xff}
+	value, n, err := decodeCBOR(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data)-1, n)
+	assert.Equal(t, map[any]any{
+		int64(1): int64(-7),
+		"a":      []any{[]byte{1, 2}, true, nil},
+	}, value)
+
+	// Lengths longer than the remaining data are rejected
+	_, _, err = decodeCBOR([]byte{0x5a, 0xff, 0xff, 0xff, 0xff})
+	assert.ErrorIs(t, err, InvalidCBORErr)
+	_, _, err = decodeCBOR([]byte{0x9a, 0xff, 0xff, 0xff, 0xff})
+	assert.ErrorIs(t, err, InvalidCBORErr)
+}
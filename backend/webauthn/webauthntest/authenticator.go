@@ -0,0 +1,182 @@
+// Package webauthntest provides a software authenticator for testing WebAuthn
+// registration and assertion without a browser or security key.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+)
+
+// Authenticator is a software authenticator holding a single P-256 (ES256)
+// credential
+type Authenticator struct {
+	RPID   string
+	Origin string
+
+	// SignCount is incremented on every assertion. Set it to 0 (and leave
+	// FixedSignCount set) to mimic authenticators without a sign counter.
+	SignCount      uint32
+	FixedSignCount bool
+
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+}
+
+func NewAuthenticator(rpID, origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err = rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		key:          key,
+		credentialID: credentialID,
+	}, nil
+}
+
+// CredentialID returns the ID of the authenticator's credential
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// Register creates a registration response for the challenge, returning the
+// client data JSON and the attestation object (using "none" attestation)
+func (a *Authenticator) Register(challenge []byte) ([]byte, []byte) {
+	clientDataJSON := a.clientData("webauthn.create", challenge)
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	publicKey := encodeCBOR(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: x,
+		-3: y,
+	})
+
+	credentialData := make([]byte, 18)
+	binary.BigEndian.PutUint16(credentialData[16:], uint16(len(a.credentialID)))
+	credentialData = append(credentialData, a.credentialID...)
+	credentialData = append(credentialData, publicKey...)
+
+	authData := append(a.authData(0x01|0x40), credentialData...)
+	attestationObject := encodeCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+
+	return clientDataJSON, attestationObject
+}
+
+// Assert creates an assertion for the challenge, returning the client data
+// JSON, authenticator data, and signature
+func (a *Authenticator) Assert(challenge []byte) ([]byte, []byte, []byte) {
+	if !a.FixedSignCount {
+		a.SignCount++
+	}
+
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	authData := a.authData(0x01)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	hash := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, hash[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return clientDataJSON, authData, signature
+}
+
+func (a *Authenticator) clientData(clientDataType string, challenge []byte) []byte {
+	clientDataJSON, _ := json.Marshal(map[string]any{
+		"type":        clientDataType,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+
+	return clientDataJSON
+}
+
+func (a *Authenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.SignCount)
+	return data
+}
+
+// encodeCBOR encodes the subset of CBOR values used by the authenticator
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return cborHeader(1, uint64(-1-v))
+		}
+
+		return cborHeader(0, uint64(v))
+	case []byte:
+		return append(cborHeader(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHeader(3, uint64(len(v))), v...)
+	case map[int]any:
+		keys := make([]int, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Ints(keys)
+		encoded := cborHeader(5, uint64(len(v)))
+		for _, key := range keys {
+			encoded = append(encoded, encodeCBOR(key)...)
+			encoded = append(encoded, encodeCBOR(v[key])...)
+		}
+
+		return encoded
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		encoded := cborHeader(5, uint64(len(v)))
+		for _, key := range keys {
+			encoded = append(encoded, encodeCBOR(key)...)
+			encoded = append(encoded, encodeCBOR(v[key])...)
+		}
+
+		return encoded
+	}
+
+	panic("unsupported CBOR value")
+}
+
+func cborHeader(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+
+	return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+}
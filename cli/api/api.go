@@ -1,5 +1,7 @@
 package api
 
+import "yeetfile/client"
+
 type Context struct {
 	Server  string
 	Session string
@@ -11,3 +13,10 @@ func InitContext(server, session string) *Context {
 		Session: session,
 	}
 }
+
+// client returns an API client for the context's server and session
+func (ctx *Context) client() *client.Client {
+	c := client.New(ctx.Server)
+	c.SetSession(ctx.Session)
+	return c
+}
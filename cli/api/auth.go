@@ -1,224 +1,72 @@
 package api
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net/http"
-
-	"yeetfile/cli/requests"
-	"yeetfile/cli/utils"
+	"context"
+	"yeetfile/client"
 	"yeetfile/shared"
-	"yeetfile/shared/endpoints"
 )
 
-var ServerPasswordError = errors.New("signup is password restricted on this server")
-var TwoFactorError = errors.New("two factor code missing or incorrect")
+var ServerPasswordError = client.ErrServerPassword
+var TwoFactorError = client.ErrTwoFactor
 
 // GetAccountInfo fetches the current user's account info
 func (ctx *Context) GetAccountInfo() (shared.AccountResponse, error) {
-	url := endpoints.Account.Format(ctx.Server)
-	resp, err := requests.GetRequest(ctx.Session, url)
-	if err != nil {
-		return shared.AccountResponse{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.AccountResponse{}, utils.ParseHTTPError(resp)
-	}
-
-	var accountResponse shared.AccountResponse
-	err = json.NewDecoder(resp.Body).Decode(&accountResponse)
-	if err != nil {
-		return shared.AccountResponse{}, err
-	}
-
-	return accountResponse, nil
+	return ctx.client().GetAccountInfo(context.Background())
 }
 
 // GetAccountUsage fetches the current user's used/available storage and
 // used/available send.
 func (ctx *Context) GetAccountUsage() (shared.UsageResponse, error) {
-	url := endpoints.AccountUsage.Format(ctx.Server)
-	resp, err := requests.GetRequest(ctx.Session, url)
-	if err != nil {
-		return shared.UsageResponse{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.UsageResponse{}, utils.ParseHTTPError(resp)
-	}
-
-	var usageResponse shared.UsageResponse
-	err = json.NewDecoder(resp.Body).Decode(&usageResponse)
-	if err != nil {
-		return shared.UsageResponse{}, err
-	}
-
-	return usageResponse, nil
+	return ctx.client().GetAccountUsage(context.Background())
 }
 
 // Login logs a user into a YeetFile server, returning the server response,
 // the session cookie, and any errors.
 func (ctx *Context) Login(login shared.Login) (shared.LoginResponse, string, error) {
-	url := endpoints.Login.Format(ctx.Server)
-	reqData, err := json.Marshal(login)
+	c := ctx.client()
+	loginResponse, err := c.Login(context.Background(), login)
 	if err != nil {
 		return shared.LoginResponse{}, "", err
 	}
 
-	resp, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return shared.LoginResponse{}, "", err
-	} else if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusForbidden {
-			return shared.LoginResponse{}, "", TwoFactorError
-		}
-		return shared.LoginResponse{}, "", utils.ParseHTTPError(resp)
-	}
-
-	var loginResponse shared.LoginResponse
-	err = json.NewDecoder(resp.Body).Decode(&loginResponse)
-	if err != nil {
-		return shared.LoginResponse{}, "", err
-	}
-
-	var session string
-	cookies := resp.Cookies()
-	if len(cookies) > 0 {
-		ctx.Session = cookies[0].Value
-		session = cookies[0].Value
-	}
-
-	return loginResponse, session, nil
+	ctx.Session = c.Session()
+	return loginResponse, ctx.Session, nil
 }
 
 // VerifyAccount finalizes account for account-id-only accounts by verifying
 // the N-digit verification code and submitting their keys
 func (ctx *Context) VerifyAccount(account shared.VerifyAccount) error {
-	reqData, err := json.Marshal(account)
-	if err != nil {
-		return err
-	}
-
-	url := endpoints.VerifyAccount.Format(ctx.Server)
-	response, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	}
-
-	if response.StatusCode != http.StatusOK {
-		if response.StatusCode == http.StatusUnauthorized {
-			return errors.New("incorrect verification code")
-		}
-
-		return utils.ParseHTTPError(response)
-	}
-
-	return nil
+	return ctx.client().VerifyAccount(context.Background(), account)
 }
 
 // SubmitSignup initiates the signup process for an account-ID-only signup,
 // returning their new account ID and allowing the user to proceed with verifying
 // their new account.
 func (ctx *Context) SubmitSignup(signup shared.Signup) (shared.SignupResponse, error) {
-	reqData, err := json.Marshal(signup)
-	if err != nil {
-		return shared.SignupResponse{}, err
-	}
-
-	url := endpoints.Signup.Format(ctx.Server)
-	response, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return shared.SignupResponse{}, err
-	} else if response.StatusCode != http.StatusOK {
-		if response.StatusCode == http.StatusForbidden {
-			return shared.SignupResponse{}, ServerPasswordError
-		}
-		return shared.SignupResponse{}, utils.ParseHTTPError(response)
-	}
-
-	decoder := json.NewDecoder(response.Body)
-	var signupResponse shared.SignupResponse
-	err = decoder.Decode(&signupResponse)
-	if err != nil {
-		return shared.SignupResponse{}, err
-	} else if len(signupResponse.Error) > 0 {
-		return shared.SignupResponse{}, errors.New(signupResponse.Error)
-	}
-
-	return signupResponse, nil
+	return ctx.client().Signup(context.Background(), signup)
 }
 
 // VerifyEmail verifies a new user's email using their email and the code sent
 // to their email address
 func (ctx *Context) VerifyEmail(email, code string) error {
-	url := endpoints.VerifyEmail.Format(ctx.Server)
-	reqData, err := json.Marshal(shared.VerifyEmail{
-		Email: email,
-		Code:  code,
-	})
-
-	response, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	} else if response.StatusCode >= http.StatusBadRequest {
-		if response.StatusCode == http.StatusUnauthorized {
-			return errors.New("incorrect verification code")
-		}
-		return errors.New("server error")
-	}
-
-	return nil
+	return ctx.client().VerifyEmail(context.Background(), email, code)
 }
 
 // GetSession returns the current session info.
 func (ctx *Context) GetSession() (shared.SessionInfo, error) {
-	url := endpoints.Session.Format(ctx.Server)
-	resp, err := requests.GetRequest(ctx.Session, url)
-
-	if err != nil {
-		return shared.SessionInfo{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.SessionInfo{}, utils.ParseHTTPError(resp)
-	}
-
-	//var sessionInfo shared.SessionInfo
-	//err = json.NewDecoder(resp.Body).Decode(&sessionInfo)
-	//if err != nil {
-	//	return shared.SessionInfo{}, err
-	//}
-
-	return shared.SessionInfo{}, nil
+	err := ctx.client().CheckSession(context.Background())
+	return shared.SessionInfo{}, err
 }
 
 // LogOut invalidates the current session for the logged-in user
 func (ctx *Context) LogOut() error {
-	url := endpoints.Logout.Format(ctx.Server)
-	response, err := requests.GetRequest(ctx.Session, url)
-	if err != nil {
-		return err
-	} else if response.StatusCode >= http.StatusBadRequest {
-		return utils.ParseHTTPError(response)
-	}
-
-	return nil
+	return ctx.client().LogOut(context.Background())
 }
 
 // GetUserProtectedKey retrieves the user's private key, which has been
 // encrypted with their unique user key before upload.
 func (ctx *Context) GetUserProtectedKey() ([]byte, error) {
-	url := endpoints.ProtectedKey.Format(ctx.Server)
-	resp, err := requests.GetRequest(ctx.Session, url)
-	if err != nil {
-		return nil, err
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, utils.ParseHTTPError(resp)
-	}
-
-	var protectedKey shared.ProtectedKeyResponse
-	err = json.NewDecoder(resp.Body).Decode(&protectedKey)
-	if err != nil {
-		return nil, err
-	}
-
-	return protectedKey.ProtectedKey, err
+	return ctx.client().GetUserProtectedKey(context.Background())
 }
 
 // StartChangeEmail initiates the process for changing a user's email. If the
@@ -226,151 +74,48 @@ func (ctx *Context) GetUserProtectedKey() ([]byte, error) {
 // needed to confirm setting a new email. If they do have an email set, this
 // ID will be sent to their current email.
 func (ctx *Context) StartChangeEmail() (shared.StartEmailChangeResponse, error) {
-	url := endpoints.ChangeEmail.Format(ctx.Server, "")
-	resp, err := requests.PostRequest(ctx.Session, url, nil)
-	if err != nil {
-		return shared.StartEmailChangeResponse{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.StartEmailChangeResponse{}, utils.ParseHTTPError(resp)
-	}
-
-	var changeResponse shared.StartEmailChangeResponse
-	err = json.NewDecoder(resp.Body).Decode(&changeResponse)
-	if err != nil {
-		return shared.StartEmailChangeResponse{}, err
-	}
-
-	return changeResponse, nil
+	return ctx.client().StartChangeEmail(context.Background())
 }
 
 // ChangeEmail finalizes the change email process, sending a verification code
 // to the user's new email and temporarily storing their updated user details
 // in the db until the verification code is confirmed.
 func (ctx *Context) ChangeEmail(changeEmail shared.ChangeEmail, changeID string) error {
-	reqData, err := json.Marshal(changeEmail)
-	if err != nil {
-		return err
-	}
-
-	url := endpoints.ChangeEmail.Format(ctx.Server, changeID)
-	resp, err := requests.PutRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	} else if resp.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(resp)
-	}
-
-	return nil
+	return ctx.client().ChangeEmail(context.Background(), changeEmail, changeID)
 }
 
 // ChangePassword changes a user's password, updating their login key hash
 // and their encrypted private key.
 func (ctx *Context) ChangePassword(password shared.ChangePassword) error {
-	url := endpoints.ChangePassword.Format(ctx.Server)
-	reqData, err := json.Marshal(password)
-	if err != nil {
-		return err
-	}
-
-	resp, err := requests.PutRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	} else if resp.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(resp)
-	}
-
-	return nil
+	return ctx.client().ChangePassword(context.Background(), password)
 }
 
 // ChangePasswordHint accepts a plaintext password hint that will be encrypted
 // by the server and sent to the user's email if they forget their password
 func (ctx *Context) ChangePasswordHint(hint string) error {
-	change := shared.ChangePasswordHint{Hint: hint}
-	reqData, err := json.Marshal(change)
-	if err != nil {
-		return err
-	}
-
-	url := endpoints.ChangeHint.Format(ctx.Server)
-	resp, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	} else if resp.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(resp)
-	}
-
-	return nil
+	return ctx.client().ChangePasswordHint(context.Background(), hint)
 }
 
 // DeleteAccount removes the current user's YeetFile account.
 func (ctx *Context) DeleteAccount(id string) error {
-	url := endpoints.Account.Format(ctx.Server)
-	reqData, err := json.Marshal(shared.DeleteAccount{Identifier: id})
-	if err != nil {
-		return err
-	}
-
-	response, err := requests.DeleteRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	} else if response.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(response)
-	}
-
-	return nil
+	return ctx.client().DeleteAccount(context.Background(), id)
 }
 
 // ForgotPassword sends a request for the user's password to be sent to the
 // provided email (must have an account and have a hint set first).
 func (ctx *Context) ForgotPassword(email string) error {
-	url := endpoints.Forgot.Format(ctx.Server)
-	reqData, err := json.Marshal(shared.ForgotPassword{Email: email})
-	if err != nil {
-		return err
-	}
-
-	response, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return err
-	} else if response.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(response)
-	}
-
-	return nil
+	return ctx.client().ForgotPassword(context.Background(), email)
 }
 
 // Generate2FA requests a TOTP secret from the server. This only succeeds if the
 // user doesn't already have 2FA enabled.
 func (ctx *Context) Generate2FA() (shared.NewTOTP, error) {
-	url := endpoints.TwoFactor.Format(ctx.Server)
-	resp, err := requests.GetRequest(ctx.Session, url)
-	if err != nil {
-		return shared.NewTOTP{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.NewTOTP{}, utils.ParseHTTPError(resp)
-	}
-
-	var newTOTP shared.NewTOTP
-	err = json.NewDecoder(resp.Body).Decode(&newTOTP)
-	if err != nil {
-		return shared.NewTOTP{}, err
-	}
-
-	return newTOTP, nil
+	return ctx.client().Generate2FA(context.Background())
 }
 
 // Disable2FA disables two-factor authentication for a user's account
 func (ctx *Context) Disable2FA(code string) error {
-	endpoint := endpoints.TwoFactor.Format(ctx.Server)
-	url := fmt.Sprintf("%s?code=%s", endpoint, code)
-	resp, err := requests.DeleteRequest(ctx.Session, url, nil)
-	if err != nil {
-		return err
-	} else if resp.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(resp)
-	}
-
-	return nil
+	return ctx.client().Disable2FA(context.Background(), code)
 }
 
 // Finalize2FA submits the secret returned by Generate2FA as well as a 6-digit
@@ -378,37 +123,38 @@ func (ctx *Context) Disable2FA(code string) error {
 // account. In response, they receive a number of one-time recovery codes that
 // they can use in the event that they lose their authentication app.
 func (ctx *Context) Finalize2FA(totp shared.SetTOTP) (shared.SetTOTPResponse, error) {
-	url := endpoints.TwoFactor.Format(ctx.Server)
-	reqData, err := json.Marshal(totp)
-	if err != nil {
-		return shared.SetTOTPResponse{}, err
-	}
+	return ctx.client().Finalize2FA(context.Background(), totp)
+}
 
-	resp, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return shared.SetTOTPResponse{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.SetTOTPResponse{}, utils.ParseHTTPError(resp)
-	}
+// RecyclePaymentID frees the user's current payment ID and grants them a new one.
+func (ctx *Context) RecyclePaymentID() error {
+	return ctx.client().RecyclePaymentID(context.Background())
+}
 
-	var setTOTP shared.SetTOTPResponse
-	err = json.NewDecoder(resp.Body).Decode(&setTOTP)
-	if err != nil {
-		return shared.SetTOTPResponse{}, err
-	}
+// GetActiveSessions fetches the user's logged in sessions
+func (ctx *Context) GetActiveSessions() ([]shared.ActiveSession, error) {
+	return ctx.client().GetActiveSessions(context.Background())
+}
 
-	return setTOTP, nil
+// RevokeSession logs the user out of one of their sessions
+func (ctx *Context) RevokeSession(id string) error {
+	return ctx.client().RevokeSession(context.Background(), id)
 }
 
-// RecyclePaymentID frees the user's current payment ID and grants them a new one.
-func (ctx *Context) RecyclePaymentID() error {
-	url := endpoints.RecyclePaymentID.Format(ctx.Server)
-	resp, err := requests.PutRequest(ctx.Session, url, nil)
-	if err != nil {
-		return err
-	} else if resp.StatusCode != http.StatusOK {
-		return utils.ParseHTTPError(resp)
-	}
+// GetAPITokens fetches info about the user's personal API tokens
+func (ctx *Context) GetAPITokens() ([]shared.APIToken, error) {
+	return ctx.client().GetAPITokens(context.Background())
+}
+
+// CreateAPIToken creates a new personal API token for the user, returning the
+// token value (which is only shown once) and its info.
+func (ctx *Context) CreateAPIToken(
+	newToken shared.NewAPIToken,
+) (shared.NewAPITokenResponse, error) {
+	return ctx.client().CreateAPIToken(context.Background(), newToken)
+}
 
-	return nil
+// RevokeAPIToken revokes one of the user's personal API tokens
+func (ctx *Context) RevokeAPIToken(id string) error {
+	return ctx.client().RevokeAPIToken(context.Background(), id)
 }
@@ -1,14 +1,11 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
-	"yeetfile/cli/requests"
-	"yeetfile/cli/utils"
+	"yeetfile/client"
 	"yeetfile/shared"
-	"yeetfile/shared/endpoints"
 )
 
 // FetchUserPubKey fetches a YeetFile user's public key, which is used to
@@ -16,23 +13,7 @@ import (
 func (ctx *Context) FetchUserPubKey(
 	userIdentifier string,
 ) (shared.PubKeyResponse, error) {
-	url := endpoints.PubKey.Format(ctx.Server)
-	url = url + fmt.Sprintf("?user=%s", userIdentifier)
-
-	resp, err := requests.GetRequest(ctx.Session, url)
-	if err != nil {
-		return shared.PubKeyResponse{}, err
-	} else if resp.StatusCode != http.StatusOK {
-		return shared.PubKeyResponse{}, utils.ParseHTTPError(resp)
-	}
-
-	var pubKeyResponse shared.PubKeyResponse
-	err = json.NewDecoder(resp.Body).Decode(&pubKeyResponse)
-	if err != nil {
-		return shared.PubKeyResponse{}, err
-	}
-
-	return pubKeyResponse, nil
+	return ctx.client().GetUserPubKey(context.Background(), userIdentifier)
 }
 
 // ShareFileWithUser shares a new file with a user. This file will appear in the
@@ -41,8 +22,7 @@ func (ctx *Context) ShareFileWithUser(
 	request shared.ShareItemRequest,
 	fileID string,
 ) (shared.ShareInfo, error) {
-	url := endpoints.ShareFile.Format(ctx.Server, fileID)
-	return shareContentWithUser(ctx.Session, url, request)
+	return ctx.client().ShareItem(context.Background(), client.ShareFile, fileID, request)
 }
 
 // ShareFolderWithUser shares a new folder with a user. This folder will appear
@@ -51,22 +31,19 @@ func (ctx *Context) ShareFolderWithUser(
 	request shared.ShareItemRequest,
 	folderID string,
 ) (shared.ShareInfo, error) {
-	url := endpoints.ShareFolder.Format(ctx.Server, folderID)
-	return shareContentWithUser(ctx.Session, url, request)
+	return ctx.client().ShareItem(context.Background(), client.ShareFolder, folderID, request)
 }
 
 // GetSharedFileInfo retrieves a list of shares that are active with the
 // specified file
 func (ctx *Context) GetSharedFileInfo(id string) ([]shared.ShareInfo, error) {
-	url := endpoints.ShareFile.Format(ctx.Server, id)
-	return getSharedInfo(ctx.Session, url)
+	return ctx.client().GetShares(context.Background(), client.ShareFile, id)
 }
 
 // GetSharedFolderInfo retrieves a list of shares that are active with the
 // specified folder
 func (ctx *Context) GetSharedFolderInfo(id string) ([]shared.ShareInfo, error) {
-	url := endpoints.ShareFolder.Format(ctx.Server, id)
-	return getSharedInfo(ctx.Session, url)
+	return ctx.client().GetShares(context.Background(), client.ShareFolder, id)
 }
 
 // RemoveSharedFileUsers takes a list of shared users to remove access to a file,
@@ -75,8 +52,7 @@ func (ctx *Context) RemoveSharedFileUsers(
 	fileID string,
 	remove []shared.ShareInfo,
 ) ([]shared.ShareInfo, error) {
-	url := endpoints.ShareFile.Format(ctx.Server, fileID)
-	return removeSharedUsers(ctx.Session, url, remove)
+	return ctx.removeSharedUsers(client.ShareFile, fileID, remove)
 }
 
 // RemoveSharedFolderUsers takes a list of shared users to remove access to a folder,
@@ -85,8 +61,7 @@ func (ctx *Context) RemoveSharedFolderUsers(
 	folderID string,
 	remove []shared.ShareInfo,
 ) ([]shared.ShareInfo, error) {
-	url := endpoints.ShareFolder.Format(ctx.Server, folderID)
-	return removeSharedUsers(ctx.Session, url, remove)
+	return ctx.removeSharedUsers(client.ShareFolder, folderID, remove)
 }
 
 // UpdateSharedFileUsers updates read/write permissions for the provided users,
@@ -95,8 +70,7 @@ func (ctx *Context) UpdateSharedFileUsers(
 	fileID string,
 	update []shared.ShareInfo,
 ) ([]shared.ShareInfo, error) {
-	url := endpoints.ShareFile.Format(ctx.Server, fileID)
-	return updateSharedUsers(ctx.Session, fileID, url, update)
+	return ctx.updateSharedUsers(client.ShareFile, fileID, update)
 }
 
 // UpdateSharedFolderUsers updates read/write permissions for the provided users,
@@ -105,63 +79,23 @@ func (ctx *Context) UpdateSharedFolderUsers(
 	folderID string,
 	update []shared.ShareInfo,
 ) ([]shared.ShareInfo, error) {
-	url := endpoints.ShareFolder.Format(ctx.Server, folderID)
-	return updateSharedUsers(ctx.Session, folderID, url, update)
-}
-
-func shareContentWithUser(
-	session,
-	url string,
-	request shared.ShareItemRequest,
-) (shared.ShareInfo, error) {
-	reqData, _ := json.Marshal(request)
-	resp, err := requests.PostRequest(session, url, reqData)
-	if err != nil {
-		return shared.ShareInfo{}, err
-	}
-
-	var shareInfo shared.ShareInfo
-	err = json.NewDecoder(resp.Body).Decode(&shareInfo)
-	if err != nil {
-		return shared.ShareInfo{}, err
-	}
-
-	return shareInfo, nil
-}
-
-func getSharedInfo(
-	session,
-	url string,
-) ([]shared.ShareInfo, error) {
-	resp, err := requests.GetRequest(session, url)
-	if err != nil {
-		return nil, err
-	}
-
-	var shares []shared.ShareInfo
-	err = json.NewDecoder(resp.Body).Decode(&shares)
-	if err != nil {
-		return nil, err
-	}
-
-	return shares, nil
+	return ctx.updateSharedUsers(client.ShareFolder, folderID, update)
 }
 
-func removeSharedUsers(
-	session,
-	url string,
+func (ctx *Context) removeSharedUsers(
+	shareType client.ShareType,
+	itemID string,
 	remove []shared.ShareInfo,
 ) ([]shared.ShareInfo, error) {
+	c := ctx.client()
+
 	var removed []shared.ShareInfo
 	for _, share := range remove {
-		deleteURL := fmt.Sprintf("%s?id=%s", url, share.ID)
-		resp, err := requests.DeleteRequest(session, deleteURL, nil)
+		err := c.RemoveShare(context.Background(), shareType, itemID, share)
 		if err != nil {
 			msg := fmt.Sprintf("Failed to remove %s -- %s",
 				share.Recipient, err.Error())
 			return removed, errors.New(msg)
-		} else if resp.StatusCode != http.StatusOK {
-			return removed, utils.ParseHTTPError(resp)
 		}
 
 		removed = append(removed, share)
@@ -170,25 +104,18 @@ func removeSharedUsers(
 	return removed, nil
 }
 
-func updateSharedUsers(
-	session,
-	itemID,
-	url string,
+func (ctx *Context) updateSharedUsers(
+	shareType client.ShareType,
+	itemID string,
 	update []shared.ShareInfo,
 ) ([]shared.ShareInfo, error) {
+	c := ctx.client()
+
 	var updated []shared.ShareInfo
 	for _, share := range update {
-		reqData, _ := json.Marshal(shared.ShareEdit{
-			ID:        share.ID,
-			ItemID:    itemID,
-			CanModify: share.CanModify,
-		})
-
-		resp, err := requests.PutRequest(session, url, reqData)
+		err := c.UpdateShare(context.Background(), shareType, itemID, share)
 		if err != nil {
 			return updated, err
-		} else if resp.StatusCode != http.StatusOK {
-			return updated, utils.ParseHTTPError(resp)
 		}
 
 		updated = append(updated, share)
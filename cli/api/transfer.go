@@ -1,14 +1,10 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"io"
-	"log"
 	"net/http"
-	"yeetfile/cli/requests"
-	"yeetfile/cli/utils"
 	"yeetfile/shared"
-	"yeetfile/shared/endpoints"
 )
 
 // UploadFileChunk uploads a chunk of file data to the server. This API call
@@ -18,19 +14,8 @@ func (ctx *Context) UploadFileChunk(
 	endpoint string,
 	encData []byte,
 ) (string, error) {
-	resp, err := requests.PostRequest(ctx.Session, endpoint, encData)
-	if err != nil {
-		return "", err
-	} else if resp.StatusCode != http.StatusOK {
-		return "", utils.ParseHTTPError(resp)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	return string(body), nil
+	body, err := ctx.client().Do(context.Background(), http.MethodPost, endpoint, encData)
+	return string(body), err
 }
 
 // UploadText uploads text to YeetFile (only used by YeetFile Send). Since text
@@ -39,40 +24,70 @@ func (ctx *Context) UploadFileChunk(
 func (ctx *Context) UploadText(
 	upload shared.PlaintextUpload,
 ) (string, error) {
-	reqData, err := json.Marshal(upload)
-	if err != nil {
-		return "", err
-	}
-
-	url := endpoints.UploadSendText.Format(ctx.Server)
-	resp, err := requests.PostRequest(ctx.Session, url, reqData)
-	if err != nil {
-		return "", err
-	} else if resp.StatusCode != http.StatusOK {
-		return "", utils.ParseHTTPError(resp)
-	}
-
-	var metaResponse shared.MetadataUploadResponse
-	err = json.NewDecoder(resp.Body).Decode(&metaResponse)
-	if err != nil {
-		log.Println("Error decoding server response: ", err)
-		return "", err
-	}
-
-	return metaResponse.ID, nil
+	return ctx.client().UploadSendText(context.Background(), upload)
 }
 
 // DownloadFileChunk downloads a chunk of encrypted file data. Note that a
 // pre-formatted endpoint url must be provided, since the server and/or chunk
 // number can change per request.
 func (ctx *Context) DownloadFileChunk(url string) ([]byte, error) {
-	resp, err := requests.GetRequest(ctx.Session, url)
+	return ctx.client().Do(context.Background(), http.MethodGet, url, nil)
+}
+
+// PresignFileChunkUpload requests a presigned upload for a chunk of a vault
+// file, which can be used to upload the chunk directly to the server's storage
+// backend. The endpoint (endpoints.UploadVaultFilePresign) must already be
+// formatted with the file ID and chunk number.
+func (ctx *Context) PresignFileChunkUpload(
+	endpoint string,
+	size int64,
+) (shared.PresignedChunk, error) {
+	var presigned shared.PresignedChunk
+	err := ctx.client().DoJSON(
+		context.Background(),
+		http.MethodPost,
+		endpoint,
+		shared.PresignedChunkRequest{Size: size},
+		&presigned)
+	return presigned, err
+}
+
+// FinishPresignedFileChunk notifies the server that a chunk has been uploaded
+// using a presigned upload. Like UploadFileChunk, the response contains the
+// file ID once the final chunk has been uploaded.
+func (ctx *Context) FinishPresignedFileChunk(
+	endpoint string,
+	etag string,
+) (string, error) {
+	reqData, err := json.Marshal(shared.PresignedChunkResult{ETag: etag})
 	if err != nil {
-		return nil, err
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, utils.ParseHTTPError(resp)
+		return "", err
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	return body, err
+	body, err := ctx.client().Do(context.Background(), http.MethodPut, endpoint, reqData)
+	return string(body), err
+}
+
+// PresignFileChunkDownload requests a presigned download for a chunk of a vault
+// file. The url (endpoints.DownloadVaultFilePresign) must already be formatted
+// with the download ID and chunk number.
+func (ctx *Context) PresignFileChunkDownload(url string) (shared.PresignedChunk, error) {
+	var presigned shared.PresignedChunk
+	err := ctx.client().DoJSON(context.Background(), http.MethodGet, url, nil, &presigned)
+	return presigned, err
+}
+
+// UploadPresignedChunk uploads encrypted file data directly to the storage
+// backend, returning the ETag of the uploaded chunk
+func (ctx *Context) UploadPresignedChunk(
+	presigned shared.PresignedChunk,
+	encData []byte,
+) (string, error) {
+	return ctx.client().UploadPresignedChunk(context.Background(), presigned, encData)
+}
+
+// DownloadPresignedChunk downloads encrypted file data directly from the
+// storage backend
+func (ctx *Context) DownloadPresignedChunk(presigned shared.PresignedChunk) ([]byte, error) {
+	return ctx.client().DownloadPresignedChunk(context.Background(), presigned)
 }
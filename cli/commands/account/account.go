@@ -27,6 +27,26 @@ func getUpgradeString(exp time.Time) string {
 	}
 }
 
+// getSessionLabel returns a short description of a logged in session
+func getSessionLabel(session shared.ActiveSession) string {
+	userAgent := session.UserAgent
+	if len(userAgent) == 0 {
+		userAgent = "Unknown device"
+	} else if len(userAgent) > 40 {
+		userAgent = userAgent[:37] + "..."
+	}
+
+	label := fmt.Sprintf("%s (%s) - last seen %s",
+		shared.EscapeString(userAgent),
+		session.IPAddress,
+		utils.LocalTimeFromUTC(session.LastSeen).Format(time.DateTime))
+	if session.Current {
+		label += " [current]"
+	}
+
+	return label
+}
+
 func getStorageString(used, available int64, isSend bool) string {
 	if available == 0 && used == 0 {
 		return "None (requires upgraded account)"
@@ -25,6 +25,7 @@ const (
 	SetPasswordHint
 	SetTwoFactor
 	DeleteTwoFactor
+	ManageSessions
 	PurchaseSendUpgrade
 	PurchaseVaultUpgrade
 	RecyclePaymentID
@@ -542,6 +543,85 @@ func showDeleteTwoFactorView() {
 	ShowAccountModel()
 }
 
+func showSessionsView() {
+	const back = -1
+
+	var sessions []shared.ActiveSession
+	var err error
+	_ = spinner.New().Title("Fetching sessions...").Action(func() {
+		sessions, err = globals.API.GetActiveSessions()
+	}).Run()
+
+	if err != nil {
+		utils.ShowErrorForm("Error fetching sessions")
+		ShowAccountModel()
+		return
+	}
+
+	selected := back
+	options := []huh.Option[int]{huh.NewOption("Go Back", back)}
+	for i, session := range sessions {
+		options = append(options, huh.NewOption(getSessionLabel(session), i))
+	}
+
+	err = huh.NewForm(huh.NewGroup(
+		huh.NewNote().
+			Title(utils.GenerateTitle("Sessions")).
+			Description(utils.GenerateWrappedText("These are the "+
+				"devices and browsers currently logged into your "+
+				"account. Select a session to log it out.")),
+		huh.NewSelect[int]().
+			Title("Sessions").
+			Options(options...).
+			Value(&selected),
+	)).WithTheme(styles.Theme).Run()
+
+	if err != nil || selected == back {
+		ShowAccountModel()
+		return
+	}
+
+	session := sessions[selected]
+	desc := "Are you sure you want to log out of this session?"
+	if session.Current {
+		desc = "This is the session used by the CLI. Logging it " +
+			"out will log you out of the CLI."
+	}
+
+	var confirmed bool
+	err = huh.NewForm(huh.NewGroup(
+		huh.NewNote().
+			Title(utils.GenerateTitle("Log Out Session")).
+			Description(utils.GenerateDescriptionSection(
+				getSessionLabel(session),
+				utils.GenerateWrappedText(desc),
+				20)),
+		huh.NewConfirm().
+			Affirmative("Log Out").
+			Negative("Cancel").
+			Value(&confirmed),
+	)).WithTheme(styles.DestructiveTheme()).Run()
+
+	if err != nil || !confirmed {
+		showSessionsView()
+		return
+	}
+
+	_ = spinner.New().Title("Logging out session...").Action(func() {
+		err = globals.API.RevokeSession(session.ID)
+	}).Run()
+
+	if err != nil {
+		utils.ShowErrorForm(err.Error())
+	} else if session.Current {
+		_ = globals.Config.Reset()
+		fmt.Println("You are logged out")
+		return
+	}
+
+	showSessionsView()
+}
+
 func showRecyclePaymentIDView() {
 	title := utils.GenerateTitle("Recycle Payment ID")
 	desc := "Recycling your payment ID is a privacy feature that removes " +
@@ -620,6 +700,7 @@ func generateSelectOptions(
 	}
 
 	options = append(options, twoFactorOption)
+	options = append(options, huh.NewOption("Manage Sessions", ManageSessions))
 
 	if globals.ServerInfo.BillingEnabled {
 		if len(globals.ServerInfo.Upgrades.SendUpgrades) > 0 {
@@ -865,6 +946,7 @@ func init() {
 		PurchaseSendUpgrade:  showSendUpgradeView,
 		PurchaseVaultUpgrade: showVaultUpgradeView,
 		DeleteTwoFactor:      showDeleteTwoFactorView,
+		ManageSessions:       showSessionsView,
 		RecyclePaymentID:     showRecyclePaymentIDView,
 		DeleteAccount:        showAccountDeletionView,
 		Exit:                 exitView,
@@ -121,10 +121,10 @@ func ShowLoginModel() {
 		}
 
 		err = LogIn(identifier, password, "", sessionKey, vaultKey)
-		if err != nil && err != api.TwoFactorError {
+		if err != nil && !errors.Is(err, api.TwoFactorError) {
 			return runFunc(err.Error())
-		} else if err == api.TwoFactorError {
-			for err == api.TwoFactorError {
+		} else if errors.Is(err, api.TwoFactorError) {
+			for errors.Is(err, api.TwoFactorError) {
 				code := showTwoFactorPrompt()
 				err = LogIn(identifier, password, code, sessionKey, vaultKey)
 			}
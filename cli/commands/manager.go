@@ -16,6 +16,7 @@ import (
 	"yeetfile/cli/commands/auth/signup"
 	"yeetfile/cli/commands/download"
 	"yeetfile/cli/commands/send"
+	"yeetfile/cli/commands/token"
 	"yeetfile/cli/commands/vault"
 	"yeetfile/cli/crypto"
 	"yeetfile/cli/globals"
@@ -35,6 +36,7 @@ const (
 	Send     Command = "send"
 	Download Command = "download"
 	Account  Command = "account"
+	Token    Command = "token"
 	Help     Command = "help"
 )
 
@@ -48,6 +50,7 @@ var CommandMap = map[Command][]func(){
 	Send:     {send.ShowSendModel},
 	Download: {download.ShowDownloadModel},
 	Account:  {account.ShowAccountModel},
+	Token:    {token.ShowTokenCommand},
 	Help:     {printHelp},
 }
 
@@ -71,6 +74,10 @@ var ActionHelp = []string{
 		"             - Example: yeetfile download\n"+
 		"             - Example: yeetfile download https://yeetfile.com/file_abc#top.secret.hash8\n"+
 		"             - Example: yeetfile download file_abc#top.secret.hash8", Download),
+	fmt.Sprintf("%s    | Manage personal API tokens for scripts and CI jobs\n"+
+		"             - Example: yeetfile token list\n"+
+		"             - Example: yeetfile token create backups --scopes vault:read --expires 90\n"+
+		"             - Example: yeetfile token revoke abc123", Token),
 }
 
 var HelpMsg = `
@@ -0,0 +1,138 @@
+package token
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"yeetfile/cli/globals"
+	"yeetfile/cli/styles"
+	"yeetfile/cli/utils"
+	"yeetfile/shared"
+)
+
+const usage = `Usage:
+  yeetfile token list
+  yeetfile token create <name> --scopes <scopes> [--folders <ids>] [--expires <days>]
+  yeetfile token revoke <id>
+
+Scopes (comma separated): vault:read, vault:write, pass:read, send:create`
+
+// ShowTokenCommand lists, creates, or revokes the user's personal API tokens,
+// depending on the subcommand provided after "token"
+func ShowTokenCommand() {
+	if len(os.Args) < 3 {
+		fmt.Println(usage)
+		return
+	}
+
+	var err error
+	switch os.Args[2] {
+	case "list":
+		err = listTokens()
+	case "create":
+		err = createToken(os.Args[3:])
+	case "revoke":
+		if len(os.Args) < 4 {
+			err = errors.New("missing token ID")
+			break
+		}
+
+		err = globals.API.RevokeAPIToken(os.Args[3])
+		if err == nil {
+			fmt.Println(styles.SuccessStyle.Render("Token revoked"))
+		}
+	default:
+		styles.PrintErrStr(fmt.Sprintf("-- Invalid token command '%s'", os.Args[2]))
+		fmt.Println(usage)
+		return
+	}
+
+	utils.HandleCLIError("Error managing API tokens", err)
+}
+
+func listTokens() error {
+	tokens, err := globals.API.GetAPITokens()
+	if err != nil {
+		return err
+	} else if len(tokens) == 0 {
+		fmt.Println("No API tokens")
+		return nil
+	}
+
+	for _, token := range tokens {
+		fmt.Println(styles.BoldStyle.Render(token.Name))
+		fmt.Printf("  ID:        %s\n", token.ID)
+		fmt.Printf("  Scopes:    %s\n", strings.Join(token.Scopes, ", "))
+		if len(token.FolderIDs) > 0 {
+			fmt.Printf("  Folders:   %s\n", strings.Join(token.FolderIDs, ", "))
+		}
+
+		fmt.Printf("  Created:   %s\n", formatTime(token.Created, ""))
+		fmt.Printf("  Expires:   %s\n", formatTime(token.Expiration, "Never"))
+		fmt.Printf("  Last used: %s\n", formatTime(token.LastUsed, "Never"))
+	}
+
+	return nil
+}
+
+func createToken(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New("missing token name")
+	}
+
+	var scopes, folders string
+	var days int
+
+	flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+	flags.StringVar(&scopes, "scopes", "", "comma separated token scopes")
+	flags.StringVar(&folders, "folders", "", "comma separated folder IDs")
+	flags.IntVar(&days, "expires", 0, "days until the token expires")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	newToken := shared.NewAPIToken{
+		Name:      args[0],
+		Scopes:    splitList(scopes),
+		FolderIDs: splitList(folders),
+	}
+
+	if days < 0 {
+		return fmt.Errorf("invalid expiration: %d days", days)
+	} else if days > 0 {
+		newToken.Expiration = time.Now().AddDate(0, 0, days).UTC()
+	}
+
+	response, err := globals.API.CreateAPIToken(newToken)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(styles.SuccessStyle.Render("Created token " + response.Info.ID))
+	fmt.Println("Copy the token below, it won't be shown again:")
+	fmt.Println()
+	fmt.Println(response.Token)
+	return nil
+}
+
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func formatTime(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+
+	return utils.LocalTimeFromUTC(t).Format(time.DateTime)
+}
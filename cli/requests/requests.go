@@ -22,6 +22,27 @@ func DeleteRequest(session, url string, data []byte) (*http.Response, error) {
 	return sendRequest(session, http.MethodDelete, url, data)
 }
 
+// PresignedRequest sends a request directly to a storage backend, using a
+// presigned URL and headers provided by the server. Session info is never
+// included in these requests.
+func PresignedRequest(
+	method,
+	url string,
+	headers map[string]string,
+	data []byte,
+) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	return new(http.Transport).RoundTrip(req)
+}
+
 func sendRequest(session, method, url string, data []byte) (*http.Response, error) {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
 	if err != nil {
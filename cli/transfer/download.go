@@ -19,13 +19,15 @@ type PendingDownload struct {
 	NumChunks           int
 	UnformattedEndpoint endpoints.Endpoint
 	Server              string
+	Presigned           bool
 }
 
 type DownloadChunk struct {
-	File     *os.File
-	ChunkNum int
-	Key      []byte
-	Endpoint string
+	File      *os.File
+	ChunkNum  int
+	Key       []byte
+	Endpoint  string
+	Presigned bool
 }
 
 // worker sends chunked and encrypted file data to the endpoint specified in the
@@ -57,7 +59,14 @@ func downloadWorker(
 }
 
 func fetchChunk(chunk DownloadChunk) ([]byte, error) {
-	body, err := globals.API.DownloadFileChunk(chunk.Endpoint)
+	var body []byte
+	var err error
+	if chunk.Presigned {
+		body, err = fetchPresignedChunk(chunk)
+	} else {
+		body, err = globals.API.DownloadFileChunk(chunk.Endpoint)
+	}
+
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +79,17 @@ func fetchChunk(chunk DownloadChunk) ([]byte, error) {
 	return decryptedData, nil
 }
 
+// fetchPresignedChunk downloads encrypted file data directly from the server's
+// storage backend
+func fetchPresignedChunk(chunk DownloadChunk) ([]byte, error) {
+	presigned, err := globals.API.PresignFileChunkDownload(chunk.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return globals.API.DownloadPresignedChunk(presigned)
+}
+
 func writeChunk(chunk DownloadChunk, data []byte) error {
 	offset := int64(constants.ChunkSize * chunk.ChunkNum)
 	_, err := chunk.File.WriteAt(data, offset)
@@ -120,6 +140,11 @@ func InitVaultDownload(
 
 	p := initDownload(metadata.ID, globals.Config.Server, key, file, metadata.Chunks)
 	p.UnformattedEndpoint = endpoints.DownloadVaultFileData
+	if metadata.Presigned {
+		p.UnformattedEndpoint = endpoints.DownloadVaultFilePresign
+		p.Presigned = true
+	}
+
 	return p, nil
 }
 
@@ -140,10 +165,11 @@ func (p PendingDownload) DownloadData(progress func()) error {
 		chunkNum := strconv.Itoa(chunk + 1)
 		url := p.UnformattedEndpoint.Format(p.Server, p.ID, chunkNum)
 		fileChunk := DownloadChunk{
-			File:     p.File,
-			ChunkNum: chunk,
-			Key:      p.Key,
-			Endpoint: url,
+			File:      p.File,
+			ChunkNum:  chunk,
+			Key:       p.Key,
+			Endpoint:  url,
+			Presigned: p.Presigned,
 		}
 		jobs <- fileChunk
 	}
@@ -157,10 +183,11 @@ func (p PendingDownload) DownloadData(progress func()) error {
 
 	// Download final chunk
 	finalChunk := DownloadChunk{
-		File:     p.File,
-		ChunkNum: p.NumChunks - 1,
-		Key:      p.Key,
-		Endpoint: p.UnformattedEndpoint.Format(p.Server, p.ID, strconv.Itoa(p.NumChunks)),
+		File:      p.File,
+		ChunkNum:  p.NumChunks - 1,
+		Key:       p.Key,
+		Endpoint:  p.UnformattedEndpoint.Format(p.Server, p.ID, strconv.Itoa(p.NumChunks)),
+		Presigned: p.Presigned,
 	}
 	data, err := fetchChunk(finalChunk)
 	if err != nil {
@@ -21,12 +21,14 @@ type PendingUpload struct {
 	File                *os.File
 	NumChunks           int
 	UnformattedEndpoint endpoints.Endpoint
+	Presigned           bool
 }
 
 type FileChunk struct {
 	Chunk         int
 	EncryptedData []byte
 	Endpoint      string
+	Presigned     bool
 }
 
 type WorkerCtx struct {
@@ -110,12 +112,20 @@ func InitVaultFile(
 		return PendingUpload{}, err
 	}
 
+	// Chunks are uploaded directly to the server's storage backend if
+	// presigned uploads are enabled
+	endpoint := endpoints.UploadVaultFileData
+	if metaResponse.Presigned {
+		endpoint = endpoints.UploadVaultFilePresign
+	}
+
 	return PendingUpload{
 		ID:                  metaResponse.ID,
 		Key:                 key,
 		File:                file,
 		NumChunks:           numChunks,
-		UnformattedEndpoint: endpoints.UploadVaultFileData,
+		UnformattedEndpoint: endpoint,
+		Presigned:           metaResponse.Presigned,
 	}, nil
 }
 
@@ -212,12 +222,37 @@ func (p PendingUpload) prepareChunk(chunk int, size int64) (FileChunk, error) {
 		Chunk:         chunk,
 		Endpoint:      endpoint,
 		EncryptedData: encData,
+		Presigned:     p.Presigned,
 	}, nil
 }
 
 // sendChunk sends the encrypted file data to the server
 func sendChunk(fileChunk FileChunk) (string, error) {
+	if fileChunk.Presigned {
+		return sendPresignedChunk(fileChunk)
+	}
+
 	return globals.API.UploadFileChunk(
 		fileChunk.Endpoint,
 		fileChunk.EncryptedData)
 }
+
+// sendPresignedChunk uploads the encrypted file data directly to the server's
+// storage backend, and then lets the server know that the chunk was uploaded
+func sendPresignedChunk(fileChunk FileChunk) (string, error) {
+	presigned, err := globals.API.PresignFileChunkUpload(
+		fileChunk.Endpoint,
+		int64(len(fileChunk.EncryptedData)))
+	if err != nil {
+		return "", err
+	}
+
+	etag, err := globals.API.UploadPresignedChunk(
+		presigned,
+		fileChunk.EncryptedData)
+	if err != nil {
+		return "", err
+	}
+
+	return globals.API.FinishPresignedFileChunk(fileChunk.Endpoint, etag)
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"yeetfile/cli/styles"
+	"yeetfile/shared/constants"
 )
 
 var (
@@ -183,6 +184,12 @@ func ParseHTTPError(response *http.Response) error {
 	body, _ := io.ReadAll(response.Body)
 	errCode := fmt.Sprintf(httpErrorCodeFormat, response.StatusCode)
 	msg := fmt.Sprintf("server error %s: %s", errCode, body)
+
+	// Include the request ID so that the error can be found in the server logs
+	if requestID := response.Header.Get(constants.RequestIDHeader); len(requestID) > 0 {
+		msg = fmt.Sprintf("%s (request ID: %s)", strings.TrimSpace(msg), requestID)
+	}
+
 	return errors.New(msg)
 }
 
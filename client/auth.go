@@ -0,0 +1,276 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+// GetServerInfo returns information about the server's configuration
+func (c *Client) GetServerInfo(ctx context.Context) (shared.ServerInfo, error) {
+	var info shared.ServerInfo
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.ServerInfo), nil, &info)
+	return info, err
+}
+
+// Signup starts creating a new account. If the signup doesn't include an
+// email, the response contains the new account ID, which needs to be verified
+// with VerifyAccount before logging in.
+func (c *Client) Signup(
+	ctx context.Context,
+	signup shared.Signup,
+) (shared.SignupResponse, error) {
+	var signupResponse shared.SignupResponse
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.Signup), signup, &signupResponse)
+	if hasStatus(err, http.StatusForbidden) {
+		return shared.SignupResponse{}, ErrServerPassword
+	} else if err != nil {
+		return shared.SignupResponse{}, err
+	} else if len(signupResponse.Error) > 0 {
+		return shared.SignupResponse{}, errors.New(signupResponse.Error)
+	}
+
+	return signupResponse, nil
+}
+
+// VerifyAccount finishes creating an account-ID-only account using the
+// verification code and the user's keys
+func (c *Client) VerifyAccount(ctx context.Context, account shared.VerifyAccount) error {
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.VerifyAccount), account, nil)
+	if hasStatus(err, http.StatusUnauthorized) {
+		return ErrIncorrectCode
+	}
+
+	return err
+}
+
+// VerifyEmail verifies an email address using the code sent to that address
+func (c *Client) VerifyEmail(ctx context.Context, email, code string) error {
+	verify := shared.VerifyEmail{Email: email, Code: code}
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.VerifyEmail), verify, nil)
+	if hasStatus(err, http.StatusUnauthorized) {
+		return ErrIncorrectCode
+	}
+
+	return err
+}
+
+// Login logs into the server, using the returned session cookie for all
+// following requests. Returns a *TwoFactorError (matching ErrTwoFactor) if the
+// account has two-factor authentication enabled and the login is missing a
+// valid code or security key assertion.
+func (c *Client) Login(
+	ctx context.Context,
+	login shared.Login,
+) (shared.LoginResponse, error) {
+	var loginResponse shared.LoginResponse
+	resp, err := c.sendJSON(ctx, http.MethodPost, c.url(endpoints.Login), login)
+	if hasStatus(err, http.StatusForbidden) {
+		return shared.LoginResponse{}, newTwoFactorError(err)
+	} else if err != nil {
+		return shared.LoginResponse{}, err
+	}
+
+	defer resp.Body.Close()
+	if err = decode(resp, &loginResponse); err != nil {
+		return shared.LoginResponse{}, err
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == constants.AuthSessionStore {
+			c.SetSession(cookie.Value)
+		}
+	}
+
+	return loginResponse, nil
+}
+
+// LogOut invalidates the current session
+func (c *Client) LogOut(ctx context.Context) error {
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.Logout), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	c.SetSession("")
+	return nil
+}
+
+// CheckSession returns nil if the current session is valid
+func (c *Client) CheckSession(ctx context.Context) error {
+	return c.DoJSON(ctx, http.MethodGet, c.url(endpoints.Session), nil, nil)
+}
+
+// GetAccountInfo returns the current user's account info
+func (c *Client) GetAccountInfo(ctx context.Context) (shared.AccountResponse, error) {
+	var account shared.AccountResponse
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.Account), nil, &account)
+	return account, err
+}
+
+// GetAccountUsage returns the current user's used and available vault
+// storage and send
+func (c *Client) GetAccountUsage(ctx context.Context) (shared.UsageResponse, error) {
+	var usage shared.UsageResponse
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.AccountUsage), nil, &usage)
+	return usage, err
+}
+
+// DeleteAccount deletes the current user's account. The identifier must be
+// the account's email or account ID.
+func (c *Client) DeleteAccount(ctx context.Context, identifier string) error {
+	deleteAccount := shared.DeleteAccount{Identifier: identifier}
+	return c.DoJSON(ctx, http.MethodDelete, c.url(endpoints.Account), deleteAccount, nil)
+}
+
+// GetUserProtectedKey returns the current user's private key, encrypted with
+// their user key
+func (c *Client) GetUserProtectedKey(ctx context.Context) ([]byte, error) {
+	var protectedKey shared.ProtectedKeyResponse
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.ProtectedKey), nil, &protectedKey)
+	return protectedKey.ProtectedKey, err
+}
+
+// StartChangeEmail starts changing the current user's email. If the user
+// doesn't have an email, the response contains the change ID for
+// ChangeEmail, otherwise the ID is sent to their current email.
+func (c *Client) StartChangeEmail(
+	ctx context.Context,
+) (shared.StartEmailChangeResponse, error) {
+	var changeResponse shared.StartEmailChangeResponse
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.ChangeEmail, ""), nil, &changeResponse)
+	return changeResponse, err
+}
+
+// ChangeEmail finishes changing the current user's email, sending a
+// verification code to the new email
+func (c *Client) ChangeEmail(
+	ctx context.Context,
+	changeEmail shared.ChangeEmail,
+	changeID string,
+) error {
+	u := c.url(endpoints.ChangeEmail, changeID)
+	return c.DoJSON(ctx, http.MethodPut, u, changeEmail, nil)
+}
+
+// ChangePassword changes the current user's password, replacing their login
+// key hash and encrypted private key
+func (c *Client) ChangePassword(ctx context.Context, password shared.ChangePassword) error {
+	return c.DoJSON(ctx, http.MethodPut, c.url(endpoints.ChangePassword), password, nil)
+}
+
+// ChangePasswordHint sets the current user's password hint, which is
+// encrypted by the server
+func (c *Client) ChangePasswordHint(ctx context.Context, hint string) error {
+	change := shared.ChangePasswordHint{Hint: hint}
+	return c.DoJSON(ctx, http.MethodPost, c.url(endpoints.ChangeHint), change, nil)
+}
+
+// ForgotPassword sends the password hint for an account to its email
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	forgot := shared.ForgotPassword{Email: email}
+	return c.DoJSON(ctx, http.MethodPost, c.url(endpoints.Forgot), forgot, nil)
+}
+
+// Generate2FA returns a new TOTP secret for the current user, which only
+// succeeds if they don't already have 2FA enabled
+func (c *Client) Generate2FA(ctx context.Context) (shared.NewTOTP, error) {
+	var newTOTP shared.NewTOTP
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.TwoFactor), nil, &newTOTP)
+	return newTOTP, err
+}
+
+// Finalize2FA enables 2FA using the secret from Generate2FA and a code
+// generated from it, returning the account's one-time recovery codes
+func (c *Client) Finalize2FA(
+	ctx context.Context,
+	totp shared.SetTOTP,
+) (shared.SetTOTPResponse, error) {
+	var setTOTP shared.SetTOTPResponse
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.TwoFactor), totp, &setTOTP)
+	return setTOTP, err
+}
+
+// Disable2FA disables 2FA for the current user using a TOTP or recovery code
+func (c *Client) Disable2FA(ctx context.Context, code string) error {
+	u := c.url(endpoints.TwoFactor) + "?code=" + url.QueryEscape(code)
+	return c.DoJSON(ctx, http.MethodDelete, u, nil, nil)
+}
+
+// GetWebAuthnOptions returns the options for registering a new security key or
+// passkey for the current user
+func (c *Client) GetWebAuthnOptions(
+	ctx context.Context,
+) (shared.WebAuthnRegistrationOptions, error) {
+	var options shared.WebAuthnRegistrationOptions
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.WebAuthn), nil, &options)
+	return options, err
+}
+
+// AddWebAuthnKey registers a security key or passkey created with the options
+// from GetWebAuthnOptions. The response includes new recovery codes if the
+// user didn't already have 2FA enabled.
+func (c *Client) AddWebAuthnKey(
+	ctx context.Context,
+	key shared.NewWebAuthnKey,
+) (shared.NewWebAuthnKeyResponse, error) {
+	var response shared.NewWebAuthnKeyResponse
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.WebAuthn), key, &response)
+	return response, err
+}
+
+// RenameWebAuthnKey renames one of the current user's security keys
+func (c *Client) RenameWebAuthnKey(ctx context.Context, id, name string) error {
+	modify := shared.ModifyWebAuthnKey{Name: name}
+	return c.DoJSON(ctx, http.MethodPut, c.url(endpoints.WebAuthnKey, id), modify, nil)
+}
+
+// RemoveWebAuthnKey revokes one of the current user's security keys
+func (c *Client) RemoveWebAuthnKey(ctx context.Context, id string) error {
+	return c.DoJSON(ctx, http.MethodDelete, c.url(endpoints.WebAuthnKey, id), nil, nil)
+}
+
+// GetActiveSessions returns the current user's logged in sessions
+func (c *Client) GetActiveSessions(ctx context.Context) ([]shared.ActiveSession, error) {
+	var sessions []shared.ActiveSession
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.AccountSessions), nil, &sessions)
+	return sessions, err
+}
+
+// RevokeSession logs the current user out of one of their sessions. Revoking
+// the client's own session is the same as logging out.
+func (c *Client) RevokeSession(ctx context.Context, id string) error {
+	return c.DoJSON(ctx, http.MethodDelete, c.url(endpoints.AccountSession, id), nil, nil)
+}
+
+// GetAPITokens returns info about the current user's personal API tokens
+func (c *Client) GetAPITokens(ctx context.Context) ([]shared.APIToken, error) {
+	var tokens []shared.APIToken
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.APITokens), nil, &tokens)
+	return tokens, err
+}
+
+// CreateAPIToken creates a new personal API token. The token value is only
+// included in the response, and can't be retrieved again later.
+func (c *Client) CreateAPIToken(
+	ctx context.Context,
+	newToken shared.NewAPIToken,
+) (shared.NewAPITokenResponse, error) {
+	var response shared.NewAPITokenResponse
+	err := c.DoJSON(ctx, http.MethodPost, c.url(endpoints.APITokens), newToken, &response)
+	return response, err
+}
+
+// RevokeAPIToken revokes one of the current user's personal API tokens
+func (c *Client) RevokeAPIToken(ctx context.Context, id string) error {
+	return c.DoJSON(ctx, http.MethodDelete, c.url(endpoints.APIToken, id), nil, nil)
+}
+
+// RecyclePaymentID replaces the current user's payment ID with a new one
+func (c *Client) RecyclePaymentID(ctx context.Context) error {
+	return c.DoJSON(ctx, http.MethodPut, c.url(endpoints.RecyclePaymentID), nil, nil)
+}
@@ -0,0 +1,325 @@
+// Package client is a Go client for the YeetFile API, covering accounts, the
+// file and password vaults, sharing, and YeetFile Send.
+//
+// Data is never encrypted or decrypted by the client. Requests and responses
+// use the shared structs as-is, so any encryption needs to happen before
+// uploading or after downloading (see cli/crypto for how the CLI does this).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+// RetryPolicy configures how failed requests are retried. Requests are only
+// retried if the failure is transient (i.e. the server is temporarily
+// unavailable or the request was rate limited), and requests that may have
+// already been processed by the server are only retried for idempotent methods.
+type RetryPolicy struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy retries a request up to 3 times, starting with a half
+// second delay that doubles with each attempt
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 500 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+}
+
+// NoRetries disables retrying failed requests
+var NoRetries = RetryPolicy{}
+
+// Client sends requests to a YeetFile server. The exported fields can be
+// changed after creating a client with New, but shouldn't be modified while
+// requests are in progress.
+type Client struct {
+	Server     string
+	HTTPClient *http.Client
+	Retry      RetryPolicy
+	UserAgent  string
+
+	mu      sync.RWMutex
+	session string
+	token   string
+}
+
+// New returns a client for the server at the provided URL, using the default
+// retry policy and an HTTP client that doesn't follow redirects
+func New(server string) *Client {
+	return &Client{
+		Server: strings.TrimSuffix(server, "/"),
+		HTTPClient: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Retry:     DefaultRetryPolicy,
+		UserAgent: constants.CLIUserAgent,
+	}
+}
+
+// Session returns the value of the current session cookie
+func (c *Client) Session() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.session
+}
+
+// SetSession sets the session cookie to send with each request. This is
+// set automatically after logging in, but can be used to resume a previous
+// session.
+func (c *Client) SetSession(session string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = session
+}
+
+// SetToken sets a personal API token to send with each request in place of a
+// session. Only the routes allowed by the token's scopes can be accessed.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+// Do sends a request to a URL on the server, typically a formatted endpoint
+// (i.e. endpoints.DownloadVaultFileData.Format(server, id, chunk)), and returns
+// the response body. Responses with an error status code are returned as an
+// *Error.
+func (c *Client) Do(
+	ctx context.Context,
+	method,
+	url string,
+	body []byte,
+) ([]byte, error) {
+	resp, err := c.send(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// url returns the full URL for an endpoint on the client's server
+func (c *Client) url(endpoint endpoints.Endpoint, args ...string) string {
+	return endpoint.Format(c.Server, args...)
+}
+
+// DoJSON is like Do, but sends the JSON encoding of in (if not nil) as the
+// request body and decodes the JSON response into out (if not nil)
+func (c *Client) DoJSON(
+	ctx context.Context,
+	method,
+	url string,
+	in any,
+	out any,
+) error {
+	resp, err := c.sendJSON(ctx, method, url, in)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	return decode(resp, out)
+}
+
+// sendJSON sends a request with the JSON encoding of in (if not nil) as the
+// body. The caller must close the response body.
+func (c *Client) sendJSON(
+	ctx context.Context,
+	method,
+	url string,
+	in any,
+) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.send(ctx, method, url, body)
+}
+
+// decode decodes a JSON response into out, or discards the response if out is
+// nil
+func decode(resp *http.Response, out any) error {
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send sends a request to the server, retrying according to the client's
+// retry policy. The returned response always has a successful status code.
+func (c *Client) send(
+	ctx context.Context,
+	method,
+	url string,
+	body []byte,
+) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.sendOnce(ctx, method, url, body)
+		if err == nil && isLoginRedirect(resp) {
+			resp.StatusCode = http.StatusUnauthorized
+		}
+
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			return resp, nil
+		}
+
+		var delay time.Duration
+		if err == nil {
+			delay = retryAfter(resp)
+			err = parseError(resp)
+		}
+
+		if attempt >= c.Retry.MaxRetries || !isRetryable(method, err) {
+			return nil, err
+		}
+
+		if delay == 0 || delay > c.Retry.MaxBackoff {
+			delay = c.Retry.backoff(attempt)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) sendOnce(
+	ctx context.Context,
+	method,
+	url string,
+	body []byte,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if session := c.Session(); len(session) > 0 {
+		req.AddCookie(&http.Cookie{
+			Name:  constants.AuthSessionStore,
+			Value: session,
+		})
+	}
+
+	req.Header.Set("User-Agent", c.UserAgent)
+	return c.httpClient().Do(req)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+
+	return c.HTTPClient
+}
+
+// isLoginRedirect returns true if the server responded to an API request with
+// an HTML page instead, which older servers send to redirect expired sessions
+// to the login page
+func isLoginRedirect(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusOK &&
+		resp.Request != nil &&
+		strings.HasPrefix(resp.Request.URL.Path, "/api/") &&
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html")
+}
+
+// backoff returns the delay before retrying a request, with jitter added to
+// avoid many clients retrying at the same time
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MinBackoff << attempt
+	if delay > p.MaxBackoff || delay <= 0 {
+		delay = p.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// isRetryable returns true if a request can be safely retried after failing
+// with the provided error
+func isRetryable(method string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var serverErr *Error
+	if errors.As(err, &serverErr) {
+		switch serverErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			// The request was rejected before being handled
+			return true
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return isIdempotent(method)
+		}
+
+		return false
+	}
+
+	// Connection errors, or the connection closing before a response
+	var opErr *net.OpError
+	if errors.As(err, &opErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return isIdempotent(method)
+	}
+
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// retryAfter returns the delay requested by the server in the Retry-After
+// header, or 0 if the header is missing or isn't a number of seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
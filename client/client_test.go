@@ -0,0 +1,200 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxRetries: 2,
+	MinBackoff: time.Millisecond,
+	MaxBackoff: 5 * time.Millisecond,
+}
+
+// newTestClient returns a client for a test server using the provided handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := New(server.URL)
+	c.Retry = testRetryPolicy
+	return c
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"storageBackend":"local"}`))
+	})
+
+	info, err := c.GetServerInfo(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "local", info.StorageBackend)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	// Give up after the max number of retries
+	attempts.Store(-10)
+	_, err = c.GetServerInfo(context.Background())
+	assert.True(t, hasStatus(err, http.StatusServiceUnavailable))
+	assert.Equal(t, int32(-7), attempts.Load())
+}
+
+func TestNoRetryNonIdempotent(t *testing.T) {
+	var attempts atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	// The upload may have been processed, so it shouldn't be sent again
+	_, err := c.UploadVaultChunk(context.Background(), "id", 1, []byte("data"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), attempts.Load())
+
+	attempts.Store(0)
+	_, err = c.DownloadVaultChunk(context.Background(), "id", 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestTypedErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(constants.RequestIDHeader, "abc123")
+		http.Error(w, "File not found", http.StatusNotFound)
+	})
+
+	_, err := c.GetFileInfo(context.Background(), "missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+
+	var serverErr *Error
+	assert.True(t, errors.As(err, &serverErr))
+	assert.Equal(t, "abc123", serverErr.RequestID)
+	assert.Contains(t, err.Error(), "File not found")
+	assert.Contains(t, err.Error(), "request ID: abc123")
+}
+
+func TestContextCancellation(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	c.Retry = RetryPolicy{MaxRetries: 5, MinBackoff: time.Minute, MaxBackoff: time.Minute}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetAccountInfo(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestLoginSession(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case string(endpoints.Login):
+			var login shared.Login
+			_ = json.NewDecoder(req.Body).Decode(&login)
+			if len(login.Code) == 0 {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"totp":true}`))
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:  constants.AuthSessionStore,
+				Value: "session-value",
+			})
+			_, _ = w.Write([]byte(`{}`))
+		case string(endpoints.Session):
+			cookie, err := req.Cookie(constants.AuthSessionStore)
+			if err != nil || cookie.Value != "session-value" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	})
+
+	_, err := c.Login(context.Background(), shared.Login{Identifier: "user"})
+	assert.True(t, errors.Is(err, ErrTwoFactor))
+
+	var twoFactorErr *TwoFactorError
+	assert.True(t, errors.As(err, &twoFactorErr))
+	assert.True(t, twoFactorErr.Challenge.TOTP)
+	assert.Nil(t, twoFactorErr.Challenge.WebAuthn)
+	assert.True(t, errors.Is(c.CheckSession(context.Background()), ErrUnauthorized))
+
+	_, err = c.Login(context.Background(), shared.Login{Identifier: "user", Code: "123456"})
+	assert.Nil(t, err)
+	assert.Equal(t, "session-value", c.Session())
+	assert.Nil(t, c.CheckSession(context.Background()))
+}
+
+func TestAPIToken(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer yft_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, err := req.Cookie(constants.AuthSessionStore)
+		assert.NotNil(t, err, "session cookie shouldn't be sent with a token")
+		_, _ = w.Write([]byte(`{"protectedKey":"a2V5"}`))
+	})
+
+	_, err := c.GetUserProtectedKey(context.Background())
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	c.SetSession("session-value")
+	c.SetToken("yft_token")
+	key, err := c.GetUserProtectedKey(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key"), key)
+}
+
+func TestExpiredSession(t *testing.T) {
+	// Older servers redirect API requests from expired sessions to the login
+	// page, rather than responding with 401
+	loginRedirect := `
+<html>
+<head>
+<meta http-equiv="refresh" content="0;URL='/login?next=/api/vault/d/abc/1'"/>
+</head>
+<body><p>Moved to <a href="/login?next=/api/vault/d/abc/1">/login?next=/api/vault/d/abc/1</a>.</p></body>
+</html>`
+
+	for _, legacy := range []bool{false, true} {
+		c := newTestClient(t, func(w http.ResponseWriter, req *http.Request) {
+			if legacy {
+				_, _ = w.Write([]byte(loginRedirect))
+				return
+			}
+
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		})
+
+		c.SetSession("expired-session")
+		_, err := c.DownloadVaultChunk(context.Background(), "abc", 1)
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+
+		err = c.ModifyFile(context.Background(), "abc", shared.ModifyVaultItem{})
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+
+		_, err = c.GetFileInfo(context.Background(), "abc")
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+	}
+}
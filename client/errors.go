@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("too many requests")
+
+	ErrTwoFactor      = errors.New("two factor code missing or incorrect")
+	ErrServerPassword = errors.New("signup is password restricted on this server")
+	ErrIncorrectCode  = errors.New("incorrect verification code")
+)
+
+// Error is returned when the server responds with an error status code. It
+// can be compared to ErrUnauthorized, ErrForbidden, ErrNotFound, and
+// ErrRateLimited with errors.Is.
+type Error struct {
+	StatusCode int
+	Message    string
+
+	// RequestID identifies the request in the server logs
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("server error [code: %d]: %s", e.StatusCode, e.Message)
+	if len(e.RequestID) > 0 {
+		msg = fmt.Sprintf("%s (request ID: %s)", strings.TrimSpace(msg), e.RequestID)
+	}
+
+	return msg
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+
+	return false
+}
+
+// TwoFactorError is returned when logging in to an account with two-factor
+// authentication enabled without a valid second factor. The challenge lists the
+// second factors the account accepts, and can be compared to ErrTwoFactor with
+// errors.Is.
+type TwoFactorError struct {
+	Challenge shared.TwoFactorChallenge
+}
+
+func (e *TwoFactorError) Error() string {
+	return ErrTwoFactor.Error()
+}
+
+func (e *TwoFactorError) Is(target error) bool {
+	return target == ErrTwoFactor
+}
+
+// newTwoFactorError creates a TwoFactorError from a 403 login response, which
+// includes the second factor challenge if the second factor was missing
+func newTwoFactorError(err error) error {
+	twoFactorErr := &TwoFactorError{}
+	var serverErr *Error
+	if errors.As(err, &serverErr) {
+		_ = json.Unmarshal([]byte(serverErr.Message), &twoFactorErr.Challenge)
+	}
+
+	return twoFactorErr
+}
+
+// parseError reads an error response from the server, closing the response
+// body afterward
+func parseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Message:    string(body),
+		RequestID:  resp.Header.Get(constants.RequestIDHeader),
+	}
+}
+
+// hasStatus returns true if err is an *Error with the provided status code
+func hasStatus(err error, status int) bool {
+	var serverErr *Error
+	return errors.As(err, &serverErr) && serverErr.StatusCode == status
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"yeetfile/shared"
+	"yeetfile/shared/endpoints"
+)
+
+// PresignVaultChunkUpload requests a presigned upload for a chunk of a vault
+// file, which can be used with UploadPresignedChunk to upload the chunk
+// directly to the server's storage backend. Returns an error if the storage
+// backend doesn't support presigned requests, in which case UploadVaultChunk
+// should be used instead.
+func (c *Client) PresignVaultChunkUpload(
+	ctx context.Context,
+	id string,
+	chunk int,
+	size int64,
+) (shared.PresignedChunk, error) {
+	var presigned shared.PresignedChunk
+	u := c.url(endpoints.UploadVaultFilePresign, id, strconv.Itoa(chunk))
+	req := shared.PresignedChunkRequest{Size: size}
+	err := c.DoJSON(ctx, http.MethodPost, u, req, &presigned)
+	return presigned, err
+}
+
+// FinishPresignedVaultChunk notifies the server that a chunk was uploaded with
+// a presigned upload. Like UploadVaultChunk, the response is empty until the
+// final chunk is uploaded.
+func (c *Client) FinishPresignedVaultChunk(
+	ctx context.Context,
+	id string,
+	chunk int,
+	etag string,
+) (string, error) {
+	u := c.url(endpoints.UploadVaultFilePresign, id, strconv.Itoa(chunk))
+	resp, err := c.sendJSON(ctx, http.MethodPut, u, shared.PresignedChunkResult{ETag: etag})
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+// PresignVaultChunkDownload requests a presigned download for a chunk of a
+// vault file, using the download ID returned by GetVaultItemMetadata
+func (c *Client) PresignVaultChunkDownload(
+	ctx context.Context,
+	id string,
+	chunk int,
+) (shared.PresignedChunk, error) {
+	var presigned shared.PresignedChunk
+	u := c.url(endpoints.DownloadVaultFilePresign, id, strconv.Itoa(chunk))
+	err := c.DoJSON(ctx, http.MethodGet, u, nil, &presigned)
+	return presigned, err
+}
+
+// UploadPresignedChunk uploads encrypted file data directly to the storage
+// backend, returning the ETag of the uploaded chunk. The session cookie is
+// never sent with presigned requests.
+func (c *Client) UploadPresignedChunk(
+	ctx context.Context,
+	presigned shared.PresignedChunk,
+	encData []byte,
+) (string, error) {
+	resp, err := c.sendPresigned(ctx, presigned, encData)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", parseError(resp)
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+// DownloadPresignedChunk downloads encrypted file data directly from the
+// storage backend
+func (c *Client) DownloadPresignedChunk(
+	ctx context.Context,
+	presigned shared.PresignedChunk,
+) ([]byte, error) {
+	resp, err := c.sendPresigned(ctx, presigned, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, parseError(resp)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (c *Client) sendPresigned(
+	ctx context.Context,
+	presigned shared.PresignedChunk,
+	data []byte,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		presigned.Method,
+		presigned.URL,
+		bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range presigned.Headers {
+		req.Header.Set(key, value)
+	}
+
+	return c.httpClient().Do(req)
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"yeetfile/shared"
+	"yeetfile/shared/endpoints"
+)
+
+// InitSendFile starts a new YeetFile Send upload. The file's chunks are
+// uploaded afterward with UploadSendChunk.
+func (c *Client) InitSendFile(
+	ctx context.Context,
+	meta shared.UploadMetadata,
+) (shared.MetadataUploadResponse, error) {
+	var metaResponse shared.MetadataUploadResponse
+	u := c.url(endpoints.UploadSendFileMetadata)
+	err := c.DoJSON(ctx, http.MethodPost, u, meta, &metaResponse)
+	return metaResponse, err
+}
+
+// UploadSendChunk uploads a chunk of encrypted file data, starting from chunk
+// 1. The response is empty until the final chunk is uploaded.
+func (c *Client) UploadSendChunk(
+	ctx context.Context,
+	id string,
+	chunk int,
+	encData []byte,
+) (string, error) {
+	u := c.url(endpoints.UploadSendFileData, id, strconv.Itoa(chunk))
+	body, err := c.Do(ctx, http.MethodPost, u, encData)
+	return string(body), err
+}
+
+// UploadSendText uploads encrypted text along with its metadata in a single
+// request, returning the ID of the new text upload
+func (c *Client) UploadSendText(
+	ctx context.Context,
+	upload shared.PlaintextUpload,
+) (string, error) {
+	var metaResponse shared.MetadataUploadResponse
+	u := c.url(endpoints.UploadSendText)
+	err := c.DoJSON(ctx, http.MethodPost, u, upload, &metaResponse)
+	return metaResponse.ID, err
+}
+
+// GetSendMetadata returns the metadata for a file or text sent with YeetFile
+// Send. Sent files don't require an account to download.
+func (c *Client) GetSendMetadata(
+	ctx context.Context,
+	id string,
+) (shared.DownloadResponse, error) {
+	var downloadResponse shared.DownloadResponse
+	u := c.url(endpoints.DownloadSendFileMetadata, id)
+	err := c.DoJSON(ctx, http.MethodGet, u, nil, &downloadResponse)
+	return downloadResponse, err
+}
+
+// DownloadSendChunk downloads a chunk of an encrypted file sent with YeetFile
+// Send, starting from chunk 1
+func (c *Client) DownloadSendChunk(
+	ctx context.Context,
+	id string,
+	chunk int,
+) ([]byte, error) {
+	u := c.url(endpoints.DownloadSendFileData, id, strconv.Itoa(chunk))
+	return c.Do(ctx, http.MethodGet, u, nil)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"yeetfile/shared"
+	"yeetfile/shared/endpoints"
+)
+
+// ShareType is the type of vault item being shared
+type ShareType int
+
+const (
+	ShareFile ShareType = iota
+	ShareFolder
+)
+
+func (t ShareType) endpoint() endpoints.Endpoint {
+	if t == ShareFolder {
+		return endpoints.ShareFolder
+	}
+
+	return endpoints.ShareFile
+}
+
+// GetUserPubKey returns the public key of a user, which is used to encrypt an
+// item's key before sharing the item with them. The identifier is the user's
+// email or account ID.
+func (c *Client) GetUserPubKey(
+	ctx context.Context,
+	identifier string,
+) (shared.PubKeyResponse, error) {
+	var pubKey shared.PubKeyResponse
+	u := c.url(endpoints.PubKey) + "?user=" + url.QueryEscape(identifier)
+	err := c.DoJSON(ctx, http.MethodGet, u, nil, &pubKey)
+	return pubKey, err
+}
+
+// ShareItem shares a vault file or folder with another user. The item appears
+// in the recipient's root folder.
+func (c *Client) ShareItem(
+	ctx context.Context,
+	shareType ShareType,
+	id string,
+	request shared.ShareItemRequest,
+) (shared.ShareInfo, error) {
+	var shareInfo shared.ShareInfo
+	u := c.url(shareType.endpoint(), id)
+	err := c.DoJSON(ctx, http.MethodPost, u, request, &shareInfo)
+	return shareInfo, err
+}
+
+// GetShares returns the users that a vault file or folder is shared with
+func (c *Client) GetShares(
+	ctx context.Context,
+	shareType ShareType,
+	id string,
+) ([]shared.ShareInfo, error) {
+	var shares []shared.ShareInfo
+	err := c.DoJSON(ctx, http.MethodGet, c.url(shareType.endpoint(), id), nil, &shares)
+	return shares, err
+}
+
+// UpdateShare changes whether a user can modify a shared vault file or folder
+func (c *Client) UpdateShare(
+	ctx context.Context,
+	shareType ShareType,
+	id string,
+	share shared.ShareInfo,
+) error {
+	edit := shared.ShareEdit{
+		ID:        share.ID,
+		ItemID:    id,
+		CanModify: share.CanModify,
+	}
+
+	return c.DoJSON(ctx, http.MethodPut, c.url(shareType.endpoint(), id), edit, nil)
+}
+
+// RemoveShare stops sharing a vault file or folder with a user
+func (c *Client) RemoveShare(
+	ctx context.Context,
+	shareType ShareType,
+	id string,
+	share shared.ShareInfo,
+) error {
+	u := c.url(shareType.endpoint(), id) + "?id=" + url.QueryEscape(share.ID)
+	return c.DoJSON(ctx, http.MethodDelete, u, nil, nil)
+}
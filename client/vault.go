@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"yeetfile/shared"
+	"yeetfile/shared/endpoints"
+)
+
+// Vault is either the file vault or the password vault (YeetPass). Both use
+// the same folder structure, and password entries are stored as vault items
+// with PasswordData set.
+type Vault int
+
+const (
+	FileVault Vault = iota
+	PassVault
+)
+
+func (v Vault) folderEndpoint() endpoints.Endpoint {
+	if v == PassVault {
+		return endpoints.PassFolder
+	}
+
+	return endpoints.VaultFolder
+}
+
+// GetFolder returns the contents of a vault folder. The ID can be left empty
+// to fetch the user's root folder.
+func (c *Client) GetFolder(
+	ctx context.Context,
+	vault Vault,
+	id string,
+) (shared.VaultFolderResponse, error) {
+	var folder shared.VaultFolderResponse
+	u := c.url(vault.folderEndpoint(), id)
+	err := c.DoJSON(ctx, http.MethodGet, u, nil, &folder)
+	return folder, err
+}
+
+// CreateFolder creates a new folder in a vault
+func (c *Client) CreateFolder(
+	ctx context.Context,
+	vault Vault,
+	folder shared.NewVaultFolder,
+) (shared.NewFolderResponse, error) {
+	var folderResponse shared.NewFolderResponse
+	u := c.url(vault.folderEndpoint())
+	err := c.DoJSON(ctx, http.MethodPost, u, folder, &folderResponse)
+	return folderResponse, err
+}
+
+// ModifyFolder renames a vault folder
+func (c *Client) ModifyFolder(
+	ctx context.Context,
+	vault Vault,
+	id string,
+	mod shared.ModifyVaultItem,
+) error {
+	u := c.url(vault.folderEndpoint(), id)
+	return c.DoJSON(ctx, http.MethodPut, u, mod, nil)
+}
+
+// DeleteFolder deletes a vault folder and its contents. If the folder was
+// shared with the user, only the user's access to the folder is removed.
+func (c *Client) DeleteFolder(
+	ctx context.Context,
+	vault Vault,
+	id string,
+	isShared bool,
+) (shared.DeleteResponse, error) {
+	var deleteResponse shared.DeleteResponse
+	u := withShared(c.url(vault.folderEndpoint(), id), isShared)
+	err := c.DoJSON(ctx, http.MethodDelete, u, nil, &deleteResponse)
+	return deleteResponse, err
+}
+
+// GetFileInfo returns info about a vault file or password entry
+func (c *Client) GetFileInfo(ctx context.Context, id string) (shared.VaultItemInfo, error) {
+	var info shared.VaultItemInfo
+	err := c.DoJSON(ctx, http.MethodGet, c.url(endpoints.VaultFile, id), nil, &info)
+	return info, err
+}
+
+// ModifyFile renames a vault file, or updates a password entry
+func (c *Client) ModifyFile(
+	ctx context.Context,
+	id string,
+	mod shared.ModifyVaultItem,
+) error {
+	return c.DoJSON(ctx, http.MethodPut, c.url(endpoints.VaultFile, id), mod, nil)
+}
+
+// DeleteFile deletes a vault file or password entry. If the file was shared
+// with the user, only the user's access to the file is removed.
+func (c *Client) DeleteFile(
+	ctx context.Context,
+	id string,
+	isShared bool,
+) (shared.DeleteResponse, error) {
+	var deleteResponse shared.DeleteResponse
+	u := withShared(c.url(endpoints.VaultFile, id), isShared)
+	err := c.DoJSON(ctx, http.MethodDelete, u, nil, &deleteResponse)
+	return deleteResponse, err
+}
+
+// InitVaultFile starts a new vault upload. Password entries are uploaded in a
+// single step by setting PasswordData (with Chunks set to 1), while files are
+// uploaded afterward with UploadVaultChunk.
+func (c *Client) InitVaultFile(
+	ctx context.Context,
+	upload shared.VaultUpload,
+) (shared.MetadataUploadResponse, error) {
+	var metaResponse shared.MetadataUploadResponse
+	u := c.url(endpoints.UploadVaultFileMetadata)
+	err := c.DoJSON(ctx, http.MethodPost, u, upload, &metaResponse)
+	return metaResponse, err
+}
+
+// UploadVaultChunk uploads a chunk of encrypted file data, starting from chunk
+// 1. The response is empty until the final chunk is uploaded.
+func (c *Client) UploadVaultChunk(
+	ctx context.Context,
+	id string,
+	chunk int,
+	encData []byte,
+) (string, error) {
+	u := c.url(endpoints.UploadVaultFileData, id, strconv.Itoa(chunk))
+	body, err := c.Do(ctx, http.MethodPost, u, encData)
+	return string(body), err
+}
+
+// GetVaultItemMetadata starts downloading a vault file or password entry,
+// returning its metadata and the ID to use for downloading its chunks
+func (c *Client) GetVaultItemMetadata(
+	ctx context.Context,
+	id string,
+) (shared.VaultDownloadResponse, error) {
+	var metadata shared.VaultDownloadResponse
+	u := c.url(endpoints.DownloadVaultFileMetadata, id)
+	err := c.DoJSON(ctx, http.MethodGet, u, nil, &metadata)
+	return metadata, err
+}
+
+// DownloadVaultChunk downloads a chunk of encrypted file data, starting from
+// chunk 1. The ID is the download ID returned by GetVaultItemMetadata.
+func (c *Client) DownloadVaultChunk(
+	ctx context.Context,
+	id string,
+	chunk int,
+) ([]byte, error) {
+	u := c.url(endpoints.DownloadVaultFileData, id, strconv.Itoa(chunk))
+	return c.Do(ctx, http.MethodGet, u, nil)
+}
+
+// withShared adds the "shared" query param to a URL for items that were
+// shared with the user
+func withShared(u string, isShared bool) string {
+	if isShared {
+		return u + "?shared=true"
+	}
+
+	return u
+}
@@ -12,6 +12,7 @@ const (
 	JSSessionKey = "JS_SESSION_KEY"
 
 	CLIUserAgent                    = "yeetfile-cli"
+	RequestIDHeader                 = "X-Request-Id"
 	AuthSessionStore                = "auth"
 	Argon2Mem                uint32 = 64 // MB
 	Argon2Iter               uint32 = 2
@@ -31,4 +32,11 @@ const (
 	MaxSendAgeDays                  = 30 //days
 	MaxPassNoteLen                  = 500
 	RecoveryCodeLen                 = 8
+	APITokenPrefix                  = "yft_"
+
+	// API token scopes
+	ScopeVaultRead  = "vault:read"
+	ScopeVaultWrite = "vault:write"
+	ScopePassRead   = "pass:read"
+	ScopeSendCreate = "send:create"
 )
@@ -2,11 +2,16 @@ package endpoints
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+// Endpoint is a path on the YeetFile server. Segments wrapped in braces are
+// path parameters (i.e. "/api/vault/d/{id}").
 type Endpoint string
 
+var paramPattern = regexp.MustCompile(`{[^/]+}`)
+
 type HTMLEndpoints struct {
 	Account        string
 	Send           string
@@ -23,6 +28,7 @@ type HTMLEndpoints struct {
 	Info           string
 	Upgrade        string
 	Admin          string
+	SSOLogin       string
 }
 
 type BillingEndpoints struct {
@@ -39,44 +45,57 @@ var (
 	Logout           = Endpoint("/api/logout")
 	Account          = Endpoint("/api/account")
 	AccountUsage     = Endpoint("/api/account/usage")
+	AccountSessions  = Endpoint("/api/account/sessions")
+	AccountSession   = Endpoint("/api/account/sessions/{id}")
 	RecyclePaymentID = Endpoint("/api/account/recycle/payment_id")
 	Forgot           = Endpoint("/api/forgot")
 	Session          = Endpoint("/api/session")
 	TwoFactor        = Endpoint("/api/2fa")
+	WebAuthn         = Endpoint("/api/2fa/webauthn")
+	WebAuthnKey      = Endpoint("/api/2fa/webauthn/{id}")
+	APITokens        = Endpoint("/api/tokens")
+	APIToken         = Endpoint("/api/tokens/{id}")
 	VerifyAccount    = Endpoint("/api/verify/account")
 	VerifyEmail      = Endpoint("/api/verify/email")
-	ChangeEmail      = Endpoint("/api/change/email/*")
+	ChangeEmail      = Endpoint("/api/change/email/{id}")
 	ChangePassword   = Endpoint("/api/change/password")
 	ChangeHint       = Endpoint("/api/change/hint")
 	ServerInfo       = Endpoint("/api/info")
+	OpenAPI          = Endpoint("/api/openapi.json")
+	SSOAccount       = Endpoint("/api/sso/account")
 
-	AdminUserActions = Endpoint("/api/admin/user/*")
-	AdminFileActions = Endpoint("/api/admin/files/*")
+	AdminUserActions  = Endpoint("/api/admin/user/{id}")
+	AdminFileActions  = Endpoint("/api/admin/files/{id}")
+	AdminStorageScrub = Endpoint("/api/admin/storage/scrub")
 
-	Up = Endpoint("/up")
+	Up    = Endpoint("/up")
+	Live  = Endpoint("/up/live")
+	Ready = Endpoint("/up/ready")
 
 	PassRoot     = Endpoint("/api/pass")
-	PassFolder   = Endpoint("/api/pass/folder/*")
-	PassEntry    = Endpoint("/api/pass/entry/*")
+	PassFolder   = Endpoint("/api/pass/folder/{id}")
+	PassEntry    = Endpoint("/api/pass/entry/{id}")
 	NewPassEntry = Endpoint("/api/pass/u")
 
 	VaultRoot   = Endpoint("/api/vault")
-	VaultFolder = Endpoint("/api/vault/folder/*")
-	VaultFile   = Endpoint("/api/vault/file/*")
+	VaultFolder = Endpoint("/api/vault/folder/{id}")
+	VaultFile   = Endpoint("/api/vault/file/{id}")
 
 	UploadVaultFileMetadata   = Endpoint("/api/vault/u")
-	UploadVaultFileData       = Endpoint("/api/vault/u/*/*")
-	DownloadVaultFileMetadata = Endpoint("/api/vault/d/*")
-	DownloadVaultFileData     = Endpoint("/api/vault/d/*/*")
+	UploadVaultFileData       = Endpoint("/api/vault/u/{id}/{chunk}")
+	DownloadVaultFileMetadata = Endpoint("/api/vault/d/{id}")
+	DownloadVaultFileData     = Endpoint("/api/vault/d/{id}/{chunk}")
+	UploadVaultFilePresign    = Endpoint("/api/vault/u/presign/{id}/{chunk}")
+	DownloadVaultFilePresign  = Endpoint("/api/vault/d/presign/{id}/{chunk}")
 
 	UploadSendFileMetadata   = Endpoint("/api/send/u")
-	UploadSendFileData       = Endpoint("/api/send/u/*/*")
+	UploadSendFileData       = Endpoint("/api/send/u/{id}/{chunk}")
 	UploadSendText           = Endpoint("/api/send/plaintext")
-	DownloadSendFileMetadata = Endpoint("/api/send/d/*")
-	DownloadSendFileData     = Endpoint("/api/send/d/*/*")
+	DownloadSendFileMetadata = Endpoint("/api/send/d/{id}")
+	DownloadSendFileData     = Endpoint("/api/send/d/{id}/{chunk}")
 
-	ShareFile    = Endpoint("/api/share/file/*")
-	ShareFolder  = Endpoint("/api/share/folder/*")
+	ShareFile    = Endpoint("/api/share/file/{id}")
+	ShareFolder  = Endpoint("/api/share/folder/{id}")
 	PubKey       = Endpoint("/api/pubkey")
 	ProtectedKey = Endpoint("/api/protectedkey")
 
@@ -85,23 +104,26 @@ var (
 	BTCPayWebhook  = Endpoint("/btcpay/webhook")
 	BTCPayCheckout = Endpoint("/btcpay/checkout")
 
-	StaticFile = Endpoint("/static/*/*")
+	SSOLogin    = Endpoint("/sso/login")
+	SSOCallback = Endpoint("/sso/callback")
+
+	StaticFile = Endpoint("/static/{dir}/{file}")
 
 	HTMLAccount          = Endpoint("/account")
 	HTMLHome             = Endpoint("/")
 	HTMLSend             = Endpoint("/send")
-	HTMLSendDownload     = Endpoint("/send/*")
+	HTMLSendDownload     = Endpoint("/send/{id}")
 	HTMLPass             = Endpoint("/pass")
-	HTMLPassFolder       = Endpoint("/pass/*")
-	HTMLPassEntry        = Endpoint("/pass/*/entry/*")
+	HTMLPassFolder       = Endpoint("/pass/{folder}")
+	HTMLPassEntry        = Endpoint("/pass/{folder}/entry/{id}")
 	HTMLPassIndex        = Endpoint("/pass/index")
 	HTMLVault            = Endpoint("/vault")
-	HTMLVaultFolder      = Endpoint("/vault/*")
-	HTMLVaultFile        = Endpoint("/vault/*/file/*")
+	HTMLVaultFolder      = Endpoint("/vault/{folder}")
+	HTMLVaultFile        = Endpoint("/vault/{folder}/file/{id}")
 	HTMLLogin            = Endpoint("/login")
 	HTMLSignup           = Endpoint("/signup")
 	HTMLForgot           = Endpoint("/forgot")
-	HTMLChangeEmail      = Endpoint("/change/email/*")
+	HTMLChangeEmail      = Endpoint("/change/email/{id}")
 	HTMLChangePassword   = Endpoint("/change/password")
 	HTMLChangeHint       = Endpoint("/change/hint")
 	HTMLVerifyEmail      = Endpoint("/verify/email")
@@ -110,6 +132,7 @@ var (
 	HTMLCheckoutComplete = Endpoint("/checkout/complete")
 	HTMLUpgrade          = Endpoint("/upgrade")
 	HTMLAdmin            = Endpoint("/admin")
+	HTMLSSO              = Endpoint("/sso")
 )
 
 var JSVarNameMap = map[Endpoint]string{
@@ -120,17 +143,25 @@ var JSVarNameMap = map[Endpoint]string{
 	Session:          "Session",
 	Account:          "Account",
 	AccountUsage:     "AccountUsage",
+	AccountSessions:  "AccountSessions",
+	AccountSession:   "AccountSession",
 	RecyclePaymentID: "RecyclePaymentID",
 	TwoFactor:        "TwoFactor",
+	WebAuthn:         "WebAuthn",
+	WebAuthnKey:      "WebAuthnKey",
+	APITokens:        "APITokens",
+	APIToken:         "APIToken",
 	VerifyAccount:    "VerifyAccount",
 	VerifyEmail:      "VerifyEmail",
 	ChangeEmail:      "ChangeEmail",
 	ChangePassword:   "ChangePassword",
 	ChangeHint:       "ChangeHint",
 	ServerInfo:       "ServerInfo",
+	SSOAccount:       "SSOAccount",
 
-	AdminUserActions: "AdminUserActions",
-	AdminFileActions: "AdminFileActions",
+	AdminUserActions:  "AdminUserActions",
+	AdminFileActions:  "AdminFileActions",
+	AdminStorageScrub: "AdminStorageScrub",
 
 	PassRoot:     "PassRoot",
 	PassFolder:   "PassFolder",
@@ -145,6 +176,8 @@ var JSVarNameMap = map[Endpoint]string{
 	UploadVaultFileData:       "UploadVaultFileData",
 	DownloadVaultFileMetadata: "DownloadVaultFileMetadata",
 	DownloadVaultFileData:     "DownloadVaultFileData",
+	UploadVaultFilePresign:    "UploadVaultFilePresign",
+	DownloadVaultFilePresign:  "DownloadVaultFilePresign",
 
 	UploadSendFileMetadata:   "UploadSendFileMetadata",
 	UploadSendFileData:       "UploadSendFileData",
@@ -161,6 +194,8 @@ var JSVarNameMap = map[Endpoint]string{
 
 	StripeCheckout: "StripeCheckout",
 
+	SSOLogin: "SSOLogin",
+
 	HTMLHome:             "HTMLHome",
 	HTMLAccount:          "HTMLAccount",
 	HTMLSend:             "HTMLSend",
@@ -181,16 +216,22 @@ var JSVarNameMap = map[Endpoint]string{
 	HTMLServerInfo:       "HTMLServerInfo",
 	HTMLCheckoutComplete: "HTMLCheckoutComplete",
 	HTMLAdmin:            "HTMLAdmin",
+	HTMLSSO:              "HTMLSSO",
 }
 
+// Format returns the full URL for an endpoint on the provided server, replacing
+// each path parameter (i.e. "{id}") with the provided args in order
 func (e Endpoint) Format(server string, args ...string) string {
-	strEndpoint := string(e)
-	for _, arg := range args {
-		strEndpoint = strings.Replace(strEndpoint, "*", arg, 1)
-	}
+	strEndpoint := paramPattern.ReplaceAllStringFunc(string(e), func(string) string {
+		if len(args) == 0 {
+			// Remove remaining parameters
+			return ""
+		}
 
-	// Remove remaining wildcards
-	strEndpoint = strings.ReplaceAll(strEndpoint, "*", "")
+		arg := args[0]
+		args = args[1:]
+		return arg
+	})
 
 	server = strings.TrimSuffix(server, "/")
 	strEndpoint = strings.TrimPrefix(strEndpoint, "/")
@@ -215,6 +256,7 @@ func init() {
 		Info:           string(HTMLServerInfo),
 		Upgrade:        string(HTMLUpgrade),
 		Admin:          string(HTMLAdmin),
+		SSOLogin:       string(SSOLogin),
 	}
 
 	BillingPageEndpoints = BillingEndpoints{
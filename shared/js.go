@@ -39,10 +39,11 @@ const endpointsTailJS = `
     static format(endpoint: Endpoint, ...args: string[]): string {
         let path = endpoint.path;
         for (let arg of args) {
-            path = path.replace("*", arg);
+            path = path.replace(/{[^/]+}/, arg);
         }
 
-        return path;
+        // Remove remaining parameters
+        return path.replace(/{[^/]+}/g, "");
     }
 }
 `
@@ -0,0 +1,403 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+const (
+	OpenAPIVersion = "3.0.3"
+	Title          = "YeetFile API"
+	FileName       = "openapi.json"
+
+	sessionScheme = "session"
+	tokenScheme   = "token"
+)
+
+// Auth is the type of authentication required by an API operation
+type Auth int
+
+const (
+	NoAuth Auth = iota
+	SessionAuth
+	AdminAuth
+
+	// LockdownAuth requires a session only if the server is locked down
+	LockdownAuth
+)
+
+// Binary and Text are used in place of a struct for operations that send or
+// receive raw file data or plain text instead of JSON
+var (
+	Binary = binaryBody{}
+	Text   = textBody{}
+)
+
+type binaryBody struct{}
+type textBody struct{}
+
+// QueryParam is a URL query parameter accepted by an operation
+type QueryParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Operation describes a single method on an API endpoint. Request and Response
+// should be an empty value of the struct sent in the body (i.e.
+// shared.Login{}), Binary, Text, or nil if the operation doesn't have a body.
+type Operation struct {
+	Summary  string
+	Auth     Auth
+	Scopes   []string // API token scopes accepted in place of a session
+	Limited  bool     // Rate limited by IP address or session
+	Query    []QueryParam
+	Request  any
+	Response any
+}
+
+// Route is a single method and path handled by the server
+type Route struct {
+	Method string
+	Path   endpoints.Endpoint
+}
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem contains the operations for a path, keyed by lowercase method
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// pathParamSchemas contains the schemas for path parameters that aren't strings
+var pathParamSchemas = map[string]*Schema{
+	"chunk": {Type: "integer"},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Routes returns every documented API route, sorted by path and method
+func Routes() []Route {
+	var routes []Route
+	for path, methods := range Operations {
+		for method := range methods {
+			routes = append(routes, Route{Method: method, Path: path})
+		}
+	}
+
+	SortRoutes(routes)
+	return routes
+}
+
+// SortRoutes sorts routes by path and method
+func SortRoutes(routes []Route) {
+	slices.SortFunc(routes, func(a, b Route) int {
+		if a.Path != b.Path {
+			return strings.Compare(string(a.Path), string(b.Path))
+		}
+
+		return strings.Compare(a.Method, b.Method)
+	})
+}
+
+// Generate returns an OpenAPI document describing the provided routes, using
+// the documentation for each route in Operations. Routes without documentation
+// are still included, but without any details about the operation.
+func Generate(routes []Route) Document {
+	doc := Document{
+		OpenAPI: OpenAPIVersion,
+		Info:    Info{Title: Title, Version: constants.VERSION},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: make(map[string]*Schema),
+			SecuritySchemes: map[string]SecurityScheme{
+				sessionScheme: {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        constants.AuthSessionStore,
+					Description: "Session cookie set after logging in",
+				},
+				tokenScheme: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "Personal API token, limited to the listed scopes",
+				},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		path := string(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(PathItem)
+		}
+
+		op := Operations[route.Path][route.Method]
+		doc.Paths[path][strings.ToLower(route.Method)] = doc.operation(route, op)
+	}
+
+	return doc
+}
+
+// JSON returns the indented JSON representation of the document
+func (doc Document) JSON() ([]byte, error) {
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+func (doc Document) operation(route Route, op Operation) *OperationObject {
+	obj := &OperationObject{
+		Summary:   op.Summary,
+		Responses: make(map[string]Response),
+	}
+
+	if name, ok := endpoints.JSVarNameMap[route.Path]; ok {
+		obj.OperationID = strings.ToLower(route.Method) + name
+	}
+
+	for _, segment := range strings.Split(string(route.Path), "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+
+		name := strings.Trim(segment, "{}.")
+		schema, ok := pathParamSchemas[name]
+		if !ok {
+			schema = &Schema{Type: "string"}
+		}
+
+		obj.Parameters = append(obj.Parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+
+	for _, param := range op.Query {
+		obj.Parameters = append(obj.Parameters, Parameter{
+			Name:        param.Name,
+			In:          "query",
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	if op.Request != nil {
+		obj.RequestBody = &RequestBody{
+			Required: true,
+			Content:  doc.content(op.Request),
+		}
+	}
+
+	obj.Responses["200"] = Response{
+		Description: http.StatusText(http.StatusOK),
+		Content:     doc.content(op.Response),
+	}
+
+	switch op.Auth {
+	case SessionAuth:
+		obj.Security = []map[string][]string{{sessionScheme: {}}}
+	case AdminAuth:
+		obj.Security = []map[string][]string{{sessionScheme: {}}}
+		obj.Description = "Requires an admin account."
+	case LockdownAuth:
+		obj.Security = []map[string][]string{{}, {sessionScheme: {}}}
+		obj.Description = "Requires a session if the server is locked down."
+	}
+
+	if len(op.Scopes) > 0 {
+		obj.Security = append(obj.Security, map[string][]string{
+			tokenScheme: op.Scopes,
+		})
+	}
+
+	if op.Auth != NoAuth {
+		obj.Responses["401"] = Response{
+			Description: http.StatusText(http.StatusUnauthorized),
+		}
+	}
+
+	if op.Limited {
+		obj.Responses["429"] = Response{
+			Description: http.StatusText(http.StatusTooManyRequests),
+		}
+	}
+
+	return obj
+}
+
+// content returns the media type and schema for a request or response body
+func (doc Document) content(body any) map[string]MediaType {
+	switch body.(type) {
+	case nil:
+		return nil
+	case binaryBody:
+		return map[string]MediaType{
+			"application/octet-stream": {Schema: &Schema{Type: "string", Format: "binary"}},
+		}
+	case textBody:
+		return map[string]MediaType{
+			"text/plain": {Schema: &Schema{Type: "string"}},
+		}
+	}
+
+	return map[string]MediaType{
+		"application/json": {Schema: doc.schema(reflect.TypeOf(body))},
+	}
+}
+
+// schema returns the JSON schema for a type, matching how the type is encoded
+// by encoding/json. Named structs are added to the document components and
+// referenced by name.
+func (doc Document) schema(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: "string", Format: "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := doc.schema(t.Elem())
+		if len(schema.Ref) > 0 {
+			// Siblings of $ref are ignored, so nullable can't be set
+			return schema
+		}
+
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: doc.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: doc.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return doc.structSchema(t)
+		}
+
+		ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+		if _, ok := doc.Components.Schemas[t.Name()]; !ok {
+			// Reserve the name first in case the struct references itself
+			doc.Components.Schemas[t.Name()] = nil
+			doc.Components.Schemas[t.Name()] = doc.structSchema(t)
+		}
+
+		return ref
+	}
+
+	// Interfaces and anything else without a fixed encoding can be any value
+	return &Schema{}
+}
+
+func (doc Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && len(opts) == 0 {
+			continue
+		} else if len(name) == 0 {
+			name = field.Name
+		}
+
+		schema.Properties[name] = doc.schema(field.Type)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,52 @@
+package openapi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+// TestGeneratedFile ensures openapi.json is regenerated after changes to the
+// documented operations or shared structs
+func TestGeneratedFile(t *testing.T) {
+	expected, err := Generate(Routes()).JSON()
+	assert.Nil(t, err)
+
+	committed, err := os.ReadFile(FileName)
+	assert.Nil(t, err)
+	assert.Equal(t, string(expected), string(committed),
+		"openapi.json is out of date, run 'make openapi' to regenerate it")
+}
+
+func TestGenerate(t *testing.T) {
+	doc := Generate([]Route{
+		{Method: "GET", Path: endpoints.DownloadVaultFileData},
+		{Method: "POST", Path: endpoints.Login},
+	})
+
+	chunk := doc.Paths[string(endpoints.DownloadVaultFileData)]["get"]
+	assert.Len(t, chunk.Parameters, 2)
+	assert.Equal(t, "integer", chunk.Parameters[1].Schema.Type)
+	assert.Contains(t, chunk.Responses, "401")
+	assert.Contains(t, chunk.Responses["200"].Content, "application/octet-stream")
+	assert.Contains(t, chunk.Security, map[string][]string{
+		tokenScheme: {constants.ScopeVaultRead},
+	})
+
+	login := doc.Paths[string(endpoints.Login)]["post"]
+	assert.Empty(t, login.Security)
+	assert.Contains(t, login.Responses, "429")
+
+	schema := login.RequestBody.Content["application/json"].Schema
+	assert.Equal(t, "#/components/schemas/Login", schema.Ref)
+
+	loginSchema := doc.Components.Schemas["Login"]
+	assert.NotNil(t, loginSchema)
+	assert.Equal(t, "byte", loginSchema.Properties["loginKeyHash"].Format)
+	assert.Contains(t, doc.Components.Schemas, "LoginResponse")
+
+	// Structs only referenced by undocumented routes aren't included
+	assert.NotContains(t, doc.Components.Schemas, "VaultFolderResponse")
+}
@@ -0,0 +1,517 @@
+package openapi
+
+import (
+	"net/http"
+	"yeetfile/shared"
+	"yeetfile/shared/constants"
+	"yeetfile/shared/endpoints"
+)
+
+var sharedParam = QueryParam{
+	Name:        "shared",
+	Description: "Set if the item was shared with the current user",
+}
+
+// API token scopes accepted by each operation, which must match the scopes
+// checked by the server (see backend/server/tokens.go)
+var (
+	vaultRead  = []string{constants.ScopeVaultRead}
+	vaultWrite = []string{constants.ScopeVaultWrite}
+	passRead   = []string{constants.ScopePassRead}
+	sendCreate = []string{constants.ScopeSendCreate}
+	keyScopes  = []string{
+		constants.ScopeVaultRead,
+		constants.ScopeVaultWrite,
+		constants.ScopePassRead,
+	}
+)
+
+// Operations documents every method of each API endpoint. This must be
+// updated when API routes are added or changed on the server, followed by
+// regenerating openapi.json (see utils/generate_openapi.go).
+var Operations = map[endpoints.Endpoint]map[string]Operation{
+	// Auth (signup, login/logout, account mgmt, etc)
+	endpoints.Signup: {
+		http.MethodPost: {
+			Summary:  "Create a new account",
+			Limited:  true,
+			Request:  shared.Signup{},
+			Response: shared.SignupResponse{},
+		},
+	},
+	endpoints.Login: {
+		http.MethodPost: {
+			Summary:  "Log in and start a new session",
+			Limited:  true,
+			Request:  shared.Login{},
+			Response: shared.LoginResponse{},
+		},
+	},
+	endpoints.SSOAccount: {
+		http.MethodGet: {
+			Summary:  "Get the account for the current single sign-on login",
+			Limited:  true,
+			Response: shared.SSOAccount{},
+		},
+		http.MethodPost: {
+			Summary: "Create an account after logging in with single sign-on",
+			Limited: true,
+			Request: shared.Signup{},
+		},
+	},
+	endpoints.Logout: {
+		http.MethodGet: {
+			Summary: "End the current session",
+		},
+	},
+	endpoints.Session: {
+		http.MethodGet: {
+			Summary: "Check if the current session is valid",
+		},
+	},
+	endpoints.Account: {
+		http.MethodGet: {
+			Summary:  "Get account info",
+			Auth:     SessionAuth,
+			Response: shared.AccountResponse{},
+		},
+		http.MethodPut: {
+			Summary: "Update the current account (no-op, kept for compatibility)",
+			Auth:    SessionAuth,
+		},
+		http.MethodDelete: {
+			Summary: "Delete the current account",
+			Auth:    SessionAuth,
+			Request: shared.DeleteAccount{},
+		},
+	},
+	endpoints.AccountUsage: {
+		http.MethodGet: {
+			Summary:  "Get storage and send usage",
+			Auth:     SessionAuth,
+			Response: shared.UsageResponse{},
+		},
+	},
+	endpoints.AccountSessions: {
+		http.MethodGet: {
+			Summary:  "Get the current user's logged in sessions",
+			Auth:     SessionAuth,
+			Response: []shared.ActiveSession{},
+		},
+	},
+	endpoints.AccountSession: {
+		http.MethodDelete: {
+			Summary: "Log out of one of the current user's sessions",
+			Auth:    SessionAuth,
+		},
+	},
+	endpoints.RecyclePaymentID: {
+		http.MethodPut: {
+			Summary: "Replace the account payment ID with a new one",
+			Auth:    SessionAuth,
+		},
+	},
+	endpoints.Forgot: {
+		http.MethodPost: {
+			Summary: "Request a password hint email",
+			Limited: true,
+			Request: shared.ForgotPassword{},
+		},
+	},
+	endpoints.TwoFactor: {
+		http.MethodGet: {
+			Summary:  "Generate a new TOTP secret",
+			Auth:     SessionAuth,
+			Response: shared.NewTOTP{},
+		},
+		http.MethodPost: {
+			Summary:  "Enable two-factor authentication",
+			Auth:     SessionAuth,
+			Request:  shared.SetTOTP{},
+			Response: shared.SetTOTPResponse{},
+		},
+		http.MethodDelete: {
+			Summary: "Disable two-factor authentication",
+			Auth:    SessionAuth,
+			Query: []QueryParam{{
+				Name:        "code",
+				Description: "A current TOTP code or recovery code",
+				Required:    true,
+			}},
+		},
+	},
+	endpoints.WebAuthn: {
+		http.MethodGet: {
+			Summary:  "Get options for registering a security key",
+			Auth:     SessionAuth,
+			Response: shared.WebAuthnRegistrationOptions{},
+		},
+		http.MethodPost: {
+			Summary:  "Register a security key as a second factor",
+			Auth:     SessionAuth,
+			Request:  shared.NewWebAuthnKey{},
+			Response: shared.NewWebAuthnKeyResponse{},
+		},
+	},
+	endpoints.WebAuthnKey: {
+		http.MethodPut: {
+			Summary: "Rename a security key",
+			Auth:    SessionAuth,
+			Request: shared.ModifyWebAuthnKey{},
+		},
+		http.MethodDelete: {
+			Summary: "Revoke a security key",
+			Auth:    SessionAuth,
+		},
+	},
+	endpoints.APITokens: {
+		http.MethodGet: {
+			Summary:  "Get the current user's API tokens",
+			Auth:     SessionAuth,
+			Response: []shared.APIToken{},
+		},
+		http.MethodPost: {
+			Summary:  "Create a new API token",
+			Auth:     SessionAuth,
+			Request:  shared.NewAPIToken{},
+			Response: shared.NewAPITokenResponse{},
+		},
+	},
+	endpoints.APIToken: {
+		http.MethodDelete: {
+			Summary: "Revoke an API token",
+			Auth:    SessionAuth,
+		},
+	},
+	endpoints.VerifyAccount: {
+		http.MethodPost: {
+			Summary: "Verify a new account",
+			Limited: true,
+			Request: shared.VerifyAccount{},
+		},
+	},
+	endpoints.VerifyEmail: {
+		http.MethodPost: {
+			Summary: "Verify an email address",
+			Request: shared.VerifyEmail{},
+		},
+	},
+	endpoints.ChangeEmail: {
+		http.MethodPost: {
+			Summary:  "Start changing the account email",
+			Auth:     SessionAuth,
+			Response: shared.StartEmailChangeResponse{},
+		},
+		http.MethodPut: {
+			Summary: "Finish changing the account email",
+			Auth:    SessionAuth,
+			Request: shared.ChangeEmail{},
+		},
+	},
+	endpoints.ChangePassword: {
+		http.MethodPut: {
+			Summary: "Change the account password",
+			Auth:    SessionAuth,
+			Request: shared.ChangePassword{},
+		},
+	},
+	endpoints.ChangeHint: {
+		http.MethodPost: {
+			Summary: "Change the account password hint",
+			Auth:    SessionAuth,
+			Request: shared.ChangePasswordHint{},
+		},
+	},
+	endpoints.PubKey: {
+		http.MethodGet: {
+			Summary: "Get the public key of a user",
+			Auth:    SessionAuth,
+			Limited: true,
+			Query: []QueryParam{{
+				Name:        "user",
+				Description: "The email or account ID of the user",
+				Required:    true,
+			}},
+			Response: shared.PubKeyResponse{},
+		},
+	},
+	endpoints.ProtectedKey: {
+		http.MethodGet: {
+			Summary:  "Get the current user's encrypted private key",
+			Auth:     SessionAuth,
+			Scopes:   keyScopes,
+			Response: shared.ProtectedKeyResponse{},
+		},
+	},
+	endpoints.ServerInfo: {
+		http.MethodGet: {
+			Summary:  "Get the server configuration and available upgrades",
+			Response: shared.ServerInfo{},
+		},
+	},
+	endpoints.OpenAPI: {
+		http.MethodGet: {
+			Summary: "Get the OpenAPI document for the server",
+		},
+	},
+
+	// Admin
+	endpoints.AdminUserActions: {
+		http.MethodGet: {
+			Summary:  "Get a user and their files",
+			Auth:     AdminAuth,
+			Response: shared.AdminUserInfoResponse{},
+		},
+		http.MethodDelete: {
+			Summary: "Delete a user",
+			Auth:    AdminAuth,
+		},
+	},
+	endpoints.AdminFileActions: {
+		http.MethodGet: {
+			Summary:  "Get file info",
+			Auth:     AdminAuth,
+			Response: shared.AdminFileInfoResponse{},
+		},
+		http.MethodDelete: {
+			Summary: "Delete a file",
+			Auth:    AdminAuth,
+		},
+	},
+	endpoints.AdminStorageScrub: {
+		http.MethodGet: {
+			Summary:  "Get files that failed the storage scrub",
+			Auth:     AdminAuth,
+			Response: []shared.AdminScrubResult{},
+		},
+	},
+
+	// YeetFile Send
+	endpoints.UploadSendFileMetadata: {
+		http.MethodPost: {
+			Summary:  "Start a new Send file upload",
+			Auth:     SessionAuth,
+			Scopes:   sendCreate,
+			Request:  shared.UploadMetadata{},
+			Response: shared.MetadataUploadResponse{},
+		},
+	},
+	endpoints.UploadSendFileData: {
+		http.MethodPost: {
+			Summary:  "Upload an encrypted chunk of a Send file",
+			Auth:     SessionAuth,
+			Scopes:   sendCreate,
+			Request:  Binary,
+			Response: Text,
+		},
+	},
+	endpoints.UploadSendText: {
+		http.MethodPost: {
+			Summary:  "Upload encrypted text to Send",
+			Auth:     LockdownAuth,
+			Scopes:   sendCreate,
+			Limited:  true,
+			Request:  shared.PlaintextUpload{},
+			Response: shared.MetadataUploadResponse{},
+		},
+	},
+	endpoints.DownloadSendFileMetadata: {
+		http.MethodGet: {
+			Summary:  "Get the metadata of a Send file",
+			Response: shared.DownloadResponse{},
+		},
+	},
+	endpoints.DownloadSendFileData: {
+		http.MethodGet: {
+			Summary:  "Download an encrypted chunk of a Send file",
+			Response: Binary,
+		},
+	},
+
+	// YeetFile Vault
+	endpoints.VaultFolder: {
+		http.MethodGet: {
+			Summary:  "Get the contents of a vault folder",
+			Auth:     SessionAuth,
+			Scopes:   vaultRead,
+			Response: shared.VaultFolderResponse{},
+		},
+		http.MethodPost: {
+			Summary:  "Create a vault folder",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Request:  shared.NewVaultFolder{},
+			Response: shared.NewFolderResponse{},
+		},
+		http.MethodPut: {
+			Summary: "Rename a vault folder",
+			Auth:    SessionAuth,
+			Scopes:  vaultWrite,
+			Query:   []QueryParam{sharedParam},
+			Request: shared.ModifyVaultItem{},
+		},
+		http.MethodDelete: {
+			Summary:  "Delete a vault folder",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Query:    []QueryParam{sharedParam},
+			Response: shared.DeleteResponse{},
+		},
+	},
+	endpoints.VaultFile: {
+		http.MethodGet: {
+			Summary:  "Get vault file info",
+			Auth:     SessionAuth,
+			Scopes:   vaultRead,
+			Response: shared.VaultItemInfo{},
+		},
+		http.MethodPut: {
+			Summary: "Rename a vault file",
+			Auth:    SessionAuth,
+			Scopes:  vaultWrite,
+			Query:   []QueryParam{sharedParam},
+			Request: shared.ModifyVaultItem{},
+		},
+		http.MethodDelete: {
+			Summary:  "Delete a vault file",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Query:    []QueryParam{sharedParam},
+			Response: shared.DeleteResponse{},
+		},
+	},
+	endpoints.UploadVaultFileMetadata: {
+		http.MethodPost: {
+			Summary:  "Start a new vault file upload",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Request:  shared.VaultUpload{},
+			Response: shared.MetadataUploadResponse{},
+		},
+	},
+	endpoints.UploadVaultFileData: {
+		http.MethodPost: {
+			Summary:  "Upload an encrypted chunk of a vault file",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Request:  Binary,
+			Response: Text,
+		},
+	},
+	endpoints.DownloadVaultFileMetadata: {
+		http.MethodGet: {
+			Summary:  "Start downloading a vault file",
+			Auth:     SessionAuth,
+			Scopes:   vaultRead,
+			Limited:  true,
+			Response: shared.VaultDownloadResponse{},
+		},
+	},
+	endpoints.DownloadVaultFileData: {
+		http.MethodGet: {
+			Summary:  "Download an encrypted chunk of a vault file",
+			Auth:     SessionAuth,
+			Scopes:   vaultRead,
+			Response: Binary,
+		},
+	},
+	endpoints.UploadVaultFilePresign: {
+		http.MethodPost: {
+			Summary:  "Get a presigned request for uploading a chunk",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Request:  shared.PresignedChunkRequest{},
+			Response: shared.PresignedChunk{},
+		},
+		http.MethodPut: {
+			Summary:  "Confirm a chunk uploaded with a presigned request",
+			Auth:     SessionAuth,
+			Scopes:   vaultWrite,
+			Request:  shared.PresignedChunkResult{},
+			Response: Text,
+		},
+	},
+	endpoints.DownloadVaultFilePresign: {
+		http.MethodGet: {
+			Summary:  "Get a presigned request for downloading a chunk",
+			Auth:     SessionAuth,
+			Scopes:   vaultRead,
+			Response: shared.PresignedChunk{},
+		},
+	},
+	endpoints.ShareFile:   shareOperations("file"),
+	endpoints.ShareFolder: shareOperations("folder"),
+
+	// YeetFile Pass (YeetPass)
+	endpoints.PassFolder: {
+		http.MethodGet: {
+			Summary:  "Get the contents of a password folder",
+			Auth:     SessionAuth,
+			Scopes:   passRead,
+			Response: shared.VaultFolderResponse{},
+		},
+		http.MethodPost: {
+			Summary:  "Create a password folder",
+			Auth:     SessionAuth,
+			Request:  shared.NewVaultFolder{},
+			Response: shared.NewFolderResponse{},
+		},
+		http.MethodPut: {
+			Summary: "Rename a password folder",
+			Auth:    SessionAuth,
+			Query:   []QueryParam{sharedParam},
+			Request: shared.ModifyVaultItem{},
+		},
+		http.MethodDelete: {
+			Summary:  "Delete a password folder",
+			Auth:     SessionAuth,
+			Query:    []QueryParam{sharedParam},
+			Response: shared.DeleteResponse{},
+		},
+	},
+	endpoints.PassEntry: {
+		http.MethodPost: {
+			Summary:  "Create a password entry",
+			Auth:     SessionAuth,
+			Request:  shared.VaultUpload{},
+			Response: shared.MetadataUploadResponse{},
+		},
+		http.MethodDelete: {
+			Summary:  "Delete a password entry",
+			Auth:     SessionAuth,
+			Query:    []QueryParam{sharedParam},
+			Response: shared.DeleteResponse{},
+		},
+	},
+}
+
+// shareOperations returns the operations for sharing a vault file or folder
+func shareOperations(itemType string) map[string]Operation {
+	return map[string]Operation{
+		http.MethodGet: {
+			Summary:  "Get the users a " + itemType + " is shared with",
+			Auth:     SessionAuth,
+			Response: []shared.ShareInfo{},
+		},
+		http.MethodPost: {
+			Summary:  "Share a " + itemType + " with another user",
+			Auth:     SessionAuth,
+			Request:  shared.ShareItemRequest{},
+			Response: shared.ShareInfo{},
+		},
+		http.MethodPut: {
+			Summary: "Change the permissions of a shared " + itemType,
+			Auth:    SessionAuth,
+			Request: shared.ShareEdit{},
+		},
+		http.MethodDelete: {
+			Summary: "Stop sharing a " + itemType + " with a user",
+			Auth:    SessionAuth,
+			Query: []QueryParam{{
+				Name:        "id",
+				Description: "The ID of the share to remove",
+				Required:    true,
+			}},
+		},
+	}
+}
@@ -6,15 +6,16 @@ import (
 )
 
 type AccountResponse struct {
-	Email            string    `json:"email"`
-	PaymentID        string    `json:"paymentID"`
-	HasPasswordHint  bool      `json:"hasPasswordHint"`
-	Has2FA           bool      `json:"has2FA"`
-	StorageAvailable int64     `json:"storageAvailable"`
-	StorageUsed      int64     `json:"storageUsed"`
-	SendAvailable    int64     `json:"sendAvailable"`
-	SendUsed         int64     `json:"sendUsed"`
-	UpgradeExp       time.Time `json:"upgradeExp" ts_type:"Date" ts_transform:"new Date(__VALUE__)"`
+	Email            string        `json:"email"`
+	PaymentID        string        `json:"paymentID"`
+	HasPasswordHint  bool          `json:"hasPasswordHint"`
+	Has2FA           bool          `json:"has2FA"`
+	WebAuthnKeys     []WebAuthnKey `json:"webAuthnKeys"`
+	StorageAvailable int64         `json:"storageAvailable"`
+	StorageUsed      int64         `json:"storageUsed"`
+	SendAvailable    int64         `json:"sendAvailable"`
+	SendUsed         int64         `json:"sendUsed"`
+	UpgradeExp       time.Time     `json:"upgradeExp" ts_type:"Date" ts_transform:"new Date(__VALUE__)"`
 }
 
 type UsageResponse struct {
@@ -47,7 +48,8 @@ type ModifyVaultItem struct {
 }
 
 type MetadataUploadResponse struct {
-	ID string `json:"id"`
+	ID        string `json:"id"`
+	Presigned bool   `json:"presigned,omitempty"`
 }
 
 type NewFolderResponse struct {
@@ -122,6 +124,21 @@ type VaultDownloadResponse struct {
 	Chunks       int    `json:"chunks"`
 	ProtectedKey []byte `json:"protectedKey" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
 	PasswordData []byte `json:"passwordData" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	Presigned    bool   `json:"presigned,omitempty"`
+}
+
+type PresignedChunkRequest struct {
+	Size int64 `json:"size"`
+}
+
+type PresignedChunk struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+}
+
+type PresignedChunkResult struct {
+	ETag string `json:"etag"`
 }
 
 type PlaintextUpload struct {
@@ -170,6 +187,10 @@ type Login struct {
 	Identifier   string `json:"identifier"`
 	LoginKeyHash []byte `json:"loginKeyHash" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
 	Code         string `json:"code"`
+
+	// Set when responding to a WebAuthn challenge instead of providing a
+	// TOTP code
+	WebAuthn *WebAuthnAssertion `json:"webAuthn,omitempty"`
 }
 
 type LoginResponse struct {
@@ -177,6 +198,17 @@ type LoginResponse struct {
 	ProtectedKey []byte `json:"protectedKey" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
 }
 
+// SSOAccount is the account for a user who has logged in with single sign-on.
+// The vault password is never sent to the server, so the identifier is
+// returned for deriving the user's key from their vault password. If the user
+// doesn't have an account yet, NewAccount is set and the keys are empty.
+type SSOAccount struct {
+	Identifier   string `json:"identifier"`
+	NewAccount   bool   `json:"newAccount"`
+	PublicKey    []byte `json:"publicKey" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	ProtectedKey []byte `json:"protectedKey" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+}
+
 type SessionInfo struct {
 	Meter int `json:"meter"`
 }
@@ -287,6 +319,104 @@ type SetTOTPResponse struct {
 	RecoveryCodes [6]string `json:"recoveryCodes"`
 }
 
+// TwoFactorChallenge is returned when logging in to an account with 2FA
+// enabled, indicating which second factors can be used. WebAuthn is only set if
+// the user has registered a WebAuthn credential.
+type TwoFactorChallenge struct {
+	TOTP     bool                      `json:"totp"`
+	WebAuthn *WebAuthnAssertionOptions `json:"webAuthn,omitempty"`
+}
+
+type WebAuthnKey struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created" ts_type:"Date" ts_transform:"new Date(__VALUE__)"`
+	LastUsed time.Time `json:"lastUsed" ts_type:"Date" ts_transform:"new Date(__VALUE__)"`
+}
+
+// WebAuthnRegistrationOptions contains the values needed for
+// navigator.credentials.create
+type WebAuthnRegistrationOptions struct {
+	Challenge          []byte   `json:"challenge" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	RPID               string   `json:"rpId"`
+	RPName             string   `json:"rpName"`
+	UserID             []byte   `json:"userId" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	UserName           string   `json:"userName"`
+	Algorithms         []int    `json:"algorithms"`
+	ExcludeCredentials [][]byte `json:"excludeCredentials" ts_type:"Uint8Array[]" ts_transform:"__VALUE__ ? __VALUE__.map(base64ToArray) : []"`
+	Timeout            int      `json:"timeout"`
+}
+
+// WebAuthnAssertionOptions contains the values needed for
+// navigator.credentials.get
+type WebAuthnAssertionOptions struct {
+	Challenge        []byte   `json:"challenge" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	RPID             string   `json:"rpId"`
+	AllowCredentials [][]byte `json:"allowCredentials" ts_type:"Uint8Array[]" ts_transform:"__VALUE__ ? __VALUE__.map(base64ToArray) : []"`
+	Timeout          int      `json:"timeout"`
+}
+
+type NewWebAuthnKey struct {
+	Name              string `json:"name"`
+	ClientDataJSON    []byte `json:"clientDataJSON" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	AttestationObject []byte `json:"attestationObject" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+}
+
+// NewWebAuthnKeyResponse includes recovery codes if the user didn't have any
+// recovery codes before registering the key
+type NewWebAuthnKeyResponse struct {
+	Key           WebAuthnKey `json:"key"`
+	RecoveryCodes []string    `json:"recoveryCodes"`
+}
+
+type WebAuthnAssertion struct {
+	CredentialID      []byte `json:"credentialId" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	ClientDataJSON    []byte `json:"clientDataJSON" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	AuthenticatorData []byte `json:"authenticatorData" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+	Signature         []byte `json:"signature" ts_type:"Uint8Array" ts_transform:"__VALUE__ ? base64ToArray(__VALUE__) : new Uint8Array()"`
+}
+
+type ModifyWebAuthnKey struct {
+	Name string `json:"name"`
+}
+
+// NewAPIToken creates a personal API token limited to the provided scopes. If
+// FolderIDs is set, vault access is limited to those folders (and their
+// subfolders). A zero Expiration creates a token that doesn't expire.
+type NewAPIToken struct {
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	FolderIDs  []string  `json:"folderIds"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// NewAPITokenResponse includes the token value, which is only returned once
+type NewAPITokenResponse struct {
+	Token string   `json:"token"`
+	Info  APIToken `json:"info"`
+}
+
+type APIToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	FolderIDs  []string  `json:"folderIds"`
+	Created    time.Time `json:"created"`
+	Expiration time.Time `json:"expiration"`
+	LastUsed   time.Time `json:"lastUsed"`
+}
+
+// ActiveSession is a logged in session for the current user. Current is set
+// for the session used to make the request.
+type ActiveSession struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"userAgent"`
+	IPAddress string    `json:"ipAddress"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Current   bool      `json:"current"`
+}
+
 type ServerInfo struct {
 	StorageBackend     string `json:"storageBackend"`
 	PasswordRestricted bool   `json:"passwordRestricted"`
@@ -372,3 +502,23 @@ type AdminFileInfoResponse struct {
 
 	RawSize int64
 }
+
+type AdminScrubResult struct {
+	ID       string    `json:"id"`
+	Table    string    `json:"table"`
+	RemoteID string    `json:"remoteID"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error"`
+	Checked  time.Time `json:"checked" ts_type:"Date" ts_transform:"new Date(__VALUE__)"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status     string `json:"status"`
+	Critical   bool   `json:"critical"`
+	DurationMs int64  `json:"durationMs"`
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"yeetfile/shared/openapi"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("Must specify output directory")
+	}
+
+	outDir := os.Args[1]
+	if _, err := os.Stat(outDir); err != nil {
+		log.Fatal(err)
+	}
+
+	spec, err := openapi.Generate(openapi.Routes()).JSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := filepath.Join(outDir, openapi.FileName)
+	if err = os.WriteFile(out, spec, 0666); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("OpenAPI spec written to: %s\n", out)
+}
@@ -61,6 +61,9 @@ func main() {
 		Add(shared.VaultFolder{}).
 		Add(shared.VaultFolderResponse{}).
 		Add(shared.VaultDownloadResponse{}).
+		Add(shared.PresignedChunkRequest{}).
+		Add(shared.PresignedChunk{}).
+		Add(shared.PresignedChunkResult{}).
 		Add(shared.PlaintextUpload{}).
 		Add(shared.DownloadResponse{}).
 		Add(shared.Signup{}).
@@ -68,6 +71,7 @@ func main() {
 		Add(shared.VerifyAccount{}).
 		Add(shared.Login{}).
 		Add(shared.LoginResponse{}).
+		Add(shared.SSOAccount{}).
 		Add(shared.SessionInfo{}).
 		Add(shared.ForgotPassword{}).
 		Add(shared.ResetPassword{}).
@@ -89,9 +93,17 @@ func main() {
 		Add(shared.NewTOTP{}).
 		Add(shared.SetTOTP{}).
 		Add(shared.SetTOTPResponse{}).
+		Add(shared.TwoFactorChallenge{}).
+		Add(shared.WebAuthnAssertionOptions{}).
+		Add(shared.WebAuthnAssertion{}).
+		Add(shared.WebAuthnRegistrationOptions{}).
+		Add(shared.NewWebAuthnKey{}).
+		Add(shared.NewWebAuthnKeyResponse{}).
+		Add(shared.ModifyWebAuthnKey{}).
 		Add(shared.ItemIndex{}).
 		Add(shared.AdminUserInfoResponse{}).
-		Add(shared.AdminFileInfoResponse{})
+		Add(shared.AdminFileInfoResponse{}).
+		Add(shared.AdminScrubResult{})
 
 	converter.WithBackupDir("")
 	err = converter.ConvertToFile(structsOut)
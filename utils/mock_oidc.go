@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"yeetfile/backend/oidc/oidctest"
+)
+
+// Runs a mock OpenID Connect provider for testing single sign-on locally. Every
+// visit to the provider's login page logs in as the user set with the flags.
+func main() {
+	port := flag.Int("port", 8091, "the port to listen on")
+	clientID := flag.String("client-id", "yeetfile", "the client ID to accept")
+	clientSecret := flag.String("client-secret", "yeetfile-secret", "the client secret to accept")
+	email := flag.String("email", "user@example.com", "the email of the logged in user")
+	subject := flag.String("subject", "", "the subject of the logged in user (defaults to the email)")
+	unverified := flag.Bool("unverified", false, "mark the user's email as unverified")
+	flag.Parse()
+
+	provider, err := oidctest.NewProvider(*clientID, *clientSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(*subject) == 0 {
+		*subject = *email
+	}
+
+	provider.Issuer = fmt.Sprintf("http://localhost:%d", *port)
+	provider.User = oidctest.User{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: !*unverified,
+	}
+
+	fmt.Printf("Mock identity provider running at %s\n\n", provider.Issuer)
+	fmt.Println("Start the YeetFile server with:")
+	fmt.Printf("YEETFILE_OIDC_ISSUER=%s\n", provider.Issuer)
+	fmt.Printf("YEETFILE_OIDC_CLIENT_ID=%s\n", *clientID)
+	fmt.Printf("YEETFILE_OIDC_CLIENT_SECRET=%s\n", *clientSecret)
+
+	addr := fmt.Sprintf("localhost:%d", *port)
+	log.Fatal(http.ListenAndServe(addr, provider))
+}
@@ -30,6 +30,22 @@ const init = () => {
         disable2FALink.addEventListener("click", disable2FA);
     }
 
+    let ssoLink = document.getElementById("sso-link");
+    if (ssoLink) {
+        ssoLink.addEventListener("click", linkSSO);
+    }
+
+    let addKeyLink = document.getElementById("add-key");
+    addKeyLink.addEventListener("click", addSecurityKey);
+
+    document.querySelectorAll<HTMLElement>(".rename-key").forEach(link => {
+        link.addEventListener("click", () => renameSecurityKey(link.dataset.id));
+    });
+
+    document.querySelectorAll<HTMLElement>(".remove-key").forEach(link => {
+        link.addEventListener("click", () => removeSecurityKey(link.dataset.id));
+    });
+
     let recyclePaymentIDBtn = document.getElementById("recycle-payment-id");
     recyclePaymentIDBtn.addEventListener("click", recyclePaymentID);
 
@@ -118,6 +134,15 @@ const logout = () => {
     }
 }
 
+const linkSSO = (event: Event) => {
+    let confirmMsg = "Once your account is linked to single sign-on, you " +
+        "will need to log in with single sign-on instead of your password. " +
+        "Your vault password stays the same. Continue?";
+    if (!confirm(confirmMsg)) {
+        event.preventDefault();
+    }
+}
+
 const deleteAccount = () => {
     let confirmMsg = "Are you sure you want to delete your account? This can " +
         "not be undone."
@@ -239,6 +264,111 @@ const disable2FA = () => {
     dialog.showModal();
 }
 
+const addSecurityKey = async () => {
+    let name = prompt("Enter a name for the new security key:");
+    if (!name || !name.trim()) {
+        return;
+    }
+
+    let response = await fetch(Endpoints.WebAuthn.path);
+    if (!response.ok) {
+        alert("Error: " + await response.text());
+        return;
+    }
+
+    let options = new interfaces.WebAuthnRegistrationOptions(await response.json());
+    let credential: PublicKeyCredential;
+    try {
+        credential = await navigator.credentials.create({
+            publicKey: {
+                challenge: options.challenge,
+                rp: {id: options.rpId, name: options.rpName},
+                user: {
+                    id: options.userId,
+                    name: options.userName,
+                    displayName: options.userName,
+                },
+                pubKeyCredParams: options.algorithms.map(alg => ({
+                    type: "public-key",
+                    alg: alg,
+                })),
+                excludeCredentials: options.excludeCredentials.map(id => ({
+                    type: "public-key",
+                    id: id,
+                })),
+                timeout: options.timeout,
+                attestation: "none",
+                authenticatorSelection: {userVerification: "discouraged"},
+            },
+        }) as PublicKeyCredential;
+    } catch (e) {
+        alert("Security key registration failed or was cancelled");
+        return;
+    }
+
+    let attestation = credential.response as AuthenticatorAttestationResponse;
+    let newKey = new interfaces.NewWebAuthnKey();
+    newKey.name = name.trim();
+    newKey.clientDataJSON = new Uint8Array(attestation.clientDataJSON);
+    newKey.attestationObject = new Uint8Array(attestation.attestationObject);
+
+    response = await fetch(Endpoints.WebAuthn.path, {
+        method: "POST",
+        body: JSON.stringify(newKey, jsonReplacer),
+    });
+
+    if (!response.ok) {
+        alert("Error: " + await response.text());
+        return;
+    }
+
+    let keyResponse = new interfaces.NewWebAuthnKeyResponse(await response.json());
+    if (keyResponse.recoveryCodes && keyResponse.recoveryCodes.length > 0) {
+        alert("Security key added! Store these recovery codes somewhere safe, " +
+            "they can be used to access your account if you lose your " +
+            "security key:\n\n" + keyResponse.recoveryCodes.join("\n"));
+    }
+
+    window.location.reload();
+}
+
+const renameSecurityKey = (id: string) => {
+    let name = prompt("Enter a new name for the security key:");
+    if (!name || !name.trim()) {
+        return;
+    }
+
+    let modify = new interfaces.ModifyWebAuthnKey();
+    modify.name = name.trim();
+
+    fetch(Endpoints.format(Endpoints.WebAuthnKey, id), {
+        method: "PUT",
+        body: JSON.stringify(modify),
+    }).then(async response => {
+        if (response.ok) {
+            window.location.reload();
+        } else {
+            alert("Error: " + await response.text());
+        }
+    });
+}
+
+const removeSecurityKey = (id: string) => {
+    if (!confirm("Are you sure you want to remove this security key?")) {
+        return;
+    }
+
+    fetch(Endpoints.format(Endpoints.WebAuthnKey, id), {
+        method: "DELETE",
+    }).then(async response => {
+        if (response.ok) {
+            window.location.reload();
+        } else {
+            alert("Error: " + await response.text());
+        }
+    });
+}
+
 const recyclePaymentID = () => {
     let confirmMsg = "Are you sure you want to recycle your payment ID? " +
         "This will remove all records of past payments you've made.";
@@ -1,7 +1,13 @@
 import * as crypto from "./crypto.js";
 import * as localstorage from "./localstorage.js";
 import { Endpoints } from "./endpoints.js";
-import { Login, LoginResponse } from "./interfaces.js";
+import {
+    Login,
+    LoginResponse,
+    TwoFactorChallenge,
+    WebAuthnAssertion,
+    WebAuthnAssertionOptions,
+} from "./interfaces.js";
 
 let vaultPasswordDialog;
 let twoFactorDialog;
@@ -38,6 +44,13 @@ const init = () => {
             loginBtn.click();
         }
     });
+
+    // Single sign-on returns to the same page as a regular login
+    let ssoLink = document.getElementById("sso-login") as HTMLAnchorElement;
+    let next = new URLSearchParams(window.location.search).get("next");
+    if (ssoLink && next) {
+        ssoLink.href += `?next=${encodeURIComponent(next)}`;
+    }
 }
 
 const resetLoginButton = () => {
@@ -64,7 +77,7 @@ const disableInputs = (disabled: boolean) => {
     forgotPw.style.display = disabled ? "none" : "inline";
 }
 
-const login = async (twoFactorCode: string) => {
+const login = async (twoFactorCode: string, webAuthn?: WebAuthnAssertion) => {
     disableInputs(true);
 
     let identifier = document.getElementById("identifier") as HTMLInputElement;
@@ -88,6 +101,7 @@ const login = async (twoFactorCode: string) => {
     loginBody.loginKeyHash = loginKeyHash;
     loginBody.identifier = identifier.value;
     loginBody.code = twoFactorCode;
+    loginBody.webAuthn = webAuthn;
 
     fetch(Endpoints.Login.path, {
         method: "POST",
@@ -95,7 +109,8 @@ const login = async (twoFactorCode: string) => {
     }).then(async response => {
         if (!response.ok) {
             if (response.status == 403) {
-                showTwoFactorDialog();
+                let challenge = new TwoFactorChallenge(await response.json().catch(() => ({})));
+                showTwoFactorDialog(challenge);
             } else {
                 let errMsg = await response.text();
                 showMessage(`Error ${response.status}: ${errMsg}`, true);
@@ -140,11 +155,28 @@ const isValidIdentifier = (identifier) => {
     }
 }
 
-const showTwoFactorDialog = () => {
+const showTwoFactorDialog = (challenge: TwoFactorChallenge) => {
     let dialog = document.getElementById("two-factor-dialog") as HTMLDialogElement;
+    let message = document.getElementById("two-factor-message") as HTMLParagraphElement;
     let codeInput = document.getElementById("two-factor-code") as HTMLInputElement;
     let submit = document.getElementById("submit-2fa") as HTMLButtonElement;
     let cancel = document.getElementById("cancel-2fa") as HTMLButtonElement;
+    let securityKey = document.getElementById("security-key-2fa") as HTMLButtonElement;
+
+    if (challenge.webAuthn) {
+        message.innerText = challenge.totp ?
+            "Use one of your security keys, or enter your 6-digit 2FA code " +
+            "or a recovery code below." :
+            "Use one of your security keys, or enter a recovery code below.";
+        securityKey.className = "";
+        securityKey.onclick = async () => {
+            let assertion = await getAssertion(challenge.webAuthn);
+            if (assertion) {
+                dialog.close();
+                await login("", assertion);
+            }
+        };
+    }
 
     codeInput.addEventListener("keydown", (event: KeyboardEvent) => {
         if (event.key === "Enter") {
@@ -165,6 +197,41 @@ const showTwoFactorDialog = () => {
     dialog.showModal();
 }
 
+/**
+ * Prompts the user to use one of their security keys or passkeys for logging in
+ * @param options {WebAuthnAssertionOptions} - The options from the server
+ * @returns {Promise<WebAuthnAssertion>} The assertion, or null if it failed
+ */
+const getAssertion = async (
+    options: WebAuthnAssertionOptions,
+): Promise<WebAuthnAssertion> => {
+    try {
+        let credential = await navigator.credentials.get({
+            publicKey: {
+                challenge: options.challenge,
+                rpId: options.rpId,
+                timeout: options.timeout,
+                allowCredentials: options.allowCredentials.map(id => ({
+                    type: "public-key",
+                    id: id,
+                })),
+                userVerification: "discouraged",
+            },
+        }) as PublicKeyCredential;
+
+        let response = credential.response as AuthenticatorAssertionResponse;
+        let assertion = new WebAuthnAssertion();
+        assertion.credentialId = new Uint8Array(credential.rawId);
+        assertion.clientDataJSON = new Uint8Array(response.clientDataJSON);
+        assertion.authenticatorData = new Uint8Array(response.authenticatorData);
+        assertion.signature = new Uint8Array(response.signature);
+        return assertion;
+    } catch (e) {
+        showMessage("Security key login failed or was cancelled", true);
+        return null;
+    }
+}
+
 const showVaultPassDialog = async (
     privKeyBytes: Uint8Array,
     pubKeyBytes: Uint8Array,
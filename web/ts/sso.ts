@@ -0,0 +1,144 @@
+import {MaxHintLen} from "./constants.js";
+import * as crypto from "./crypto.js";
+import {Endpoints} from "./endpoints.js";
+import {Signup, SSOAccount} from "./interfaces.js";
+
+let account: SSOAccount;
+
+const init = () => {
+    fetch(Endpoints.SSOAccount.path).then(async response => {
+        if (!response.ok) {
+            showMessage(`Error ${response.status}: ${await response.text()}`, true);
+            return;
+        }
+
+        account = new SSOAccount(await response.json());
+        document.getElementById("sso-identifier").innerText = account.identifier;
+
+        let formID = account.newAccount ? "sso-signup" : "sso-unlock";
+        let buttonID = account.newAccount ? "create-sso-account" : "unlock-btn";
+        document.getElementById(formID).classList.remove("hidden");
+
+        let button = document.getElementById(buttonID) as HTMLButtonElement;
+        button.addEventListener("click", async () => {
+            if (account.newAccount) {
+                await createAccount();
+            } else {
+                await unlockVault();
+            }
+        });
+
+        // Enter key submits the visible form
+        document.addEventListener("keydown", (event: KeyboardEvent) => {
+            if (event.key === "Enter") {
+                button.click();
+            }
+        });
+    });
+}
+
+const disableInputs = (disabled: boolean) => {
+    document.querySelectorAll("input").forEach(input => {
+        input.disabled = disabled;
+    });
+
+    let spinner = document.getElementById("sso-spinner");
+    spinner.classList.toggle("hidden", !disabled);
+}
+
+/**
+ * Decrypts the user's private key using their vault password
+ */
+const unlockVault = async () => {
+    let passwordInput = document.getElementById("vault-password") as HTMLInputElement;
+    disableInputs(true);
+
+    let userKey = await crypto.generateUserKey(account.identifier, passwordInput.value);
+    let privKey: Uint8Array;
+    try {
+        privKey = new Uint8Array(await crypto.decryptChunk(userKey, account.protectedKey));
+    } catch {
+        showMessage("Incorrect vault password", true);
+        disableInputs(false);
+        return;
+    }
+
+    await storeKeys(privKey, account.publicKey);
+}
+
+/**
+ * Generates the keys for a new account from the user's new vault password, and
+ * creates the account for the user's single sign-on login
+ */
+const createAccount = async () => {
+    let passwordInput = document.getElementById("new-vault-password") as HTMLInputElement;
+    let confirmInput = document.getElementById("confirm-vault-password") as HTMLInputElement;
+    let hintInput = document.getElementById("password-hint") as HTMLInputElement;
+    let serverPasswordInput = document.getElementById("server-password") as HTMLInputElement;
+
+    if (!passwordInput.value || passwordInput.value !== confirmInput.value) {
+        showMessage("Passwords do not match", true);
+        return;
+    } else if (passwordInput.value.length < 8) {
+        showMessage("Password must be at least 8 characters long", true);
+        return;
+    } else if (hintInput.value.length > MaxHintLen) {
+        showMessage(`Hint exceeds max length (${MaxHintLen})`, true);
+        return;
+    }
+
+    disableInputs(true);
+
+    let password = passwordInput.value;
+    let userKey = await crypto.generateUserKey(account.identifier, password);
+    let keyPair = await crypto.generateKeyPair();
+    let publicKey = await crypto.exportKey(keyPair.publicKey, "spki");
+    let privateKey = await crypto.exportKey(keyPair.privateKey, "pkcs8");
+    let vaultFolderKey = await crypto.generateRandomKey();
+
+    let signup = new Signup();
+    signup.identifier = account.identifier;
+    signup.loginKeyHash = await crypto.generateLoginKeyHash(userKey, password);
+    signup.publicKey = publicKey;
+    signup.protectedPrivateKey = await crypto.encryptChunk(userKey, privateKey);
+    signup.protectedVaultFolderKey = await crypto.encryptRSA(keyPair.publicKey, vaultFolderKey);
+    signup.passwordHint = hintInput.value;
+    signup.serverPassword = serverPasswordInput ? serverPasswordInput.value : "";
+
+    let response = await fetch(Endpoints.SSOAccount.path, {
+        method: "POST",
+        body: JSON.stringify(signup, jsonReplacer),
+    });
+
+    if (!response.ok) {
+        showMessage(`Error ${response.status}: ${await response.text()}`, true);
+        disableInputs(false);
+        return;
+    }
+
+    await storeKeys(privateKey, publicKey);
+}
+
+const storeKeys = async (privKey: Uint8Array, pubKey: Uint8Array) => {
+    let params = new URLSearchParams(window.location.search);
+    let next = params.get("next") || Endpoints.HTMLAccount.path;
+
+    const dbModule = await import("./db.js");
+    let db = new dbModule.YeetFileDB();
+    db.insertVaultKeyPair(privKey, pubKey, "", success => {
+        if (success) {
+            window.location.assign(next);
+        } else {
+            alert("Failed to insert vault keys into indexeddb");
+            window.location.assign(Endpoints.Logout.path);
+        }
+    });
+}
+
+if (document.readyState !== "loading") {
+    init();
+} else {
+    document.addEventListener("DOMContentLoaded", () => {
+        init();
+    });
+}